@@ -2,7 +2,10 @@ module proxydav
 
 go 1.21
 
-require github.com/dgraph-io/badger/v4 v4.2.0
+require (
+	github.com/dgraph-io/badger/v4 v4.2.0
+	golang.org/x/crypto v0.17.0
+)
 
 require (
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
@@ -17,7 +20,7 @@ require (
 	github.com/klauspost/compress v1.12.3 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	go.opencensus.io v0.22.5 // indirect
-	golang.org/x/net v0.7.0 // indirect
-	golang.org/x/sys v0.5.0 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/sys v0.15.0 // indirect
 	google.golang.org/protobuf v1.28.1 // indirect
 )
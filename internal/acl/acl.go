@@ -0,0 +1,278 @@
+package acl
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/internal/auth"
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+// Access is what a user may do with a path, from least to most
+type Access int
+
+const (
+	Hidden Access = iota // neither listed nor accessible
+	Read                 // browse and download
+	Write                // also add, move, copy and delete
+)
+
+func (a Access) String() string {
+	switch a {
+	case Read:
+		return types.PermissionRead
+	case Write:
+		return types.PermissionWrite
+	default:
+		return types.PermissionHidden
+	}
+}
+
+// ParsePermission returns the access a rule permission grants
+func ParsePermission(permission string) (Access, error) {
+	switch permission {
+	case types.PermissionHidden:
+		return Hidden, nil
+	case types.PermissionRead:
+		return Read, nil
+	case types.PermissionWrite:
+		return Write, nil
+	}
+	return Hidden, fmt.Errorf("unknown permission %q (use hidden, read or write)", permission)
+}
+
+// List holds the ACLs of the virtual filesystem, keyed by path. Rules
+// narrow what an account's role allows: readers never get more than read
+// access, and admins are not restricted at all.
+type List struct {
+	store *storage.PersistentStore
+	mutex sync.RWMutex
+	acls  map[string]types.ACL
+}
+
+// New loads the stored ACLs
+func New(store *storage.PersistentStore) (*List, error) {
+	acls, err := store.GetAllACLs()
+	if err != nil {
+		return nil, err
+	}
+	l := &List{store: store, acls: make(map[string]types.ACL, len(acls))}
+	for _, acl := range acls {
+		l.acls[acl.Path] = acl
+	}
+	return l, nil
+}
+
+// All returns the ACLs ordered by path
+func (l *List) All() []types.ACL {
+	if l == nil {
+		return nil
+	}
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	acls := make([]types.ACL, 0, len(l.acls))
+	for _, acl := range l.acls {
+		acls = append(acls, acl)
+	}
+	sort.Slice(acls, func(i, j int) bool { return acls[i].Path < acls[j].Path })
+	return acls
+}
+
+// Len returns the number of paths with an ACL
+func (l *List) Len() int {
+	if l == nil {
+		return 0
+	}
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return len(l.acls)
+}
+
+// Set replaces the rules of a path. An empty rule list removes its ACL.
+func (l *List) Set(itemPath string, rules []types.ACLRule) (*types.ACL, error) {
+	itemPath = path.Clean("/" + strings.TrimPrefix(itemPath, "/"))
+	rules, err := normalizeRules(rules)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, l.Delete(itemPath)
+	}
+
+	acl := types.ACL{Path: itemPath, Rules: rules, Updated: time.Now().UTC()}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.store.SetACL(&acl); err != nil {
+		return nil, err
+	}
+	l.acls[itemPath] = acl
+	return &acl, nil
+}
+
+// Delete removes the ACL of a path
+func (l *List) Delete(itemPath string) error {
+	itemPath = path.Clean("/" + strings.TrimPrefix(itemPath, "/"))
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if err := l.store.DeleteACL(itemPath); err != nil {
+		return fmt.Errorf("failed to delete ACL: %w", err)
+	}
+	delete(l.acls, itemPath)
+	return nil
+}
+
+// normalizeRules validates rules and orders them by principal
+func normalizeRules(rules []types.ACLRule) ([]types.ACLRule, error) {
+	seen := make(map[string]bool)
+	normalized := make([]types.ACLRule, 0, len(rules))
+	for _, rule := range rules {
+		rule.Principal = strings.TrimSpace(rule.Principal)
+		rule.Permission = strings.ToLower(strings.TrimSpace(rule.Permission))
+		if err := validatePrincipal(rule.Principal); err != nil {
+			return nil, err
+		}
+		if _, err := ParsePermission(rule.Permission); err != nil {
+			return nil, err
+		}
+		if seen[rule.Principal] {
+			return nil, fmt.Errorf("more than one rule for %s", rule.Principal)
+		}
+		seen[rule.Principal] = true
+		normalized = append(normalized, rule)
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].Principal < normalized[j].Principal })
+	return normalized, nil
+}
+
+func validatePrincipal(principal string) error {
+	if principal == "*" {
+		return nil
+	}
+	if group, ok := strings.CutPrefix(principal, "@"); ok {
+		return auth.ValidateName("group name", group)
+	}
+	return auth.ValidateName("username", principal)
+}
+
+// ParseRules reads rules written one per line as "principal=permission",
+// the format of the admin panel. Blank lines and lines starting with # are skipped.
+func ParseRules(text string) ([]types.ACLRule, error) {
+	var rules []types.ACLRule
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		principal, permission, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("rule %q must have the form principal=permission", line)
+		}
+		rules = append(rules, types.ACLRule{Principal: principal, Permission: permission})
+	}
+	return normalizeRules(rules)
+}
+
+// ceiling is the most a user's role allows
+func ceiling(user *types.User) Access {
+	if user.Role == types.RoleReader {
+		return Read
+	}
+	return Write
+}
+
+// Access returns what user may do with itemPath. The ACL closest to the
+// path with a rule for the user decides; at the same path a rule for the
+// user wins over group rules, of which the most permissive applies, and
+// those win over a rule for everyone. A nil user, as when authentication
+// is disabled, and admins have full access.
+func (l *List) Access(user *types.User, itemPath string) Access {
+	if user == nil || user.Role == types.RoleAdmin {
+		return Write
+	}
+	limit := ceiling(user)
+	if l == nil {
+		return limit
+	}
+
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+	return min(l.access(user, path.Clean("/"+strings.TrimPrefix(itemPath, "/"))), limit)
+}
+
+// access walks from itemPath up to the root; callers hold the read lock
+func (l *List) access(user *types.User, itemPath string) Access {
+	for {
+		if acl, ok := l.acls[itemPath]; ok {
+			if access, matched := match(acl, user); matched {
+				return access
+			}
+		}
+		if itemPath == "/" {
+			return Write
+		}
+		itemPath = path.Dir(itemPath)
+	}
+}
+
+// match returns the access an ACL grants user, if it has a rule for them
+func match(acl types.ACL, user *types.User) (Access, bool) {
+	everyone, hasEveryone := Hidden, false
+	group, hasGroup := Hidden, false
+	for _, rule := range acl.Rules {
+		access, err := ParsePermission(rule.Permission)
+		if err != nil {
+			continue
+		}
+		switch {
+		case rule.Principal == user.Username:
+			return access, true
+		case rule.Principal == "*":
+			everyone, hasEveryone = access, true
+		case strings.HasPrefix(rule.Principal, "@") && memberOf(user, rule.Principal[1:]):
+			group, hasGroup = max(group, access), true
+		}
+	}
+	if hasGroup {
+		return group, true
+	}
+	return everyone, hasEveryone
+}
+
+func memberOf(user *types.User, group string) bool {
+	for _, candidate := range user.Groups {
+		if candidate == group {
+			return true
+		}
+	}
+	return false
+}
+
+// TreeAccess returns the least access user has anywhere in the subtree of
+// itemPath, which bounds operations on a whole directory
+func (l *List) TreeAccess(user *types.User, itemPath string) Access {
+	itemPath = path.Clean("/" + strings.TrimPrefix(itemPath, "/"))
+	access := l.Access(user, itemPath)
+	if l == nil || user == nil || user.Role == types.RoleAdmin {
+		return access
+	}
+
+	prefix := strings.TrimSuffix(itemPath, "/") + "/"
+	l.mutex.RLock()
+	var below []string
+	for aclPath := range l.acls {
+		if strings.HasPrefix(aclPath, prefix) {
+			below = append(below, aclPath)
+		}
+	}
+	l.mutex.RUnlock()
+
+	for _, aclPath := range below {
+		access = min(access, l.Access(user, aclPath))
+	}
+	return access
+}
@@ -0,0 +1,112 @@
+package acl
+
+import (
+	"testing"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func TestList_Access(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	acls, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to load ACLs: %v", err)
+	}
+	set := func(itemPath, rules string) {
+		t.Helper()
+		parsed, err := ParseRules(rules)
+		if err != nil {
+			t.Fatalf("Failed to parse rules %q: %v", rules, err)
+		}
+		if _, err := acls.Set(itemPath, parsed); err != nil {
+			t.Fatalf("Failed to set rules of %s: %v", itemPath, err)
+		}
+	}
+	set("/shared", "*=read\n@staff=write")
+	set("/shared/private", "*=hidden\n@staff=read\n# the owner\nalice=write")
+	set("/archive/", "bob=hidden")
+
+	alice := &types.User{Username: "alice", Role: types.RoleEditor}
+	bob := &types.User{Username: "bob", Role: types.RoleEditor, Groups: []string{"staff"}}
+	carol := &types.User{Username: "carol", Role: types.RoleReader, Groups: []string{"staff"}}
+	admin := &types.User{Username: "root", Role: types.RoleAdmin}
+
+	tests := []struct {
+		user     *types.User
+		itemPath string
+		want     Access
+	}{
+		{alice, "/other/file.txt", Write},
+		{carol, "/other/file.txt", Read},
+		{alice, "/shared/file.txt", Read},
+		{bob, "/shared/file.txt", Write},
+		{carol, "/shared/file.txt", Read}, // the role still limits readers
+		{alice, "/shared/private/notes.txt", Write},
+		{bob, "/shared/private/notes.txt", Read},
+		{&types.User{Username: "dave", Role: types.RoleEditor}, "/shared/private", Hidden},
+		{bob, "/archive/2020", Hidden},
+		{alice, "/archive/2020", Write},
+		{admin, "/shared/private", Write},
+		{nil, "/shared/private", Write},
+	}
+	for _, tt := range tests {
+		name := "anonymous"
+		if tt.user != nil {
+			name = tt.user.Username
+		}
+		if got := acls.Access(tt.user, tt.itemPath); got != tt.want {
+			t.Errorf("Access(%s, %s) = %v, want %v", name, tt.itemPath, got, tt.want)
+		}
+	}
+
+	if got := acls.TreeAccess(bob, "/shared"); got != Read {
+		t.Errorf("Expected bob's access to the /shared tree to be limited by /shared/private, got %v", got)
+	}
+	if got := acls.TreeAccess(alice, "/shared/private"); got != Write {
+		t.Errorf("Expected alice to have write access to the /shared/private tree, got %v", got)
+	}
+
+	reloaded, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to reload ACLs: %v", err)
+	}
+	if reloaded.Len() != 3 || reloaded.Access(bob, "/archive") != Hidden {
+		t.Errorf("Expected rules to persist, got %+v", reloaded.All())
+	}
+
+	if _, err := acls.Set("/archive", nil); err != nil {
+		t.Fatalf("Failed to clear rules: %v", err)
+	}
+	if acls.Len() != 2 || acls.Access(bob, "/archive") != Write {
+		t.Error("Expected empty rules to remove the ACL")
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	invalid := []string{
+		"alice",
+		"alice=owner",
+		"alice=read\nalice=write",
+		"@=read",
+		"a:b=read",
+	}
+	for _, rules := range invalid {
+		if _, err := ParseRules(rules); err == nil {
+			t.Errorf("Expected %q to be rejected", rules)
+		}
+	}
+
+	rules, err := ParseRules(" *=READ \n\n@staff = write")
+	if err != nil {
+		t.Fatalf("ParseRules failed: %v", err)
+	}
+	if len(rules) != 2 || rules[0] != (types.ACLRule{Principal: "*", Permission: "read"}) || rules[1] != (types.ACLRule{Principal: "@staff", Permission: "write"}) {
+		t.Errorf("Unexpected rules %+v", rules)
+	}
+}
@@ -0,0 +1,432 @@
+package archive
+
+import (
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/pkg/types"
+)
+
+var (
+	// ErrUnsupported is returned for members that are encrypted or use an unsupported compression method
+	ErrUnsupported = errors.New("unsupported archive member")
+	// ErrChanged is returned when the archive upstream no longer matches its index
+	ErrChanged = errors.New("archive changed upstream")
+	// ErrNoRanges is returned when upstream ignores range requests
+	ErrNoRanges = errors.New("upstream does not support range requests")
+	// ErrChecksum is returned when a member's content doesn't match its CRC-32
+	ErrChecksum = errors.New("archive member checksum mismatch")
+)
+
+// Reader reads remote ZIP archives with HTTP range requests, so that only
+// the central directory and the members actually requested are transferred
+type Reader struct {
+	client *http.Client
+
+	// offsets caches where each member's data starts, keyed by memberKey
+	offsets sync.Map
+}
+
+func NewReader(client *http.Client) *Reader {
+	return &Reader{client: client}
+}
+
+// fetchRange requests bytes [start, end] of url. A negative start requests
+// the last -start bytes. When etag is known, a response for a different
+// version of the file is rejected with ErrChanged.
+func (r *Reader) fetchRange(ctx context.Context, url, etag string, start, end int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if start < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d", start))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: range %d-%d is not satisfiable", ErrChanged, start, end)
+	case resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, fmt.Errorf("upstream returned %s", resp.Status)
+	}
+	if responseETag := resp.Header.Get("ETag"); etag != "" && responseETag != "" && responseETag != etag {
+		resp.Body.Close()
+		return nil, ErrChanged
+	}
+	return resp, nil
+}
+
+// readRange returns bytes [start, end] of url
+func (r *Reader) readRange(ctx context.Context, url, etag string, start, end int64) ([]byte, error) {
+	resp, err := r.fetchRange(ctx, url, etag, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, ErrNoRanges
+	}
+	if got, _, ok := contentRange(resp.Header.Get("Content-Range")); !ok || got != start {
+		return nil, fmt.Errorf("upstream returned an unexpected range: %q", resp.Header.Get("Content-Range"))
+	}
+
+	data := make([]byte, end-start+1)
+	if _, err := io.ReadFull(resp.Body, data); err != nil {
+		return nil, fmt.Errorf("failed to read range: %w", err)
+	}
+	return data, nil
+}
+
+// ReadIndex fetches and parses the central directory of the archive at url
+func (r *Reader) ReadIndex(ctx context.Context, url string) (*types.ArchiveIndex, error) {
+	resp, err := r.fetchRange(ctx, url, "", -tailLen, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive tail: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A file shorter than the requested suffix may be sent whole
+	var tailStart, size int64
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		start, total, ok := contentRange(resp.Header.Get("Content-Range"))
+		if !ok {
+			return nil, fmt.Errorf("upstream returned an invalid Content-Range: %q", resp.Header.Get("Content-Range"))
+		}
+		tailStart, size = start, total
+	case resp.ContentLength >= 0 && resp.ContentLength <= tailLen:
+		size = resp.ContentLength
+	default:
+		return nil, ErrNoRanges
+	}
+
+	tail, err := io.ReadAll(io.LimitReader(resp.Body, tailLen))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive tail: %w", err)
+	}
+	etag := resp.Header.Get("ETag")
+
+	end, err := findDirectoryEnd(tail, tailStart)
+	if err != nil {
+		return nil, err
+	}
+
+	// Offsets are relative to the start of the archive, which is not the
+	// start of the file when data such as a self-extractor is prepended
+	var base int64
+	if end.zip64 {
+		locatorOffset := end.endOffset - directory64LocLen
+		if locatorOffset < 0 {
+			return nil, fmt.Errorf("invalid ZIP64 archive: locator missing")
+		}
+		locator, err := r.slice(ctx, url, etag, tail, tailStart, locatorOffset, directory64LocLen)
+		if err != nil {
+			return nil, err
+		}
+		recordOffset, err := directory64Offset(locator)
+		if err != nil {
+			return nil, err
+		}
+		record, err := r.slice(ctx, url, etag, tail, tailStart, recordOffset, directory64EndLen)
+		if err != nil {
+			return nil, err
+		}
+		if err := readDirectory64End(record, end); err != nil {
+			return nil, err
+		}
+	} else {
+		base = end.endOffset - int64(end.size) - int64(end.offset)
+		if base < 0 {
+			return nil, fmt.Errorf("invalid central directory offset")
+		}
+	}
+
+	if end.size > maxDirectorySize {
+		return nil, fmt.Errorf("central directory of %d bytes is too large", end.size)
+	}
+	directoryOffset := int64(end.offset) + base
+	if directoryOffset+int64(end.size) > end.endOffset {
+		return nil, fmt.Errorf("invalid central directory bounds")
+	}
+	directory, err := r.slice(ctx, url, etag, tail, tailStart, directoryOffset, int64(end.size))
+	if err != nil {
+		return nil, err
+	}
+
+	members, err := parseDirectory(directory, end.records, base)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.ArchiveIndex{
+		URL:       url,
+		Size:      size,
+		ETag:      etag,
+		Members:   members,
+		FetchedAt: time.Now(),
+	}, nil
+}
+
+// slice returns length bytes at offset, from the already fetched tail when
+// it covers them and with another range request otherwise
+func (r *Reader) slice(ctx context.Context, url, etag string, tail []byte, tailStart, offset, length int64) ([]byte, error) {
+	if length == 0 {
+		return nil, nil
+	}
+	if offset >= tailStart && offset+length <= tailStart+int64(len(tail)) {
+		return tail[offset-tailStart : offset-tailStart+length], nil
+	}
+	return r.readRange(ctx, url, etag, offset, offset+length-1)
+}
+
+// contentRange parses "bytes 100-199/1000" into its start and complete length
+func contentRange(header string) (int64, int64, bool) {
+	spec, ok := strings.CutPrefix(header, "bytes ")
+	if !ok {
+		return 0, 0, false
+	}
+	byteRange, total, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, false
+	}
+	first, _, ok := strings.Cut(byteRange, "-")
+	if !ok {
+		return 0, 0, false
+	}
+
+	start, err := strconv.ParseInt(strings.TrimSpace(first), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(total), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return start, size, true
+}
+
+func memberKey(index *types.ArchiveIndex, member *types.ArchiveMember) string {
+	return index.URL + "\x00" + index.ETag + "\x00" + strconv.FormatInt(member.HeaderOffset, 10)
+}
+
+// Locate finds where a member's data starts by reading its local file
+// header. The result is cached, so calling it before streaming surfaces
+// upstream errors while a proper error status can still be sent.
+func (r *Reader) Locate(ctx context.Context, index *types.ArchiveIndex, member *types.ArchiveMember) (int64, error) {
+	key := memberKey(index, member)
+	if offset, ok := r.offsets.Load(key); ok {
+		return offset.(int64), nil
+	}
+
+	header, err := r.readRange(ctx, index.URL, index.ETag, member.HeaderOffset, member.HeaderOffset+fileHeaderLen-1)
+	if err != nil {
+		return 0, err
+	}
+	offset, err := dataStart(header, member.HeaderOffset)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrChanged, err)
+	}
+
+	r.offsets.Store(key, offset)
+	return offset, nil
+}
+
+// Open streams length bytes of a member's content starting at start.
+// Stored members are read with a range request for exactly those bytes;
+// deflated members are inflated from the beginning of their data and the
+// bytes before start are discarded. A complete read is checked against the
+// member's CRC-32.
+func (r *Reader) Open(ctx context.Context, index *types.ArchiveIndex, member *types.ArchiveMember, start, length int64) (io.ReadCloser, error) {
+	if err := Supported(member); err != nil {
+		return nil, err
+	}
+	if start < 0 || length < 0 || start+length > member.Size {
+		return nil, fmt.Errorf("range %d+%d is outside of %s", start, length, member.Name)
+	}
+	if length == 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	offset, err := r.Locate(ctx, index, member)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := &memberReader{remaining: length}
+	if start == 0 && length == member.Size {
+		reader.crc = crc32.NewIEEE()
+		reader.want = member.CRC32
+	}
+
+	if member.Method == MethodStore {
+		resp, err := r.fetchRange(ctx, index.URL, index.ETag, offset+start, offset+start+length-1)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusPartialContent {
+			resp.Body.Close()
+			return nil, ErrNoRanges
+		}
+		reader.source = resp.Body
+		reader.closers = []io.Closer{resp.Body}
+		return reader, nil
+	}
+
+	if member.CompressedSize == 0 {
+		return nil, fmt.Errorf("%w: %s has no compressed data", ErrChanged, member.Name)
+	}
+	resp, err := r.fetchRange(ctx, index.URL, index.ETag, offset, offset+member.CompressedSize-1)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, ErrNoRanges
+	}
+
+	inflater := flate.NewReader(io.LimitReader(resp.Body, member.CompressedSize))
+	if _, err := io.CopyN(io.Discard, inflater, start); err != nil {
+		inflater.Close()
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to seek in %s: %w", member.Name, err)
+	}
+	reader.source = inflater
+	reader.closers = []io.Closer{inflater, resp.Body}
+	return reader, nil
+}
+
+// memberReader yields exactly the requested number of bytes and, for
+// complete reads, verifies the checksum at the end
+type memberReader struct {
+	source    io.Reader
+	closers   []io.Closer
+	remaining int64
+	crc       hash.Hash32
+	want      uint32
+}
+
+func (m *memberReader) Read(p []byte) (int, error) {
+	if m.remaining <= 0 {
+		if m.crc != nil && m.crc.Sum32() != m.want {
+			return 0, ErrChecksum
+		}
+		return 0, io.EOF
+	}
+
+	if int64(len(p)) > m.remaining {
+		p = p[:m.remaining]
+	}
+	n, err := m.source.Read(p)
+	m.remaining -= int64(n)
+	if m.crc != nil {
+		m.crc.Write(p[:n])
+	}
+
+	if err == io.EOF {
+		if m.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (m *memberReader) Close() error {
+	var first error
+	for _, closer := range m.closers {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// File is an io.ReadSeeker over one member, suitable for http.ServeContent.
+// Content is requested lazily from the current position on the first Read
+// after a Seek.
+type File struct {
+	reader *Reader
+	ctx    context.Context
+	index  *types.ArchiveIndex
+	member *types.ArchiveMember
+	offset int64
+	body   io.ReadCloser
+}
+
+// File returns a seekable reader over member; it must be closed
+func (r *Reader) File(ctx context.Context, index *types.ArchiveIndex, member *types.ArchiveMember) *File {
+	return &File{reader: r, ctx: ctx, index: index, member: member}
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.offset >= f.member.Size {
+		return 0, io.EOF
+	}
+	if f.body == nil {
+		body, err := f.reader.Open(f.ctx, f.index, f.member, f.offset, f.member.Size-f.offset)
+		if err != nil {
+			return 0, err
+		}
+		f.body = body
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.member.Size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid seek to negative offset")
+	}
+
+	if offset != f.offset && f.body != nil {
+		f.body.Close()
+		f.body = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *File) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	return f.body.Close()
+}
+
+// MemberETag derives a strong validator for a member from the archive's
+// version and the member's checksum
+func MemberETag(index *types.ArchiveIndex, member *types.ArchiveMember) string {
+	version := strings.Trim(strings.TrimPrefix(index.ETag, "W/"), `"`)
+	if version == "" {
+		version = strconv.FormatInt(index.Size, 16)
+	}
+	return fmt.Sprintf(`"%s-%08x-%x"`, version, member.CRC32, member.Size)
+}
@@ -0,0 +1,204 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
+)
+
+// buildZip returns an archive with a deflated and a stored member, after
+// an optional prefix such as a self-extractor stub
+func buildZip(t *testing.T, prefix string, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString(prefix)
+
+	// Offsets are written relative to the archive, not the file
+	writer := zip.NewWriter(&buf)
+	for name, content := range files {
+		method := zip.Deflate
+		if strings.HasSuffix(name, ".bin") {
+			method = zip.Store
+		}
+		w, err := writer.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)})
+		if err != nil {
+			t.Fatalf("Failed to create member: %v", err)
+		}
+		io.WriteString(w, content)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Failed to write archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// rangeServer serves data with range support and counts the bytes it sends
+func rangeServer(t *testing.T, data []byte, sent *atomic.Int64) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		counter := &countingWriter{ResponseWriter: w, sent: sent}
+		http.ServeContent(counter, r, "archive.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	sent *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.sent.Add(int64(len(p)))
+	return c.ResponseWriter.Write(p)
+}
+
+func newTestReader(t *testing.T) *Reader {
+	policy, err := upstream.NewPolicy(nil, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	return NewReader(upstream.NewClient(policy, &upstream.Router{}, 5*time.Second))
+}
+
+func findMember(t *testing.T, index *types.ArchiveIndex, name string) *types.ArchiveMember {
+	t.Helper()
+	for i := range index.Members {
+		if index.Members[i].Name == name {
+			return &index.Members[i]
+		}
+	}
+	t.Fatalf("Member %s not found", name)
+	return nil
+}
+
+func readMember(t *testing.T, reader *Reader, index *types.ArchiveIndex, member *types.ArchiveMember, start, length int64) string {
+	t.Helper()
+	body, err := reader.Open(context.Background(), index, member, start, length)
+	if err != nil {
+		t.Fatalf("Open(%s, %d, %d) failed: %v", member.Name, start, length, err)
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatalf("Reading %s failed: %v", member.Name, err)
+	}
+	return string(data)
+}
+
+func TestReader_ReadsMembers(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 2000)
+	padding := strings.Repeat("x", 200000)
+	files := map[string]string{
+		"docs/readme.txt": text,
+		"data/blob.bin":   "0123456789abcdef",
+		"padding.bin":     padding,
+	}
+
+	for name, prefix := range map[string]string{"plain": "", "prefixed": "#!/bin/sh\nexit 0\n"} {
+		t.Run(name, func(t *testing.T) {
+			var sent atomic.Int64
+			data := buildZip(t, prefix, files)
+			server := rangeServer(t, data, &sent)
+			reader := newTestReader(t)
+
+			index, err := reader.ReadIndex(context.Background(), server.URL+"/archive.zip")
+			if err != nil {
+				t.Fatalf("ReadIndex failed: %v", err)
+			}
+			if len(index.Members) != 3 || index.Size != int64(len(data)) || index.ETag != `"v1"` {
+				t.Fatalf("Unexpected index: %d members, size %d, etag %s", len(index.Members), index.Size, index.ETag)
+			}
+
+			readme := findMember(t, index, "docs/readme.txt")
+			if readme.Method != MethodDeflate || readme.Size != int64(len(text)) {
+				t.Errorf("Unexpected readme entry %+v", readme)
+			}
+			if !readme.Modified.Equal(time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)) {
+				t.Errorf("Unexpected modification time %v", readme.Modified)
+			}
+
+			if got := readMember(t, reader, index, readme, 0, readme.Size); got != text {
+				t.Error("Deflated member content mismatch")
+			}
+			if got := readMember(t, reader, index, readme, 4, 11); got != "quick brown" {
+				t.Errorf("Expected range inside deflated member, got %q", got)
+			}
+
+			blob := findMember(t, index, "data/blob.bin")
+			if got := readMember(t, reader, index, blob, 10, 6); got != "abcdef" {
+				t.Errorf("Expected range inside stored member, got %q", got)
+			}
+
+			// The padding member is never requested, so it is never transferred
+			if sent.Load() >= int64(len(padding)) {
+				t.Errorf("Expected only needed ranges to be fetched, %d bytes were sent", sent.Load())
+			}
+		})
+	}
+}
+
+func TestReader_DetectsChanges(t *testing.T) {
+	var sent atomic.Int64
+	server := rangeServer(t, buildZip(t, "", map[string]string{"a.bin": "aaaa"}), &sent)
+	reader := newTestReader(t)
+
+	index, err := reader.ReadIndex(context.Background(), server.URL+"/archive.zip")
+	if err != nil {
+		t.Fatalf("ReadIndex failed: %v", err)
+	}
+
+	index.ETag = `"v0"`
+	if _, err := reader.Open(context.Background(), index, &index.Members[0], 0, 4); !errors.Is(err, ErrChanged) {
+		t.Errorf("Expected ErrChanged for a different ETag, got %v", err)
+	}
+}
+
+func TestReader_RejectsNonArchives(t *testing.T) {
+	var sent atomic.Int64
+	server := rangeServer(t, []byte("<html>not a zip</html>"), &sent)
+
+	if _, err := newTestReader(t).ReadIndex(context.Background(), server.URL+"/archive.zip"); err == nil {
+		t.Error("Expected an error for content without a central directory")
+	}
+}
+
+func TestReader_RequiresRanges(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), tailLen+100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	if _, err := newTestReader(t).ReadIndex(context.Background(), server.URL+"/archive.zip"); !errors.Is(err, ErrNoRanges) {
+		t.Errorf("Expected ErrNoRanges, got %v", err)
+	}
+}
+
+func TestSupported(t *testing.T) {
+	tests := []struct {
+		member types.ArchiveMember
+		ok     bool
+	}{
+		{member: types.ArchiveMember{Method: MethodStore}, ok: true},
+		{member: types.ArchiveMember{Method: MethodDeflate}, ok: true},
+		{member: types.ArchiveMember{Method: 12}, ok: false},
+		{member: types.ArchiveMember{Method: MethodDeflate, Encrypted: true}, ok: false},
+	}
+	for _, tt := range tests {
+		if err := Supported(&tt.member); (err == nil) != tt.ok {
+			t.Errorf("Supported(%+v) = %v", tt.member, err)
+		}
+	}
+}
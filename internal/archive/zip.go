@@ -0,0 +1,198 @@
+package archive
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"proxydav/pkg/types"
+)
+
+// Compression methods that members can be served with
+const (
+	MethodStore   = 0
+	MethodDeflate = 8
+)
+
+const (
+	fileHeaderSignature      = 0x04034b50
+	directoryHeaderSignature = 0x02014b50
+	directoryEndSignature    = 0x06054b50
+	directory64LocSignature  = 0x07064b50
+	directory64EndSignature  = 0x06064b50
+
+	fileHeaderLen      = 30
+	directoryHeaderLen = 46
+	directoryEndLen    = 22
+	directory64LocLen  = 20
+	directory64EndLen  = 56
+
+	zip64ExtraID     = 0x0001
+	timestampExtraID = 0x5455
+
+	// maxCommentLen bounds how far from the end the end-of-directory record can be
+	maxCommentLen = 65535
+	// tailLen is fetched first; it holds the end record and, for small archives, the whole directory
+	tailLen = directoryEndLen + maxCommentLen
+	// maxDirectorySize refuses archives whose central directory would not fit comfortably in memory
+	maxDirectorySize = 64 << 20
+)
+
+// directoryEnd locates the central directory
+type directoryEnd struct {
+	records   uint64
+	size      uint64
+	offset    uint64
+	zip64     bool
+	endOffset int64 // position of the end-of-directory record in the archive
+}
+
+// findDirectoryEnd searches tail, the last bytes of the archive starting
+// at tailStart, for the end-of-directory record
+func findDirectoryEnd(tail []byte, tailStart int64) (*directoryEnd, error) {
+	for i := len(tail) - directoryEndLen; i >= 0; i-- {
+		b := tail[i:]
+		if binary.LittleEndian.Uint32(b) != directoryEndSignature {
+			continue
+		}
+		commentLen := int(binary.LittleEndian.Uint16(b[20:]))
+		if i+directoryEndLen+commentLen > len(tail) {
+			continue
+		}
+
+		end := &directoryEnd{
+			records:   uint64(binary.LittleEndian.Uint16(b[10:])),
+			size:      uint64(binary.LittleEndian.Uint32(b[12:])),
+			offset:    uint64(binary.LittleEndian.Uint32(b[16:])),
+			endOffset: tailStart + int64(i),
+		}
+		end.zip64 = end.records == 0xffff || end.size == 0xffffffff || end.offset == 0xffffffff
+		return end, nil
+	}
+	return nil, fmt.Errorf("not a ZIP archive: end of central directory not found")
+}
+
+// directory64Offset reads the ZIP64 end-of-directory locator
+func directory64Offset(locator []byte) (int64, error) {
+	if len(locator) < directory64LocLen || binary.LittleEndian.Uint32(locator) != directory64LocSignature {
+		return 0, fmt.Errorf("invalid ZIP64 end of central directory locator")
+	}
+	offset := binary.LittleEndian.Uint64(locator[8:])
+	if offset > math.MaxInt64 {
+		return 0, fmt.Errorf("invalid ZIP64 end of central directory offset")
+	}
+	return int64(offset), nil
+}
+
+// readDirectory64End fills end from a ZIP64 end-of-directory record
+func readDirectory64End(record []byte, end *directoryEnd) error {
+	if len(record) < directory64EndLen || binary.LittleEndian.Uint32(record) != directory64EndSignature {
+		return fmt.Errorf("invalid ZIP64 end of central directory record")
+	}
+	end.records = binary.LittleEndian.Uint64(record[32:])
+	end.size = binary.LittleEndian.Uint64(record[40:])
+	end.offset = binary.LittleEndian.Uint64(record[48:])
+	return nil
+}
+
+// parseDirectory decodes the central directory. base is added to every
+// recorded offset, which is non-zero for archives with prepended data.
+func parseDirectory(directory []byte, records uint64, base int64) ([]types.ArchiveMember, error) {
+	var members []types.ArchiveMember
+	for n := uint64(0); n < records; n++ {
+		if len(directory) < directoryHeaderLen || binary.LittleEndian.Uint32(directory) != directoryHeaderSignature {
+			return nil, fmt.Errorf("invalid central directory header for entry %d", n)
+		}
+
+		flags := binary.LittleEndian.Uint16(directory[8:])
+		nameLen := int(binary.LittleEndian.Uint16(directory[28:]))
+		extraLen := int(binary.LittleEndian.Uint16(directory[30:]))
+		commentLen := int(binary.LittleEndian.Uint16(directory[32:]))
+		total := directoryHeaderLen + nameLen + extraLen + commentLen
+		if len(directory) < total {
+			return nil, fmt.Errorf("truncated central directory entry %d", n)
+		}
+
+		compressed := uint64(binary.LittleEndian.Uint32(directory[20:]))
+		size := uint64(binary.LittleEndian.Uint32(directory[24:]))
+		offset := uint64(binary.LittleEndian.Uint32(directory[42:]))
+		modified := dosTime(binary.LittleEndian.Uint16(directory[14:]), binary.LittleEndian.Uint16(directory[12:]))
+
+		extra := directory[directoryHeaderLen+nameLen : directoryHeaderLen+nameLen+extraLen]
+		for len(extra) >= 4 {
+			id := binary.LittleEndian.Uint16(extra)
+			fieldLen := int(binary.LittleEndian.Uint16(extra[2:]))
+			if len(extra) < 4+fieldLen {
+				break
+			}
+			field := extra[4 : 4+fieldLen]
+			extra = extra[4+fieldLen:]
+
+			switch id {
+			case zip64ExtraID:
+				// Only the fields saturated in the header are present, in this order
+				for _, value := range []*uint64{&size, &compressed, &offset} {
+					if *value != 0xffffffff {
+						continue
+					}
+					if len(field) < 8 {
+						return nil, fmt.Errorf("invalid ZIP64 extra field for entry %d", n)
+					}
+					*value = binary.LittleEndian.Uint64(field)
+					field = field[8:]
+				}
+			case timestampExtraID:
+				if len(field) >= 5 && field[0]&1 != 0 {
+					modified = time.Unix(int64(binary.LittleEndian.Uint32(field[1:])), 0).UTC()
+				}
+			}
+		}
+
+		if size > math.MaxInt64 || compressed > math.MaxInt64 || offset > math.MaxInt64-uint64(base) {
+			return nil, fmt.Errorf("invalid sizes for entry %d", n)
+		}
+
+		members = append(members, types.ArchiveMember{
+			Name:           string(directory[directoryHeaderLen : directoryHeaderLen+nameLen]),
+			Method:         binary.LittleEndian.Uint16(directory[10:]),
+			Encrypted:      flags&0x1 != 0,
+			CRC32:          binary.LittleEndian.Uint32(directory[16:]),
+			CompressedSize: int64(compressed),
+			Size:           int64(size),
+			Modified:       modified,
+			HeaderOffset:   int64(offset) + base,
+		})
+		directory = directory[total:]
+	}
+	return members, nil
+}
+
+// dosTime converts an MS-DOS date and time, which carry no time zone
+func dosTime(date, clock uint16) time.Time {
+	return time.Date(
+		1980+int(date>>9), time.Month(date>>5&0xf), int(date&0x1f),
+		int(clock>>11), int(clock>>5&0x3f), int(clock&0x1f)*2, 0, time.UTC,
+	)
+}
+
+// dataStart returns the offset of a member's data from its local file header
+func dataStart(header []byte, headerOffset int64) (int64, error) {
+	if len(header) < fileHeaderLen || binary.LittleEndian.Uint32(header) != fileHeaderSignature {
+		return 0, fmt.Errorf("invalid local file header at offset %d", headerOffset)
+	}
+	nameLen := int64(binary.LittleEndian.Uint16(header[26:]))
+	extraLen := int64(binary.LittleEndian.Uint16(header[28:]))
+	return headerOffset + fileHeaderLen + nameLen + extraLen, nil
+}
+
+// Supported reports why a member cannot be served, or nil if it can
+func Supported(member *types.ArchiveMember) error {
+	if member.Encrypted {
+		return fmt.Errorf("%w: %s is encrypted", ErrUnsupported, member.Name)
+	}
+	if member.Method != MethodStore && member.Method != MethodDeflate {
+		return fmt.Errorf("%w: %s uses compression method %d", ErrUnsupported, member.Name, member.Method)
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+var ErrAppPasswordNotFound = errors.New("app password not found")
+
+// AppPasswordPrefix starts every app password, which tells them apart from
+// account passwords
+const AppPasswordPrefix = "pdvapp_"
+
+// AppPasswords manages the app passwords kept in the store
+type AppPasswords struct {
+	store *storage.PersistentStore
+}
+
+func NewAppPasswords(store *storage.PersistentStore) *AppPasswords {
+	return &AppPasswords{store: store}
+}
+
+// List returns the app passwords of username, or of everyone when username
+// is empty, ordered by user and name
+func (a *AppPasswords) List(username string) ([]types.AppPassword, error) {
+	all, err := a.store.GetAllAppPasswords()
+	if err != nil {
+		return nil, err
+	}
+	appPasswords := all[:0]
+	for _, appPassword := range all {
+		if username == "" || appPassword.Username == username {
+			appPasswords = append(appPasswords, appPassword)
+		}
+	}
+	sort.Slice(appPasswords, func(i, j int) bool {
+		if appPasswords[i].Username != appPasswords[j].Username {
+			return appPasswords[i].Username < appPasswords[j].Username
+		}
+		return appPasswords[i].Name < appPasswords[j].Name
+	})
+	return appPasswords, nil
+}
+
+// Create stores a new app password for user and returns its secret, which
+// is shown only once. local tells whether user is an account, as opposed to
+// a single sign-on user whose role and groups are kept with the password.
+func (a *AppPasswords) Create(user *types.User, local bool, name string) (string, *types.AppPassword, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return "", nil, fmt.Errorf("name must be 1 to 64 characters")
+	}
+	if err := ValidateName("username", user.Username); err != nil {
+		return "", nil, fmt.Errorf("app passwords are only available to users: %w", err)
+	}
+
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomString(24, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	appPassword := &types.AppPassword{
+		ID:       id,
+		Username: user.Username,
+		Name:     name,
+		Hash:     hashSecret(secret),
+		Local:    local,
+		Created:  time.Now().UTC(),
+	}
+	if !local {
+		appPassword.Role = user.Role
+		appPassword.Groups = append([]string(nil), user.Groups...)
+	}
+	if err := a.store.SetAppPassword(appPassword); err != nil {
+		return "", nil, err
+	}
+	return AppPasswordPrefix + id + "_" + secret, appPassword, nil
+}
+
+// Revoke deletes an app password. A non-empty username must own it.
+func (a *AppPasswords) Revoke(id, username string) error {
+	appPassword, err := a.store.GetAppPassword(id)
+	if err != nil {
+		return err
+	}
+	if appPassword == nil || (username != "" && appPassword.Username != username) {
+		return fmt.Errorf("%w: %s", ErrAppPasswordNotFound, id)
+	}
+	if err := a.store.DeleteAppPassword(id); err != nil {
+		return fmt.Errorf("failed to revoke app password: %w", err)
+	}
+	return nil
+}
+
+// Authenticate checks an app password of username and records its use. App
+// passwords of accounts act with the account's current role and groups,
+// and stop working when it is deleted. A disabled account of the same name
+// stops all of them.
+func (a *AppPasswords) Authenticate(username, password string) (*types.User, error) {
+	rest, ok := strings.CutPrefix(password, AppPasswordPrefix)
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	appPassword, err := a.store.GetAppPassword(id)
+	if err != nil {
+		return nil, err
+	}
+	if appPassword == nil || appPassword.Username != username ||
+		subtle.ConstantTimeCompare([]byte(appPassword.Hash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	account, err := a.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	user := &types.User{Username: appPassword.Username, Role: appPassword.Role, Groups: appPassword.Groups}
+	if appPassword.Local {
+		if account == nil {
+			return nil, ErrInvalidCredentials
+		}
+		user = account
+	}
+	if account != nil && account.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now().UTC()
+	if now.Sub(appPassword.LastUsed) >= lastUsedResolution {
+		appPassword.LastUsed = now
+		if err := a.store.SetAppPassword(appPassword); err != nil {
+			log.Printf("⚠️  Failed to record use of app password %s: %v", appPassword.Name, err)
+		}
+	}
+	return user, nil
+}
+
+// AppPasswordAuth checks app passwords sent with Basic auth
+type AppPasswordAuth struct {
+	appPasswords *AppPasswords
+}
+
+func NewAppPasswordAuth(appPasswords *AppPasswords) *AppPasswordAuth {
+	return &AppPasswordAuth{appPasswords: appPasswords}
+}
+
+func (a *AppPasswordAuth) Authenticate(r *http.Request) (*Identity, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok || !strings.HasPrefix(password, AppPasswordPrefix) {
+		return nil, ErrNoCredentials
+	}
+	user, err := a.appPasswords.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{User: user, Method: MethodAppPassword, Principal: "📱 " + user.Username}, nil
+}
+
+func (a *AppPasswordAuth) Challenge(error) string {
+	return basicChallenge
+}
@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func TestAppPasswords(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	users := NewUsers(store)
+	appPasswords := NewAppPasswords(store)
+
+	alice, _ := users.Create("alice", "alice-password", types.RoleEditor, []string{"staff"})
+	local, _, err := appPasswords.Create(alice, true, "laptop")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(local, AppPasswordPrefix) {
+		t.Errorf("Expected the password to start with %s, got %s", AppPasswordPrefix, local)
+	}
+
+	// Single sign-on users keep the role and groups they had
+	sso := &types.User{Username: "bob", Role: types.RoleReader, Groups: []string{"dev"}}
+	remote, bobPassword, err := appPasswords.Create(sso, false, "phone")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if bobPassword.Hash == "" || strings.Contains(remote, bobPassword.Hash) {
+		t.Errorf("Expected only a hash to be stored, got %+v", bobPassword)
+	}
+
+	user, err := appPasswords.Authenticate("bob", remote)
+	if err != nil || user.Role != types.RoleReader || len(user.Groups) != 1 || user.Groups[0] != "dev" {
+		t.Errorf("Unexpected single sign-on user %+v, %v", user, err)
+	}
+	reader := types.RoleReader
+	users.Update("alice", UserUpdate{Role: &reader})
+	if user, err := appPasswords.Authenticate("alice", local); err != nil || user.Role != types.RoleReader {
+		t.Errorf("Expected the account's current role, got %+v, %v", user, err)
+	}
+
+	for name, password := range map[string]string{"bob": local, "alice": remote + "x", "carol": "pdvapp_nope"} {
+		if _, err := appPasswords.Authenticate(name, password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Expected %s to be refused, got %v", name, err)
+		}
+	}
+
+	// The chain leaves account passwords and app passwords to their own authenticators
+	req := httptest.NewRequest("GET", "/", nil)
+	req.SetBasicAuth("alice", local)
+	chain := NewChain(NewPasswordAuth(users), NewAppPasswordAuth(appPasswords))
+	identity, _, err := chain.Authenticate(req)
+	if err != nil || identity.Method != MethodAppPassword {
+		t.Errorf("Expected the app password to authenticate, got %+v, %v", identity, err)
+	}
+	req.SetBasicAuth("alice", "alice-password")
+	if identity, _, err := chain.Authenticate(req); err != nil || identity.Method != MethodPassword {
+		t.Errorf("Expected the account password to authenticate, got %+v, %v", identity, err)
+	}
+	if _, _, err := NewChain(NewAppPasswordAuth(appPasswords)).Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected account passwords to need the password method, got %v", err)
+	}
+
+	if list, _ := appPasswords.List("alice"); len(list) != 1 || list[0].Name != "laptop" {
+		t.Errorf("Unexpected app passwords of alice: %+v", list)
+	}
+	if list, _ := appPasswords.List(""); len(list) != 2 {
+		t.Errorf("Expected 2 app passwords, got %d", len(list))
+	}
+
+	// Disabling or deleting the account stops its app passwords
+	disabled := true
+	users.Update("alice", UserUpdate{Disabled: &disabled})
+	if _, err := appPasswords.Authenticate("alice", local); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a disabled account's app password to be refused, got %v", err)
+	}
+	users.Delete("alice")
+	if _, err := appPasswords.Authenticate("alice", local); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a deleted account's app password to be refused, got %v", err)
+	}
+
+	if err := appPasswords.Revoke(bobPassword.ID, "alice"); !errors.Is(err, ErrAppPasswordNotFound) {
+		t.Errorf("Expected others' app passwords to be out of reach, got %v", err)
+	}
+	if err := appPasswords.Revoke(bobPassword.ID, "bob"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := appPasswords.Authenticate("bob", remote); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a revoked app password to be refused, got %v", err)
+	}
+}
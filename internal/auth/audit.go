@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+const (
+	// maxLoginEvents is how many events the audit trail keeps
+	maxLoginEvents = 10000
+	// WebDAV clients authenticate every request, so a user's successful
+	// logins from one address are recorded once in this window
+	successWindow = 10 * time.Minute
+)
+
+// Audit keeps the trail of failed and successful logins in the store
+type Audit struct {
+	store *storage.PersistentStore
+
+	mutex    sync.Mutex
+	recent   map[string]time.Time // successful logins recorded within successWindow
+	sequence int
+}
+
+func NewAudit(store *storage.PersistentStore) *Audit {
+	return &Audit{store: store, recent: make(map[string]time.Time)}
+}
+
+// Record adds an event to the trail. Repeated successful logins of a user
+// from the same address with the same method are left out until the next
+// failure.
+func (a *Audit) Record(event types.LoginEvent) {
+	now := time.Now()
+	key := event.Username + "\x00" + event.ClientIP + "\x00" + event.Method
+	a.mutex.Lock()
+	if !event.Success {
+		// The next success after a failure shows whether a guess worked
+		for recentKey := range a.recent {
+			if strings.HasPrefix(recentKey, event.Username+"\x00"+event.ClientIP+"\x00") {
+				delete(a.recent, recentKey)
+			}
+		}
+	} else {
+		if recorded, ok := a.recent[key]; ok && now.Sub(recorded) < successWindow {
+			a.mutex.Unlock()
+			return
+		}
+		if len(a.recent) >= maxLoginEvents {
+			a.recent = make(map[string]time.Time)
+		}
+		a.recent[key] = now
+	}
+	a.sequence++
+	sequence := a.sequence
+	a.mutex.Unlock()
+
+	event.Time = now.UTC()
+	event.ID = fmt.Sprintf("%020d-%06d", now.UnixNano(), sequence%1000000)
+	if err := a.store.AddLoginEvent(&event); err != nil {
+		log.Printf("⚠️  Failed to record login event: %v", err)
+		return
+	}
+	if sequence%100 == 0 {
+		if err := a.store.PruneLoginEvents(maxLoginEvents); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+	}
+}
+
+// List returns up to limit events, newest first, optionally only failures
+func (a *Audit) List(limit int, failedOnly bool) ([]types.LoginEvent, error) {
+	if !failedOnly {
+		return a.store.GetLoginEvents(limit)
+	}
+	events, err := a.store.GetLoginEvents(maxLoginEvents)
+	if err != nil {
+		return nil, err
+	}
+	var failed []types.LoginEvent
+	for _, event := range events {
+		if !event.Success && len(failed) < limit {
+			failed = append(failed, event)
+		}
+	}
+	return failed, nil
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"proxydav/pkg/types"
+)
+
+// ErrNoCredentials is returned by an Authenticator for requests that carry
+// no credentials of its kind, so that the chain tries the next one
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authentication methods, as listed in the auth_methods setting
+const (
+	MethodPassword    = "password"     // account passwords with Basic auth
+	MethodAppPassword = "app_password" // app passwords with Basic auth
+	MethodToken       = "token"        // API tokens as bearer tokens
+	MethodJWT         = "jwt"          // JWTs from a single sign-on provider as bearer tokens
+	MethodProxy       = "proxy"        // users named by a trusted reverse proxy
+	MethodHtpasswd    = "htpasswd"     // passwords from an htpasswd file with Basic auth
+	MethodClientCert  = "client_cert"  // TLS client certificates naming an account
+)
+
+// DefaultMethods are used when auth_methods is empty. JWTs, htpasswd files
+// and client certificates are added when they are configured; proxy
+// headers are never trusted unless listed.
+var DefaultMethods = []string{MethodPassword, MethodAppPassword, MethodToken}
+
+// Identity is who a request authenticated as
+type Identity struct {
+	User      *types.User
+	Token     *types.APIToken // set for API tokens, which are checked by scope rather than role
+	Method    string
+	Principal string // names the identity in the request log
+}
+
+// Authenticator checks one kind of credentials
+type Authenticator interface {
+	// Authenticate returns ErrNoCredentials when r carries none of its kind
+	Authenticate(r *http.Request) (*Identity, error)
+	// Challenge is the WWW-Authenticate value asking for its credentials
+	// again after err, or "" when clients cannot be asked for them
+	Challenge(err error) string
+}
+
+// Chain tries authenticators in order. The first one that finds its kind
+// of credentials decides.
+type Chain struct {
+	authenticators []Authenticator
+}
+
+func NewChain(authenticators ...Authenticator) *Chain {
+	return &Chain{authenticators: authenticators}
+}
+
+// Authenticate returns the identity of r. On failure it also returns the
+// challenges to answer with: those of every authenticator when r carried
+// no credentials, otherwise that of the authenticator that refused them.
+func (c *Chain) Authenticate(r *http.Request) (*Identity, []string, error) {
+	for _, authenticator := range c.authenticators {
+		identity, err := authenticator.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			if challenge := authenticator.Challenge(err); challenge != "" {
+				return nil, []string{challenge}, err
+			}
+			return nil, nil, err
+		}
+		return identity, nil, nil
+	}
+
+	var challenges []string
+	seen := make(map[string]bool)
+	for _, authenticator := range c.authenticators {
+		challenge := authenticator.Challenge(ErrNoCredentials)
+		if challenge != "" && !seen[challenge] {
+			seen[challenge] = true
+			challenges = append(challenges, challenge)
+		}
+	}
+	return nil, challenges, ErrNoCredentials
+}
+
+// passwordChecker is implemented by authenticators that check passwords of
+// their own
+type passwordChecker interface {
+	method() string
+	checkPassword(username, password string) (*types.User, error)
+}
+
+// CheckPassword checks the password of a user who signed in with method,
+// the way that method's authenticator does. It returns ErrNoCredentials
+// when the method has no passwords of its own.
+func (c *Chain) CheckPassword(method, username, password string) (*types.User, error) {
+	for _, authenticator := range c.authenticators {
+		if checker, ok := authenticator.(passwordChecker); ok && checker.method() == method {
+			return checker.checkPassword(username, password)
+		}
+	}
+	return nil, ErrNoCredentials
+}
+
+// basicChallenge asks for a username and password
+const basicChallenge = `Basic realm="ProxyDAV"`
+
+// bearerChallenge asks for a bearer token, telling clients whose token was
+// refused that it was invalid
+func bearerChallenge(err error) string {
+	if err != nil && !errors.Is(err, ErrNoCredentials) {
+		return `Bearer realm="ProxyDAV", error="invalid_token"`
+	}
+	return `Bearer realm="ProxyDAV"`
+}
+
+// bearerToken returns the bearer token of a request
+func bearerToken(r *http.Request) (string, bool) {
+	bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return strings.TrimSpace(bearer), ok
+}
+
+// PasswordAuth checks Basic credentials against the accounts
+type PasswordAuth struct {
+	users *Users
+}
+
+func NewPasswordAuth(users *Users) *PasswordAuth {
+	return &PasswordAuth{users: users}
+}
+
+func (a *PasswordAuth) Authenticate(r *http.Request) (*Identity, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok || strings.HasPrefix(password, AppPasswordPrefix) {
+		return nil, ErrNoCredentials
+	}
+	user, err := a.users.Authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{User: user, Method: MethodPassword, Principal: "👤 " + user.Username}, nil
+}
+
+func (a *PasswordAuth) Challenge(error) string {
+	return basicChallenge
+}
+
+func (a *PasswordAuth) method() string {
+	return MethodPassword
+}
+
+func (a *PasswordAuth) checkPassword(username, password string) (*types.User, error) {
+	return a.users.Authenticate(username, password)
+}
+
+// TokenAuth checks API tokens sent as bearer tokens
+type TokenAuth struct {
+	tokens *Tokens
+}
+
+func NewTokenAuth(tokens *Tokens) *TokenAuth {
+	return &TokenAuth{tokens: tokens}
+}
+
+func (a *TokenAuth) Authenticate(r *http.Request) (*Identity, error) {
+	bearer, ok := bearerToken(r)
+	if !ok || !strings.HasPrefix(bearer, TokenPrefix) {
+		return nil, ErrNoCredentials
+	}
+	token, err := a.tokens.Authenticate(bearer)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{User: TokenUser(token), Token: token, Method: MethodToken, Principal: "🔑 " + token.Name}, nil
+}
+
+func (a *TokenAuth) Challenge(err error) string {
+	return bearerChallenge(err)
+}
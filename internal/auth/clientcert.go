@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ClientCertAuth signs in clients with a TLS certificate the listener
+// verified against the configured CAs, as an existing account. The
+// certificate's common name, or failing that its first email address,
+// names the account, unless UserMap maps it to another username.
+type ClientCertAuth struct {
+	userMap map[string]string
+	users   *Users
+}
+
+// NewClientCertAuth returns an authenticator for client certificates.
+// userMap maps common names and email addresses to usernames.
+func NewClientCertAuth(userMap map[string]string, users *Users) *ClientCertAuth {
+	return &ClientCertAuth{userMap: userMap, users: users}
+}
+
+// ParseUserMap parses subject=username mappings. The subject is split off
+// at the last "=", since common names may contain one.
+func ParseUserMap(entries []string) (map[string]string, error) {
+	userMap := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		i := strings.LastIndex(entry, "=")
+		if i < 1 {
+			return nil, fmt.Errorf("user mapping %q must be in the form subject=username", entry)
+		}
+		subject, username := strings.TrimSpace(entry[:i]), strings.TrimSpace(entry[i+1:])
+		if err := ValidateName("username", username); err != nil {
+			return nil, fmt.Errorf("user mapping %q: %w", entry, err)
+		}
+		userMap[subject] = username
+	}
+	return userMap, nil
+}
+
+func (a *ClientCertAuth) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return nil, ErrNoCredentials
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	username := a.username(cert)
+	if err := ValidateName("username", username); err != nil {
+		return nil, fmt.Errorf("%w: the certificate of %q names no account", ErrInvalidCredentials, cert.Subject.CommonName)
+	}
+
+	account, err := a.users.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.Disabled {
+		return nil, fmt.Errorf("%w: no enabled account %s for the client certificate", ErrInvalidCredentials, username)
+	}
+	return &Identity{User: account, Method: MethodClientCert, Principal: "📜 " + username}, nil
+}
+
+// username returns the account a certificate names
+func (a *ClientCertAuth) username(cert *x509.Certificate) string {
+	subjects := append([]string{cert.Subject.CommonName}, cert.EmailAddresses...)
+	for _, subject := range subjects {
+		if username, ok := a.userMap[subject]; ok && subject != "" {
+			return username
+		}
+	}
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.EmailAddresses) > 0 {
+		return cert.EmailAddresses[0]
+	}
+	return ""
+}
+
+// Challenge is empty: certificates are asked for during the TLS handshake
+func (a *ClientCertAuth) Challenge(error) string {
+	return ""
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func TestClientCertAuth(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	users := NewUsers(store)
+	users.Create("alice", "alice-password", types.RoleEditor, nil)
+	users.Create("backup", "backup-password", types.RoleReader, nil)
+	carol, _ := users.Create("carol", "carol-password", types.RoleAdmin, nil)
+	carol.Disabled = true
+	store.SetUser(carol)
+
+	if _, err := ParseUserMap([]string{"backup"}); err == nil {
+		t.Error("Expected a mapping without a username to be refused")
+	}
+	if _, err := ParseUserMap([]string{"Backup Bot=@ops"}); err == nil {
+		t.Error("Expected a mapping to an invalid username to be refused")
+	}
+	userMap, err := ParseUserMap([]string{"Backup Bot=backup", "CN=with=equals=alice"})
+	if err != nil {
+		t.Fatalf("ParseUserMap failed: %v", err)
+	}
+	if userMap["CN=with=equals"] != "alice" {
+		t.Errorf("Expected subjects to be split at the last '=', got %v", userMap)
+	}
+	certAuth := NewClientCertAuth(userMap, users)
+
+	authenticate := func(cert *x509.Certificate) (*Identity, error) {
+		req := httptest.NewRequest("GET", "/", nil)
+		if cert != nil {
+			req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		return certAuth.Authenticate(req)
+	}
+
+	if _, err := authenticate(nil); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected requests without a certificate to be left to other methods, got %v", err)
+	}
+
+	identity, err := authenticate(&x509.Certificate{Subject: pkix.Name{CommonName: "alice"}})
+	if err != nil || identity.User.Username != "alice" || identity.User.Role != types.RoleEditor || identity.Method != MethodClientCert {
+		t.Fatalf("Expected alice's account, got %+v, %v", identity, err)
+	}
+	identity, err = authenticate(&x509.Certificate{Subject: pkix.Name{CommonName: "Backup Bot"}})
+	if err != nil || identity.User.Username != "backup" {
+		t.Errorf("Expected the mapped account, got %+v, %v", identity, err)
+	}
+	identity, err = authenticate(&x509.Certificate{EmailAddresses: []string{"alice"}})
+	if err != nil || identity.User.Username != "alice" {
+		t.Errorf("Expected the email address to name the account without a common name, got %+v, %v", identity, err)
+	}
+
+	refused := map[string]*x509.Certificate{
+		"an unknown account": {Subject: pkix.Name{CommonName: "mallory"}},
+		"a disabled account": {Subject: pkix.Name{CommonName: "carol"}},
+		"an invalid name":    {Subject: pkix.Name{CommonName: "Alice Smith"}},
+		"no one":             {},
+	}
+	for name, cert := range refused {
+		if _, err := authenticate(cert); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Expected a certificate naming %s to be refused, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+
+	"proxydav/pkg/types"
+)
+
+type userKey struct{}
+
+// WithUser returns a context carrying the authenticated user
+func WithUser(ctx context.Context, user *types.User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFrom returns the authenticated user of a request, or nil when
+// authentication is disabled
+func UserFrom(ctx context.Context) *types.User {
+	user, _ := ctx.Value(userKey{}).(*types.User)
+	return user
+}
+
+type tokenKey struct{}
+
+// WithToken returns a context carrying the API token a request authenticated with
+func WithToken(ctx context.Context, token *types.APIToken) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// TokenFrom returns the API token of a request, or nil when it was made
+// with a password or without authentication
+func TokenFrom(ctx context.Context) *types.APIToken {
+	token, _ := ctx.Value(tokenKey{}).(*types.APIToken)
+	return token
+}
+
+type methodKey struct{}
+
+// WithMethod returns a context recording how a request authenticated, as
+// one of the Method constants
+func WithMethod(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, methodKey{}, method)
+}
+
+// MethodFrom returns how a request authenticated, or "" without authentication
+func MethodFrom(ctx context.Context) string {
+	method, _ := ctx.Value(methodKey{}).(string)
+	return method
+}
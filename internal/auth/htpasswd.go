@@ -0,0 +1,317 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"proxydav/pkg/types"
+)
+
+// HtpasswdOptions name the files of an htpasswd authenticator
+type HtpasswdOptions struct {
+	File       string // user:hash lines, with bcrypt, SHA1 or APR1 hashes
+	GroupsFile string // optional group: user user ... lines
+	// RoleMap maps groups to roles; without one, groups that name a role
+	// grant it. Users in no mapped group are readers.
+	RoleMap map[string]string
+}
+
+// HtpasswdAuth checks Basic credentials against an Apache htpasswd file.
+// The files are read again whenever they change, so users can be managed
+// with the htpasswd tool while the server runs.
+type HtpasswdAuth struct {
+	options HtpasswdOptions
+	users   *Users
+
+	mutex    sync.Mutex
+	stamp    string              // sizes and modification times the entries were read at
+	hashes   map[string]string   // username to hash
+	groups   map[string][]string // username to groups
+	verified map[[sha256.Size]byte]time.Time
+}
+
+// NewHtpasswdAuth reads the htpasswd and group files. A disabled account
+// refuses users of the same name.
+func NewHtpasswdAuth(options HtpasswdOptions, users *Users) (*HtpasswdAuth, error) {
+	a := &HtpasswdAuth{options: options, users: users}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *HtpasswdAuth) Authenticate(r *http.Request) (*Identity, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok || strings.HasPrefix(password, AppPasswordPrefix) {
+		return nil, ErrNoCredentials
+	}
+	user, err := a.check(username, password)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{User: user, Method: MethodHtpasswd, Principal: "📒 " + user.Username}, nil
+}
+
+func (a *HtpasswdAuth) Challenge(error) string {
+	return basicChallenge
+}
+
+func (a *HtpasswdAuth) method() string {
+	return MethodHtpasswd
+}
+
+func (a *HtpasswdAuth) checkPassword(username, password string) (*types.User, error) {
+	return a.check(username, password)
+}
+
+// check verifies a user's password. Users that are not in the file are
+// left to the other authenticators.
+func (a *HtpasswdAuth) check(username, password string) (*types.User, error) {
+	a.mutex.Lock()
+	if err := a.reload(); err != nil {
+		log.Printf("⚠️  Failed to reload the htpasswd files, keeping the previous users: %v", err)
+	}
+	hash, found := a.hashes[username]
+	groups := a.groups[username]
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+	expires, cached := a.verified[key]
+	a.mutex.Unlock()
+
+	if !found {
+		return nil, ErrNoCredentials
+	}
+	if !cached || time.Now().After(expires) {
+		if !verifyHtpasswd(hash, password) {
+			return nil, ErrInvalidCredentials
+		}
+		a.mutex.Lock()
+		if len(a.verified) >= maxVerified {
+			a.verified = make(map[[sha256.Size]byte]time.Time)
+		}
+		a.verified[key] = time.Now().Add(verifiedTTL)
+		a.mutex.Unlock()
+	}
+
+	account, err := a.users.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil && account.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+	role := mapRole(a.options.RoleMap, groups, len(a.options.RoleMap) == 0)
+	return &types.User{Username: username, Role: role, Groups: groups}, nil
+}
+
+// reload reads the files again if they changed since they were last read.
+// The caller holds the mutex.
+func (a *HtpasswdAuth) reload() error {
+	stamp, err := fileStamp(a.options.File, a.options.GroupsFile)
+	if err != nil {
+		stamp = "unreadable"
+	}
+	if stamp == a.stamp {
+		return nil
+	}
+	// A broken file is reported once, not on every request
+	a.stamp = stamp
+	if err != nil {
+		return fmt.Errorf("failed to read htpasswd files: %w", err)
+	}
+
+	data, err := os.ReadFile(a.options.File)
+	if err != nil {
+		return fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+	hashes, err := parseHtpasswd(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", a.options.File, err)
+	}
+
+	members := make(map[string][]string)
+	if a.options.GroupsFile != "" {
+		data, err := os.ReadFile(a.options.GroupsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read htpasswd groups file: %w", err)
+		}
+		members, err = parseGroupFile(data)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", a.options.GroupsFile, err)
+		}
+	}
+	groups := make(map[string][]string, len(members))
+	for username, values := range members {
+		groups[username] = groupNames(values)
+	}
+
+	if a.hashes != nil {
+		log.Printf("🔄 Reloaded %s: %d users", a.options.File, len(hashes))
+	}
+	a.hashes, a.groups = hashes, groups
+	// Removed users and changed passwords must not stay signed in
+	a.verified = make(map[[sha256.Size]byte]time.Time)
+	return nil
+}
+
+// fileStamp describes the size and modification time of files
+func fileStamp(files ...string) (string, error) {
+	var stamp strings.Builder
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&stamp, "%d/%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp.String(), nil
+}
+
+// parseHtpasswd reads user:hash lines. Users whose hash is in a format
+// other than bcrypt, SHA1 or APR1 are skipped with a warning.
+func parseHtpasswd(data []byte) (map[string]string, error) {
+	hashes := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(text, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("line %d is not in the form user:hash", line)
+		}
+		if err := ValidateName("username", username); err != nil {
+			log.Printf("⚠️  Skipping %q in the htpasswd file: %v", username, err)
+			continue
+		}
+		if !supportedHtpasswdHash(hash) {
+			log.Printf("⚠️  Skipping %s in the htpasswd file: only bcrypt, SHA1 and APR1 hashes are supported", username)
+			continue
+		}
+		hashes[username] = hash
+	}
+	return hashes, scanner.Err()
+}
+
+// parseGroupFile reads Apache group files, with group: user user ... lines,
+// into the groups of each user
+func parseGroupFile(data []byte) (map[string][]string, error) {
+	groups := make(map[string][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		group, members, ok := strings.Cut(text, ":")
+		if !ok || strings.TrimSpace(group) == "" {
+			return nil, fmt.Errorf("line %d is not in the form group: user user", line)
+		}
+		for _, username := range strings.Fields(members) {
+			groups[username] = append(groups[username], strings.TrimSpace(group))
+		}
+	}
+	return groups, scanner.Err()
+}
+
+func supportedHtpasswdHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "{SHA}", "$apr1$"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyHtpasswd checks password against an htpasswd hash
+func verifyHtpasswd(hash, password string) bool {
+	switch {
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(hash[len("{SHA}"):]), []byte(base64.StdEncoding.EncodeToString(sum[:]))) == 1
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt, _, _ := strings.Cut(hash[len("$apr1$"):], "$")
+		return subtle.ConstantTimeCompare([]byte(hash), []byte(apr1(password, salt))) == 1
+	default:
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+}
+
+// apr1 is Apache's variant of the MD5-based crypt
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alternate := md5.Sum([]byte(password + salt + password))
+	digest := md5.New()
+	digest.Write([]byte(password + magic + salt))
+	for i := len(pw); i > 0; i -= 16 {
+		digest.Write(alternate[:min(i, 16)])
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			digest.Write([]byte{0})
+		} else {
+			digest.Write(pw[:1])
+		}
+	}
+	final := digest.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		round := md5.New()
+		if i&1 != 0 {
+			round.Write(pw)
+		} else {
+			round.Write(final)
+		}
+		if i%3 != 0 {
+			round.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			round.Write(pw)
+		}
+		if i&1 != 0 {
+			round.Write(final)
+		} else {
+			round.Write(pw)
+		}
+		final = round.Sum(nil)
+	}
+
+	const alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var encoded []byte
+	encode := func(a, b, c byte, n int) {
+		v := uint(a)<<16 | uint(b)<<8 | uint(c)
+		for ; n > 0; n-- {
+			encoded = append(encoded, alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(final[0], final[6], final[12], 4)
+	encode(final[1], final[7], final[13], 4)
+	encode(final[2], final[8], final[14], 4)
+	encode(final[3], final[9], final[15], 4)
+	encode(final[4], final[10], final[5], 4)
+	encode(0, 0, final[11], 2)
+	return magic + salt + "$" + string(encoded)
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func TestApr1(t *testing.T) {
+	// Made with openssl passwd -apr1
+	for password, hash := range map[string]string{
+		"apr1-pass": "$apr1$8sFt66rZ$8ctGeVTXq9XlA6l6wfsWp0",
+		"":          "$apr1$ab$S8K6Sgp3W8c9Jb6LxgywZ.",
+	} {
+		salt, _, _ := strings.Cut(strings.TrimPrefix(hash, "$apr1$"), "$")
+		if got := apr1(password, salt); got != hash {
+			t.Errorf("apr1(%q) = %s, want %s", password, got, hash)
+		}
+	}
+}
+
+func TestHtpasswdAuth(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	users := NewUsers(store)
+
+	bcryptHash, _ := bcrypt.GenerateFromPassword([]byte("bcrypt-pass"), bcrypt.MinCost)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "htpasswd")
+	groupsFile := filepath.Join(dir, "groups")
+	os.WriteFile(file, []byte(strings.Join([]string{
+		"# managed by ops",
+		"alice:" + strings.Replace(string(bcryptHash), "$2a$", "$2y$", 1),
+		"bob:{SHA}xO2etOilyqtV8o1RvvnmkeBx7QI=",
+		"carol:$apr1$8sFt66rZ$8ctGeVTXq9XlA6l6wfsWp0",
+		"dave:plaintext",
+		"",
+	}, "\n")), 0600)
+	os.WriteFile(groupsFile, []byte("editor: alice\nstaff: alice bob\n"), 0600)
+
+	htpasswd, err := NewHtpasswdAuth(HtpasswdOptions{File: file, GroupsFile: groupsFile}, users)
+	if err != nil {
+		t.Fatalf("NewHtpasswdAuth failed: %v", err)
+	}
+	authenticate := func(username, password string) (*Identity, error) {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.SetBasicAuth(username, password)
+		return htpasswd.Authenticate(req)
+	}
+
+	identity, err := authenticate("alice", "bcrypt-pass")
+	if err != nil || identity.Method != MethodHtpasswd || identity.User.Role != types.RoleEditor || !reflect.DeepEqual(identity.User.Groups, []string{"editor", "staff"}) {
+		t.Fatalf("Unexpected identity %+v, %v", identity, err)
+	}
+	if identity, err := authenticate("bob", "sha-pass"); err != nil || identity.User.Role != types.RoleReader {
+		t.Errorf("Expected a SHA1 password to authenticate a reader, got %+v, %v", identity, err)
+	}
+	if _, err := authenticate("carol", "apr1-pass"); err != nil {
+		t.Errorf("Expected an APR1 password to authenticate, got %v", err)
+	}
+	if _, err := authenticate("carol", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a wrong password to be refused, got %v", err)
+	}
+	for _, username := range []string{"dave", "erin"} {
+		if _, err := authenticate(username, "plaintext"); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("Expected %s to be left to other methods, got %v", username, err)
+		}
+	}
+
+	// Changes to the files take effect without a restart
+	apr1Hash := apr1("new-pass", "newsalt1")
+	os.WriteFile(file, []byte("carol:"+apr1Hash+"\n"), 0600)
+	os.Chtimes(file, time.Now().Add(time.Minute), time.Now().Add(time.Minute))
+	if _, err := authenticate("alice", "bcrypt-pass"); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected a removed user to be forgotten, got %v", err)
+	}
+	if _, err := authenticate("carol", "apr1-pass"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the old password to stop working, got %v", err)
+	}
+	if _, err := authenticate("carol", "new-pass"); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+
+	// A broken file keeps the users read before
+	os.WriteFile(file, []byte("no separator\n"), 0600)
+	os.Chtimes(file, time.Now().Add(2*time.Minute), time.Now().Add(2*time.Minute))
+	if _, err := authenticate("carol", "new-pass"); err != nil {
+		t.Errorf("Expected a broken file to keep the previous users, got %v", err)
+	}
+
+	// A disabled account of the same name refuses the user
+	account, _ := users.Create("carol", "carol-password", types.RoleReader, nil)
+	account.Disabled = true
+	store.SetUser(account)
+	if _, err := authenticate("carol", "new-pass"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a disabled account to be refused, got %v", err)
+	}
+
+	if _, err := NewHtpasswdAuth(HtpasswdOptions{File: filepath.Join(dir, "missing")}, users); err == nil {
+		t.Error("Expected a missing file to be refused")
+	}
+}
@@ -0,0 +1,525 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/pkg/types"
+)
+
+// Default claims a JWT's user is read from
+const (
+	DefaultUsernameClaim = "preferred_username"
+	DefaultGroupsClaim   = "groups"
+	DefaultRoleClaim     = "roles"
+)
+
+const (
+	// jwtLeeway allows for clocks that differ between ProxyDAV and the provider
+	jwtLeeway = time.Minute
+	// jwksRefresh is how long keys are used before they are loaded again
+	jwksRefresh = time.Hour
+	// jwksRetry limits how often unknown key IDs make the keys load again
+	jwksRetry = time.Minute
+	// maxJWKSSize limits the size of a key set
+	maxJWKSSize = 1 << 20
+)
+
+// JWTOptions configure which JWTs are accepted and how their claims map to
+// a user. Claims may name nested claims with dots, as in realm_access.roles.
+type JWTOptions struct {
+	JWKS          string   // file or http(s) URL of the provider's key set
+	Issuers       []string // accepted iss claims
+	Audiences     []string // accepted aud claims; a token needs one of them
+	UsernameClaim string
+	GroupsClaim   string
+	RoleClaim     string
+	// RoleMap maps values of the role claim to roles. Without it, values
+	// that name a role are used as is.
+	RoleMap map[string]string
+}
+
+// ParseRoleMap parses role mappings of the form value=role
+func ParseRoleMap(entries []string) (map[string]string, error) {
+	roleMap := make(map[string]string)
+	for _, entry := range entries {
+		value, role, ok := strings.Cut(entry, "=")
+		value, role = strings.TrimSpace(value), strings.TrimSpace(role)
+		if !ok || value == "" || !ValidRole(role) {
+			return nil, fmt.Errorf("role mapping %q must be in the form value=reader, value=editor or value=admin", entry)
+		}
+		roleMap[value] = role
+	}
+	return roleMap, nil
+}
+
+// JWTAuth checks JWTs sent as bearer tokens against a provider's keys
+type JWTAuth struct {
+	options JWTOptions
+	users   *Users
+	keys    *keySet
+}
+
+// NewJWTAuth returns an authenticator for JWTs. Keys are loaded when the
+// first token arrives. A disabled account refuses JWTs of the same name.
+func NewJWTAuth(options JWTOptions, users *Users) (*JWTAuth, error) {
+	if options.JWKS == "" {
+		return nil, fmt.Errorf("a JWKS file or URL is required")
+	}
+	if len(options.Issuers) == 0 || len(options.Audiences) == 0 {
+		return nil, fmt.Errorf("at least one JWT issuer and audience are required")
+	}
+	if options.UsernameClaim == "" {
+		options.UsernameClaim = DefaultUsernameClaim
+	}
+	if options.GroupsClaim == "" {
+		options.GroupsClaim = DefaultGroupsClaim
+	}
+	if options.RoleClaim == "" {
+		options.RoleClaim = DefaultRoleClaim
+	}
+	return &JWTAuth{options: options, users: users, keys: newKeySet(options.JWKS)}, nil
+}
+
+func (a *JWTAuth) Authenticate(r *http.Request) (*Identity, error) {
+	bearer, ok := bearerToken(r)
+	if !ok || strings.HasPrefix(bearer, TokenPrefix) || strings.Count(bearer, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+	user, err := a.Verify(bearer)
+	if err != nil {
+		if errors.Is(err, ErrInvalidToken) {
+			log.Printf("⚠️  Refused a JWT: %v", err)
+		}
+		return nil, err
+	}
+	return &Identity{User: user, Method: MethodJWT, Principal: "🪪 " + user.Username}, nil
+}
+
+func (a *JWTAuth) Challenge(err error) string {
+	return bearerChallenge(err)
+}
+
+// Verify checks a JWT's signature and claims and returns its user
+func (a *JWTAuth) Verify(raw string) (*types.User, error) {
+	claims, err := a.verifySignature(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkClaims(claims, time.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	username, _ := claimValue(claims, a.options.UsernameClaim).(string)
+	if username == "" && a.options.UsernameClaim == DefaultUsernameClaim {
+		username, _ = claims["sub"].(string)
+	}
+	if err := ValidateName("username", username); err != nil {
+		return nil, fmt.Errorf("%w: claim %s: %v", ErrInvalidToken, a.options.UsernameClaim, err)
+	}
+	user := &types.User{
+		Username: username,
+		Role:     a.role(claimStrings(claimValue(claims, a.options.RoleClaim))),
+		Groups:   groupNames(claimStrings(claimValue(claims, a.options.GroupsClaim))),
+	}
+
+	account, err := a.users.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil && account.Disabled {
+		return nil, fmt.Errorf("%w: the account %s is disabled", ErrInvalidToken, username)
+	}
+	return user, nil
+}
+
+// verifySignature checks the signature of a JWT and returns its claims
+func (a *JWTAuth) verifySignature(raw string) (map[string]interface{}, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed JWT", ErrInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+
+	keys, err := a.keys.get(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range keys {
+		if verifyJWS(header.Alg, key, signed, signature) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("%w: no key verifies its %s signature", ErrInvalidToken, header.Alg)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims: %v", ErrInvalidToken, err)
+	}
+	return claims, nil
+}
+
+// checkClaims checks the expiry, issuer and audience of a JWT
+func (a *JWTAuth) checkClaims(claims map[string]interface{}, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("no expiry")
+	}
+	if now.Add(-jwtLeeway).After(time.Unix(int64(exp), 0)) {
+		return fmt.Errorf("expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("not valid yet")
+	}
+
+	issuer, _ := claims["iss"].(string)
+	if !contains(a.options.Issuers, issuer) {
+		return fmt.Errorf("issuer %q is not accepted", issuer)
+	}
+	for _, audience := range claimStrings(claims["aud"]) {
+		if contains(a.options.Audiences, audience) {
+			return nil
+		}
+	}
+	return fmt.Errorf("audience is not accepted")
+}
+
+// role returns the highest role that values map to, or reader
+func (a *JWTAuth) role(values []string) string {
+	return mapRole(a.options.RoleMap, values, len(a.options.RoleMap) == 0)
+}
+
+// mapRole returns the highest role that values map to through roleMap, or
+// reader. With literal set, values that name a role count as that role.
+func mapRole(roleMap map[string]string, values []string, literal bool) string {
+	role := types.RoleReader
+	for _, value := range values {
+		mapped, ok := roleMap[value]
+		if !ok && literal && ValidRole(value) {
+			mapped, ok = value, true
+		}
+		if ok && Allows(mapped, role) {
+			role = mapped
+		}
+	}
+	return role
+}
+
+// groupNames turns group claims into group names. Providers that send group
+// paths such as /staff get the leading slash removed; names that cannot be
+// used in access rules are skipped.
+func groupNames(values []string) []string {
+	var names []string
+	for _, value := range values {
+		name := strings.TrimPrefix(value, "/")
+		if ValidateName("group name", name) == nil {
+			names = append(names, name)
+		}
+	}
+	groups, _ := normalizeGroups(names)
+	return groups
+}
+
+// claimValue looks up a claim, following dots into nested objects
+func claimValue(claims map[string]interface{}, name string) interface{} {
+	if value, ok := claims[name]; ok {
+		return value
+	}
+	var value interface{} = claims
+	for _, part := range strings.Split(name, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[part]
+	}
+	return value
+}
+
+// claimStrings returns a claim that is a string or a list of strings as a list
+func claimStrings(value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwsHashes are the hashes of the accepted signature algorithms. Only
+// asymmetric algorithms are accepted; "none" and shared secrets never verify.
+var jwsHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// verifyJWS checks a signature made with alg
+func verifyJWS(alg string, key crypto.PublicKey, signed, signature []byte) bool {
+	hash, ok := jwsHashes[alg]
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		switch {
+		case ok && strings.HasPrefix(alg, "RS"):
+			return rsa.VerifyPKCS1v15(key, hash, hashed(hash, signed), signature) == nil
+		case ok && strings.HasPrefix(alg, "PS"):
+			return rsa.VerifyPSS(key, hash, hashed(hash, signed), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !ok || key.Curve != curveFor(alg) || len(signature) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		return ecdsa.Verify(key, hashed(hash, signed), r, s)
+	case ed25519.PublicKey:
+		return alg == "EdDSA" && ed25519.Verify(key, signed, signature)
+	}
+	return false
+}
+
+func hashed(hash crypto.Hash, data []byte) []byte {
+	h := hash.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// curveFor returns the curve an ES algorithm signs with
+func curveFor(alg string) elliptic.Curve {
+	switch alg {
+	case "ES256":
+		return elliptic.P256()
+	case "ES384":
+		return elliptic.P384()
+	case "ES512":
+		return elliptic.P521()
+	}
+	return nil
+}
+
+// keySet holds the keys of a JWKS file or URL and loads them again
+// periodically and when a token names an unknown key
+type keySet struct {
+	source string
+	client *http.Client
+
+	mutex       sync.Mutex
+	keys        map[string][]crypto.PublicKey // by key ID; keys without one are under ""
+	loaded      time.Time
+	lastAttempt time.Time
+}
+
+func newKeySet(source string) *keySet {
+	return &keySet{source: source, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// get returns the keys that may have signed a token with key ID kid
+func (k *keySet) get(kid string) ([]crypto.PublicKey, error) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	now := time.Now()
+	stale := now.Sub(k.loaded) >= jwksRefresh
+	if (stale || k.find(kid) == nil) && now.Sub(k.lastAttempt) >= jwksRetry {
+		k.lastAttempt = now
+		keys, err := k.load()
+		if err != nil {
+			if k.keys == nil {
+				return nil, fmt.Errorf("failed to load JWKS: %w", err)
+			}
+			log.Printf("⚠️  Failed to reload JWKS, using the keys loaded before: %v", err)
+		} else {
+			k.keys, k.loaded = keys, now
+		}
+	}
+
+	keys := k.find(kid)
+	if keys == nil {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalidToken, kid)
+	}
+	return keys, nil
+}
+
+// find returns the keys for kid: the key with that ID, or every key for
+// tokens without one
+func (k *keySet) find(kid string) []crypto.PublicKey {
+	if kid != "" {
+		return k.keys[kid]
+	}
+	var keys []crypto.PublicKey
+	for _, set := range k.keys {
+		keys = append(keys, set...)
+	}
+	return keys
+}
+
+func (k *keySet) load() (map[string][]crypto.PublicKey, error) {
+	var data []byte
+	if strings.HasPrefix(k.source, "https://") || strings.HasPrefix(k.source, "http://") {
+		resp, err := k.client.Get(k.source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s answered %s", k.source, resp.Status)
+		}
+		if data, err = io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize)); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(k.source); err != nil {
+			return nil, err
+		}
+	}
+	return parseJWKS(data)
+}
+
+// jsonWebKey holds the members of the RSA, EC and OKP keys of RFC 7517/8037
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS reads the signing keys of a key set, skipping keys of other
+// types and uses
+func parseJWKS(data []byte) (map[string][]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string][]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("⚠️  Skipping JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		if key != nil {
+			keys[jwk.Kid] = append(keys[jwk.Kid], key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS has no usable signing keys")
+	}
+	return keys, nil
+}
+
+// publicKey returns the key, or nil for key types that cannot sign JWTs
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys need at least 2048 bits")
+		}
+		return key, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(jwk.X)
+		y, errY := base64.RawURLEncoding.DecodeString(jwk.Y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid coordinates")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("point is not on the curve")
+		}
+		return key, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if jwk.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("only Ed25519 OKP keys are supported")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signJWT makes a JWT with claims, signed by key with alg
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	var signature []byte
+	var err error
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signed))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signed))
+	}
+	if err != nil {
+		t.Fatalf("Failed to sign JWT: %v", err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes())}
+}
+
+func writeJWKS(t *testing.T, file string, keys ...map[string]string) {
+	t.Helper()
+	data, _ := json.Marshal(map[string]interface{}{"keys": keys})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatalf("Failed to write JWKS: %v", err)
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	users := NewUsers(store)
+
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	edPublic, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwks,
+		rsaJWK("rsa", &rsaKey.PublicKey),
+		map[string]string{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(ecKey.X.FillBytes(make([]byte, 32))), "y": b64(ecKey.Y.FillBytes(make([]byte, 32)))},
+		map[string]string{"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(edPublic)},
+		map[string]string{"kty": "oct", "kid": "secret", "k": b64([]byte("shared secret"))},
+	)
+
+	jwtAuth, err := NewJWTAuth(JWTOptions{
+		JWKS:        jwks,
+		Issuers:     []string{"https://sso.example.com"},
+		Audiences:   []string{"proxydav"},
+		RoleClaim:   "realm_access.roles",
+		RoleMap:     map[string]string{"dav-editors": types.RoleEditor, "dav-admins": types.RoleAdmin},
+		GroupsClaim: "groups",
+	}, users)
+	if err != nil {
+		t.Fatalf("NewJWTAuth failed: %v", err)
+	}
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		base := map[string]interface{}{
+			"iss":                "https://sso.example.com",
+			"aud":                []string{"account", "proxydav"},
+			"sub":                "1b2c3d",
+			"preferred_username": "alice",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"groups":             []string{"/staff", "with space", "dev"},
+			"realm_access":       map[string]interface{}{"roles": []string{"offline_access", "dav-editors"}},
+		}
+		for name, value := range changes {
+			if value == nil {
+				delete(base, name)
+			} else {
+				base[name] = value
+			}
+		}
+		return base
+	}
+
+	user, err := jwtAuth.Verify(signJWT(t, "RS256", "rsa", rsaKey, claims(nil)))
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	if user.Username != "alice" || user.Role != types.RoleEditor || !reflect.DeepEqual(user.Groups, []string{"dev", "staff"}) {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	for _, token := range []string{
+		signJWT(t, "ES256", "ec", ecKey, claims(nil)),
+		signJWT(t, "EdDSA", "ed", edKey, claims(nil)),
+		signJWT(t, "RS256", "", rsaKey, claims(nil)),
+	} {
+		if _, err := jwtAuth.Verify(token); err != nil {
+			t.Errorf("Expected a valid token to verify, got %v", err)
+		}
+	}
+
+	user, err = jwtAuth.Verify(signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"preferred_username": nil, "realm_access": nil})))
+	if err != nil || user.Username != "1b2c3d" || user.Role != types.RoleReader {
+		t.Errorf("Expected sub and the reader role as fallbacks, got %+v, %v", user, err)
+	}
+
+	valid := signJWT(t, "RS256", "rsa", rsaKey, claims(nil))
+	parts := strings.Split(valid, ".")
+	forged, _ := json.Marshal(claims(map[string]interface{}{"preferred_username": "admin"}))
+	noneHeader, _ := json.Marshal(map[string]string{"alg": "none"})
+
+	invalid := map[string]string{
+		"expired":        signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+		"no expiry":      signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"exp": nil})),
+		"not yet valid":  signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+		"wrong issuer":   signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+		"wrong audience": signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})),
+		"unknown key":    signJWT(t, "RS256", "rsa", otherKey, claims(nil)),
+		"wrong alg":      signJWT(t, "RS256", "ec", rsaKey, claims(nil)),
+		"bad username":   signJWT(t, "RS256", "rsa", rsaKey, claims(map[string]interface{}{"preferred_username": "token:x"})),
+		"tampered":       parts[0] + "." + b64(forged) + "." + parts[2],
+		"alg none":       b64(noneHeader) + "." + parts[1] + ".",
+		"shared secret":  strings.Replace(valid, parts[0], b64([]byte(`{"alg":"HS256","kid":"secret"}`)), 1),
+	}
+	for name, token := range invalid {
+		if _, err := jwtAuth.Verify(token); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	// A disabled account of the same name refuses the user's tokens
+	account, _ := users.Create("alice", "alice-password", types.RoleReader, nil)
+	account.Disabled = true
+	store.SetUser(account)
+	if _, err := jwtAuth.Verify(valid); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a disabled account to refuse its JWTs, got %v", err)
+	}
+
+	// Only bearer tokens that look like JWTs are taken
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Authorization", "Bearer "+TokenPrefix+"abc_def")
+	if _, err := jwtAuth.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+		t.Errorf("Expected API tokens to be left to the token authenticator, got %v", err)
+	}
+}
+
+func TestJWTAuth_KeyRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, jwks, rsaJWK("old", &oldKey.PublicKey))
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.ServeFile(w, r, jwks)
+	}))
+	defer server.Close()
+
+	jwtAuth, err := NewJWTAuth(JWTOptions{JWKS: server.URL, Issuers: []string{"sso"}, Audiences: []string{"dav"}}, NewUsers(nil))
+	if err != nil {
+		t.Fatalf("NewJWTAuth failed: %v", err)
+	}
+	claims := map[string]interface{}{"iss": "sso", "aud": "dav", "sub": "bob", "exp": time.Now().Add(time.Hour).Unix()}
+
+	if _, err := jwtAuth.verifySignature(signJWT(t, "RS256", "old", oldKey, claims)); err != nil {
+		t.Fatalf("Expected the old key to verify, got %v", err)
+	}
+
+	writeJWKS(t, jwks, rsaJWK("old", &oldKey.PublicKey), rsaJWK("new", &newKey.PublicKey))
+	rotated := signJWT(t, "RS256", "new", newKey, claims)
+	if _, err := jwtAuth.verifySignature(rotated); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected unknown keys not to reload the key set right away, got %v", err)
+	}
+	jwtAuth.keys.lastAttempt = time.Time{}
+	if _, err := jwtAuth.verifySignature(rotated); err != nil {
+		t.Errorf("Expected an unknown key to reload the key set, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 key set requests, got %d", requests)
+	}
+}
@@ -0,0 +1,291 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrLockoutNotFound = errors.New("lockout not found")
+
+// Kinds of lockouts, which prefix their keys as kind:subject
+const (
+	LockoutAddress = "address"
+	LockoutUser    = "user"
+	LockoutShare   = "share"
+)
+
+// maxTracked bounds the addresses, usernames and shares whose failures are
+// counted
+const maxTracked = 10000
+
+// LockoutOptions configure how failed logins lock clients out
+type LockoutOptions struct {
+	MaxFailures int           // failures before the first lockout; 0 turns lockouts off
+	Lockout     time.Duration // first lockout, doubled for every further failure
+	MaxLockout  time.Duration // longest lockout; failures are forgotten after as long without one
+	Allowlist   []string      // addresses and CIDRs that are never locked out
+}
+
+// Lockout is an address, username or share that is locked out
+type Lockout struct {
+	Key      string    `json:"key"`
+	Kind     string    `json:"kind"`
+	Subject  string    `json:"subject"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+type failures struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+// Lockouts counts failed logins per client address and per username, and
+// wrong share link passwords per address and per share, and locks any of
+// them out for a while once there are too many. Every failure after
+// that doubles the next lockout. Counts are kept in memory only.
+type Lockouts struct {
+	mutex     sync.Mutex
+	options   LockoutOptions
+	allowlist []*net.IPNet
+	entries   map[string]*failures
+}
+
+func NewLockouts(options LockoutOptions) (*Lockouts, error) {
+	l := &Lockouts{entries: make(map[string]*failures)}
+	if err := l.Configure(options); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Configure applies new options; counted failures are kept
+func (l *Lockouts) Configure(options LockoutOptions) error {
+	var allowlist []*net.IPNet
+	for _, entry := range options.Allowlist {
+		ipNet, err := parseNetwork(entry)
+		if err != nil {
+			return err
+		}
+		allowlist = append(allowlist, ipNet)
+	}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.options, l.allowlist = options, allowlist
+	return nil
+}
+
+// parseNetwork parses an address or CIDR
+func parseNetwork(entry string) (*net.IPNet, error) {
+	entry = strings.TrimSpace(entry)
+	if _, ipNet, err := net.ParseCIDR(entry); err == nil {
+		return ipNet, nil
+	}
+	ip := net.ParseIP(entry)
+	if ip == nil {
+		return nil, fmt.Errorf("%q is not an address or CIDR", entry)
+	}
+	bits := 8 * len(ip)
+	if ip.To4() != nil {
+		ip, bits = ip.To4(), 8*net.IPv4len
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+}
+
+// allowed reports whether ip is on the allowlist. The caller holds the mutex.
+func (l *Lockouts) allowed(ip string) bool {
+	parsed := net.ParseIP(ip)
+	for _, ipNet := range l.allowlist {
+		if parsed != nil && ipNet.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// lockoutKeys returns the keys failed logins of a client count against
+func lockoutKeys(ip, username string) []string {
+	keys := []string{LockoutAddress + ":" + ip}
+	if username != "" {
+		keys = append(keys, LockoutUser+":"+username)
+	}
+	return keys
+}
+
+// shareKeys returns the keys wrong passwords for a share count against
+func shareKeys(ip, id string) []string {
+	return []string{LockoutAddress + ":" + ip, LockoutShare + ":" + id}
+}
+
+// Check returns how long the client address or the username is still
+// locked out, or 0
+func (l *Lockouts) Check(ip, username string) time.Duration {
+	return l.check(ip, lockoutKeys(ip, username))
+}
+
+// CheckShare returns how long the client address or the share is still
+// locked out, or 0
+func (l *Lockouts) CheckShare(ip, id string) time.Duration {
+	return l.check(ip, shareKeys(ip, id))
+}
+
+func (l *Lockouts) check(ip string, keys []string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.options.MaxFailures == 0 || l.allowed(ip) {
+		return 0
+	}
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		if entry, ok := l.entries[key]; ok && entry.until.After(now) {
+			wait = max(wait, entry.until.Sub(now))
+		}
+	}
+	return wait
+}
+
+// Fail counts a failed login. It returns the lockout the failure started,
+// or 0.
+func (l *Lockouts) Fail(ip, username string) time.Duration {
+	return l.fail(ip, lockoutKeys(ip, username))
+}
+
+// FailShare counts a wrong password for a share link. It returns the
+// lockout the failure started, or 0.
+func (l *Lockouts) FailShare(ip, id string) time.Duration {
+	return l.fail(ip, shareKeys(ip, id))
+}
+
+func (l *Lockouts) fail(ip string, keys []string) time.Duration {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.options.MaxFailures == 0 || l.allowed(ip) {
+		return 0
+	}
+	now := time.Now()
+	if len(l.entries) >= maxTracked {
+		l.prune(now)
+	}
+
+	var started time.Duration
+	for _, key := range keys {
+		entry, ok := l.entries[key]
+		if !ok || now.Sub(entry.last) > l.options.MaxLockout && entry.until.Before(now) {
+			entry = &failures{}
+			l.entries[key] = entry
+		}
+		entry.count++
+		entry.last = now
+		if excess := entry.count - l.options.MaxFailures; excess >= 0 {
+			lockout := l.options.MaxLockout
+			if excess < 30 && l.options.Lockout<<excess < lockout {
+				lockout = l.options.Lockout << excess
+			}
+			entry.until = now.Add(lockout)
+			started = max(started, lockout)
+		}
+	}
+	return started
+}
+
+// prune forgets failures that no longer count, and when too many clients
+// are still tracked, all but the lockouts. Should lockouts alone still fill
+// the table, as when guessing sprays random usernames, those closest to
+// ending are lifted early. The caller holds the mutex.
+func (l *Lockouts) prune(now time.Time) {
+	for key, entry := range l.entries {
+		if now.Sub(entry.last) > l.options.MaxLockout && entry.until.Before(now) {
+			delete(l.entries, key)
+		}
+	}
+	if len(l.entries) < maxTracked {
+		return
+	}
+	for key, entry := range l.entries {
+		if entry.until.Before(now) {
+			delete(l.entries, key)
+		}
+	}
+	if len(l.entries) < maxTracked {
+		return
+	}
+
+	keys := make([]string, 0, len(l.entries))
+	for key := range l.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return l.entries[keys[i]].until.Before(l.entries[keys[j]].until)
+	})
+	// Make room for a while rather than for a single failure
+	for _, key := range keys[:len(keys)-maxTracked*9/10] {
+		delete(l.entries, key)
+	}
+}
+
+// Succeed forgets the failures of a client that signed in after failing:
+// those of its address and those of the username it signed in as. Clients
+// without failures of their own, such as a WebDAV client that signs in with
+// every request, leave the username's failures alone, so that they cannot
+// keep lifting a lockout built up by guesses from elsewhere.
+func (l *Lockouts) Succeed(ip, username string) {
+	l.succeed(ip, lockoutKeys(ip, username))
+}
+
+// SucceedShare forgets the failures of a client that opened a share with
+// its password after failing, like Succeed
+func (l *Lockouts) SucceedShare(ip, id string) {
+	l.succeed(ip, shareKeys(ip, id))
+}
+
+func (l *Lockouts) succeed(ip string, keys []string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if _, failed := l.entries[LockoutAddress+":"+ip]; !failed {
+		return
+	}
+	for _, key := range keys {
+		delete(l.entries, key)
+	}
+}
+
+// List returns the current lockouts, longest first
+func (l *Lockouts) List() []Lockout {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	now := time.Now()
+	lockouts := []Lockout{}
+	for key, entry := range l.entries {
+		if !entry.until.After(now) {
+			continue
+		}
+		kind, subject, _ := strings.Cut(key, ":")
+		lockouts = append(lockouts, Lockout{Key: key, Kind: kind, Subject: subject, Failures: entry.count, Until: entry.until})
+	}
+	sort.Slice(lockouts, func(i, j int) bool {
+		if !lockouts[i].Until.Equal(lockouts[j].Until) {
+			return lockouts[i].Until.After(lockouts[j].Until)
+		}
+		return lockouts[i].Key < lockouts[j].Key
+	})
+	return lockouts
+}
+
+// Unlock lifts a lockout and forgets the failures that led to it
+func (l *Lockouts) Unlock(key string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	entry, ok := l.entries[key]
+	if !ok || !entry.until.After(time.Now()) {
+		return ErrLockoutNotFound
+	}
+	delete(l.entries, key)
+	return nil
+}
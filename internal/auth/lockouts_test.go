@@ -0,0 +1,182 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func TestLockouts(t *testing.T) {
+	if _, err := NewLockouts(LockoutOptions{MaxFailures: 3, Lockout: time.Minute, MaxLockout: time.Hour, Allowlist: []string{"not-an-ip"}}); err == nil {
+		t.Error("Expected an invalid allowlist entry to be refused")
+	}
+	lockouts, err := NewLockouts(LockoutOptions{MaxFailures: 3, Lockout: time.Minute, MaxLockout: 5 * time.Minute, Allowlist: []string{"10.0.0.0/8", "::1"}})
+	if err != nil {
+		t.Fatalf("NewLockouts failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if lockout := lockouts.Fail("192.0.2.1", "alice"); lockout != 0 {
+			t.Fatalf("Failure %d locked out for %v", i+1, lockout)
+		}
+	}
+	if wait := lockouts.Check("192.0.2.1", "alice"); wait != 0 {
+		t.Fatalf("Expected no lockout before the limit, got %v", wait)
+	}
+	if lockout := lockouts.Fail("192.0.2.1", "alice"); lockout != time.Minute {
+		t.Fatalf("Expected the third failure to lock out for a minute, got %v", lockout)
+	}
+	// Both the address and the username are locked out
+	if wait := lockouts.Check("192.0.2.1", ""); wait <= 0 || wait > time.Minute {
+		t.Errorf("Expected the address to be locked out, got %v", wait)
+	}
+	if wait := lockouts.Check("198.51.100.7", "alice"); wait <= 0 {
+		t.Errorf("Expected the username to be locked out from any address, got %v", wait)
+	}
+	if wait := lockouts.Check("198.51.100.7", "bob"); wait != 0 {
+		t.Errorf("Expected other clients to be let in, got %v", wait)
+	}
+
+	// Every further failure doubles the lockout, up to the maximum
+	if lockout := lockouts.Fail("192.0.2.1", "alice"); lockout != 2*time.Minute {
+		t.Errorf("Expected the lockout to double, got %v", lockout)
+	}
+	for i := 0; i < 3; i++ {
+		lockouts.Fail("192.0.2.1", "alice")
+	}
+	if lockout := lockouts.Fail("192.0.2.1", "alice"); lockout != 5*time.Minute {
+		t.Errorf("Expected the lockout to be capped, got %v", lockout)
+	}
+
+	list := lockouts.List()
+	if len(list) != 2 || list[0].Failures != 8 {
+		t.Fatalf("Unexpected lockouts %+v", list)
+	}
+	if err := lockouts.Unlock(LockoutUser + ":alice"); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if err := lockouts.Unlock(LockoutUser + ":alice"); !errors.Is(err, ErrLockoutNotFound) {
+		t.Errorf("Expected ErrLockoutNotFound, got %v", err)
+	}
+	if wait := lockouts.Check("198.51.100.7", "alice"); wait != 0 {
+		t.Errorf("Expected alice to be unlocked, got %v", wait)
+	}
+	if list := lockouts.List(); len(list) != 1 || list[0].Kind != LockoutAddress || list[0].Subject != "192.0.2.1" {
+		t.Errorf("Unexpected lockouts %+v", list)
+	}
+
+	// Allowlisted addresses are neither counted nor locked out
+	for i := 0; i < 5; i++ {
+		if lockout := lockouts.Fail("10.1.2.3", "carol"); lockout != 0 {
+			t.Fatalf("Allowlisted address locked out for %v", lockout)
+		}
+	}
+	if wait := lockouts.Check("::1", "alice"); wait != 0 {
+		t.Errorf("Expected an allowlisted address to be let in, got %v", wait)
+	}
+
+	// A successful login forgets earlier failures
+	lockouts.Fail("203.0.113.9", "dave")
+	lockouts.Fail("203.0.113.9", "dave")
+	lockouts.Succeed("203.0.113.9", "dave")
+	if lockout := lockouts.Fail("203.0.113.9", "dave"); lockout != 0 {
+		t.Errorf("Expected failures to be forgotten after a success, got %v", lockout)
+	}
+
+	// Signing in from an address without failures leaves the username's alone
+	lockouts.Fail("203.0.113.10", "erin")
+	lockouts.Fail("203.0.113.11", "erin")
+	lockouts.Succeed("198.51.100.20", "erin")
+	if lockout := lockouts.Fail("203.0.113.12", "erin"); lockout != time.Minute {
+		t.Errorf("Expected a client without failures not to lift the username's, got %v", lockout)
+	}
+
+	// Wrong share passwords lock the share out from any address, while
+	// logins and other shares go on
+	for _, ip := range []string{"203.0.113.20", "203.0.113.21", "203.0.113.22"} {
+		lockouts.FailShare(ip, "abc")
+	}
+	if wait := lockouts.CheckShare("198.51.100.30", "abc"); wait <= 0 {
+		t.Errorf("Expected the share to be locked out, got %v", wait)
+	}
+	if wait := lockouts.CheckShare("198.51.100.30", "def"); wait != 0 {
+		t.Errorf("Expected other shares to be let in, got %v", wait)
+	}
+	if wait := lockouts.Check("198.51.100.30", "abc"); wait != 0 {
+		t.Errorf("Expected a share lockout to leave the username alone, got %v", wait)
+	}
+	if err := lockouts.Unlock(LockoutShare + ":abc"); err != nil {
+		t.Errorf("Expected share lockouts to be listed and lifted, got %v", err)
+	}
+
+	// Zero failures turns lockouts off
+	if err := lockouts.Configure(LockoutOptions{}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if wait := lockouts.Check("192.0.2.1", ""); wait != 0 {
+		t.Errorf("Expected disabled lockouts to let everyone in, got %v", wait)
+	}
+}
+
+func TestLockouts_Bounded(t *testing.T) {
+	lockouts, err := NewLockouts(LockoutOptions{MaxFailures: 1, Lockout: time.Minute, MaxLockout: time.Hour})
+	if err != nil {
+		t.Fatalf("NewLockouts failed: %v", err)
+	}
+	// Spraying random usernames locks every one of them out
+	for i := 0; i < maxTracked+500; i++ {
+		lockouts.Fail("192.0.2.1", fmt.Sprintf("user%d", i))
+	}
+	if len(lockouts.entries) > maxTracked {
+		t.Errorf("Expected at most %d tracked clients, got %d", maxTracked, len(lockouts.entries))
+	}
+	if wait := lockouts.Check("192.0.2.1", ""); wait < time.Hour-time.Minute {
+		t.Errorf("Expected the spraying address to stay locked out, got %v", wait)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	audit := NewAudit(store)
+
+	success := types.LoginEvent{Username: "alice", ClientIP: "192.0.2.1", Method: MethodPassword, Success: true}
+	audit.Record(success)
+	// Repeated successes are recorded once
+	audit.Record(success)
+	audit.Record(types.LoginEvent{Username: "alice", ClientIP: "192.0.2.1", Reason: ErrInvalidCredentials.Error()})
+	// but the first success after a failure is recorded again
+	audit.Record(success)
+
+	events, err := audit.List(10, false)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	if !events[0].Success || events[1].Success || !events[2].Success {
+		t.Errorf("Expected events newest first, got %+v", events)
+	}
+	if events[0].ID == "" || events[0].Time.IsZero() {
+		t.Errorf("Expected events to get an ID and time, got %+v", events[0])
+	}
+
+	failed, err := audit.List(10, true)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(failed) != 1 || failed[0].Reason != ErrInvalidCredentials.Error() {
+		t.Errorf("Expected only the failure, got %+v", failed)
+	}
+	if limited, _ := audit.List(1, false); len(limited) != 1 || !limited[0].Success {
+		t.Errorf("Expected the newest event only, got %+v", limited)
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"proxydav/internal/forwarded"
+	"proxydav/pkg/types"
+)
+
+// Default headers a reverse proxy names the user it authenticated in
+const (
+	DefaultProxyUserHeader   = "X-Forwarded-User"
+	DefaultProxyGroupsHeader = "X-Forwarded-Groups"
+)
+
+// ProxyOptions configure which proxies are trusted to authenticate users
+// and how their headers map to a user
+type ProxyOptions struct {
+	Proxies      *forwarded.Proxies
+	UserHeader   string
+	GroupsHeader string // comma-separated groups
+	// RoleMap maps groups to roles; users in no mapped group are readers
+	RoleMap map[string]string
+}
+
+// ProxyAuth trusts the user a reverse proxy such as oauth2-proxy names in a
+// header, for requests that come from one of the trusted proxies
+type ProxyAuth struct {
+	options ProxyOptions
+	users   *Users
+}
+
+// NewProxyAuth returns an authenticator for identity headers of trusted
+// proxies. A disabled account refuses users of the same name.
+func NewProxyAuth(options ProxyOptions, users *Users) (*ProxyAuth, error) {
+	if options.Proxies.Len() == 0 {
+		return nil, fmt.Errorf("at least one trusted proxy is required")
+	}
+	if options.UserHeader == "" {
+		options.UserHeader = DefaultProxyUserHeader
+	}
+	if options.GroupsHeader == "" {
+		options.GroupsHeader = DefaultProxyGroupsHeader
+	}
+	return &ProxyAuth{options: options, users: users}, nil
+}
+
+func (a *ProxyAuth) Authenticate(r *http.Request) (*Identity, error) {
+	// Anyone else could send the header themselves
+	if !a.options.Proxies.Trusts(r.RemoteAddr) {
+		return nil, ErrNoCredentials
+	}
+	username := strings.TrimSpace(r.Header.Get(a.options.UserHeader))
+	if username == "" {
+		return nil, ErrNoCredentials
+	}
+	if err := ValidateName("username", username); err != nil {
+		return nil, fmt.Errorf("%w: %s header: %v", ErrInvalidCredentials, a.options.UserHeader, err)
+	}
+
+	account, err := a.users.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil && account.Disabled {
+		return nil, fmt.Errorf("%w: the account %s is disabled", ErrInvalidCredentials, username)
+	}
+
+	var values []string
+	for _, header := range r.Header.Values(a.options.GroupsHeader) {
+		for _, group := range strings.Split(header, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				values = append(values, group)
+			}
+		}
+	}
+	groups := groupNames(values)
+	user := &types.User{Username: username, Role: mapRole(a.options.RoleMap, groups, false), Groups: groups}
+	return &Identity{User: user, Method: MethodProxy, Principal: "🔀 " + username}, nil
+}
+
+// Challenge is empty: the proxy signs users in, ProxyDAV cannot ask them
+func (a *ProxyAuth) Challenge(error) string {
+	return ""
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"proxydav/internal/forwarded"
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func TestProxyAuth(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	users := NewUsers(store)
+
+	if _, err := NewProxyAuth(ProxyOptions{}, users); err == nil {
+		t.Error("Expected proxy authentication to require trusted proxies")
+	}
+	proxies, _ := forwarded.ParseProxies([]string{"10.0.0.0/8"})
+	proxyAuth, err := NewProxyAuth(ProxyOptions{
+		Proxies: proxies,
+		RoleMap: map[string]string{"dav-admins": types.RoleAdmin, "dav-editors": types.RoleEditor},
+	}, users)
+	if err != nil {
+		t.Fatalf("NewProxyAuth failed: %v", err)
+	}
+
+	request := func(remoteAddr, user, groups string) *Identity {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = remoteAddr
+		if user != "" {
+			req.Header.Set(DefaultProxyUserHeader, user)
+		}
+		if groups != "" {
+			req.Header.Set(DefaultProxyGroupsHeader, groups)
+		}
+		identity, err := proxyAuth.Authenticate(req)
+		if err != nil {
+			t.Errorf("Authenticate(%s, %s) failed: %v", remoteAddr, user, err)
+		}
+		return identity
+	}
+
+	identity := request("10.0.0.5:4000", "alice", "/staff, dav-editors, reader")
+	if identity == nil || identity.User.Username != "alice" || identity.User.Role != types.RoleEditor || identity.Method != MethodProxy {
+		t.Fatalf("Unexpected identity %+v", identity)
+	}
+	if !reflect.DeepEqual(identity.User.Groups, []string{"dav-editors", "reader", "staff"}) {
+		t.Errorf("Unexpected groups %v", identity.User.Groups)
+	}
+	// Group names are not roles unless mapped
+	if identity := request("10.0.0.5:4000", "bob", "admin"); identity == nil || identity.User.Role != types.RoleReader {
+		t.Errorf("Expected unmapped groups to leave the reader role, got %+v", identity)
+	}
+
+	for name, test := range map[string]struct{ remoteAddr, user string }{
+		"untrusted peer": {"203.0.113.9:4000", "alice"},
+		"no user header": {"10.0.0.5:4000", ""},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.user != "" {
+			req.Header.Set(DefaultProxyUserHeader, test.user)
+		}
+		if _, err := proxyAuth.Authenticate(req); !errors.Is(err, ErrNoCredentials) {
+			t.Errorf("%s: expected ErrNoCredentials, got %v", name, err)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:4000"
+	req.Header.Set(DefaultProxyUserHeader, "token:x")
+	if _, err := proxyAuth.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected an invalid username to be refused, got %v", err)
+	}
+
+	// A disabled account of the same name refuses the proxy's user
+	account, _ := users.Create("alice", "alice-password", types.RoleReader, nil)
+	account.Disabled = true
+	store.SetUser(account)
+	req.Header.Set(DefaultProxyUserHeader, "alice")
+	if _, err := proxyAuth.Authenticate(req); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a disabled account to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+var (
+	// ErrShareUnavailable is returned for unknown, revoked and expired shares alike
+	ErrShareUnavailable = errors.New("share not found or expired")
+	ErrShareNotFound    = errors.New("share not found")
+	ErrSharePassword    = errors.New("share password required")
+	ErrDownloadLimit    = errors.New("share download limit reached")
+)
+
+// Shares manages the public share links kept in the store
+type Shares struct {
+	store *storage.PersistentStore
+
+	mutex sync.Mutex // serializes counter updates
+
+	cacheMutex sync.Mutex
+	verified   map[[sha256.Size]byte]time.Time
+}
+
+func NewShares(store *storage.PersistentStore) *Shares {
+	return &Shares{store: store, verified: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// ShareRequest describes a share to create
+type ShareRequest struct {
+	Path         string    `json:"path"`
+	Password     string    `json:"password"`
+	Listing      bool      `json:"listing"`
+	MaxDownloads int       `json:"max_downloads"`
+	Expires      time.Time `json:"expires"`
+}
+
+// List returns all shares ordered by path
+func (s *Shares) List() ([]types.Share, error) {
+	shares, err := s.store.GetAllShares()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Path != shares[j].Path {
+			return shares[i].Path < shares[j].Path
+		}
+		return shares[i].Created.Before(shares[j].Created)
+	})
+	return shares, nil
+}
+
+// Create stores a new share. Callers check that the path exists.
+func (s *Shares) Create(request ShareRequest, createdBy string) (*types.Share, error) {
+	if strings.TrimSpace(request.Path) == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	if request.MaxDownloads < 0 {
+		return nil, fmt.Errorf("maximum downloads cannot be negative")
+	}
+	if !request.Expires.IsZero() && !request.Expires.After(time.Now()) {
+		return nil, fmt.Errorf("expiry must be in the future")
+	}
+
+	share := &types.Share{
+		Path:         path.Clean("/" + strings.TrimPrefix(strings.TrimSpace(request.Path), "/")),
+		Listing:      request.Listing,
+		MaxDownloads: request.MaxDownloads,
+		CreatedBy:    createdBy,
+		Created:      time.Now().UTC(),
+		Expires:      request.Expires.UTC(),
+	}
+	if request.Password != "" {
+		if len(request.Password) < MinPasswordLength {
+			return nil, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+		}
+		hash, err := hashPassword(request.Password)
+		if err != nil {
+			return nil, err
+		}
+		share.PasswordHash = hash
+	}
+
+	id, err := randomString(16, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return nil, err
+	}
+	share.ID = id
+
+	if err := s.store.SetShare(share); err != nil {
+		return nil, err
+	}
+	return share, nil
+}
+
+// Revoke deletes a share
+func (s *Shares) Revoke(id string) error {
+	share, err := s.store.GetShare(id)
+	if err != nil {
+		return err
+	}
+	if share == nil {
+		return fmt.Errorf("%w: %s", ErrShareNotFound, id)
+	}
+	if err := s.store.DeleteShare(id); err != nil {
+		return fmt.Errorf("failed to revoke share: %w", err)
+	}
+	return nil
+}
+
+// Open returns a share that can be used with password. Shares without a
+// password ignore it.
+func (s *Shares) Open(id, password string) (*types.Share, error) {
+	share, err := s.store.GetShare(id)
+	if err != nil {
+		return nil, err
+	}
+	if share == nil || (!share.Expires.IsZero() && time.Now().After(share.Expires)) {
+		return nil, ErrShareUnavailable
+	}
+	if share.PasswordHash != "" && !s.checkPassword(share, password) {
+		return nil, ErrSharePassword
+	}
+	return share, nil
+}
+
+// Record counts an access to a share, and a download when download is set.
+// Downloads beyond the share's limit are refused with ErrDownloadLimit.
+func (s *Shares) Record(id string, download bool) (*types.Share, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	share, err := s.store.GetShare(id)
+	if err != nil {
+		return nil, err
+	}
+	if share == nil {
+		return nil, ErrShareUnavailable
+	}
+	if download && share.MaxDownloads > 0 && share.Downloads >= share.MaxDownloads {
+		return nil, ErrDownloadLimit
+	}
+
+	share.Accesses++
+	if download {
+		share.Downloads++
+	}
+	share.LastAccess = time.Now().UTC()
+	if err := s.store.SetShare(share); err != nil {
+		return nil, fmt.Errorf("failed to record share access: %w", err)
+	}
+	return share, nil
+}
+
+// checkPassword compares password with the share's, remembering matches
+// for a while as WebDAV clients send it with every request
+func (s *Shares) checkPassword(share *types.Share, password string) bool {
+	key := sha256.Sum256([]byte(share.ID + "\x00" + share.PasswordHash + "\x00" + password))
+	s.cacheMutex.Lock()
+	expires, cached := s.verified[key]
+	s.cacheMutex.Unlock()
+	if cached && time.Now().Before(expires) {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+		return false
+	}
+
+	s.cacheMutex.Lock()
+	if len(s.verified) >= maxVerified {
+		s.verified = make(map[[sha256.Size]byte]time.Time)
+	}
+	s.verified[key] = time.Now().Add(verifiedTTL)
+	s.cacheMutex.Unlock()
+	return true
+}
+
+// ShareToken is the read-only token a share's requests are made with, which
+// limits them to the shared path
+func ShareToken(share *types.Share) *types.APIToken {
+	return &types.APIToken{
+		ID:         share.ID,
+		Name:       "share:" + share.Path,
+		PathPrefix: share.Path,
+		Scopes:     []string{types.ScopeRead},
+	}
+}
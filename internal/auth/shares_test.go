@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"proxydav/internal/storage"
+)
+
+func TestShares(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	shares := NewShares(store)
+
+	share, err := shares.Create(ShareRequest{Path: "docs/", Password: "outsider-pass", MaxDownloads: 1}, "alice")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if share.Path != "/docs" || share.PasswordHash == "" || share.PasswordHash == "outsider-pass" || len(share.ID) < 20 {
+		t.Errorf("Unexpected share %+v", share)
+	}
+
+	for _, password := range []string{"", "wrong-password"} {
+		if _, err := shares.Open(share.ID, password); !errors.Is(err, ErrSharePassword) {
+			t.Errorf("Open with %q = %v, want ErrSharePassword", password, err)
+		}
+	}
+	if _, err := shares.Open(share.ID, "outsider-pass"); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if _, err := shares.Open("unknown", ""); !errors.Is(err, ErrShareUnavailable) {
+		t.Errorf("Expected an unknown share to be unavailable, got %v", err)
+	}
+
+	if _, err := shares.Record(share.ID, false); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if _, err := shares.Record(share.ID, true); err != nil {
+		t.Fatalf("Record of the first download failed: %v", err)
+	}
+	if _, err := shares.Record(share.ID, true); !errors.Is(err, ErrDownloadLimit) {
+		t.Errorf("Expected the second download to exceed the limit, got %v", err)
+	}
+	recorded, _ := store.GetShare(share.ID)
+	if recorded.Downloads != 1 || recorded.Accesses != 2 || recorded.LastAccess.IsZero() {
+		t.Errorf("Unexpected counts %+v", recorded)
+	}
+
+	invalid := []ShareRequest{
+		{},
+		{Path: "/docs", Password: "short"},
+		{Path: "/docs", MaxDownloads: -1},
+		{Path: "/docs", Expires: time.Now().Add(-time.Hour)},
+	}
+	for _, request := range invalid {
+		if _, err := shares.Create(request, ""); err == nil {
+			t.Errorf("Expected %+v to be rejected", request)
+		}
+	}
+
+	// Expiry is checked on use
+	expiring, _ := shares.Create(ShareRequest{Path: "/docs", Expires: time.Now().Add(time.Hour)}, "")
+	expiring.Expires = time.Now().Add(-time.Minute)
+	store.SetShare(expiring)
+	if _, err := shares.Open(expiring.ID, ""); !errors.Is(err, ErrShareUnavailable) {
+		t.Errorf("Expected an expired share to be unavailable, got %v", err)
+	}
+
+	if err := shares.Revoke(share.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := shares.Open(share.ID, "outsider-pass"); !errors.Is(err, ErrShareUnavailable) {
+		t.Errorf("Expected a revoked share to be unavailable, got %v", err)
+	}
+	if err := shares.Revoke(share.ID); !errors.Is(err, ErrShareNotFound) {
+		t.Errorf("Expected ErrShareNotFound, got %v", err)
+	}
+}
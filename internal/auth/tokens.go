@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+var (
+	// ErrInvalidToken is returned for unknown, revoked, expired and malformed tokens alike
+	ErrInvalidToken  = errors.New("invalid or expired token")
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// TokenPrefix starts every token, so leaked tokens are easy to recognize
+const TokenPrefix = "pdv_"
+
+// Last-used times are written at most this often, as every request of a
+// token would otherwise write to the store
+const lastUsedResolution = time.Minute
+
+// Tokens manages the API tokens kept in the store
+type Tokens struct {
+	store *storage.PersistentStore
+}
+
+func NewTokens(store *storage.PersistentStore) *Tokens {
+	return &Tokens{store: store}
+}
+
+// TokenRequest describes a token to create
+type TokenRequest struct {
+	Name       string    `json:"name"`
+	PathPrefix string    `json:"path_prefix"`
+	Scopes     []string  `json:"scopes"`
+	Expires    time.Time `json:"expires"`
+}
+
+// ValidScope reports whether scope is one of the token scopes
+func ValidScope(scope string) bool {
+	return scope == types.ScopeRead || scope == types.ScopeAdd || scope == types.ScopeDelete || scope == types.ScopeAdmin
+}
+
+// HasScope reports whether token grants scope. The admin scope grants all others.
+func HasScope(token *types.APIToken, scope string) bool {
+	for _, granted := range token.Scopes {
+		if granted == scope || granted == types.ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenRole is the account role a token acts with, given its scopes
+func TokenRole(token *types.APIToken) string {
+	switch {
+	case HasScope(token, types.ScopeAdmin):
+		return types.RoleAdmin
+	case HasScope(token, types.ScopeAdd) || HasScope(token, types.ScopeDelete):
+		return types.RoleEditor
+	}
+	return types.RoleReader
+}
+
+// TokenUser is the identity a token's requests are made as. Its name
+// cannot be taken by an account, so only "*" access rules apply to it.
+func TokenUser(token *types.APIToken) *types.User {
+	return &types.User{Username: "token:" + token.Name, Role: TokenRole(token)}
+}
+
+// List returns all tokens ordered by name
+func (t *Tokens) List() ([]types.APIToken, error) {
+	tokens, err := t.store.GetAllAPITokens()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	return tokens, nil
+}
+
+// Create stores a new token and returns its secret, which is shown only once
+func (t *Tokens) Create(request TokenRequest, createdBy string) (string, *types.APIToken, error) {
+	name := strings.TrimSpace(request.Name)
+	if name == "" || len(name) > 64 {
+		return "", nil, fmt.Errorf("name must be 1 to 64 characters")
+	}
+	if len(request.Scopes) == 0 {
+		return "", nil, fmt.Errorf("at least one scope is required (read, add, delete or admin)")
+	}
+	scopes := make([]string, 0, len(request.Scopes))
+	for _, scope := range request.Scopes {
+		if !ValidScope(scope) {
+			return "", nil, fmt.Errorf("unknown scope %q (use read, add, delete or admin)", scope)
+		}
+		scopes = append(scopes, scope)
+	}
+	if !request.Expires.IsZero() && !request.Expires.After(time.Now()) {
+		return "", nil, fmt.Errorf("expiry must be in the future")
+	}
+	prefix := path.Clean("/" + strings.TrimPrefix(strings.TrimSpace(request.PathPrefix), "/"))
+
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	token := &types.APIToken{
+		ID:         id,
+		Name:       name,
+		Hash:       hashSecret(secret),
+		PathPrefix: prefix,
+		Scopes:     scopes,
+		CreatedBy:  createdBy,
+		Created:    time.Now().UTC(),
+		Expires:    request.Expires.UTC(),
+	}
+	if err := t.store.SetAPIToken(token); err != nil {
+		return "", nil, err
+	}
+	return TokenPrefix + id + "_" + secret, token, nil
+}
+
+// Revoke deletes a token
+func (t *Tokens) Revoke(id string) error {
+	token, err := t.store.GetAPIToken(id)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, id)
+	}
+	if err := t.store.DeleteAPIToken(id); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+	return nil
+}
+
+// Authenticate checks a bearer token and records its use
+func (t *Tokens) Authenticate(bearer string) (*types.APIToken, error) {
+	rest, ok := strings.CutPrefix(bearer, TokenPrefix)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := t.store.GetAPIToken(id)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidToken
+	}
+	now := time.Now().UTC()
+	if !token.Expires.IsZero() && now.After(token.Expires) {
+		return nil, ErrInvalidToken
+	}
+
+	if now.Sub(token.LastUsed) >= lastUsedResolution {
+		token.LastUsed = now
+		if err := t.store.SetAPIToken(token); err != nil {
+			log.Printf("⚠️  Failed to record use of token %s: %v", token.Name, err)
+		}
+	}
+	return token, nil
+}
+
+// InScope reports whether itemPath lies within a token's path prefix
+func InScope(token *types.APIToken, itemPath string) bool {
+	return token.PathPrefix == "/" || itemPath == token.PathPrefix || strings.HasPrefix(itemPath, token.PathPrefix+"/")
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(size int, encode func([]byte) string) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return encode(buf), nil
+}
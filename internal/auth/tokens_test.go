@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func TestTokens(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	tokens := NewTokens(store)
+
+	secret, token, err := tokens.Create(TokenRequest{Name: "ci", PathPrefix: "builds/", Scopes: []string{types.ScopeRead, types.ScopeAdd}}, "alice")
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if !strings.HasPrefix(secret, TokenPrefix) || strings.Contains(token.Hash, secret) || token.PathPrefix != "/builds" {
+		t.Errorf("Unexpected token %q: %+v", secret, token)
+	}
+
+	authenticated, err := tokens.Authenticate(secret)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if authenticated.Name != "ci" || authenticated.LastUsed.IsZero() {
+		t.Errorf("Expected the use to be recorded, got %+v", authenticated)
+	}
+	if TokenRole(authenticated) != types.RoleEditor || HasScope(authenticated, types.ScopeDelete) {
+		t.Errorf("Unexpected scopes %v", authenticated.Scopes)
+	}
+
+	for _, bearer := range []string{"", "pdv_", secret + "x", strings.TrimPrefix(secret, TokenPrefix), TokenPrefix + "unknown_secret"} {
+		if _, err := tokens.Authenticate(bearer); !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("Authenticate(%q) = %v, want ErrInvalidToken", bearer, err)
+		}
+	}
+
+	invalid := []TokenRequest{
+		{Name: "", Scopes: []string{types.ScopeRead}},
+		{Name: "none"},
+		{Name: "bad", Scopes: []string{"write"}},
+		{Name: "past", Scopes: []string{types.ScopeRead}, Expires: time.Now().Add(-time.Hour)},
+	}
+	for _, request := range invalid {
+		if _, _, err := tokens.Create(request, ""); err == nil {
+			t.Errorf("Expected %+v to be rejected", request)
+		}
+	}
+
+	// Expiry is checked on use
+	expiring, expiringToken, _ := tokens.Create(TokenRequest{Name: "soon", Scopes: []string{types.ScopeAdmin}, Expires: time.Now().Add(time.Hour)}, "")
+	expiringToken.Expires = time.Now().Add(-time.Minute)
+	store.SetAPIToken(expiringToken)
+	if _, err := tokens.Authenticate(expiring); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected an expired token to be refused, got %v", err)
+	}
+
+	if err := tokens.Revoke(token.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := tokens.Authenticate(secret); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected a revoked token to be refused, got %v", err)
+	}
+	if err := tokens.Revoke(token.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("Expected ErrTokenNotFound, got %v", err)
+	}
+}
+
+func TestInScope(t *testing.T) {
+	token := &types.APIToken{PathPrefix: "/builds"}
+	tests := map[string]bool{
+		"/builds":          true,
+		"/builds/a.zip":    true,
+		"/builds-old/a":    false,
+		"/":                false,
+		"/other/builds/x1": false,
+	}
+	for itemPath, want := range tests {
+		if got := InScope(token, itemPath); got != want {
+			t.Errorf("InScope(%s) = %v, want %v", itemPath, got, want)
+		}
+	}
+	if !InScope(&types.APIToken{PathPrefix: "/"}, "/anything") {
+		t.Error("Expected a root prefix to cover everything")
+	}
+}
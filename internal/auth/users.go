@@ -0,0 +1,357 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+var (
+	// ErrInvalidCredentials is returned for unknown users, wrong passwords and disabled accounts alike
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserExists         = errors.New("user already exists")
+	ErrUserNotFound       = errors.New("user not found")
+	// ErrLastAdmin is returned by changes that would leave no enabled admin account
+	ErrLastAdmin = errors.New("at least one enabled admin account is required")
+)
+
+// MinPasswordLength applies to passwords set through Create and Update
+const MinPasswordLength = 8
+
+// Successful logins are remembered for a while so that WebDAV clients,
+// which send credentials with every request, don't pay for bcrypt each time
+const (
+	verifiedTTL = 5 * time.Minute
+	maxVerified = 1024
+)
+
+// Users manages the accounts kept in the store
+type Users struct {
+	store *storage.PersistentStore
+
+	mutex sync.Mutex // serializes changes so the last-admin check holds
+
+	cacheMutex sync.Mutex
+	verified   map[[sha256.Size]byte]verifiedLogin
+}
+
+type verifiedLogin struct {
+	username string
+	expires  time.Time
+}
+
+func NewUsers(store *storage.PersistentStore) *Users {
+	return &Users{store: store, verified: make(map[[sha256.Size]byte]verifiedLogin)}
+}
+
+// ValidRole reports whether role is one of the account roles
+func ValidRole(role string) bool {
+	return role == types.RoleReader || role == types.RoleEditor || role == types.RoleAdmin
+}
+
+// Allows reports whether role grants at least the privileges of required
+func Allows(role, required string) bool {
+	rank := map[string]int{types.RoleReader: 1, types.RoleEditor: 2, types.RoleAdmin: 3}
+	return rank[role] > 0 && rank[role] >= rank[required]
+}
+
+// ValidateName checks a username or group name, which kind names in errors
+func ValidateName(kind, name string) error {
+	if name == "" || len(name) > 64 {
+		return fmt.Errorf("%s must be 1 to 64 characters", kind)
+	}
+	if strings.ContainsAny(name, ":/") || strings.IndexFunc(name, func(r rune) bool { return r <= ' ' || r == 0x7f }) >= 0 {
+		return fmt.Errorf("%s cannot contain spaces, control characters, ':' or '/'", kind)
+	}
+	// ACL rules name groups as "@group" and everyone as "*"
+	if strings.HasPrefix(name, "@") || name == "*" {
+		return fmt.Errorf("%s cannot start with '@' or be '*'", kind)
+	}
+	return nil
+}
+
+// normalizeGroups validates and sorts group names, dropping blanks and duplicates
+func normalizeGroups(groups []string) ([]string, error) {
+	var normalized []string
+	seen := make(map[string]bool)
+	for _, group := range groups {
+		group = strings.TrimSpace(group)
+		if group == "" || seen[group] {
+			continue
+		}
+		if err := ValidateName("group name", group); err != nil {
+			return nil, err
+		}
+		seen[group] = true
+		normalized = append(normalized, group)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// List returns all accounts ordered by name
+func (u *Users) List() ([]types.User, error) {
+	users, err := u.store.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+func (u *Users) Get(username string) (*types.User, error) {
+	user, err := u.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserNotFound, username)
+	}
+	return user, nil
+}
+
+// HasAdmin reports whether an enabled admin account exists
+func (u *Users) HasAdmin() (bool, error) {
+	users, err := u.store.GetAllUsers()
+	if err != nil {
+		return false, err
+	}
+	for _, user := range users {
+		if user.Role == types.RoleAdmin && !user.Disabled {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (u *Users) Create(username, password, role string, groups []string) (*types.User, error) {
+	if len(password) < MinPasswordLength {
+		return nil, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+	}
+	return u.create(username, password, role, groups)
+}
+
+func (u *Users) create(username, password, role string, groups []string) (*types.User, error) {
+	if err := ValidateName("username", username); err != nil {
+		return nil, err
+	}
+	if !ValidRole(role) {
+		return nil, fmt.Errorf("unknown role %q (use reader, editor or admin)", role)
+	}
+	groups, err := normalizeGroups(groups)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	existing, err := u.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUserExists, username)
+	}
+	user := &types.User{Username: username, PasswordHash: hash, Role: role, Groups: groups, Created: time.Now().UTC()}
+	if err := u.store.SetUser(user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UserUpdate lists the fields Update changes; nil fields are kept
+type UserUpdate struct {
+	Password *string   `json:"password,omitempty"`
+	Role     *string   `json:"role,omitempty"`
+	Groups   *[]string `json:"groups,omitempty"`
+	Disabled *bool     `json:"disabled,omitempty"`
+}
+
+func (u *Users) Update(username string, update UserUpdate) (*types.User, error) {
+	var hash string
+	if update.Password != nil {
+		if len(*update.Password) < MinPasswordLength {
+			return nil, fmt.Errorf("password must be at least %d characters", MinPasswordLength)
+		}
+		var err error
+		if hash, err = hashPassword(*update.Password); err != nil {
+			return nil, err
+		}
+	}
+	if update.Role != nil && !ValidRole(*update.Role) {
+		return nil, fmt.Errorf("unknown role %q (use reader, editor or admin)", *update.Role)
+	}
+	var groups []string
+	if update.Groups != nil {
+		var err error
+		if groups, err = normalizeGroups(*update.Groups); err != nil {
+			return nil, err
+		}
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	user, err := u.Get(username)
+	if err != nil {
+		return nil, err
+	}
+	wasAdmin := user.Role == types.RoleAdmin && !user.Disabled
+	if hash != "" {
+		user.PasswordHash = hash
+	}
+	if update.Role != nil {
+		user.Role = *update.Role
+	}
+	if update.Groups != nil {
+		user.Groups = groups
+	}
+	if update.Disabled != nil {
+		user.Disabled = *update.Disabled
+	}
+	if wasAdmin && (user.Role != types.RoleAdmin || user.Disabled) {
+		if err := u.requireOtherAdmin(username); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := u.store.SetUser(user); err != nil {
+		return nil, err
+	}
+	u.forgetLogins()
+	return user, nil
+}
+
+func (u *Users) Delete(username string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	user, err := u.Get(username)
+	if err != nil {
+		return err
+	}
+	if user.Role == types.RoleAdmin && !user.Disabled {
+		if err := u.requireOtherAdmin(username); err != nil {
+			return err
+		}
+	}
+	if err := u.store.DeleteUser(username); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	u.forgetLogins()
+	return nil
+}
+
+// requireOtherAdmin fails unless an enabled admin other than username exists
+func (u *Users) requireOtherAdmin(username string) error {
+	users, err := u.store.GetAllUsers()
+	if err != nil {
+		return err
+	}
+	for _, other := range users {
+		if other.Username != username && other.Role == types.RoleAdmin && !other.Disabled {
+			return nil
+		}
+	}
+	return ErrLastAdmin
+}
+
+// Authenticate checks a username and password and records the login
+func (u *Users) Authenticate(username, password string) (*types.User, error) {
+	key := sha256.Sum256([]byte(username + "\x00" + password))
+	u.cacheMutex.Lock()
+	login, cached := u.verified[key]
+	u.cacheMutex.Unlock()
+	if cached && time.Now().Before(login.expires) && login.username == username {
+		user, err := u.store.GetUser(username)
+		if err == nil && user != nil && !user.Disabled {
+			return user, nil
+		}
+	}
+
+	user, err := u.store.GetUser(username)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		// Spend the same time as for a wrong password
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil || user.Disabled {
+		return nil, ErrInvalidCredentials
+	}
+
+	user.LastLogin = time.Now().UTC()
+	if err := u.store.SetUser(user); err != nil {
+		log.Printf("⚠️  Failed to record login of %s: %v", username, err)
+	}
+
+	u.cacheMutex.Lock()
+	if len(u.verified) >= maxVerified {
+		u.verified = make(map[[sha256.Size]byte]verifiedLogin)
+	}
+	u.verified[key] = verifiedLogin{username: username, expires: time.Now().Add(verifiedTTL)}
+	u.cacheMutex.Unlock()
+	return user, nil
+}
+
+// forgetLogins makes the next request of every user check its password again
+func (u *Users) forgetLogins() {
+	u.cacheMutex.Lock()
+	defer u.cacheMutex.Unlock()
+	u.verified = make(map[[sha256.Size]byte]verifiedLogin)
+}
+
+// Migrate creates an admin account from the single username and password
+// earlier versions kept in the configuration, unless accounts exist. It
+// reports whether it created one.
+func (u *Users) Migrate(username, password string) (bool, error) {
+	if username == "" || password == "" {
+		return false, nil
+	}
+	users, err := u.store.GetAllUsers()
+	if err != nil {
+		return false, err
+	}
+	if len(users) > 0 {
+		return false, nil
+	}
+	if _, err := u.create(username, password, types.RoleAdmin, nil); err != nil {
+		return false, fmt.Errorf("failed to migrate the configured credentials: %w", err)
+	}
+	return true, nil
+}
+
+var (
+	dummyOnce sync.Once
+	dummy     []byte
+)
+
+// dummyHash is compared against for unknown users
+func dummyHash() []byte {
+	dummyOnce.Do(func() {
+		dummy, _ = bcrypt.GenerateFromPassword([]byte("proxydav"), bcrypt.DefaultCost)
+	})
+	return dummy
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"proxydav/internal/storage"
+	"proxydav/pkg/types"
+)
+
+func newTestUsers(t *testing.T) *Users {
+	t.Helper()
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return NewUsers(store)
+}
+
+func TestUsers_Authenticate(t *testing.T) {
+	users := newTestUsers(t)
+
+	created, err := users.Create("alice", "correct horse", types.RoleEditor, nil)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if created.PasswordHash == "" || strings.Contains(created.PasswordHash, "correct horse") {
+		t.Errorf("Expected a password hash, got %q", created.PasswordHash)
+	}
+	if _, err := users.Create("alice", "another password", types.RoleReader, nil); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+	if _, err := users.Create("bob", "short", types.RoleReader, nil); err == nil {
+		t.Error("Expected a short password to be rejected")
+	}
+	if _, err := users.Create("bob:x", "long enough", types.RoleReader, nil); err == nil {
+		t.Error("Expected a username with ':' to be rejected")
+	}
+	if _, err := users.Create("bob", "long enough", "owner", nil); err == nil {
+		t.Error("Expected an unknown role to be rejected")
+	}
+
+	user, err := users.Authenticate("alice", "correct horse")
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if user.Role != types.RoleEditor || user.LastLogin.IsZero() {
+		t.Errorf("Unexpected user %+v", user)
+	}
+	if stored, _ := users.Get("alice"); stored.LastLogin.IsZero() {
+		t.Error("Expected the login to be recorded")
+	}
+
+	for _, credentials := range [][2]string{{"alice", "wrong"}, {"nobody", "correct horse"}, {"", ""}} {
+		if _, err := users.Authenticate(credentials[0], credentials[1]); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) = %v, want ErrInvalidCredentials", credentials[0], credentials[1], err)
+		}
+	}
+
+	disabled := true
+	if _, err := users.Update("alice", UserUpdate{Disabled: &disabled}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := users.Authenticate("alice", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected a disabled account to be refused, got %v", err)
+	}
+
+	enabled, password := false, "battery staple"
+	if _, err := users.Update("alice", UserUpdate{Disabled: &enabled, Password: &password}); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if _, err := users.Authenticate("alice", "correct horse"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected the old password to stop working, got %v", err)
+	}
+	if _, err := users.Authenticate("alice", "battery staple"); err != nil {
+		t.Errorf("Expected the new password to work, got %v", err)
+	}
+}
+
+func TestUsers_LastAdmin(t *testing.T) {
+	users := newTestUsers(t)
+
+	if _, err := users.Create("root", "admin password", types.RoleAdmin, nil); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if hasAdmin, _ := users.HasAdmin(); !hasAdmin {
+		t.Error("Expected HasAdmin to find the admin")
+	}
+
+	reader, disabled := types.RoleReader, true
+	if _, err := users.Update("root", UserUpdate{Role: &reader}); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected demoting the last admin to fail, got %v", err)
+	}
+	if _, err := users.Update("root", UserUpdate{Disabled: &disabled}); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected disabling the last admin to fail, got %v", err)
+	}
+	if err := users.Delete("root"); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected deleting the last admin to fail, got %v", err)
+	}
+
+	if _, err := users.Create("second", "admin password", types.RoleAdmin, nil); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if err := users.Delete("root"); err != nil {
+		t.Errorf("Expected deleting one of two admins to work, got %v", err)
+	}
+	if err := users.Delete("root"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestUsers_Migrate(t *testing.T) {
+	users := newTestUsers(t)
+
+	created, err := users.Migrate("legacy", "pw")
+	if err != nil || !created {
+		t.Fatalf("Expected the credential to be migrated, got %v, %v", created, err)
+	}
+	user, err := users.Authenticate("legacy", "pw")
+	if err != nil {
+		t.Fatalf("Expected the migrated account to keep its short password, got %v", err)
+	}
+	if user.Role != types.RoleAdmin {
+		t.Errorf("Expected the migrated account to be an admin, got %s", user.Role)
+	}
+
+	if created, _ := users.Migrate("other", "password"); created {
+		t.Error("Expected no migration once accounts exist")
+	}
+}
+
+func TestUsers_Groups(t *testing.T) {
+	users := newTestUsers(t)
+
+	user, err := users.Create("alice", "correct horse", types.RoleEditor, []string{"staff", " ", "editors", "staff"})
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if strings.Join(user.Groups, ",") != "editors,staff" {
+		t.Errorf("Expected sorted groups without duplicates, got %v", user.Groups)
+	}
+
+	for _, groups := range [][]string{{"@staff"}, {"*"}, {"a b"}} {
+		if _, err := users.Update("alice", UserUpdate{Groups: &groups}); err == nil {
+			t.Errorf("Expected groups %q to be rejected", groups)
+		}
+	}
+
+	none := []string{}
+	if user, err = users.Update("alice", UserUpdate{Groups: &none}); err != nil || len(user.Groups) != 0 {
+		t.Errorf("Expected groups to be cleared, got %v, %v", user.Groups, err)
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role, required string
+		want           bool
+	}{
+		{types.RoleAdmin, types.RoleEditor, true},
+		{types.RoleEditor, types.RoleEditor, true},
+		{types.RoleReader, types.RoleEditor, false},
+		{types.RoleEditor, types.RoleAdmin, false},
+		{"", types.RoleReader, false},
+	}
+	for _, tt := range tests {
+		if got := Allows(tt.role, tt.required); got != tt.want {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"proxydav/pkg/types"
+)
+
+// ErrNotFound is returned when a backend has no file at a URL
+var ErrNotFound = errors.New("file not found")
+
+// ErrTooLarge is returned when content exceeds a backend's size limit
+var ErrTooLarge = errors.New("content too large")
+
+// Backend serves entries whose URL scheme is not fetched over HTTP. HTTP
+// and HTTPS URLs are proxied by the WebDAV handler itself.
+type Backend interface {
+	// Stat returns the size, modification time and validators of a file
+	Stat(ctx context.Context, fileURL string) (*types.FileMetadata, error)
+	// Open returns the whole file for random access
+	Open(ctx context.Context, fileURL string) (io.ReadSeekCloser, error)
+	// ReadRange returns length bytes of a file starting at offset
+	ReadRange(ctx context.Context, fileURL string, offset, length int64) (io.ReadCloser, error)
+}
+
+// Writer is implemented by backends that can store new content
+type Writer interface {
+	// Put stores content and returns the URL it can be read from
+	Put(ctx context.Context, content io.Reader) (string, error)
+}
+
+// Deleter is implemented by backends whose content is owned by its entries
+type Deleter interface {
+	// Delete removes stored content once no entry uses it anymore
+	Delete(ctx context.Context, fileURL string) error
+}
+
+// Registry maps URL schemes to backends
+type Registry struct {
+	mutex    sync.RWMutex
+	backends map[string]Backend
+}
+
+func NewRegistry() *Registry {
+	return &Registry{backends: make(map[string]Backend)}
+}
+
+// Register serves URLs with scheme from b, replacing any earlier backend
+func (r *Registry) Register(scheme string, b Backend) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.backends[strings.ToLower(scheme)] = b
+}
+
+// For returns the backend serving fileURL. A nil registry has no backends.
+func (r *Registry) For(fileURL string) (Backend, bool) {
+	if r == nil {
+		return nil, false
+	}
+	scheme := Scheme(fileURL)
+	if scheme == "" {
+		return nil, false
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	b, ok := r.backends[scheme]
+	return b, ok
+}
+
+// Writer returns the backend for scheme if it can store new content
+func (r *Registry) Writer(scheme string) (Writer, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	w, ok := r.backends[strings.ToLower(scheme)].(Writer)
+	return w, ok
+}
+
+// Release deletes content that no entry refers to anymore, if the backend
+// of its URL stores content
+func (r *Registry) Release(fileURL string) {
+	b, ok := r.For(fileURL)
+	if !ok {
+		return
+	}
+	deleter, ok := b.(Deleter)
+	if !ok {
+		return
+	}
+	if err := deleter.Delete(context.Background(), fileURL); err != nil {
+		log.Printf("⚠️  Failed to delete stored content %s: %v", fileURL, err)
+	}
+}
+
+// Schemes returns the registered schemes in order
+func (r *Registry) Schemes() []string {
+	if r == nil {
+		return nil
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	schemes := make([]string, 0, len(r.backends))
+	for scheme := range r.backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// Scheme returns the lowercased scheme of fileURL, or "" if it has none
+func Scheme(fileURL string) string {
+	scheme, _, ok := strings.Cut(fileURL, ":")
+	if !ok || scheme == "" {
+		return ""
+	}
+	for i, c := range scheme {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !isLetter && (i == 0 || !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.')) {
+			return ""
+		}
+	}
+	return strings.ToLower(scheme)
+}
+
+// readRange serves a range read from a file opened for random access
+func readRange(file io.ReadSeekCloser, offset, length int64) (io.ReadCloser, error) {
+	if offset < 0 || length < 0 {
+		file.Close()
+		return nil, fmt.Errorf("invalid range %d+%d", offset, length)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &rangeReader{Reader: io.LimitReader(file, length), file: file}, nil
+}
+
+type rangeReader struct {
+	io.Reader
+	file io.Closer
+}
+
+func (r *rangeReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"proxydav/internal/storage"
+)
+
+func TestScheme(t *testing.T) {
+	tests := map[string]string{
+		"file:///srv/a.txt":     "file",
+		"inline:abc":            "inline",
+		"HTTPS://example.com/a": "https",
+		"s3+v2://bucket/key":    "s3+v2",
+		"/no/scheme":            "",
+		":missing":              "",
+		"1abc:x":                "",
+	}
+	for fileURL, want := range tests {
+		if got := Scheme(fileURL); got != want {
+			t.Errorf("Scheme(%q) = %q, want %q", fileURL, got, want)
+		}
+	}
+}
+
+func TestLocal_Resolve(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	os.WriteFile(filepath.Join(root, "inside.txt"), []byte("0123456789"), 0o644)
+	os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0o644)
+	os.Mkdir(filepath.Join(root, "dir"), 0o755)
+	if err := os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "escape.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	local := NewLocal([]string{root})
+	ctx := context.Background()
+
+	metadata, err := local.Stat(ctx, "file://"+filepath.Join(root, "inside.txt"))
+	if err != nil || metadata.Size != 10 || metadata.ETag == "" {
+		t.Fatalf("Unexpected Stat result %+v, %v", metadata, err)
+	}
+
+	body, err := local.ReadRange(ctx, "file://"+filepath.Join(root, "inside.txt"), 3, 4)
+	if err != nil {
+		t.Fatalf("ReadRange failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "3456" {
+		t.Errorf("Expected range content, got %q", data)
+	}
+
+	rejected := map[string]error{
+		"file://" + filepath.Join(outside, "secret.txt"):       ErrOutsideRoots,
+		"file://" + filepath.Join(root, "escape.txt"):          ErrOutsideRoots,
+		"file://" + filepath.Join(root, "missing.txt"):         ErrNotFound,
+		"file://otherhost" + filepath.Join(root, "inside.txt"): nil,
+		"file://" + filepath.Join(root, "dir"):                 nil,
+	}
+	for fileURL, want := range rejected {
+		_, err := local.Stat(ctx, fileURL)
+		if err == nil {
+			t.Errorf("Expected %s to be rejected", fileURL)
+			continue
+		}
+		if want != nil && !errors.Is(err, want) {
+			t.Errorf("Stat(%s) = %v, want %v", fileURL, err, want)
+		}
+	}
+
+	local.SetRoots(nil)
+	if _, err := local.Stat(ctx, "file://"+filepath.Join(root, "inside.txt")); err == nil {
+		t.Error("Expected local files to be disabled without roots")
+	}
+}
+
+func TestInline(t *testing.T) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	inline := NewInline(store)
+	ctx := context.Background()
+
+	shortcut := []byte("[InternetShortcut]\nURL=https://example.com/\n")
+	fileURL, err := inline.Put(ctx, bytes.NewReader(shortcut))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	again, _ := inline.Put(ctx, bytes.NewReader(shortcut))
+	if again != fileURL {
+		t.Errorf("Expected identical content to share a URL, got %s and %s", fileURL, again)
+	}
+
+	metadata, err := inline.Stat(ctx, fileURL)
+	if err != nil || metadata.Size != int64(len(shortcut)) {
+		t.Fatalf("Unexpected Stat result %+v, %v", metadata, err)
+	}
+
+	body, err := inline.ReadRange(ctx, fileURL, 1, 16)
+	if err != nil {
+		t.Fatalf("ReadRange failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	if string(data) != "InternetShortcut" {
+		t.Errorf("Expected range content, got %q", data)
+	}
+
+	if _, err := inline.Stat(ctx, InlineURL([]byte("never stored"))); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if _, err := inline.Put(ctx, bytes.NewReader(make([]byte, MaxInlineSize+1))); !errors.Is(err, ErrTooLarge) {
+		t.Error("Expected oversized content to be rejected")
+	}
+}
+
+func TestBlob(t *testing.T) {
+	dir := t.TempDir()
+	blobs, err := NewBlob(dir, false, 8, 12)
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := blobs.Put(ctx, strings.NewReader("abc")); !errors.Is(err, ErrUploadsDisabled) {
+		t.Fatalf("Expected uploads to be disabled, got %v", err)
+	}
+
+	blobs.Configure(true, 8, 12)
+	fileURL, err := blobs.Put(ctx, strings.NewReader("01234567"))
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	again, err := blobs.Put(ctx, strings.NewReader("01234567"))
+	if err != nil || again != fileURL {
+		t.Errorf("Expected identical content to share a URL, got %s and %s, %v", fileURL, again, err)
+	}
+	if used, _ := blobs.Usage(); used != 8 {
+		t.Errorf("Expected identical content to be stored once, using %d bytes", used)
+	}
+
+	body, err := blobs.ReadRange(ctx, fileURL, 2, 3)
+	if err != nil {
+		t.Fatalf("ReadRange failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "234" {
+		t.Errorf("Expected range content, got %q", data)
+	}
+
+	if _, err := blobs.Put(ctx, strings.NewReader("012345678")); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected the file size limit to apply, got %v", err)
+	}
+	if _, err := blobs.Put(ctx, strings.NewReader("abcdefg")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("Expected the total size limit to apply, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected rejected uploads to leave no files, found %d", len(entries))
+	}
+
+	if err := blobs.Delete(ctx, fileURL); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := blobs.Stat(ctx, fileURL); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound after Delete, got %v", err)
+	}
+	if _, err := blobs.Stat(ctx, "blob:../../etc/passwd"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected a malformed URL to be rejected, got %v", err)
+	}
+}
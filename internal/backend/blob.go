@@ -0,0 +1,222 @@
+package backend
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/pkg/types"
+)
+
+// BlobPrefix starts the URLs of uploaded files kept in the blob store
+const BlobPrefix = "blob:"
+
+var (
+	// ErrUploadsDisabled is returned by Put while the blob store is disabled
+	ErrUploadsDisabled = errors.New("uploads are disabled")
+	// ErrQuotaExceeded is returned when an upload would exceed the total size limit
+	ErrQuotaExceeded = errors.New("blob store is full")
+)
+
+// Blob keeps uploaded files in a directory, named by the SHA-256 of their
+// content. Uploads can be limited per file and in total; 0 disables a limit.
+// Stored files keep being served while uploads are disabled.
+type Blob struct {
+	dir string
+
+	commitMutex sync.Mutex // serializes the final quota check and rename of uploads
+
+	mutex        sync.RWMutex
+	enabled      bool
+	maxFileSize  int64
+	maxTotalSize int64
+}
+
+func NewBlob(dir string, enabled bool, maxFileSize, maxTotalSize int64) (*Blob, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob directory: %w", err)
+	}
+	b := &Blob{dir: dir}
+	b.Configure(enabled, maxFileSize, maxTotalSize)
+	return b, nil
+}
+
+// Configure enables or disables uploads and sets the size limits
+func (b *Blob) Configure(enabled bool, maxFileSize, maxTotalSize int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.enabled = enabled
+	b.maxFileSize = maxFileSize
+	b.maxTotalSize = maxTotalSize
+}
+
+// Enabled reports whether uploads are accepted
+func (b *Blob) Enabled() bool {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+	return b.enabled
+}
+
+// path returns the file holding a blob, rejecting malformed URLs
+func (b *Blob) path(fileURL string) (string, error) {
+	name, ok := strings.CutPrefix(fileURL, BlobPrefix)
+	if !ok || len(name) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid blob URL %q", fileURL)
+	}
+	if _, err := hex.DecodeString(name); err != nil {
+		return "", fmt.Errorf("invalid blob URL %q", fileURL)
+	}
+	return filepath.Join(b.dir, strings.ToLower(name)), nil
+}
+
+// Usage returns the combined size of the stored blobs
+func (b *Blob) Usage() (int64, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	var total int64
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+	}
+	return total, nil
+}
+
+// Put stores an upload and returns its URL. Content is written to a
+// temporary file while it is hashed, so limits are enforced without
+// buffering it in memory.
+func (b *Blob) Put(ctx context.Context, content io.Reader) (string, error) {
+	b.mutex.RLock()
+	enabled, maxFileSize, maxTotalSize := b.enabled, b.maxFileSize, b.maxTotalSize
+	b.mutex.RUnlock()
+	if !enabled {
+		return "", ErrUploadsDisabled
+	}
+
+	temp, err := os.CreateTemp(b.dir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create upload file: %w", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	// Read one byte past the limit to tell when it is exceeded. The quota is
+	// checked once the content is known, as it may already be stored.
+	limit := maxFileSize
+	if limit <= 0 || (maxTotalSize > 0 && maxTotalSize < limit) {
+		limit = maxTotalSize
+	}
+	reader := content
+	if limit > 0 {
+		reader = io.LimitReader(content, limit+1)
+	}
+
+	hash := sha256.New()
+	written, err := io.Copy(io.MultiWriter(temp, hash), reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to store upload: %w", err)
+	}
+	if limit > 0 && written > limit {
+		if maxFileSize > 0 && written > maxFileSize {
+			return "", fmt.Errorf("%w: uploads are limited to %d bytes", ErrTooLarge, maxFileSize)
+		}
+		return "", fmt.Errorf("%w: the store holds at most %d bytes", ErrQuotaExceeded, maxTotalSize)
+	}
+	if err := temp.Close(); err != nil {
+		return "", fmt.Errorf("failed to store upload: %w", err)
+	}
+
+	fileURL := BlobPrefix + hex.EncodeToString(hash.Sum(nil))
+	target, _ := b.path(fileURL)
+
+	// Identical content may be stored already, and other uploads may have
+	// finished meanwhile
+	b.commitMutex.Lock()
+	defer b.commitMutex.Unlock()
+	if _, err := os.Stat(target); err == nil {
+		return fileURL, nil
+	}
+	if maxTotalSize > 0 {
+		used, err := b.Usage()
+		if err != nil {
+			return "", err
+		}
+		if used+written > maxTotalSize {
+			return "", fmt.Errorf("%w: %d of %d bytes are in use", ErrQuotaExceeded, used, maxTotalSize)
+		}
+	}
+	if err := os.Rename(temp.Name(), target); err != nil {
+		return "", fmt.Errorf("failed to store upload: %w", err)
+	}
+	return fileURL, nil
+}
+
+// Delete removes a stored blob
+func (b *Blob) Delete(ctx context.Context, fileURL string) error {
+	target, err := b.path(fileURL)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete blob: %w", err)
+	}
+	return nil
+}
+
+func (b *Blob) Stat(ctx context.Context, fileURL string) (*types.FileMetadata, error) {
+	target, err := b.path(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, fileURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat blob: %w", err)
+	}
+	return &types.FileMetadata{
+		URL:          fileURL,
+		Size:         info.Size(),
+		LastModified: info.ModTime().UTC(),
+		ETag:         `"` + strings.TrimPrefix(fileURL, BlobPrefix) + `"`,
+		FetchedAt:    time.Now(),
+	}, nil
+}
+
+func (b *Blob) Open(ctx context.Context, fileURL string) (io.ReadSeekCloser, error) {
+	target, err := b.path(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(target)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, fileURL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open blob: %w", err)
+	}
+	return file, nil
+}
+
+func (b *Blob) ReadRange(ctx context.Context, fileURL string, offset, length int64) (io.ReadCloser, error) {
+	file, err := b.Open(ctx, fileURL)
+	if err != nil {
+		return nil, err
+	}
+	return readRange(file, offset, length)
+}
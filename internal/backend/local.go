@@ -0,0 +1,148 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/pkg/types"
+)
+
+// ErrOutsideRoots is returned for local files that no configured root contains
+var ErrOutsideRoots = errors.New("local file is outside of the configured roots")
+
+// Local serves file:// URLs from directories on the server. Paths are
+// resolved through symlinks before they are checked against the roots, so
+// a link cannot lead outside of them.
+type Local struct {
+	mutex sync.RWMutex
+	roots []string
+}
+
+func NewLocal(roots []string) *Local {
+	l := &Local{}
+	l.SetRoots(roots)
+	return l
+}
+
+// SetRoots replaces the directories that local files may be served from
+func (l *Local) SetRoots(roots []string) {
+	cleaned := make([]string, 0, len(roots))
+	for _, root := range roots {
+		if root = strings.TrimSpace(root); root != "" {
+			cleaned = append(cleaned, filepath.Clean(root))
+		}
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.roots = cleaned
+}
+
+// Resolve returns the real path of a file:// URL, checking that it is an
+// existing regular file inside one of the roots
+func (l *Local) Resolve(fileURL string) (string, error) {
+	u, err := url.Parse(fileURL)
+	if err != nil || u.Scheme != "file" {
+		return "", fmt.Errorf("invalid file URL %q", fileURL)
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		return "", fmt.Errorf("file URLs cannot name a remote host: %s", u.Host)
+	}
+	filePath := filepath.FromSlash(u.Path)
+	if !filepath.IsAbs(filePath) {
+		return "", fmt.Errorf("file URL must have an absolute path: %s", fileURL)
+	}
+
+	l.mutex.RLock()
+	roots := l.roots
+	l.mutex.RUnlock()
+	if len(roots) == 0 {
+		return "", fmt.Errorf("local files are disabled: no local roots are configured")
+	}
+
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, filePath)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", filePath, err)
+	}
+
+	for _, root := range roots {
+		resolvedRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			continue
+		}
+		if within(resolvedRoot, resolved) {
+			return resolved, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s", ErrOutsideRoots, filePath)
+}
+
+// within reports whether target is root or lies below it
+func within(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+func (l *Local) Stat(ctx context.Context, fileURL string) (*types.FileMetadata, error) {
+	resolved, err := l.Resolve(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat %s: %w", resolved, err)
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", resolved)
+	}
+
+	return &types.FileMetadata{
+		URL:          fileURL,
+		Size:         info.Size(),
+		LastModified: info.ModTime().UTC(),
+		ETag:         fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+		ContentType:  mime.TypeByExtension(filepath.Ext(resolved)),
+		Filename:     filepath.Base(resolved),
+		FetchedAt:    time.Now(),
+	}, nil
+}
+
+func (l *Local) Open(ctx context.Context, fileURL string) (io.ReadSeekCloser, error) {
+	resolved, err := l.Resolve(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", resolved, err)
+	}
+	if info, err := file.Stat(); err != nil || !info.Mode().IsRegular() {
+		file.Close()
+		return nil, fmt.Errorf("%s is not a regular file", resolved)
+	}
+	return file, nil
+}
+
+func (l *Local) ReadRange(ctx context.Context, fileURL string, offset, length int64) (io.ReadCloser, error) {
+	file, err := l.Open(ctx, fileURL)
+	if err != nil {
+		return nil, err
+	}
+	return readRange(file, offset, length)
+}
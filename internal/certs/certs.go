@@ -0,0 +1,172 @@
+// Package certs provides the server certificates of the HTTPS listeners:
+// certificate files that are read again when they change, self-signed
+// certificates for local use, and the CAs client certificates are checked
+// against.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Self-signed certificates are valid for a year and replaced a month
+// before they expire
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	selfSignedRenewal  = 30 * 24 * time.Hour
+)
+
+// Reloader serves a certificate and key from files, and reads them again
+// when either changes, so renewed certificates are used without a restart
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	mutex sync.Mutex
+	stamp string // sizes and modification times the certificate was read at
+	cert  *tls.Certificate
+}
+
+// NewReloader reads the certificate and key, which must be valid
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate is a tls.Config.GetCertificate callback. If changed files
+// cannot be loaded, the previous certificate is served.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err := r.reload(); err != nil {
+		log.Printf("⚠️  Failed to reload the TLS certificate, keeping the previous one: %v", err)
+	}
+	return r.cert, nil
+}
+
+// reload reads the files again if they changed since they were last read.
+// The caller holds the mutex, except in NewReloader.
+func (r *Reloader) reload() error {
+	stamp, err := fileStamp(r.certFile, r.keyFile)
+	if err != nil {
+		stamp = "unreadable"
+	}
+	if stamp == r.stamp {
+		return nil
+	}
+	// A broken file is reported once, not on every handshake
+	r.stamp = stamp
+	if err != nil {
+		return fmt.Errorf("failed to read TLS certificate files: %w", err)
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if r.cert != nil {
+		log.Printf("🔄 Reloaded TLS certificate %s", r.certFile)
+	}
+	r.cert = &cert
+	return nil
+}
+
+// fileStamp describes the size and modification time of files
+func fileStamp(files ...string) (string, error) {
+	var stamp string
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return "", err
+		}
+		stamp += fmt.Sprintf("%d/%d;", info.Size(), info.ModTime().UnixNano())
+	}
+	return stamp, nil
+}
+
+// SelfSigned returns the files of a self-signed certificate for localhost
+// and this machine's hostname in dir, generating one if there is none or
+// it is about to expire
+func SelfSigned(dir string) (certFile, keyFile string, err error) {
+	certFile = filepath.Join(dir, "selfsigned.crt")
+	keyFile = filepath.Join(dir, "selfsigned.key")
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err == nil && time.Until(leaf.NotAfter) > selfSignedRenewal {
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	names := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "localhost" {
+		names = append(names, hostname)
+	}
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "ProxyDAV self-signed", Organization: []string{"ProxyDAV"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              names,
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode key: %w", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return "", "", fmt.Errorf("failed to write key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", fmt.Errorf("failed to write certificate: %w", err)
+	}
+	log.Printf("🔏 Generated a self-signed certificate for %v in %s", names, dir)
+	return certFile, keyFile, nil
+}
+
+// LoadPool reads the PEM certificates of CAs from a file
+func LoadPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", file)
+	}
+	return pool, nil
+}
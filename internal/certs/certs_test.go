@@ -0,0 +1,113 @@
+package certs
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSelfSigned(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	certFile, keyFile, err := SelfSigned(dir)
+	if err != nil {
+		t.Fatalf("SelfSigned failed: %v", err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the key to be private, got %v", info.Mode())
+	}
+	first, _ := os.ReadFile(certFile)
+
+	// An existing certificate is kept
+	if _, _, err := SelfSigned(dir); err != nil {
+		t.Fatalf("SelfSigned failed: %v", err)
+	}
+	if second, _ := os.ReadFile(certFile); !bytes.Equal(first, second) {
+		t.Error("Expected the existing certificate to be kept")
+	}
+
+	reloader, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate failed: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	if err := leaf.VerifyHostname("localhost"); err != nil {
+		t.Errorf("Expected the certificate to be valid for localhost: %v", err)
+	}
+	if err := leaf.VerifyHostname("127.0.0.1"); err != nil {
+		t.Errorf("Expected the certificate to be valid for 127.0.0.1: %v", err)
+	}
+	if time.Until(leaf.NotAfter) < selfSignedValidity-time.Hour {
+		t.Errorf("Unexpected expiry %v", leaf.NotAfter)
+	}
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, err := SelfSigned(filepath.Join(dir, "first"))
+	if err != nil {
+		t.Fatalf("SelfSigned failed: %v", err)
+	}
+	if _, err := NewReloader(certFile, filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("Expected a missing key to be refused")
+	}
+	reloader, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	first, _ := reloader.GetCertificate(nil)
+
+	// A renewed certificate is picked up without a restart
+	renewedCert, renewedKey, err := SelfSigned(filepath.Join(dir, "renewed"))
+	if err != nil {
+		t.Fatalf("SelfSigned failed: %v", err)
+	}
+	copyFile(t, renewedCert, certFile)
+	copyFile(t, renewedKey, keyFile)
+	renewed, _ := reloader.GetCertificate(nil)
+	if bytes.Equal(first.Certificate[0], renewed.Certificate[0]) {
+		t.Fatal("Expected the renewed certificate to be served")
+	}
+
+	// A broken file leaves the previous certificate in place
+	if err := os.WriteFile(certFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatalf("Failed to break the certificate: %v", err)
+	}
+	if cert, err := reloader.GetCertificate(nil); err != nil || !bytes.Equal(cert.Certificate[0], renewed.Certificate[0]) {
+		t.Errorf("Expected the previous certificate to be kept, got %v", err)
+	}
+}
+
+func TestLoadPool(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, err := SelfSigned(dir)
+	if err != nil {
+		t.Fatalf("SelfSigned failed: %v", err)
+	}
+	if _, err := LoadPool(certFile); err != nil {
+		t.Errorf("LoadPool failed: %v", err)
+	}
+	if _, err := LoadPool(keyFile); err == nil {
+		t.Error("Expected a file without certificates to be refused")
+	}
+}
+
+func copyFile(t *testing.T, from, to string) {
+	t.Helper()
+	data, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", from, err)
+	}
+	if err := os.WriteFile(to, data, 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", to, err)
+	}
+}
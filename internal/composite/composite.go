@@ -0,0 +1,316 @@
+package composite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"time"
+
+	"proxydav/internal/backend"
+	"proxydav/pkg/types"
+)
+
+// ErrNoRanges is returned when upstream ignores a range request that can't be served without one
+var ErrNoRanges = errors.New("upstream does not support range requests")
+
+// IsComposite reports whether entries of kind are assembled from byte ranges of upstream files
+func IsComposite(kind string) bool {
+	return kind == types.EntryKindConcat || kind == types.EntryKindSlice
+}
+
+// Segment is a byte region of an upstream file
+type Segment struct {
+	URL    string
+	Offset int64
+	Length int64
+}
+
+// Size returns the combined length of segments
+func Size(segments []Segment) int64 {
+	var size int64
+	for _, segment := range segments {
+		size += segment.Length
+	}
+	return size
+}
+
+// Layout returns the segments of a composite entry and metadata describing
+// the assembled file, using the upstream metadata of its URLs. Every part of
+// a concatenation must have a known size. A slice only needs metadata to
+// check its bounds and to derive validators.
+func Layout(entry *types.FileEntry, metadata map[string]*types.FileMetadata) ([]Segment, *types.FileMetadata, error) {
+	var segments []Segment
+	switch entry.Kind {
+	case types.EntryKindConcat:
+		for i, part := range entry.Parts {
+			partMetadata := metadata[part]
+			if partMetadata == nil || partMetadata.Size <= 0 {
+				return nil, nil, fmt.Errorf("size of part %d (%s) is unknown", i+1, part)
+			}
+			segments = append(segments, Segment{URL: part, Length: partMetadata.Size})
+		}
+	case types.EntryKindSlice:
+		if sourceMetadata := metadata[entry.URL]; sourceMetadata != nil && sourceMetadata.Size > 0 && entry.Offset+entry.Length > sourceMetadata.Size {
+			return nil, nil, fmt.Errorf("slice %d+%d exceeds the %d bytes of %s", entry.Offset, entry.Length, sourceMetadata.Size, entry.URL)
+		}
+		segments = []Segment{{URL: entry.URL, Offset: entry.Offset, Length: entry.Length}}
+	default:
+		return nil, nil, fmt.Errorf("entry kind %q is not composite", entry.Kind)
+	}
+
+	return segments, combinedMetadata(entry, segments, metadata), nil
+}
+
+// combinedMetadata derives size, date and a strong ETag for the assembled
+// file. The ETag changes whenever any source's validator or the layout does.
+func combinedMetadata(entry *types.FileEntry, segments []Segment, metadata map[string]*types.FileMetadata) *types.FileMetadata {
+	combined := &types.FileMetadata{
+		URL:       entry.Path,
+		Size:      Size(segments),
+		FetchedAt: time.Now(),
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s\x00", entry.Kind)
+	for _, segment := range segments {
+		fmt.Fprintf(h, "%s\x00%d\x00%d\x00", segment.URL, segment.Offset, segment.Length)
+		source := metadata[segment.URL]
+		if source == nil {
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%d\x00", source.ETag, source.LastModified.Unix())
+		if source.LastModified.After(combined.LastModified) {
+			combined.LastModified = source.LastModified
+		}
+	}
+	combined.ETag = fmt.Sprintf(`"%x"`, h.Sum64())
+	return combined
+}
+
+// CheckFunc inspects the HTTP response for each segment before its body is used
+type CheckFunc func(segment Segment, resp *http.Response) error
+
+// piece is the part of a segment that a read covers
+type piece struct {
+	segment Segment
+	start   int64 // relative to the segment
+	length  int64
+}
+
+// pieces maps bytes [start, start+length) of the assembled file onto segments
+func pieces(segments []Segment, start, length int64) []piece {
+	var result []piece
+	var position int64
+	for _, segment := range segments {
+		segmentEnd := position + segment.Length
+		if length > 0 && start < segmentEnd {
+			from := start - position
+			if from < 0 {
+				from = 0
+			}
+			n := segment.Length - from
+			if n > length {
+				n = length
+			}
+			result = append(result, piece{segment: segment, start: from, length: n})
+			start += n
+			length -= n
+		}
+		position = segmentEnd
+	}
+	return result
+}
+
+// stream reads a sequence of pieces, requesting each one when the previous is exhausted
+type stream struct {
+	ctx      context.Context
+	client   *http.Client
+	backends *backend.Registry
+	check    CheckFunc
+	pieces   []piece
+	body     io.ReadCloser
+	left     int64 // bytes left in the current piece
+}
+
+// open requests the next piece, from its backend or over HTTP
+func (s *stream) open() error {
+	next := s.pieces[0]
+	s.pieces = s.pieces[1:]
+
+	if b, ok := s.backends.For(next.segment.URL); ok {
+		body, err := b.ReadRange(s.ctx, next.segment.URL, next.segment.Offset+next.start, next.length)
+		if err != nil {
+			return err
+		}
+		s.body = body
+		s.left = next.length
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, next.segment.URL, nil)
+	if err != nil {
+		return err
+	}
+	first := next.segment.Offset + next.start
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", first, first+next.length-1))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	// A server ignoring the range is only usable when the piece starts the file
+	if resp.StatusCode != http.StatusPartialContent && !(resp.StatusCode == http.StatusOK && first == 0) {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK {
+			return ErrNoRanges
+		}
+		return fmt.Errorf("upstream returned %s for %s", resp.Status, next.segment.URL)
+	}
+	if s.check != nil {
+		if err := s.check(next.segment, resp); err != nil {
+			resp.Body.Close()
+			return err
+		}
+	}
+
+	s.body = resp.Body
+	s.left = next.length
+	return nil
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	for s.body == nil || s.left == 0 {
+		if s.body != nil {
+			s.body.Close()
+			s.body = nil
+		}
+		if len(s.pieces) == 0 {
+			return 0, io.EOF
+		}
+		if err := s.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if int64(len(p)) > s.left {
+		p = p[:s.left]
+	}
+	n, err := s.body.Read(p)
+	s.left -= int64(n)
+	if err == io.EOF {
+		if s.left > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+		err = nil
+	}
+	return n, err
+}
+
+func (s *stream) Close() error {
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
+
+// Open streams bytes [start, start+length) of the assembled file. The
+// first piece is requested right away so that upstream errors surface
+// before any response is written.
+func Open(ctx context.Context, client *http.Client, backends *backend.Registry, segments []Segment, start, length int64, check CheckFunc) (io.ReadCloser, error) {
+	if start < 0 || length < 0 || start+length > Size(segments) {
+		return nil, fmt.Errorf("range %d+%d is outside of the file", start, length)
+	}
+
+	s := &stream{ctx: ctx, client: client, backends: backends, check: check, pieces: pieces(segments, start, length)}
+	if len(s.pieces) > 0 {
+		if err := s.open(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// File is an io.ReadSeeker over an assembled file, suitable for
+// http.ServeContent. Seeking only records the position; content is
+// requested from there on the next Read.
+type File struct {
+	ctx      context.Context
+	client   *http.Client
+	backends *backend.Registry
+	segments []Segment
+	check    CheckFunc
+	size     int64
+
+	offset     int64
+	body       io.ReadCloser
+	bodyOffset int64
+}
+
+func NewFile(ctx context.Context, client *http.Client, backends *backend.Registry, segments []Segment, check CheckFunc) *File {
+	return &File{ctx: ctx, client: client, backends: backends, segments: segments, check: check, size: Size(segments)}
+}
+
+// Prime opens the content at offset ahead of time, so that a following
+// read from there reuses it. Errors are returned immediately.
+func (f *File) Prime(offset int64) error {
+	if offset < 0 || offset >= f.size {
+		return nil
+	}
+	return f.openAt(offset)
+}
+
+func (f *File) openAt(offset int64) error {
+	f.Close()
+	body, err := Open(f.ctx, f.client, f.backends, f.segments, offset, f.size-offset, f.check)
+	if err != nil {
+		return err
+	}
+	f.body = body
+	f.bodyOffset = offset
+	return nil
+}
+
+func (f *File) Read(p []byte) (int, error) {
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	if f.body == nil || f.bodyOffset != f.offset {
+		if err := f.openAt(f.offset); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.body.Read(p)
+	f.offset += int64(n)
+	f.bodyOffset += int64(n)
+	return n, err
+}
+
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("invalid seek to negative offset")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *File) Close() error {
+	if f.body == nil {
+		return nil
+	}
+	err := f.body.Close()
+	f.body = nil
+	return err
+}
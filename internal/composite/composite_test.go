@@ -0,0 +1,178 @@
+package composite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
+)
+
+func partsServer(t *testing.T, parts map[string]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := parts[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestClient(t *testing.T) *http.Client {
+	policy, err := upstream.NewPolicy(nil, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	return upstream.NewClient(policy, &upstream.Router{}, 5*time.Second)
+}
+
+func TestPieces(t *testing.T) {
+	segments := []Segment{{URL: "a", Length: 4}, {URL: "b", Length: 4}, {URL: "c", Offset: 10, Length: 4}}
+
+	tests := []struct {
+		name          string
+		start, length int64
+		want          []piece
+	}{
+		{name: "within one segment", start: 1, length: 2, want: []piece{{segment: segments[0], start: 1, length: 2}}},
+		{name: "across a boundary", start: 3, length: 3, want: []piece{{segment: segments[0], start: 3, length: 1}, {segment: segments[1], start: 0, length: 2}}},
+		{name: "whole file", start: 0, length: 12, want: []piece{{segment: segments[0], length: 4}, {segment: segments[1], length: 4}, {segment: segments[2], length: 4}}},
+		{name: "empty", start: 5, length: 0, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pieces(segments, tt.start, tt.length)
+			if len(got) != len(tt.want) {
+				t.Fatalf("Expected %d pieces, got %+v", len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Piece %d: expected %+v, got %+v", i, tt.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpen_ConcatenatesParts(t *testing.T) {
+	server := partsServer(t, map[string]string{"/a.001": "hello ", "/a.002": "split ", "/a.003": "world"})
+	segments := []Segment{
+		{URL: server.URL + "/a.001", Length: 6},
+		{URL: server.URL + "/a.002", Length: 6},
+		{URL: server.URL + "/a.003", Length: 5},
+	}
+	client := newTestClient(t)
+
+	tests := []struct {
+		start, length int64
+		want          string
+	}{
+		{start: 0, length: 17, want: "hello split world"},
+		{start: 4, length: 9, want: "o split w"},
+		{start: 12, length: 5, want: "world"},
+	}
+	for _, tt := range tests {
+		body, err := Open(context.Background(), client, nil, segments, tt.start, tt.length, nil)
+		if err != nil {
+			t.Fatalf("Open(%d, %d) failed: %v", tt.start, tt.length, err)
+		}
+		data, err := io.ReadAll(body)
+		body.Close()
+		if err != nil || string(data) != tt.want {
+			t.Errorf("Open(%d, %d) = %q, %v; want %q", tt.start, tt.length, data, err, tt.want)
+		}
+	}
+
+	if _, err := Open(context.Background(), client, nil, segments, 10, 10, nil); err == nil {
+		t.Error("Expected a range past the end to fail")
+	}
+}
+
+func TestOpen_DetectsShortParts(t *testing.T) {
+	server := partsServer(t, map[string]string{"/a.001": "abc"})
+	segments := []Segment{{URL: server.URL + "/a.001", Length: 6}}
+
+	body, err := Open(context.Background(), newTestClient(t), nil, segments, 0, 6, nil)
+	if err != nil {
+		// The server may refuse the unsatisfiable range outright
+		return
+	}
+	defer body.Close()
+	if _, err := io.ReadAll(body); err == nil {
+		t.Error("Expected an error for a part shorter than its recorded size")
+	}
+}
+
+func TestLayout(t *testing.T) {
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	metadata := map[string]*types.FileMetadata{
+		"https://example.com/a.001": {Size: 100, ETag: `"a"`, LastModified: modified},
+		"https://example.com/a.002": {Size: 50, ETag: `"b"`, LastModified: modified.Add(time.Hour)},
+		"https://example.com/blob":  {Size: 1000},
+	}
+
+	concat := &types.FileEntry{Path: "/a", Kind: types.EntryKindConcat, Parts: []string{"https://example.com/a.001", "https://example.com/a.002"}}
+	segments, combined, err := Layout(concat, metadata)
+	if err != nil {
+		t.Fatalf("Layout failed: %v", err)
+	}
+	if len(segments) != 2 || combined.Size != 150 || !combined.LastModified.Equal(modified.Add(time.Hour)) {
+		t.Errorf("Unexpected concat layout %+v, %+v", segments, combined)
+	}
+
+	metadata["https://example.com/a.002"] = &types.FileMetadata{Size: 50, ETag: `"c"`}
+	_, changed, _ := Layout(concat, metadata)
+	if changed.ETag == combined.ETag {
+		t.Error("Expected ETag to change when a part changes")
+	}
+
+	missing := &types.FileEntry{Kind: types.EntryKindConcat, Parts: []string{"https://example.com/a.001", "https://example.com/a.003"}}
+	if _, _, err := Layout(missing, metadata); err == nil {
+		t.Error("Expected an error for a part of unknown size")
+	}
+
+	slice := &types.FileEntry{Kind: types.EntryKindSlice, URL: "https://example.com/blob", Offset: 900, Length: 100}
+	if _, combined, err := Layout(slice, metadata); err != nil || combined.Size != 100 {
+		t.Errorf("Unexpected slice layout %+v, %v", combined, err)
+	}
+	slice.Length = 101
+	if _, _, err := Layout(slice, metadata); err == nil {
+		t.Error("Expected an error for a slice past the end of the file")
+	}
+}
+
+func TestFile_ServeContent(t *testing.T) {
+	server := partsServer(t, map[string]string{"/blob": "0123456789abcdefghij"})
+	client := newTestClient(t)
+	segments := []Segment{{URL: server.URL + "/blob", Offset: 5, Length: 10}}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file := NewFile(r.Context(), client, nil, segments, nil)
+		defer file.Close()
+		http.ServeContent(w, r, "slice.bin", time.Time{}, file)
+	})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/slice.bin", nil))
+	if w.Body.String() != "56789abcde" {
+		t.Errorf("Expected slice content, got %q", w.Body.String())
+	}
+
+	request := httptest.NewRequest("GET", "/slice.bin", nil)
+	request.Header.Set("Range", "bytes=-3")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, request)
+	if w.Code != http.StatusPartialContent || !bytes.Equal(w.Body.Bytes(), []byte("cde")) {
+		t.Errorf("Expected suffix of the slice, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"testing"
+	"time"
 )
 
 func TestConfigValidation(t *testing.T) {
@@ -43,12 +44,22 @@ func TestConfigValidation(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			name: "auth enabled without credentials",
+			name: "auth enabled without initial account",
 			config: Config{
 				Port:        8080,
 				DataDir:     "./proxydavData",
 				AuthEnabled: true,
 			},
+			wantErr: false,
+		},
+		{
+			name: "initial account without username",
+			config: Config{
+				Port:        8080,
+				DataDir:     "./proxydavData",
+				AuthEnabled: true,
+				AuthPass:    "testpass",
+			},
 			wantErr: true,
 		},
 		{
@@ -62,6 +73,255 @@ func TestConfigValidation(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "admin panel on localhost",
+			config: Config{
+				Port:      8080,
+				DataDir:   "./proxydavData",
+				AdminAddr: "127.0.0.1:8081",
+			},
+			wantErr: false,
+		},
+		{
+			name: "admin address without port",
+			config: Config{
+				Port:      8080,
+				DataDir:   "./proxydavData",
+				AdminAddr: "127.0.0.1",
+			},
+			wantErr: true,
+		},
+		{
+			name: "admin address on the WebDAV port",
+			config: Config{
+				Port:      8080,
+				DataDir:   "./proxydavData",
+				AdminAddr: ":8080",
+			},
+			wantErr: true,
+		},
+		{
+			name: "JWT authentication",
+			config: Config{
+				Port:         8080,
+				DataDir:      "./proxydavData",
+				AuthMethods:  []string{"jwt", "app_password"},
+				JWTJWKS:      "https://sso.example.com/certs",
+				JWTIssuers:   []string{"https://sso.example.com"},
+				JWTAudiences: []string{"proxydav"},
+				JWTRoleMap:   []string{"dav-admins=admin"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown authentication method",
+			config: Config{
+				Port:        8080,
+				DataDir:     "./proxydavData",
+				AuthMethods: []string{"password", "kerberos"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "JWT authentication without issuers",
+			config: Config{
+				Port:         8080,
+				DataDir:      "./proxydavData",
+				JWTJWKS:      "/etc/proxydav/jwks.json",
+				JWTAudiences: []string{"proxydav"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "JWT role mapping to an unknown role",
+			config: Config{
+				Port:       8080,
+				DataDir:    "./proxydavData",
+				JWTRoleMap: []string{"dav-admins=root"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "proxy authentication",
+			config: Config{
+				Port:           8080,
+				DataDir:        "./proxydavData",
+				AuthMethods:    []string{"proxy", "token"},
+				TrustedProxies: []string{"10.0.0.0/8", "::1"},
+				ProxyRoleMap:   []string{"dav-admins=admin"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "proxy authentication without trusted proxies",
+			config: Config{
+				Port:        8080,
+				DataDir:     "./proxydavData",
+				AuthMethods: []string{"proxy"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "htpasswd authentication",
+			config: Config{
+				Port:               8080,
+				DataDir:            "./proxydavData",
+				AuthMethods:        []string{"htpasswd", "password"},
+				HtpasswdFile:       "/etc/proxydav/htpasswd",
+				HtpasswdGroupsFile: "/etc/proxydav/groups",
+				HtpasswdRoleMap:    []string{"ops=admin"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "htpasswd authentication without a file",
+			config: Config{
+				Port:        8080,
+				DataDir:     "./proxydavData",
+				AuthMethods: []string{"htpasswd"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "htpasswd groups file without an htpasswd file",
+			config: Config{
+				Port:               8080,
+				DataDir:            "./proxydavData",
+				HtpasswdGroupsFile: "/etc/proxydav/groups",
+			},
+			wantErr: true,
+		},
+		{
+			name: "login lockouts",
+			config: Config{
+				Port:             8080,
+				DataDir:          "./proxydavData",
+				LoginMaxFailures: 5,
+				LoginLockout:     time.Minute,
+				LoginMaxLockout:  time.Hour,
+				LoginAllowlist:   []string{"192.168.0.0/16", "203.0.113.7"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "login lockout longer than the longest",
+			config: Config{
+				Port:             8080,
+				DataDir:          "./proxydavData",
+				LoginMaxFailures: 5,
+				LoginLockout:     time.Hour,
+				LoginMaxLockout:  time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed login allowlist entry",
+			config: Config{
+				Port:           8080,
+				DataDir:        "./proxydavData",
+				LoginAllowlist: []string{"office"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "TLS with client certificates and a redirect",
+			config: Config{
+				Port:             8443,
+				DataDir:          "./proxydavData",
+				TLSCert:          "/etc/proxydav/cert.pem",
+				TLSKey:           "/etc/proxydav/key.pem",
+				TLSClientCA:      "/etc/proxydav/clients.pem",
+				TLSClientUserMap: []string{"Alice Smith=alice"},
+				HTTPRedirectAddr: ":8080",
+				AuthMethods:      []string{"client_cert", "password"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "TLS certificate without a key",
+			config: Config{
+				Port:    8443,
+				DataDir: "./proxydavData",
+				TLSCert: "/etc/proxydav/cert.pem",
+			},
+			wantErr: true,
+		},
+		{
+			name: "TLS certificate files and a self-signed certificate",
+			config: Config{
+				Port:          8443,
+				DataDir:       "./proxydavData",
+				TLSCert:       "/etc/proxydav/cert.pem",
+				TLSKey:        "/etc/proxydav/key.pem",
+				TLSSelfSigned: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "client certificates without TLS",
+			config: Config{
+				Port:        8080,
+				DataDir:     "./proxydavData",
+				TLSClientCA: "/etc/proxydav/clients.pem",
+			},
+			wantErr: true,
+		},
+		{
+			name: "client certificate authentication without a CA",
+			config: Config{
+				Port:          8443,
+				DataDir:       "./proxydavData",
+				TLSSelfSigned: true,
+				AuthMethods:   []string{"client_cert"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "HTTP redirect without TLS",
+			config: Config{
+				Port:             8080,
+				DataDir:          "./proxydavData",
+				HTTPRedirectAddr: ":80",
+			},
+			wantErr: true,
+		},
+		{
+			name: "HTTP redirect on the HTTPS port",
+			config: Config{
+				Port:             8443,
+				DataDir:          "./proxydavData",
+				TLSSelfSigned:    true,
+				HTTPRedirectAddr: ":8443",
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed trusted proxy",
+			config: Config{
+				Port:           8080,
+				DataDir:        "./proxydavData",
+				TrustedProxies: []string{"10.0.0.0/33"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "proxy role mapping without a group",
+			config: Config{
+				Port:         8080,
+				DataDir:      "./proxydavData",
+				ProxyRoleMap: []string{"=editor"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "malformed junk file pattern",
+			config: Config{
+				Port:         8080,
+				DataDir:      "./proxydavData",
+				JunkPatterns: []string{"._*", "[abc"},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
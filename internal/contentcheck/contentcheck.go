@@ -0,0 +1,223 @@
+package contentcheck
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"proxydav/pkg/types"
+)
+
+// SniffLength is the number of leading bytes inspected by Sniff
+const SniffLength = 512
+
+// SuspiciousError describes an upstream response that doesn't look like the
+// file it is supposed to be, typically a login, captcha or error page
+// served with status 200
+type SuspiciousError struct {
+	Reason string
+	// ETagChanged is set when the size differs under a new ETag, which a
+	// file replaced upstream explains as well as an error page does
+	ETagChanged bool
+}
+
+func (e *SuspiciousError) Error() string {
+	return "suspicious upstream response: " + e.Reason
+}
+
+func suspicious(format string, args ...interface{}) error {
+	return &SuspiciousError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// signatures lists the leading bytes of formats commonly served from
+// upstream mirrors, keyed by file extension
+var signatures = map[string][][]byte{
+	".zip":  {[]byte("PK\x03\x04"), []byte("PK\x05\x06"), []byte("PK\x07\x08")},
+	".jar":  {[]byte("PK\x03\x04")},
+	".apk":  {[]byte("PK\x03\x04")},
+	".docx": {[]byte("PK\x03\x04")},
+	".xlsx": {[]byte("PK\x03\x04")},
+	".pptx": {[]byte("PK\x03\x04")},
+	".epub": {[]byte("PK\x03\x04")},
+	".pdf":  {[]byte("%PDF-")},
+	".gz":   {[]byte("\x1f\x8b")},
+	".tgz":  {[]byte("\x1f\x8b")},
+	".bz2":  {[]byte("BZh")},
+	".xz":   {[]byte("\xfd7zXZ\x00")},
+	".7z":   {[]byte("7z\xbc\xaf\x27\x1c")},
+	".rar":  {[]byte("Rar!\x1a\x07")},
+	".png":  {[]byte("\x89PNG\r\n\x1a\n")},
+	".jpg":  {[]byte("\xff\xd8\xff")},
+	".jpeg": {[]byte("\xff\xd8\xff")},
+	".gif":  {[]byte("GIF87a"), []byte("GIF89a")},
+}
+
+func mediaType(contentType string) string {
+	if contentType == "" {
+		return ""
+	}
+	media, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	}
+	return media
+}
+
+func isHTML(media string) bool {
+	return media == "text/html" || media == "application/xhtml+xml"
+}
+
+// isErrorFormat reports whether a media type is a typical error payload.
+// text/plain is left out because misconfigured servers use it for binaries.
+func isErrorFormat(media string) bool {
+	return isHTML(media) || media == "application/json" || media == "application/xml" || media == "text/xml"
+}
+
+// isTextual reports whether a media type is a text format
+func isTextual(media string) bool {
+	return strings.HasPrefix(media, "text/") || strings.HasSuffix(media, "+xml") || strings.HasSuffix(media, "+json") ||
+		media == "application/json" || media == "application/xml" || media == "application/javascript"
+}
+
+// expectedType returns the media type implied by the virtual file's
+// extension. Binary formats missing from the system MIME table are still
+// known to be binary.
+func expectedType(virtualPath string) string {
+	ext := strings.ToLower(path.Ext(virtualPath))
+	if media := mediaType(mime.TypeByExtension(ext)); media != "" {
+		return media
+	}
+	if _, ok := signatures[ext]; ok {
+		return "application/octet-stream"
+	}
+	return ""
+}
+
+// checkType rejects HTML or other text served for a file whose extension
+// says it is binary. Files without a recognizable extension are not judged.
+func checkType(virtualPath, contentType string) error {
+	got := mediaType(contentType)
+	want := expectedType(virtualPath)
+	if got == "" || want == "" || got == want {
+		return nil
+	}
+	if isHTML(got) && !isHTML(want) {
+		return suspicious("upstream served %s for %s", got, path.Base(virtualPath))
+	}
+	if isErrorFormat(got) && !isTextual(want) {
+		return suspicious("upstream served %s, expected %s", got, want)
+	}
+	return nil
+}
+
+// representationSize returns the full size of the upstream file from a 200
+// or 206 response, or -1 when it is unknown
+func representationSize(statusCode int, header http.Header, contentLength int64) int64 {
+	if statusCode == http.StatusPartialContent {
+		contentRange := header.Get("Content-Range")
+		if slash := strings.LastIndex(contentRange, "/"); slash >= 0 {
+			if total, err := strconv.ParseInt(contentRange[slash+1:], 10, 64); err == nil {
+				return total
+			}
+		}
+		return -1
+	}
+	return contentLength
+}
+
+// CheckResponse compares an upstream response's headers with the virtual
+// file's extension and the cached metadata, if any. A file of known size
+// must be served at that size whatever the ETag is: error pages rarely
+// carry one, let alone the file's.
+func CheckResponse(virtualPath string, statusCode int, header http.Header, contentLength int64, cached *types.FileMetadata) error {
+	if err := checkType(virtualPath, header.Get("Content-Type")); err != nil {
+		return err
+	}
+
+	if cached == nil || cached.Size <= 0 {
+		return nil
+	}
+
+	size := representationSize(statusCode, header, contentLength)
+	if size < 0 || size == cached.Size {
+		return nil
+	}
+	etag := header.Get("ETag")
+	switch {
+	case etag == "":
+		return suspicious("upstream sent %d bytes without an ETag, known size is %d", size, cached.Size)
+	case etag == cached.ETag:
+		return suspicious("upstream sent %d bytes for ETag %s, known size is %d", size, etag, cached.Size)
+	}
+	return &SuspiciousError{
+		Reason:      fmt.Sprintf("upstream sent %d bytes with a new ETag %s, known size is %d", size, etag, cached.Size),
+		ETagChanged: true,
+	}
+}
+
+// ETagChanged reports whether err is a size mismatch under a new ETag,
+// which revalidating the file's metadata can settle
+func ETagChanged(err error) bool {
+	var suspiciousErr *SuspiciousError
+	return errors.As(err, &suspiciousErr) && suspiciousErr.ETagChanged
+}
+
+// CheckMetadata applies the header checks to freshly fetched metadata,
+// comparing it with the previously cached record
+func CheckMetadata(virtualPath string, metadata, previous *types.FileMetadata) error {
+	if metadata == nil {
+		return nil
+	}
+	if err := checkType(virtualPath, metadata.ContentType); err != nil {
+		return err
+	}
+	if previous != nil && previous.Size > 0 && metadata.ETag != "" && metadata.ETag == previous.ETag && metadata.Size != previous.Size {
+		return suspicious("upstream reports %d bytes for ETag %s, known size is %d", metadata.Size, metadata.ETag, previous.Size)
+	}
+	return nil
+}
+
+// Sniff inspects the first bytes of a file. Formats with a known signature
+// must start with it; anything else must not look like an HTML page unless
+// the virtual file is HTML.
+func Sniff(virtualPath string, prefix []byte) error {
+	if len(prefix) == 0 {
+		return nil
+	}
+
+	ext := strings.ToLower(path.Ext(virtualPath))
+	if magics, ok := signatures[ext]; ok {
+		for _, magic := range magics {
+			if bytes.HasPrefix(prefix, magic) {
+				return nil
+			}
+		}
+		if len(prefix) >= len(magics[0]) {
+			return suspicious("content of %s does not start with a %s signature", path.Base(virtualPath), strings.ToUpper(strings.TrimPrefix(ext, ".")))
+		}
+		return nil
+	}
+
+	want := expectedType(virtualPath)
+	if want == "" || isHTML(want) {
+		return nil
+	}
+	if isHTML(mediaType(http.DetectContentType(prefix))) {
+		return suspicious("content of %s looks like an HTML page", path.Base(virtualPath))
+	}
+	return nil
+}
+
+// StartsAtZero reports whether a 200 or 206 response body begins at the
+// first byte of the file, so that Sniff can be applied to it
+func StartsAtZero(statusCode int, header http.Header) bool {
+	if statusCode == http.StatusOK {
+		return true
+	}
+	return statusCode == http.StatusPartialContent && strings.HasPrefix(header.Get("Content-Range"), "bytes 0-")
+}
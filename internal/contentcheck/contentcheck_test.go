@@ -0,0 +1,105 @@
+package contentcheck
+
+import (
+	"net/http"
+	"testing"
+
+	"proxydav/pkg/types"
+)
+
+func TestCheckResponse(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+		length      int64
+		etag        string
+		cached      *types.FileMetadata
+		wantErr     bool
+	}{
+		{name: "zip as zip", path: "/a.zip", status: 200, contentType: "application/zip", length: 100},
+		{name: "zip as octet stream", path: "/a.zip", status: 200, contentType: "application/octet-stream", length: 100},
+		{name: "login page for zip", path: "/a.zip", status: 200, contentType: "text/html; charset=utf-8", length: 100, wantErr: true},
+		{name: "json error for pdf", path: "/a.pdf", status: 200, contentType: "application/json", length: 40, wantErr: true},
+		{name: "html for html", path: "/index.html", status: 200, contentType: "text/html", length: 100},
+		{name: "json for json", path: "/data.json", status: 200, contentType: "application/json", length: 100},
+		{name: "unknown extension", path: "/README", status: 200, contentType: "text/html", length: 100},
+		{name: "size change with new etag", path: "/a.bin", status: 200, length: 50, etag: `"v2"`,
+			cached: &types.FileMetadata{Size: 100, ETag: `"v1"`}, wantErr: true},
+		{name: "size change with same etag", path: "/a.bin", status: 200, length: 50, etag: `"v1"`,
+			cached: &types.FileMetadata{Size: 100, ETag: `"v1"`}, wantErr: true},
+		{name: "error page without etag", path: "/a.bin", status: 200, contentType: "application/octet-stream", length: 4096,
+			cached: &types.FileMetadata{Size: 1 << 20, ETag: `"v1"`}, wantErr: true},
+		{name: "same size with new etag", path: "/a.bin", status: 200, length: 100, etag: `"v2"`,
+			cached: &types.FileMetadata{Size: 100, ETag: `"v1"`}},
+		{name: "same size without etag", path: "/a.bin", status: 200, length: 100,
+			cached: &types.FileMetadata{Size: 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.contentType != "" {
+				header.Set("Content-Type", tt.contentType)
+			}
+			if tt.etag != "" {
+				header.Set("ETag", tt.etag)
+			}
+			err := CheckResponse(tt.path, tt.status, header, tt.length, tt.cached)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckResponse error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckResponse_ETagChanged(t *testing.T) {
+	cached := &types.FileMetadata{Size: 100, ETag: `"v1"`}
+	header := http.Header{}
+	if err := CheckResponse("/a.bin", http.StatusOK, header, 50, cached); err == nil || ETagChanged(err) {
+		t.Errorf("Expected a size mismatch without an ETag to be refused outright, got %v", err)
+	}
+	header.Set("ETag", `"v2"`)
+	if err := CheckResponse("/a.bin", http.StatusOK, header, 50, cached); !ETagChanged(err) {
+		t.Errorf("Expected a size mismatch under a new ETag to be reported as such, got %v", err)
+	}
+}
+
+func TestCheckResponse_PartialContentUsesTotal(t *testing.T) {
+	header := http.Header{}
+	header.Set("Content-Range", "bytes 0-9/100")
+	header.Set("ETag", `"v1"`)
+	cached := &types.FileMetadata{Size: 100, ETag: `"v1"`}
+
+	if err := CheckResponse("/a.bin", http.StatusPartialContent, header, 10, cached); err != nil {
+		t.Errorf("Expected range response of a known file to pass, got %v", err)
+	}
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		prefix  string
+		wantErr bool
+	}{
+		{name: "zip signature", path: "/a.zip", prefix: "PK\x03\x04rest"},
+		{name: "html as zip", path: "/a.zip", prefix: "<!DOCTYPE html><html>", wantErr: true},
+		{name: "pdf signature", path: "/doc.pdf", prefix: "%PDF-1.7"},
+		{name: "captcha as pdf", path: "/doc.pdf", prefix: "<html><body>captcha", wantErr: true},
+		{name: "html as text", path: "/notes.txt", prefix: "<!doctype html><title>Login</title>", wantErr: true},
+		{name: "plain text", path: "/notes.txt", prefix: "hello world"},
+		{name: "html page", path: "/index.html", prefix: "<html></html>"},
+		{name: "short prefix", path: "/a.zip", prefix: "P"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Sniff(tt.path, []byte(tt.prefix))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Sniff error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -12,17 +12,20 @@ import (
 )
 
 type VirtualFS struct {
-	items map[string]*types.VirtualItem
-	dirs  map[string]bool
-	store *storage.PersistentStore
-	mutex sync.RWMutex // Add mutex for thread safety
+	items    map[string]*types.VirtualItem
+	dirs     map[string]bool
+	archives map[string]*types.ArchiveIndex // indexes of mounted archives by mount path
+	store    *storage.PersistentStore
+	release  func(fileURL string) // deletes stored content no entry refers to anymore
+	mutex    sync.RWMutex         // Add mutex for thread safety
 }
 
 func New(store *storage.PersistentStore) (*VirtualFS, error) {
 	vfs := &VirtualFS{
-		items: make(map[string]*types.VirtualItem),
-		dirs:  make(map[string]bool),
-		store: store,
+		items:    make(map[string]*types.VirtualItem),
+		dirs:     make(map[string]bool),
+		archives: make(map[string]*types.ArchiveIndex),
+		store:    store,
 	}
 
 	vfs.dirs["/"] = true
@@ -33,23 +36,54 @@ func New(store *storage.PersistentStore) (*VirtualFS, error) {
 	}
 
 	for _, file := range files {
-		vfs.addFileToMemory(file.Path, file.URL)
+		if file.Kind == types.EntryKindZip {
+			// An archive whose index was never fetched is mounted empty
+			index, err := store.GetArchiveIndex(file.URL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load archive index for %s: %w", file.Path, err)
+			}
+			vfs.addArchiveToMemory(file, index)
+			continue
+		}
+		vfs.addFileToMemory(file)
 	}
 
 	return vfs, nil
 }
 
+// fileItem builds the in-memory item for a file entry. A mounted archive is a directory.
+func fileItem(entry types.FileEntry) *types.VirtualItem {
+	return &types.VirtualItem{
+		Name:  path.Base(entry.Path),
+		Path:  entry.Path,
+		URL:   entry.URL,
+		IsDir: entry.Kind == types.EntryKindZip,
+		Entry: &entry,
+	}
+}
+
+// isMount reports whether item is a mounted archive
+func isMount(item *types.VirtualItem) bool {
+	return item.Entry != nil && item.Entry.Kind == types.EntryKindZip
+}
+
+// relocate returns a copy of item's entry at newPath
+func relocate(item *types.VirtualItem, newPath string) types.FileEntry {
+	entry := types.FileEntry{URL: item.URL}
+	if item.Entry != nil {
+		entry = *item.Entry
+	}
+	entry.Path = newPath
+	return entry
+}
+
 // addFileToMemory adds a file to the in-memory virtual filesystem (used during initialization)
-func (vfs *VirtualFS) addFileToMemory(filePath, fileURL string) {
-	filePath = path.Clean("/" + strings.TrimPrefix(filePath, "/"))
+func (vfs *VirtualFS) addFileToMemory(entry types.FileEntry) {
+	filePath := path.Clean("/" + strings.TrimPrefix(entry.Path, "/"))
+	entry.Path = filePath
 
 	// Add the file itself
-	vfs.items[filePath] = &types.VirtualItem{
-		Name:  path.Base(filePath),
-		Path:  filePath,
-		URL:   fileURL,
-		IsDir: false,
-	}
+	vfs.items[filePath] = fileItem(entry)
 
 	// Add all parent directories
 	dir := path.Dir(filePath)
@@ -67,6 +101,210 @@ func (vfs *VirtualFS) addFileToMemory(filePath, fileURL string) {
 	}
 }
 
+// addArchiveToMemory mounts an archive entry and lists its members below it
+func (vfs *VirtualFS) addArchiveToMemory(entry types.FileEntry, index *types.ArchiveIndex) {
+	vfs.addFileToMemory(entry)
+	mountPath := entry.Path
+	vfs.dirs[mountPath] = true
+	if index == nil {
+		return
+	}
+	vfs.archives[mountPath] = index
+
+	for i := range index.Members {
+		member := &index.Members[i]
+		// Cleaning against the root keeps names like "../x" inside the mount
+		relativePath := path.Clean("/" + member.Name)
+		if relativePath == "/" {
+			continue
+		}
+		memberPath := mountPath + relativePath
+
+		if strings.HasSuffix(member.Name, "/") {
+			vfs.addArchiveDirs(mountPath, memberPath)
+			continue
+		}
+		vfs.addArchiveDirs(mountPath, path.Dir(memberPath))
+		if _, exists := vfs.items[memberPath]; exists {
+			continue
+		}
+		vfs.items[memberPath] = &types.VirtualItem{
+			Name:    path.Base(memberPath),
+			Path:    memberPath,
+			Archive: mountPath,
+			Member:  member,
+		}
+	}
+}
+
+// addArchiveDirs creates the directories between mountPath and dirPath inside an archive
+func (vfs *VirtualFS) addArchiveDirs(mountPath, dirPath string) {
+	for dir := dirPath; dir != mountPath && strings.HasPrefix(dir, mountPath+"/"); dir = path.Dir(dir) {
+		if _, exists := vfs.items[dir]; exists {
+			continue
+		}
+		vfs.dirs[dir] = true
+		vfs.items[dir] = &types.VirtualItem{
+			Name:    path.Base(dir),
+			Path:    dir,
+			IsDir:   true,
+			Archive: mountPath,
+		}
+	}
+}
+
+// removeArchiveMembers drops the members listed below a mount from memory
+func (vfs *VirtualFS) removeArchiveMembers(mountPath string) {
+	for itemPath, item := range vfs.items {
+		if item.Archive == mountPath {
+			delete(vfs.items, itemPath)
+			delete(vfs.dirs, itemPath)
+		}
+	}
+	delete(vfs.archives, mountPath)
+}
+
+// insideArchive reports whether filePath is a mounted archive or lies within one
+func (vfs *VirtualFS) insideArchive(filePath string) bool {
+	for dir := filePath; dir != "/" && dir != "."; dir = path.Dir(dir) {
+		if item, exists := vfs.items[dir]; exists && (item.Archive != "" || isMount(item)) {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteArchiveIndex removes a stored index unless another mount still uses it
+func (vfs *VirtualFS) deleteArchiveIndex(archiveURL string) {
+	for _, index := range vfs.archives {
+		if index.URL == archiveURL {
+			return
+		}
+	}
+	_ = vfs.store.DeleteArchiveIndex(archiveURL)
+}
+
+// SetContentRelease sets the function called with the URL of content that
+// was stored for entries, such as inline content or uploads, once no entry
+// refers to it anymore
+func (vfs *VirtualFS) SetContentRelease(release func(fileURL string)) {
+	vfs.mutex.Lock()
+	defer vfs.mutex.Unlock()
+	vfs.release = release
+}
+
+// releaseContent releases stored content unless another entry still uses it.
+// Remote URLs are never stored by us.
+func (vfs *VirtualFS) releaseContent(fileURL string) {
+	if vfs.release == nil || fileURL == "" || types.IsRemoteURL(fileURL) {
+		return
+	}
+	for _, item := range vfs.items {
+		if item.Entry == nil {
+			continue
+		}
+		for _, used := range item.Entry.URLs() {
+			if used == fileURL {
+				return
+			}
+		}
+	}
+	vfs.release(fileURL)
+}
+
+// ReleaseContent releases stored content that no entry uses, such as
+// content stored for an entry that could not be added
+func (vfs *VirtualFS) ReleaseContent(fileURL string) {
+	vfs.mutex.Lock()
+	defer vfs.mutex.Unlock()
+	vfs.releaseContent(fileURL)
+}
+
+// InArchive reports whether filePath lies inside a mounted archive, where
+// nothing can be added, changed or removed. The mount itself is not inside.
+func (vfs *VirtualFS) InArchive(filePath string) bool {
+	vfs.mutex.RLock()
+	defer vfs.mutex.RUnlock()
+	if item, exists := vfs.items[filePath]; exists && isMount(item) {
+		return false
+	}
+	return vfs.insideArchive(filePath)
+}
+
+// GetArchive returns the entry and index of the archive mounted at mountPath
+func (vfs *VirtualFS) GetArchive(mountPath string) (*types.FileEntry, *types.ArchiveIndex, bool) {
+	vfs.mutex.RLock()
+	defer vfs.mutex.RUnlock()
+
+	item, exists := vfs.items[mountPath]
+	if !exists || !isMount(item) {
+		return nil, nil, false
+	}
+	index := vfs.archives[mountPath]
+	return item.Entry, index, index != nil
+}
+
+// IsMount reports whether a mounted archive is at filePath
+func (vfs *VirtualFS) IsMount(filePath string) bool {
+	vfs.mutex.RLock()
+	defer vfs.mutex.RUnlock()
+	item, exists := vfs.items[filePath]
+	return exists && isMount(item)
+}
+
+// AddArchive mounts a remote archive at entry.Path using its parsed index
+func (vfs *VirtualFS) AddArchive(entry types.FileEntry, index *types.ArchiveIndex) error {
+	vfs.mutex.Lock()
+	defer vfs.mutex.Unlock()
+
+	mountPath := path.Clean("/" + strings.TrimPrefix(entry.Path, "/"))
+	entry.Path = mountPath
+	entry.Kind = types.EntryKindZip
+
+	if mountPath == "/" {
+		return fmt.Errorf("cannot mount an archive at the root")
+	}
+	if _, exists := vfs.items[mountPath]; exists || vfs.dirs[mountPath] {
+		return fmt.Errorf("path already exists: %s", mountPath)
+	}
+	if vfs.insideArchive(path.Dir(mountPath)) {
+		return fmt.Errorf("cannot add entries inside a mounted archive: %s", mountPath)
+	}
+
+	if err := vfs.store.SetArchiveIndex(index); err != nil {
+		return fmt.Errorf("failed to persist archive index: %w", err)
+	}
+	if err := vfs.store.SetFileEntry(&entry); err != nil {
+		return fmt.Errorf("failed to persist file entry: %w", err)
+	}
+
+	vfs.addArchiveToMemory(entry, index)
+	return nil
+}
+
+// ReplaceArchiveIndex relists a mounted archive from a freshly read index
+func (vfs *VirtualFS) ReplaceArchiveIndex(mountPath string, index *types.ArchiveIndex) error {
+	vfs.mutex.Lock()
+	defer vfs.mutex.Unlock()
+
+	mountPath = path.Clean("/" + strings.TrimPrefix(mountPath, "/"))
+	item, exists := vfs.items[mountPath]
+	if !exists || !isMount(item) {
+		return fmt.Errorf("no archive mounted at path: %s", mountPath)
+	}
+	if index.URL != item.URL {
+		return fmt.Errorf("index is for %s, mount points to %s", index.URL, item.URL)
+	}
+
+	if err := vfs.store.SetArchiveIndex(index); err != nil {
+		return fmt.Errorf("failed to persist archive index: %w", err)
+	}
+
+	vfs.removeArchiveMembers(mountPath)
+	vfs.addArchiveToMemory(*item.Entry, index)
+	return nil
+}
+
 // Exists checks if a path exists in the virtual filesystem
 func (vfs *VirtualFS) Exists(path string) bool {
 	vfs.mutex.RLock()
@@ -156,10 +394,16 @@ func (vfs *VirtualFS) GetAllPaths() []string {
 
 // AddFile adds a new file to the virtual filesystem and persists it
 func (vfs *VirtualFS) AddFile(filePath, fileURL string) error {
+	return vfs.AddEntry(types.FileEntry{Path: filePath, URL: fileURL})
+}
+
+// AddEntry adds a new file with all of its entry fields and persists it
+func (vfs *VirtualFS) AddEntry(entry types.FileEntry) error {
 	vfs.mutex.Lock()
 	defer vfs.mutex.Unlock()
 
-	filePath = path.Clean("/" + strings.TrimPrefix(filePath, "/"))
+	filePath := path.Clean("/" + strings.TrimPrefix(entry.Path, "/"))
+	entry.Path = filePath
 
 	// Check if file already exists
 	if _, exists := vfs.items[filePath]; exists {
@@ -171,17 +415,22 @@ func (vfs *VirtualFS) AddFile(filePath, fileURL string) error {
 		return fmt.Errorf("directory exists at path: %s", filePath)
 	}
 
-	// Persist to storage first
-	entry := &types.FileEntry{
-		Path: filePath,
-		URL:  fileURL,
+	if vfs.insideArchive(path.Dir(filePath)) {
+		return fmt.Errorf("cannot add entries inside a mounted archive: %s", filePath)
 	}
-	if err := vfs.store.SetFileEntry(entry); err != nil {
+
+	// Persist to storage first
+	if err := vfs.store.SetFileEntry(&entry); err != nil {
 		return fmt.Errorf("failed to persist file entry: %w", err)
 	}
 
-	// Add to memory
-	vfs.addFileToMemory(filePath, fileURL)
+	// Add to memory; an archive is listed from a previously stored index, if any
+	if entry.Kind == types.EntryKindZip {
+		index, _ := vfs.store.GetArchiveIndex(entry.URL)
+		vfs.addArchiveToMemory(entry, index)
+		return nil
+	}
+	vfs.addFileToMemory(entry)
 	return nil
 }
 
@@ -203,17 +452,44 @@ func (vfs *VirtualFS) UpdateFile(filePath, fileURL string) error {
 		return fmt.Errorf("cannot update directory at path: %s", filePath)
 	}
 
+	if item.Member != nil {
+		return fmt.Errorf("archive members are read-only: %s", filePath)
+	}
+
 	// Persist to storage first
-	entry := &types.FileEntry{
-		Path: filePath,
-		URL:  fileURL,
+	entry := relocate(item, filePath)
+	entry.URL = fileURL
+	if err := vfs.store.SetFileEntry(&entry); err != nil {
+		return fmt.Errorf("failed to persist file entry: %w", err)
+	}
+
+	// Update in memory, dropping content the old URL no longer needs
+	vfs.items[filePath] = fileItem(entry)
+	vfs.releaseContent(item.URL)
+	return nil
+}
+
+// UpdateEntry replaces the stored entry of an existing file, keeping its path
+func (vfs *VirtualFS) UpdateEntry(entry types.FileEntry) error {
+	vfs.mutex.Lock()
+	defer vfs.mutex.Unlock()
+
+	filePath := path.Clean("/" + strings.TrimPrefix(entry.Path, "/"))
+	entry.Path = filePath
+
+	item, exists := vfs.items[filePath]
+	if !exists || item.Entry == nil || isMount(item) {
+		return fmt.Errorf("file not found at path: %s", filePath)
 	}
-	if err := vfs.store.SetFileEntry(entry); err != nil {
+
+	if err := vfs.store.SetFileEntry(&entry); err != nil {
 		return fmt.Errorf("failed to persist file entry: %w", err)
 	}
 
-	// Update in memory
-	item.URL = fileURL
+	vfs.items[filePath] = fileItem(entry)
+	for _, fileURL := range item.Entry.URLs() {
+		vfs.releaseContent(fileURL)
+	}
 	return nil
 }
 
@@ -235,36 +511,41 @@ func (vfs *VirtualFS) RemoveFile(filePath string) error {
 		return fmt.Errorf("cannot remove directory at path: %s", filePath)
 	}
 
+	if item.Member != nil {
+		return fmt.Errorf("archive members are read-only: %s", filePath)
+	}
+
 	// Remove from persistent storage first
 	if err := vfs.store.DeleteFileEntry(filePath); err != nil {
 		return fmt.Errorf("failed to remove file entry from storage: %w", err)
 	}
 
-	// Also remove associated metadata if it exists
-	if item.URL != "" {
-		_ = vfs.store.DeleteFileMetadata(item.URL) // Don't fail if metadata doesn't exist
+	// Also remove associated metadata and link health if they exist
+	for _, fileURL := range item.Entry.URLs() {
+		_ = vfs.store.DeleteFileMetadata(fileURL) // Don't fail if metadata doesn't exist
+		_ = vfs.store.DeleteLinkHealth(fileURL)
 	}
 
 	// Remove from memory
 	delete(vfs.items, filePath)
+	for _, fileURL := range item.Entry.URLs() {
+		vfs.releaseContent(fileURL)
+	}
 
 	// Clean up empty parent directories
 	vfs.cleanupEmptyDirectories(filePath)
 	return nil
 }
 
-// GetAllFiles returns all files (not directories) in the filesystem
+// GetAllFiles returns all file entries in the filesystem, including mounted archives but not their members
 func (vfs *VirtualFS) GetAllFiles() []types.FileEntry {
 	vfs.mutex.RLock()
 	defer vfs.mutex.RUnlock()
 
 	var files []types.FileEntry
 	for _, item := range vfs.items {
-		if !item.IsDir {
-			files = append(files, types.FileEntry{
-				Path: item.Path,
-				URL:  item.URL,
-			})
+		if item.Entry != nil {
+			files = append(files, relocate(item, item.Path))
 		}
 	}
 
@@ -276,6 +557,31 @@ func (vfs *VirtualFS) GetAllFiles() []types.FileEntry {
 	return files
 }
 
+// GetFilesUnder returns the file at filePath, or every file below it when it is a directory
+func (vfs *VirtualFS) GetFilesUnder(filePath string) []types.FileEntry {
+	vfs.mutex.RLock()
+	defer vfs.mutex.RUnlock()
+
+	filePath = path.Clean("/" + strings.TrimPrefix(filePath, "/"))
+	prefix := strings.TrimSuffix(filePath, "/") + "/"
+
+	var files []types.FileEntry
+	for itemPath, item := range vfs.items {
+		if item.Entry == nil {
+			continue
+		}
+		if itemPath == filePath || strings.HasPrefix(itemPath, prefix) {
+			files = append(files, relocate(item, item.Path))
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+
+	return files
+}
+
 // cleanupEmptyDirectories removes empty parent directories after file removal
 func (vfs *VirtualFS) cleanupEmptyDirectories(filePath string) {
 	dir := path.Dir(filePath)
@@ -317,19 +623,24 @@ func (vfs *VirtualFS) MoveFile(sourcePath, destPath string) error {
 		return fmt.Errorf("cannot move directory: %s", sourcePath)
 	}
 
+	if sourceItem.Member != nil {
+		return fmt.Errorf("archive members are read-only: %s", sourcePath)
+	}
+
 	if _, exists := vfs.items[destPath]; exists {
 		return fmt.Errorf("destination already exists: %s", destPath)
 	}
 
+	if vfs.insideArchive(path.Dir(destPath)) {
+		return fmt.Errorf("cannot add entries inside a mounted archive: %s", destPath)
+	}
+
 	// Create destination directories if they don't exist
 	vfs.ensureDirectoriesExist(destPath)
 
-	newEntry := &types.FileEntry{
-		Path: destPath,
-		URL:  sourceItem.URL,
-	}
+	newEntry := relocate(sourceItem, destPath)
 
-	if err := vfs.store.SetFileEntry(newEntry); err != nil {
+	if err := vfs.store.SetFileEntry(&newEntry); err != nil {
 		return fmt.Errorf("failed to persist moved file entry: %w", err)
 	}
 
@@ -340,12 +651,7 @@ func (vfs *VirtualFS) MoveFile(sourcePath, destPath string) error {
 	}
 
 	// Update in memory - create new item
-	vfs.items[destPath] = &types.VirtualItem{
-		Name:  path.Base(destPath),
-		Path:  destPath,
-		URL:   sourceItem.URL,
-		IsDir: false,
-	}
+	vfs.items[destPath] = fileItem(newEntry)
 
 	// Remove old item from memory
 	delete(vfs.items, sourcePath)
@@ -371,27 +677,27 @@ func (vfs *VirtualFS) CopyFile(sourcePath, destPath string) error {
 		return fmt.Errorf("cannot copy directory: %s", sourcePath)
 	}
 
+	if sourceItem.Member != nil {
+		return fmt.Errorf("cannot copy archive member: %s", sourcePath)
+	}
+
 	if _, exists := vfs.items[destPath]; exists {
 		return fmt.Errorf("destination already exists: %s", destPath)
 	}
 
+	if vfs.insideArchive(path.Dir(destPath)) {
+		return fmt.Errorf("cannot add entries inside a mounted archive: %s", destPath)
+	}
+
 	vfs.ensureDirectoriesExist(destPath)
 
-	newEntry := &types.FileEntry{
-		Path: destPath,
-		URL:  sourceItem.URL,
-	}
+	newEntry := relocate(sourceItem, destPath)
 
-	if err := vfs.store.SetFileEntry(newEntry); err != nil {
+	if err := vfs.store.SetFileEntry(&newEntry); err != nil {
 		return fmt.Errorf("failed to persist copied file entry: %w", err)
 	}
 
-	vfs.items[destPath] = &types.VirtualItem{
-		Name:  path.Base(destPath),
-		Path:  destPath,
-		URL:   sourceItem.URL,
-		IsDir: false,
-	}
+	vfs.items[destPath] = fileItem(newEntry)
 
 	return nil
 }
@@ -411,6 +717,10 @@ func (vfs *VirtualFS) RemoveDirectory(dirPath string) error {
 		return fmt.Errorf("directory not found: %s", dirPath)
 	}
 
+	if item, exists := vfs.items[dirPath]; exists && item.Archive != "" {
+		return fmt.Errorf("archive members are read-only: %s", dirPath)
+	}
+
 	var itemsToRemove []string
 	for itemPath := range vfs.items {
 		if strings.HasPrefix(itemPath, dirPath+"/") || itemPath == dirPath {
@@ -418,23 +728,36 @@ func (vfs *VirtualFS) RemoveDirectory(dirPath string) error {
 		}
 	}
 
-	// Remove all files from storage first
+	// Remove all files and mounted archives from storage first
 	for _, itemPath := range itemsToRemove {
-		if item, exists := vfs.items[itemPath]; exists && !item.IsDir {
+		if item, exists := vfs.items[itemPath]; exists && item.Entry != nil {
 			if err := vfs.store.DeleteFileEntry(itemPath); err != nil {
 				return fmt.Errorf("failed to remove file entry %s: %w", itemPath, err)
 			}
-			// Also remove associated metadata if it exists
-			if item.URL != "" {
-				_ = vfs.store.DeleteFileMetadata(item.URL)
+			// Also remove associated metadata and link health if they exist
+			for _, fileURL := range item.Entry.URLs() {
+				_ = vfs.store.DeleteFileMetadata(fileURL)
+				_ = vfs.store.DeleteLinkHealth(fileURL)
 			}
 		}
 	}
 
 	// Remove from memory
+	var removedURLs []string
 	for _, itemPath := range itemsToRemove {
+		item := vfs.items[itemPath]
+		if isMount(item) {
+			delete(vfs.archives, itemPath)
+			vfs.deleteArchiveIndex(item.URL)
+		}
+		if item.Entry != nil {
+			removedURLs = append(removedURLs, item.Entry.URLs()...)
+		}
 		delete(vfs.items, itemPath)
 	}
+	for _, fileURL := range removedURLs {
+		vfs.releaseContent(fileURL)
+	}
 
 	// Remove directory entries
 	var dirsToRemove []string
@@ -469,6 +792,14 @@ func (vfs *VirtualFS) MoveDirectory(sourcePath, destPath string) error {
 		return fmt.Errorf("destination already exists: %s", destPath)
 	}
 
+	if item, exists := vfs.items[sourcePath]; exists && item.Archive != "" {
+		return fmt.Errorf("archive members are read-only: %s", sourcePath)
+	}
+
+	if vfs.insideArchive(path.Dir(destPath)) {
+		return fmt.Errorf("cannot add entries inside a mounted archive: %s", destPath)
+	}
+
 	vfs.ensureDirectoriesExist(destPath)
 
 	var itemsToMove []string
@@ -479,17 +810,14 @@ func (vfs *VirtualFS) MoveDirectory(sourcePath, destPath string) error {
 	}
 
 	for _, itemPath := range itemsToMove {
-		if item, exists := vfs.items[itemPath]; exists && !item.IsDir {
+		if item, exists := vfs.items[itemPath]; exists && item.Entry != nil {
 			// Calculate new path
 			relativePath := strings.TrimPrefix(itemPath, sourcePath)
 			newPath := destPath + relativePath
 
-			newEntry := &types.FileEntry{
-				Path: newPath,
-				URL:  item.URL,
-			}
+			newEntry := relocate(item, newPath)
 
-			if err := vfs.store.SetFileEntry(newEntry); err != nil {
+			if err := vfs.store.SetFileEntry(&newEntry); err != nil {
 				return fmt.Errorf("failed to persist moved file entry %s: %w", newPath, err)
 			}
 
@@ -507,14 +835,12 @@ func (vfs *VirtualFS) MoveDirectory(sourcePath, destPath string) error {
 			relativePath := strings.TrimPrefix(itemPath, sourcePath)
 			newPath := destPath + relativePath
 
-			newItem := &types.VirtualItem{
-				Name:  path.Base(newPath),
-				Path:  newPath,
-				URL:   item.URL,
-				IsDir: item.IsDir,
-			}
-			newItems[newPath] = newItem
+			newItems[newPath] = relocateItem(item, sourcePath, destPath)
 			delete(vfs.items, itemPath)
+			if index, mounted := vfs.archives[itemPath]; mounted {
+				vfs.archives[newPath] = index
+				delete(vfs.archives, itemPath)
+			}
 		}
 	}
 
@@ -558,6 +884,14 @@ func (vfs *VirtualFS) CopyDirectory(sourcePath, destPath string) error {
 		return fmt.Errorf("destination already exists: %s", destPath)
 	}
 
+	if item, exists := vfs.items[sourcePath]; exists && item.Archive != "" {
+		return fmt.Errorf("archive members are read-only: %s", sourcePath)
+	}
+
+	if vfs.insideArchive(path.Dir(destPath)) {
+		return fmt.Errorf("cannot add entries inside a mounted archive: %s", destPath)
+	}
+
 	vfs.ensureDirectoriesExist(destPath)
 
 	var itemsToCopy []string
@@ -568,16 +902,13 @@ func (vfs *VirtualFS) CopyDirectory(sourcePath, destPath string) error {
 	}
 
 	for _, itemPath := range itemsToCopy {
-		if item, exists := vfs.items[itemPath]; exists && !item.IsDir {
+		if item, exists := vfs.items[itemPath]; exists && item.Entry != nil {
 			relativePath := strings.TrimPrefix(itemPath, sourcePath)
 			newPath := destPath + relativePath
 
-			newEntry := &types.FileEntry{
-				Path: newPath,
-				URL:  item.URL,
-			}
+			newEntry := relocate(item, newPath)
 
-			if err := vfs.store.SetFileEntry(newEntry); err != nil {
+			if err := vfs.store.SetFileEntry(&newEntry); err != nil {
 				return fmt.Errorf("failed to persist copied file entry %s: %w", newPath, err)
 			}
 		}
@@ -588,13 +919,10 @@ func (vfs *VirtualFS) CopyDirectory(sourcePath, destPath string) error {
 			relativePath := strings.TrimPrefix(itemPath, sourcePath)
 			newPath := destPath + relativePath
 
-			newItem := &types.VirtualItem{
-				Name:  path.Base(newPath),
-				Path:  newPath,
-				URL:   item.URL,
-				IsDir: item.IsDir,
+			vfs.items[newPath] = relocateItem(item, sourcePath, destPath)
+			if index, mounted := vfs.archives[itemPath]; mounted {
+				vfs.archives[newPath] = index
 			}
-			vfs.items[newPath] = newItem
 		}
 	}
 
@@ -614,6 +942,26 @@ func (vfs *VirtualFS) CopyDirectory(sourcePath, destPath string) error {
 	return nil
 }
 
+// relocateItem returns a copy of an item below sourcePath moved below destPath
+func relocateItem(item *types.VirtualItem, sourcePath, destPath string) *types.VirtualItem {
+	newPath := destPath + strings.TrimPrefix(item.Path, sourcePath)
+	if item.Entry != nil {
+		return fileItem(relocate(item, newPath))
+	}
+
+	newItem := &types.VirtualItem{
+		Name:   path.Base(newPath),
+		Path:   newPath,
+		URL:    item.URL,
+		IsDir:  item.IsDir,
+		Member: item.Member,
+	}
+	if item.Archive != "" {
+		newItem.Archive = destPath + strings.TrimPrefix(item.Archive, sourcePath)
+	}
+	return newItem
+}
+
 func (vfs *VirtualFS) ensureDirectoriesExist(filePath string) {
 	dir := path.Dir(filePath)
 	for dir != "/" && dir != "." {
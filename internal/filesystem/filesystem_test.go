@@ -237,3 +237,120 @@ func TestVirtualFS_RemoveFile(t *testing.T) {
 		t.Error("File should be removed from persistent storage")
 	}
 }
+
+func TestVirtualFS_MovePreservesEntryFields(t *testing.T) {
+	tempDir := t.TempDir()
+
+	store, err := storage.New(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	vfs, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+
+	checksums := map[string]string{"md5": "d41d8cd98f00b204e9800998ecf8427e"}
+	err = vfs.AddEntry(types.FileEntry{Path: "/a/file.bin", URL: "https://example.com/file.bin", Checksums: checksums})
+	if err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	if err := vfs.MoveDirectory("/a", "/b"); err != nil {
+		t.Fatalf("Failed to move directory: %v", err)
+	}
+	if err := vfs.CopyFile("/b/file.bin", "/c/file.bin"); err != nil {
+		t.Fatalf("Failed to copy file: %v", err)
+	}
+
+	for _, filePath := range []string{"/b/file.bin", "/c/file.bin"} {
+		item, exists := vfs.GetItem(filePath)
+		if !exists || item.Entry == nil || item.Entry.Checksums["md5"] != checksums["md5"] {
+			t.Errorf("Expected checksums to survive at %s, got %+v", filePath, item)
+		}
+
+		stored, err := store.GetFileEntry(filePath)
+		if err != nil || stored == nil || stored.Checksums["md5"] != checksums["md5"] {
+			t.Errorf("Expected persisted checksums at %s, got %+v", filePath, stored)
+		}
+	}
+}
+
+func TestVirtualFS_MountedArchive(t *testing.T) {
+	tempDir := t.TempDir()
+
+	store, err := storage.New(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+
+	vfs, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+
+	index := &types.ArchiveIndex{
+		URL: "https://example.com/bundle.zip",
+		Members: []types.ArchiveMember{
+			{Name: "docs/", Size: 0},
+			{Name: "docs/readme.txt", Size: 12},
+			{Name: "../escape.txt", Size: 3},
+		},
+	}
+	if err := vfs.AddArchive(types.FileEntry{Path: "/bundle", URL: index.URL}, index); err != nil {
+		t.Fatalf("Failed to mount archive: %v", err)
+	}
+
+	for _, dir := range []string{"/bundle", "/bundle/docs"} {
+		if !vfs.IsDir(dir) {
+			t.Errorf("Expected %s to be a directory", dir)
+		}
+	}
+	item, exists := vfs.GetItem("/bundle/docs/readme.txt")
+	if !exists || item.Member == nil || item.Archive != "/bundle" {
+		t.Fatalf("Expected archive member, got %+v", item)
+	}
+	if !vfs.Exists("/bundle/escape.txt") || vfs.Exists("/escape.txt") {
+		t.Error("Expected member names to stay inside the mount")
+	}
+
+	if err := vfs.RemoveFile("/bundle/docs/readme.txt"); err == nil {
+		t.Error("Expected members to be read-only")
+	}
+	if err := vfs.AddFile("/bundle/new.txt", "https://example.com/new.txt"); err == nil {
+		t.Error("Expected adding inside a mount to fail")
+	}
+	if files := vfs.GetAllFiles(); len(files) != 1 || files[0].Kind != types.EntryKindZip {
+		t.Errorf("Expected only the mount entry to be listed, got %+v", files)
+	}
+
+	// Mounts survive a restart from the stored entry and index
+	reloaded, err := New(store)
+	if err != nil {
+		t.Fatalf("Failed to reload VFS: %v", err)
+	}
+	if !reloaded.Exists("/bundle/docs/readme.txt") {
+		t.Error("Expected members to be listed after reload")
+	}
+
+	if err := vfs.MoveDirectory("/bundle", "/archives/bundle"); err != nil {
+		t.Fatalf("Failed to move mount: %v", err)
+	}
+	item, exists = vfs.GetItem("/archives/bundle/docs/readme.txt")
+	if !exists || item.Archive != "/archives/bundle" {
+		t.Errorf("Expected members to move with the mount, got %+v", item)
+	}
+	if _, _, ok := vfs.GetArchive("/archives/bundle"); !ok {
+		t.Error("Expected index to follow the mount")
+	}
+
+	if err := vfs.RemoveDirectory("/archives/bundle"); err != nil {
+		t.Fatalf("Failed to remove mount: %v", err)
+	}
+	if stored, _ := store.GetArchiveIndex(index.URL); stored != nil {
+		t.Error("Expected archive index to be deleted with the mount")
+	}
+}
@@ -0,0 +1,162 @@
+// Package forwarded resolves the client and the external URL of requests
+// that reach ProxyDAV through trusted reverse proxies
+package forwarded
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Info describes a request as the client made it
+type Info struct {
+	ClientIP string // address of the client
+	Scheme   string // http or https
+	Host     string // host, and port if any, the client connected to
+	Prefix   string // path ProxyDAV is served under, without a trailing slash
+	Proxied  bool   // the request came through a trusted proxy
+}
+
+// Origin returns the scheme and host the client connected to
+func (i Info) Origin() string {
+	return i.Scheme + "://" + i.Host
+}
+
+// Proxies lists the addresses of trusted reverse proxies. A nil *Proxies
+// trusts nothing.
+type Proxies struct {
+	nets []*net.IPNet
+}
+
+// ParseProxies parses addresses and CIDRs of trusted proxies
+func ParseProxies(entries []string) (*Proxies, error) {
+	proxies := &Proxies{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies.nets = append(proxies.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy CIDR %q", entry)
+		}
+		proxies.nets = append(proxies.nets, ipNet)
+	}
+	return proxies, nil
+}
+
+// Len returns the number of trusted addresses and ranges
+func (p *Proxies) Len() int {
+	if p == nil {
+		return 0
+	}
+	return len(p.nets)
+}
+
+// Trusts reports whether addr, an IP with or without a port, is a trusted proxy
+func (p *Proxies) Trusts(addr string) bool {
+	if p == nil {
+		return false
+	}
+	ip := net.ParseIP(hostOf(addr))
+	if ip == nil {
+		return false
+	}
+	for _, ipNet := range p.nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve describes r as the client made it. The X-Forwarded-* headers
+// only count when the request comes from a trusted proxy.
+func (p *Proxies) Resolve(r *http.Request) Info {
+	info := Info{ClientIP: hostOf(r.RemoteAddr), Scheme: "http", Host: r.Host}
+	if r.TLS != nil {
+		info.Scheme = "https"
+	}
+	if !p.Trusts(r.RemoteAddr) {
+		return info
+	}
+	info.Proxied = true
+
+	// The rightmost address that is not a trusted proxy is the client;
+	// addresses left of it may have been made up by the client
+	if header := r.Header.Values("X-Forwarded-For"); len(header) > 0 {
+		hops := strings.Split(strings.Join(header, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := hostOf(strings.TrimSpace(hops[i]))
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			info.ClientIP = hop
+			if !p.Trusts(hop) {
+				break
+			}
+		}
+	}
+	if proto := strings.ToLower(first(r.Header.Get("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+		info.Scheme = proto
+	}
+	if host := first(r.Header.Get("X-Forwarded-Host")); host != "" && !strings.ContainsAny(host, "/\\@ ") {
+		info.Host = host
+	}
+	if prefix := first(r.Header.Get("X-Forwarded-Prefix")); prefix != "" {
+		info.Prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	}
+	return info
+}
+
+type infoKey struct{}
+
+// WithInfo returns a context carrying the resolved description of a request
+func WithInfo(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// From returns the description of r resolved by the server, or one made
+// from r itself when there is none
+func From(r *http.Request) Info {
+	if info, ok := r.Context().Value(infoKey{}).(Info); ok {
+		return info
+	}
+	return (*Proxies)(nil).Resolve(r)
+}
+
+// Prefix returns the path prefix of the request of ctx
+func Prefix(ctx context.Context) string {
+	info, _ := ctx.Value(infoKey{}).(Info)
+	return info.Prefix
+}
+
+// first returns the first of comma-separated header values, as proxies
+// append theirs to the list
+func first(value string) string {
+	value, _, _ = strings.Cut(value, ",")
+	return strings.TrimSpace(value)
+}
+
+// hostOf strips the port of an address, if it has one
+func hostOf(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
@@ -0,0 +1,98 @@
+package forwarded
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseProxies(t *testing.T) {
+	proxies, err := ParseProxies([]string{"10.0.0.0/8", " 192.0.2.7 ", "::1", ""})
+	if err != nil {
+		t.Fatalf("ParseProxies failed: %v", err)
+	}
+	if proxies.Len() != 3 {
+		t.Errorf("Expected 3 entries, got %d", proxies.Len())
+	}
+	for addr, want := range map[string]bool{
+		"10.1.2.3:4567":       true,
+		"192.0.2.7":           true,
+		"192.0.2.8:80":        false,
+		"[::1]:8080":          true,
+		"::2":                 false,
+		"not an address":      false,
+		"[::ffff:10.0.0.1]:1": true,
+	} {
+		if got := proxies.Trusts(addr); got != want {
+			t.Errorf("Trusts(%q) = %v, want %v", addr, got, want)
+		}
+	}
+
+	for _, entry := range []string{"10.0.0.0/33", "proxy.example.com"} {
+		if _, err := ParseProxies([]string{entry}); err == nil {
+			t.Errorf("Expected %q to be refused", entry)
+		}
+	}
+	if (*Proxies)(nil).Trusts("127.0.0.1:1") {
+		t.Error("Expected no proxies to trust nothing")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	proxies, _ := ParseProxies([]string{"10.0.0.0/8"})
+
+	req := httptest.NewRequest("GET", "/docs/", nil)
+	req.RemoteAddr = "10.0.0.5:4000"
+	req.Header.Set("X-Forwarded-For", "6.6.6.6, 203.0.113.9, 10.0.0.4")
+	req.Header.Set("X-Forwarded-Proto", "HTTPS")
+	req.Header.Set("X-Forwarded-Host", "dav.example.com")
+	req.Header.Set("X-Forwarded-Prefix", "/files/")
+	info := proxies.Resolve(req)
+	want := Info{ClientIP: "203.0.113.9", Scheme: "https", Host: "dav.example.com", Prefix: "/files", Proxied: true}
+	if info != want {
+		t.Errorf("Resolve = %+v, want %+v", info, want)
+	}
+	if info.Origin() != "https://dav.example.com" {
+		t.Errorf("Unexpected origin %s", info.Origin())
+	}
+
+	// The same headers from anyone else are ignored
+	req.RemoteAddr = "203.0.113.9:4000"
+	req.TLS = &tls.ConnectionState{}
+	info = proxies.Resolve(req)
+	want = Info{ClientIP: "203.0.113.9", Scheme: "https", Host: "example.com"}
+	if info != want {
+		t.Errorf("Resolve = %+v, want %+v", info, want)
+	}
+
+	// Bad values fall back to what the connection says
+	req = httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:4000"
+	req.Header.Set("X-Forwarded-For", "garbage")
+	req.Header.Set("X-Forwarded-Proto", "gopher")
+	req.Header.Set("X-Forwarded-Host", "evil.example.com/path")
+	req.Header.Set("X-Forwarded-Prefix", "/../")
+	info = proxies.Resolve(req)
+	want = Info{ClientIP: "10.0.0.5", Scheme: "http", Host: "example.com", Proxied: true}
+	if info != want {
+		t.Errorf("Resolve = %+v, want %+v", info, want)
+	}
+}
+
+func TestFrom(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	if info := From(req); info.ClientIP != "192.0.2.1" || info.Proxied {
+		t.Errorf("Expected the connection's details without resolved ones, got %+v", info)
+	}
+	if Prefix(req.Context()) != "" {
+		t.Error("Expected no prefix without resolved details")
+	}
+
+	req = req.WithContext(WithInfo(req.Context(), Info{ClientIP: "203.0.113.9", Prefix: "/dav"}))
+	if info := From(req); info.ClientIP != "203.0.113.9" {
+		t.Errorf("Expected the resolved details, got %+v", info)
+	}
+	if Prefix(req.Context()) != "/dav" {
+		t.Errorf("Unexpected prefix %q", Prefix(req.Context()))
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"proxydav/internal/acl"
+	"proxydav/internal/auth"
+	"proxydav/internal/webdav"
+	"proxydav/pkg/types"
+)
+
+// requestAccess returns what the user making r may do with itemPath
+func requestAccess(acls *acl.List, r *http.Request, itemPath string) acl.Access {
+	access := acls.Access(auth.UserFrom(r.Context()), itemPath)
+	if token := auth.TokenFrom(r.Context()); token != nil {
+		access = min(access, tokenAccess(token, itemPath))
+	}
+	return access
+}
+
+// requestTreeAccess returns the least access the user making r has
+// anywhere below itemPath
+func requestTreeAccess(acls *acl.List, r *http.Request, itemPath string) acl.Access {
+	access := acls.TreeAccess(auth.UserFrom(r.Context()), itemPath)
+	if token := auth.TokenFrom(r.Context()); token != nil {
+		access = min(access, tokenAccess(token, itemPath))
+	}
+	return access
+}
+
+// tokenAccess limits an API token to its path prefix. The directories
+// leading to the prefix can be listed so clients can navigate to it.
+func tokenAccess(token *types.APIToken, itemPath string) acl.Access {
+	switch {
+	case auth.InScope(token, itemPath) && auth.TokenRole(token) != types.RoleReader:
+		return acl.Write
+	case auth.InScope(token, itemPath):
+		return acl.Read
+	case itemPath == "/" || strings.HasPrefix(token.PathPrefix, itemPath+"/"):
+		return acl.Read
+	}
+	return acl.Hidden
+}
+
+// authorize checks that the user making r has at least want on itemPath,
+// or on its whole subtree when tree is set, and writes an error otherwise.
+// Hidden paths answer like missing ones so their names don't leak.
+func authorize(w http.ResponseWriter, r *http.Request, acls *acl.List, itemPath string, want acl.Access, tree bool) bool {
+	access := requestAccess(acls, r, itemPath)
+	if access == acl.Hidden {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return false
+	}
+	if tree {
+		access = requestTreeAccess(acls, r, itemPath)
+	}
+	if access < want {
+		http.Error(w, "Forbidden: you don't have "+want.String()+" access to "+itemPath, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// privileges returns the RFC 3744 current-user-privilege-set for access
+func privileges(access acl.Access) *webdav.PrivilegeSet {
+	switch access {
+	case acl.Write:
+		return webdav.Privileges("read", "read-current-user-privilege-set", "write-content", "bind", "unbind")
+	case acl.Read:
+		return webdav.Privileges("read", "read-current-user-privilege-set")
+	default:
+		return webdav.Privileges()
+	}
+}
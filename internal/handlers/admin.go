@@ -1,23 +1,42 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
+	"proxydav/internal/acl"
+	"proxydav/internal/archive"
+	"proxydav/internal/auth"
+	"proxydav/internal/backend"
 	"proxydav/internal/config"
 	"proxydav/internal/filesystem"
+	"proxydav/internal/forwarded"
+	"proxydav/internal/linkcheck"
 	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
 	"proxydav/pkg/types"
 )
 
 type AdminHandler struct {
 	vfs           *filesystem.VirtualFS
 	store         *storage.PersistentStore
+	users         *auth.Users
+	tokens        *auth.Tokens
+	shares        *auth.Shares
+	lockouts      *auth.Lockouts
+	audit         *auth.Audit
+	acls          *acl.List
+	policy        *upstream.Policy
+	links         *linkcheck.Checker
+	archives      *archive.Reader
+	backends      *backend.Registry
 	config        *config.Config
 	configUpdater config.ConfigUpdater
 	template      *template.Template
@@ -29,7 +48,12 @@ type ServerController interface {
 	Shutdown() error
 }
 
-func NewAdminHandler(vfs *filesystem.VirtualFS, store *storage.PersistentStore, cfg *config.Config, configUpdater config.ConfigUpdater) *AdminHandler {
+// PasswordChecker checks passwords with the server's authentication methods
+type PasswordChecker interface {
+	CheckPassword(method, username, password string) (*types.User, error)
+}
+
+func NewAdminHandler(vfs *filesystem.VirtualFS, store *storage.PersistentStore, users *auth.Users, tokens *auth.Tokens, shares *auth.Shares, lockouts *auth.Lockouts, audit *auth.Audit, acls *acl.List, policy *upstream.Policy, links *linkcheck.Checker, archives *archive.Reader, backends *backend.Registry, cfg *config.Config, configUpdater config.ConfigUpdater) *AdminHandler {
 	tmpl := template.Must(template.New("admin").Funcs(template.FuncMap{
 		"formatTime": func(t time.Time) string {
 			return t.Format("2006-01-02 15:04:05")
@@ -46,11 +70,27 @@ func NewAdminHandler(vfs *filesystem.VirtualFS, store *storage.PersistentStore,
 			}
 			return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
 		},
+		"join": strings.Join,
+		// Replaced for each page by renderTemplate
+		"nonce":     func() string { return "" },
+		"csrfToken": func() string { return "" },
+		"base":      func() string { return "" },
+		"davURL":    func() string { return "" },
 	}).Parse(adminTemplate))
 
 	return &AdminHandler{
 		vfs:           vfs,
 		store:         store,
+		users:         users,
+		tokens:        tokens,
+		shares:        shares,
+		lockouts:      lockouts,
+		audit:         audit,
+		acls:          acls,
+		policy:        policy,
+		links:         links,
+		archives:      archives,
+		backends:      backends,
 		config:        cfg,
 		configUpdater: configUpdater,
 		template:      tmpl,
@@ -58,6 +98,11 @@ func NewAdminHandler(vfs *filesystem.VirtualFS, store *storage.PersistentStore,
 }
 
 func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	setSecurityHeaders(w)
+	if !checkCSRF(w, r) {
+		return
+	}
+
 	path := strings.TrimPrefix(r.URL.Path, "/admin")
 
 	switch {
@@ -67,10 +112,26 @@ func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleConfig(w, r)
 	case path == "/files":
 		h.handleFiles(w, r)
+	case path == "/links":
+		h.handleLinks(w, r)
 	case path == "/import":
 		h.handleImport(w, r)
+	case path == "/users":
+		h.handleUsers(w, r)
+	case path == "/tokens":
+		h.handleTokens(w, r)
+	case path == "/acls":
+		h.handleACLs(w, r)
+	case path == "/logins":
+		h.handleLogins(w, r)
+	case path == "/shares":
+		h.handleShares(w, r)
 	case path == "/export":
 		h.handleExport(w, r)
+	case path == "/api/csrf":
+		h.handleCSRFAPI(w, r)
+	case path == "/api/mode":
+		h.handleModeAPI(w, r)
 	case path == "/api/config":
 		h.handleConfigAPI(w, r)
 	case path == "/api/files":
@@ -79,6 +140,30 @@ func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleImportAPI(w, r)
 	case path == "/api/delete-file":
 		h.handleDeleteFileAPI(w, r)
+	case path == "/api/users":
+		h.handleUsersAPI(w, r)
+	case strings.HasPrefix(path, "/api/users/"):
+		h.handleUserAPI(w, r, strings.TrimPrefix(path, "/api/users/"))
+	case path == "/api/tokens":
+		h.handleTokensAPI(w, r)
+	case strings.HasPrefix(path, "/api/tokens/"):
+		h.handleTokenAPI(w, r, strings.TrimPrefix(path, "/api/tokens/"))
+	case path == "/api/shares":
+		h.handleSharesAPI(w, r)
+	case strings.HasPrefix(path, "/api/shares/"):
+		h.handleShareAPI(w, r, strings.TrimPrefix(path, "/api/shares/"))
+	case path == "/api/lockouts":
+		h.handleLockoutsAPI(w, r)
+	case strings.HasPrefix(path, "/api/lockouts/"):
+		h.handleLockoutAPI(w, r, strings.TrimPrefix(path, "/api/lockouts/"))
+	case path == "/api/logins":
+		h.handleLoginsAPI(w, r)
+	case path == "/api/acls":
+		h.handleACLsAPI(w, r)
+	case strings.HasPrefix(path, "/api/acls/"):
+		h.handleACLAPI(w, r, strings.TrimPrefix(path, "/api/acls"))
+	case path == "/api/links/check":
+		h.handleLinkCheckAPI(w, r)
 	case path == "/api/restart":
 		h.handleRestartAPI(w, r)
 	case path == "/api/shutdown":
@@ -103,7 +188,7 @@ func (h *AdminHandler) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		Section:   "dashboard",
 	}
 
-	h.renderTemplate(w, "dashboard", data)
+	h.renderTemplate(w, r, "dashboard", data)
 }
 
 func (h *AdminHandler) handleConfig(w http.ResponseWriter, r *http.Request) {
@@ -117,7 +202,7 @@ func (h *AdminHandler) handleConfig(w http.ResponseWriter, r *http.Request) {
 		Section: "config",
 	}
 
-	h.renderTemplate(w, "config", data)
+	h.renderTemplate(w, r, "config", data)
 }
 
 func (h *AdminHandler) handleFiles(w http.ResponseWriter, r *http.Request) {
@@ -133,7 +218,7 @@ func (h *AdminHandler) handleFiles(w http.ResponseWriter, r *http.Request) {
 		Section: "files",
 	}
 
-	h.renderTemplate(w, "files", data)
+	h.renderTemplate(w, r, "files", data)
 }
 
 func (h *AdminHandler) handleImport(w http.ResponseWriter, r *http.Request) {
@@ -145,7 +230,63 @@ func (h *AdminHandler) handleImport(w http.ResponseWriter, r *http.Request) {
 		Section: "import",
 	}
 
-	h.renderTemplate(w, "import", data)
+	h.renderTemplate(w, r, "import", data)
+}
+
+func (h *AdminHandler) handleLinks(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("status")
+	all, err := h.links.Reports("")
+	if err != nil {
+		http.Error(w, "Failed to retrieve link health", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Title   string
+		Section string
+		Filter  string
+		Links   []linkcheck.Report
+		OK      int
+		Broken  int
+		Unknown int
+		Running bool
+		LastRun time.Time
+	}{
+		Title:   "Link Health",
+		Section: "links",
+		Filter:  filter,
+	}
+	data.Running, data.LastRun = h.links.Running()
+
+	for _, report := range all {
+		switch report.Health.Status {
+		case types.LinkStatusOK:
+			data.OK++
+		case types.LinkStatusBroken:
+			data.Broken++
+		default:
+			data.Unknown++
+		}
+		if filter == "" || report.Health.Status == filter {
+			data.Links = append(data.Links, report)
+		}
+	}
+
+	h.renderTemplate(w, r, "links", data)
+}
+
+func (h *AdminHandler) handleLinkCheckAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !h.links.RunNow() {
+		renderAlerts(w, alert{Kind: "warning", Title: "Busy:", Message: "A link check is already running."})
+		return
+	}
+
+	renderAlerts(w, alert{Kind: "info", Icon: "sync", Title: "Link check started.", Message: "Reload this page to see the results."})
 }
 
 func (h *AdminHandler) handleExport(w http.ResponseWriter, r *http.Request) {
@@ -176,6 +317,9 @@ func (h *AdminHandler) handleConfigAPI(w http.ResponseWriter, r *http.Request) {
 	case http.MethodGet:
 		h.handleGetConfig(w, r)
 	case http.MethodPost:
+		if !h.confirmed(w, r) {
+			return
+		}
 		h.handleUpdateConfig(w, r)
 	default:
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -216,36 +360,86 @@ func (h *AdminHandler) handleUpdateConfig(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	newConfig.UseRedirect = r.FormValue("use_redirect") == "on"
-	newConfig.AuthEnabled = r.FormValue("auth_enabled") == "on"
+	if ttl := r.FormValue("metadata_ttl"); ttl != "" {
+		if d, err := time.ParseDuration(ttl); err != nil {
+			errors = append(errors, "Invalid metadata TTL")
+		} else {
+			newConfig.MetadataTTL = d
+		}
+	}
 
-	if newConfig.AuthEnabled {
-		if authUser := r.FormValue("auth_user"); authUser != "" {
-			newConfig.AuthUser = authUser
+	if interval := r.FormValue("metadata_refresh_interval"); interval != "" {
+		if d, err := time.ParseDuration(interval); err != nil {
+			errors = append(errors, "Invalid metadata refresh interval")
+		} else {
+			newConfig.MetadataRefreshInterval = d
 		}
-		if authPass := r.FormValue("auth_pass"); authPass != "" && authPass != "••••••••" {
-			newConfig.AuthPass = authPass
+	}
+
+	if concurrencyStr := r.FormValue("metadata_host_concurrency"); concurrencyStr != "" {
+		if concurrency, err := strconv.Atoi(concurrencyStr); err != nil || concurrency < 1 {
+			errors = append(errors, "Requests per host must be a positive number")
+		} else {
+			newConfig.MetadataHostConcurrency = concurrency
 		}
+	}
 
-		if newConfig.AuthUser == "" || newConfig.AuthPass == "" {
-			errors = append(errors, "Authentication requires both username and password")
+	if interval := r.FormValue("link_check_interval"); interval != "" {
+		if d, err := time.ParseDuration(interval); err != nil {
+			errors = append(errors, "Invalid link check interval")
+		} else {
+			newConfig.LinkCheckInterval = d
 		}
 	}
 
+	if thresholdStr := r.FormValue("link_check_failure_threshold"); thresholdStr != "" {
+		if threshold, err := strconv.Atoi(thresholdStr); err != nil || threshold < 1 {
+			errors = append(errors, "Failures before broken must be a positive number")
+		} else {
+			newConfig.LinkCheckFailureThreshold = threshold
+		}
+	}
+
+	if maxFile := r.FormValue("blob_max_file_mb"); maxFile != "" {
+		if mb, err := strconv.Atoi(maxFile); err != nil || mb < 0 {
+			errors = append(errors, "Max file size must be zero or a positive number")
+		} else {
+			newConfig.BlobMaxFileMB = mb
+		}
+	}
+
+	if maxTotal := r.FormValue("blob_max_total_mb"); maxTotal != "" {
+		if mb, err := strconv.Atoi(maxTotal); err != nil || mb < 0 {
+			errors = append(errors, "Max total size must be zero or a positive number")
+		} else {
+			newConfig.BlobMaxTotalMB = mb
+		}
+	}
+
+	if action := r.FormValue("link_check_action"); action != "" {
+		newConfig.LinkCheckAction = action
+	}
+
+	newConfig.AdminAddr = strings.TrimSpace(r.FormValue("admin_addr"))
+	newConfig.UseRedirect = r.FormValue("use_redirect") == "on"
+	newConfig.AuthEnabled = r.FormValue("auth_enabled") == "on"
+	newConfig.VerifyChecksums = r.FormValue("verify_checksums") == "on"
+	newConfig.ValidateResponses = r.FormValue("validate_responses") == "on"
+	newConfig.SniffResponses = r.FormValue("sniff_responses") == "on"
+	newConfig.UpstreamAllowHosts = splitFormList(r.FormValue("upstream_allow_hosts"))
+	newConfig.UpstreamDenyHosts = splitFormList(r.FormValue("upstream_deny_hosts"))
+	newConfig.UpstreamAllowPrivate = r.FormValue("upstream_allow_private") == "on"
+	newConfig.UpstreamProxies = splitLines(r.FormValue("upstream_proxies"))
+	newConfig.LocalRoots = splitLines(r.FormValue("local_roots"))
+	newConfig.BlobStoreEnabled = r.FormValue("blob_store_enabled") == "on"
+	newConfig.JunkPatterns = splitLines(r.FormValue("junk_patterns"))
+
 	if err := newConfig.Validate(); err != nil {
 		errors = append(errors, err.Error())
 	}
 
-	w.Header().Set("Content-Type", "text/html")
-
 	if len(errors) > 0 {
-		response := `<div class="alert alert-danger" role="alert">
-			<strong>Error:</strong> Configuration validation failed:<ul>`
-		for _, err := range errors {
-			response += fmt.Sprintf("<li>%s</li>", err)
-		}
-		response += `</ul></div>`
-		w.Write([]byte(response))
+		renderAlerts(w, alert{Kind: "danger", Title: "Error:", Message: "Configuration validation failed:", Items: errors})
 		return
 	}
 
@@ -253,40 +447,66 @@ func (h *AdminHandler) handleUpdateConfig(w http.ResponseWriter, r *http.Request
 	// Store original values for comparison
 	originalPort := h.config.Port
 	originalDataDir := h.config.DataDir
+	originalAdminAddr := h.config.AdminAddr
 
-	var response string
 	if err := h.configUpdater.UpdateConfig(&newConfig); err != nil {
-		response = fmt.Sprintf(`<div class="alert alert-danger" role="alert">
-			<strong>Error:</strong> Failed to apply configuration changes: %s
-		</div>`, err.Error())
-	} else {
-		// Update local config reference
-		h.config = h.configUpdater.GetConfig()
+		renderAlerts(w, errorAlert(fmt.Errorf("failed to apply configuration changes: %w", err)))
+		return
+	}
 
-		// Determine what requires restart
-		needsRestart := []string{}
-		if originalPort != newConfig.Port {
-			needsRestart = append(needsRestart, "Port change")
-		}
-		if originalDataDir != newConfig.DataDir {
-			needsRestart = append(needsRestart, "Data directory change")
-		}
+	// Update local config reference
+	h.config = h.configUpdater.GetConfig()
 
-		if len(needsRestart) > 0 {
-			response = fmt.Sprintf(`<div class="alert alert-warning" role="alert">
-				<i class="fas fa-exclamation-triangle me-2"></i>
-				<strong>Configuration Updated:</strong> Most changes applied successfully!<br>
-				<strong>Restart required for:</strong> %s
-			</div>`, strings.Join(needsRestart, ", "))
-		} else {
-			response = `<div class="alert alert-success" role="alert">
-				<i class="fas fa-check-circle me-2"></i>
-				<strong>Configuration Updated:</strong> All changes applied successfully and are now active!
-			</div>`
+	// Determine what requires restart
+	needsRestart := []string{}
+	if originalPort != newConfig.Port {
+		needsRestart = append(needsRestart, "Port change")
+	}
+	if originalDataDir != newConfig.DataDir {
+		needsRestart = append(needsRestart, "Data directory change")
+	}
+	if originalAdminAddr != newConfig.AdminAddr {
+		needsRestart = append(needsRestart, "Admin listener change")
+	}
+
+	if len(needsRestart) > 0 {
+		renderAlerts(w, alert{
+			Kind:    "warning",
+			Icon:    "exclamation-triangle",
+			Title:   "Configuration Updated:",
+			Message: "Most changes applied successfully! Restart required for:",
+			Items:   needsRestart,
+		})
+		return
+	}
+	renderAlerts(w, alert{
+		Kind:    "success",
+		Icon:    "check-circle",
+		Title:   "Configuration Updated:",
+		Message: "All changes applied successfully and are now active!",
+	})
+}
+
+// splitFormList splits a comma or newline separated form value
+func splitFormList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
 	}
+	return items
+}
 
-	w.Write([]byte(response))
+// splitLines splits a newline separated form value
+func splitLines(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "\n") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
 }
 
 func (h *AdminHandler) handleFilesAPI(w http.ResponseWriter, r *http.Request) {
@@ -315,9 +535,17 @@ func (h *AdminHandler) handleAddFile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	entry := types.FileEntry{Path: path, URL: url}
+	if r.FormValue("mount_archive") != "" {
+		entry.Kind = types.EntryKindZip
+	}
+
+	if err := validateFileEntry(r.Context(), h.policy, h.backends, &entry); err != nil {
+		http.Error(w, "Invalid file entry: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if err := h.store.SetFileEntry(&entry); err != nil {
-		http.Error(w, "Failed to add file", http.StatusInternalServerError)
+	if err := addEntry(r.Context(), h.vfs, h.archives, entry); err != nil {
+		http.Error(w, "Failed to add file: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -341,8 +569,17 @@ func (h *AdminHandler) handleDeleteFileAPI(w http.ResponseWriter, r *http.Reques
 		http.Error(w, "Path parameter required", http.StatusBadRequest)
 		return
 	}
+	if !h.confirmed(w, r) {
+		return
+	}
 
-	if err := h.store.DeleteFileEntry(path); err != nil {
+	var err error
+	if h.vfs.IsMount(path) {
+		err = h.vfs.RemoveDirectory(path)
+	} else {
+		err = h.vfs.RemoveFile(path)
+	}
+	if err != nil {
 		http.Error(w, "Failed to delete file", http.StatusInternalServerError)
 		return
 	}
@@ -379,34 +616,51 @@ func (h *AdminHandler) handleImportAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	successCount := 0
+	var rejected []string
 	for _, entry := range importData.Files {
-		if err := h.store.SetFileEntry(&entry); err == nil {
-			successCount++
+		if err := validateFileEntry(r.Context(), h.policy, h.backends, &entry); err != nil {
+			rejected = append(rejected, entry.Path+": "+err.Error())
+			continue
+		}
+		if err := addEntry(r.Context(), h.vfs, h.archives, entry); err != nil {
+			rejected = append(rejected, entry.Path+": "+err.Error())
+			continue
 		}
+		successCount++
 	}
 
-	response := fmt.Sprintf(`<div class="alert alert-success" role="alert">
-		<strong>Success:</strong> Imported %d of %d files successfully.
-	</div>`, successCount, len(importData.Files))
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(response))
+	alerts := []alert{{
+		Kind:    "success",
+		Title:   "Success:",
+		Message: fmt.Sprintf("Imported %d of %d files successfully.", successCount, len(importData.Files)),
+	}}
+	if len(rejected) > 0 {
+		alerts = append(alerts, alert{Kind: "warning", Title: "Rejected entries:", Items: rejected})
+	}
+	renderAlerts(w, alerts...)
 }
 
 func (h *AdminHandler) renderFileList(w http.ResponseWriter, files []types.FileEntry) {
 	fileListTemplate := `
 	{{range .}}
 	<tr>
-		<td class="path-cell">{{.Path}}</td>
+		<td class="path-cell">{{.Path}}{{if eq .Kind "zip"}} <span class="badge bg-secondary">ZIP</span>{{end}}</td>
 		<td class="url-cell">
+			{{if eq .Kind "concat"}}
+			<span class="badge bg-secondary">{{len .Parts}} parts</span>
+			{{range .Parts}}{{if remote .}}<a href="{{.}}" target="_blank" class="url-link d-block">{{.}}</a>{{else}}<code class="url-link d-block">{{.}}</code>{{end}}{{end}}
+			{{else if remote .URL}}
 			<a href="{{.URL}}" target="_blank" class="url-link">{{.URL}}</a>
+			{{else}}
+			<span class="badge bg-info text-dark">{{scheme .URL}}</span> <code class="url-link">{{.URL}}</code>
+			{{end}}
+			{{if eq .Kind "slice"}}<span class="badge bg-secondary">bytes {{.Offset}}+{{.Length}}</span>{{end}}
 		</td>
 		<td>
 			<button class="btn btn-outline-danger btn-sm" 
-					hx-delete="/admin/api/delete-file?path={{.Path}}" 
+					hx-delete="/admin/api/delete-file?path={{queryEscape .Path}}"
 					hx-target="#file-list"
-					hx-confirm="Are you sure you want to delete this file?"
-					onclick="this.disabled=true">
+					hx-confirm="Are you sure you want to delete this file?">
 				<i class="fas fa-trash"></i>
 			</button>
 		</td>
@@ -417,15 +671,59 @@ func (h *AdminHandler) renderFileList(w http.ResponseWriter, files []types.FileE
 	</tr>
 	{{end}}`
 
-	tmpl := template.Must(template.New("filelist").Parse(fileListTemplate))
+	tmpl := template.Must(template.New("filelist").Funcs(template.FuncMap{
+		"remote":      types.IsRemoteURL,
+		"scheme":      backend.Scheme,
+		"queryEscape": url.QueryEscape,
+	}).Parse(fileListTemplate))
 	tmpl.Execute(w, files)
 }
 
-func (h *AdminHandler) renderTemplate(w http.ResponseWriter, section string, data interface{}) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	if err := h.template.Execute(w, data); err != nil {
+// renderTemplate renders a page of the panel. Each page gets a script
+// nonce for its Content-Security-Policy and the session's CSRF token.
+func (h *AdminHandler) renderTemplate(w http.ResponseWriter, r *http.Request, section string, data interface{}) {
+	nonce, err := randomToken()
+	if err != nil {
+		http.Error(w, "Failed to create nonce", http.StatusInternalServerError)
+		return
+	}
+	token, err := csrfToken(w, r)
+	if err != nil {
+		http.Error(w, "Failed to create CSRF token", http.StatusInternalServerError)
+		return
+	}
+	tmpl, err := h.template.Clone()
+	if err != nil {
 		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
+	// Links follow the URL the client used when it came through a proxy;
+	// the WebDAV port is only known to be behind the same one when the
+	// panel shares it
+	info := forwarded.From(r)
+	scheme := "http"
+	if h.config.TLSEnabled() {
+		scheme = "https"
+	}
+	davURL := fmt.Sprintf("%s://localhost:%d", scheme, h.config.Port)
+	if info.Proxied && h.config.AdminAddr == "" {
+		davURL = info.Origin() + info.Prefix
+	}
+	tmpl.Funcs(template.FuncMap{
+		"nonce":     func() string { return nonce },
+		"csrfToken": func() string { return token },
+		"base":      func() string { return info.Prefix },
+		"davURL":    func() string { return davURL },
+	})
+
+	var page bytes.Buffer
+	if err := tmpl.Execute(&page, data); err != nil {
+		http.Error(w, "Template error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Security-Policy", fmt.Sprintf(pagePolicy, nonce))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page.Bytes())
 }
 
 func (h *AdminHandler) handleRestartAPI(w http.ResponseWriter, r *http.Request) {
@@ -433,38 +731,26 @@ func (h *AdminHandler) handleRestartAPI(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !h.confirmed(w, r) {
+		return
+	}
 
 	// Get server controller for restart
 	serverController := h.configUpdater.(ServerController)
 	if err := serverController.Restart(); err != nil {
-		response := fmt.Sprintf(`<div class="alert alert-danger" role="alert">
-			<i class="fas fa-exclamation-triangle me-2"></i>
-			<strong>Restart Failed:</strong> %s
-		</div>`, err.Error())
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(response))
+		renderAlerts(w, alert{Kind: "danger", Icon: "exclamation-triangle", Title: "Restart Failed:", Message: err.Error()})
 		return
 	}
 
-	response := `<div class="alert alert-success" role="alert">
-		<i class="fas fa-sync me-2"></i>
-		<strong>Restart Initiated:</strong> Server is restarting with the new configuration...
-		<div class="mt-2">
-			<div class="spinner-border spinner-border-sm me-2" role="status">
-				<span class="visually-hidden">Loading...</span>
-			</div>
-			This page will automatically reload once the server is back online.
-		</div>
-	</div>
-	<script>
-		setTimeout(function() {
-			// Reload the page after a short delay to allow restart
-			window.location.reload();
-		}, 3000);
-	</script>`
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(response))
+	// The panel reloads itself once the server is back
+	w.Header().Set("HX-Trigger", "serverRestarting")
+	renderAlerts(w, alert{
+		Kind:     "success",
+		Icon:     "sync",
+		Title:    "Restart Initiated:",
+		Message:  "Server is restarting with the new configuration...",
+		Progress: "This page will automatically reload once the server is back online.",
+	})
 }
 
 func (h *AdminHandler) handleShutdownAPI(w http.ResponseWriter, r *http.Request) {
@@ -472,29 +758,22 @@ func (h *AdminHandler) handleShutdownAPI(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if !h.confirmed(w, r) {
+		return
+	}
+
 	// Get server controller for shutdown
 	serverController := h.configUpdater.(ServerController)
 	if err := serverController.Shutdown(); err != nil {
-		response := fmt.Sprintf(`<div class="alert alert-danger" role="alert">
-			<i class="fas fa-exclamation-triangle me-2"></i>
-			<strong>Shutdown Failed:</strong> %s
-		</div>`, err.Error())
-		w.Header().Set("Content-Type", "text/html")
-		w.Write([]byte(response))
+		renderAlerts(w, alert{Kind: "danger", Icon: "exclamation-triangle", Title: "Shutdown Failed:", Message: err.Error()})
 		return
 	}
 
-	response := `<div class="alert alert-warning" role="alert">
-		<i class="fas fa-power-off me-2"></i>
-		<strong>Shutdown Initiated:</strong> Server is shutting down gracefully...
-		<div class="mt-2">
-			<div class="spinner-border spinner-border-sm me-2" role="status">
-				<span class="visually-hidden">Loading...</span>
-			</div>
-			The server will stop in a few seconds.
-		</div>
-	</div>`
-
-	w.Header().Set("Content-Type", "text/html")
-	w.Write([]byte(response))
+	renderAlerts(w, alert{
+		Kind:     "warning",
+		Icon:     "power-off",
+		Title:    "Shutdown Initiated:",
+		Message:  "Server is shutting down gracefully...",
+		Progress: "The server will stop in a few seconds.",
+	})
 }
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"proxydav/internal/acl"
+	"proxydav/pkg/types"
+)
+
+func (h *AdminHandler) handleACLs(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Title   string
+		Section string
+	}{
+		Title:   "Access Rules",
+		Section: "acls",
+	}
+
+	h.renderTemplate(w, r, "acls", data)
+}
+
+// handleACLsAPI lists ACLs or sets the rules of a path from a form or JSON
+// body. Setting an empty rule list removes the path's ACL.
+func (h *AdminHandler) handleACLsAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		acls := h.acls.All()
+		if isHTMX(r) {
+			h.renderACLList(w, acls)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: acls})
+
+	case http.MethodPost, http.MethodPut:
+		var request struct {
+			Path  string          `json:"path"`
+			Rules []types.ACLRule `json:"rules"`
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				h.aclResult(w, r, "", fmt.Errorf("invalid JSON: %w", err), "")
+				return
+			}
+		} else {
+			request.Path = strings.TrimSpace(r.FormValue("path"))
+			rules, err := acl.ParseRules(r.FormValue("rules"))
+			if err != nil {
+				h.aclResult(w, r, request.Path, err, "")
+				return
+			}
+			request.Rules = rules
+		}
+		if request.Path == "" {
+			h.aclResult(w, r, "", fmt.Errorf("path is required"), "")
+			return
+		}
+
+		saved, err := h.acls.Set(request.Path, request.Rules)
+		if err == nil && saved == nil {
+			h.aclResult(w, r, request.Path, nil, "Removed")
+			return
+		}
+		h.aclResult(w, r, request.Path, err, "Saved")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleACLAPI removes the ACL of the path following /admin/api/acls
+func (h *AdminHandler) handleACLAPI(w http.ResponseWriter, r *http.Request, itemPath string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.confirmed(w, r) {
+		return
+	}
+	itemPath = "/" + strings.TrimPrefix(itemPath, "/")
+	h.aclResult(w, r, itemPath, h.acls.Delete(itemPath), "Removed")
+}
+
+// aclResult reports the outcome of an ACL change, as an alert that makes
+// the panel reload its list or as JSON
+func (h *AdminHandler) aclResult(w http.ResponseWriter, r *http.Request, itemPath string, err error, action string) {
+	if isHTMX(r) {
+		if err != nil {
+			renderAlerts(w, errorAlert(err))
+			return
+		}
+		w.Header().Set("HX-Trigger", "aclsChanged")
+		renderAlerts(w, alert{Kind: "success", Message: action + " the rules of", Subject: itemPath, Detail: "."})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Message: action + " the rules of " + itemPath})
+}
+
+func (h *AdminHandler) renderACLList(w http.ResponseWriter, acls []types.ACL) {
+	aclListTemplate := `
+	{{range .}}
+	<tr>
+		<td class="path-cell">{{.Path}}</td>
+		<td>
+			{{range .Rules}}
+			<span class="badge {{if eq .Permission "write"}}bg-success{{else if eq .Permission "read"}}bg-info{{else}}bg-secondary{{end}} me-1">{{.Principal}}={{.Permission}}</span>
+			{{end}}
+		</td>
+		<td class="small text-muted">{{formatTime .Updated}}</td>
+		<td class="text-nowrap">
+			<button class="btn btn-outline-primary btn-sm" data-edit-acl data-path="{{.Path}}" data-rules="{{range .Rules}}{{.Principal}}={{.Permission}}&#10;{{end}}">
+				<i class="fas fa-edit"></i>
+			</button>
+			<button class="btn btn-outline-danger btn-sm"
+					hx-delete="/admin/api/acls{{escapePath .Path}}"
+					hx-target="#acl-alerts"
+					hx-confirm="Are you sure you want to remove these rules?">
+				<i class="fas fa-trash"></i>
+			</button>
+		</td>
+	</tr>
+	{{else}}
+	<tr>
+		<td colspan="4" class="text-center text-muted">No access rules; every account has the access of its role</td>
+	</tr>
+	{{end}}`
+
+	tmpl := template.Must(template.New("acllist").Funcs(template.FuncMap{
+		"escapePath": escapePath,
+		"formatTime": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04:05")
+		},
+	}).Parse(aclListTemplate))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, acls)
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// fragmentTemplates render the alerts that admin API calls answer htmx with
+var fragmentTemplates = template.Must(template.New("fragments").Parse(`
+{{define "alert"}}<div class="alert alert-{{.Kind}}" role="alert">
+	{{- if .Icon}}<i class="fas fa-{{.Icon}} me-2"></i>{{end}}
+	{{- if .Title}}<strong>{{.Title}}</strong> {{end}}{{.Message}}
+	{{- with .Subject}} <strong>{{.}}</strong>{{end}}{{.Detail}}
+	{{- if .Items}}<ul class="mb-0">{{range .Items}}<li>{{.}}</li>{{end}}</ul>{{end}}
+	{{- with .Code}}<br><code class="user-select-all">{{.}}</code>{{end}}
+	{{- with .Progress}}
+	<div class="mt-2">
+		<div class="spinner-border spinner-border-sm me-2" role="status">
+			<span class="visually-hidden">Loading...</span>
+		</div>
+		{{.}}
+	</div>
+	{{- end}}
+</div>{{end}}
+`))
+
+// alert is a Bootstrap alert. Every field is escaped as text.
+type alert struct {
+	Kind     string // success, info, warning or danger
+	Icon     string // Font Awesome icon name without the fa- prefix
+	Title    string // bold lead-in
+	Message  string
+	Subject  string // bold name the message is about
+	Detail   string // text after the subject
+	Items    []string
+	Code     string // copyable value, such as a new token
+	Progress string // text shown next to a spinner
+}
+
+// renderAlerts writes alerts as an htmx fragment
+func renderAlerts(w http.ResponseWriter, alerts ...alert) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	for _, a := range alerts {
+		if err := fragmentTemplates.ExecuteTemplate(w, "alert", a); err != nil {
+			log.Printf("❌ Failed to render alert: %v", err)
+			return
+		}
+	}
+}
+
+// errorAlert is the alert for a failed admin action
+func errorAlert(err error) alert {
+	return alert{Kind: "danger", Title: "Error:", Message: err.Error()}
+}
+
+// escapePath escapes a virtual path for use in a URL path, such as the
+// targets of hx-delete, which html/template only escapes as text
+func escapePath(itemPath string) string {
+	return (&url.URL{Path: itemPath}).EscapedPath()
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"time"
+
+	"proxydav/internal/auth"
+	"proxydav/pkg/types"
+)
+
+// Login events shown by default, and at most
+const (
+	defaultLoginEvents = 100
+	maxLoginEvents     = 1000
+)
+
+func (h *AdminHandler) handleLogins(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Title   string
+		Section string
+		Failed  bool
+	}{
+		Title:   "Logins",
+		Section: "logins",
+		Failed:  r.URL.Query().Get("failed") == "true",
+	}
+
+	h.renderTemplate(w, r, "logins", data)
+}
+
+// handleLockoutsAPI lists the addresses and usernames that are locked out
+func (h *AdminHandler) handleLockoutsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	lockouts := h.lockouts.List()
+	if isHTMX(r) {
+		h.renderLockoutList(w, lockouts)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: lockouts})
+}
+
+// handleLockoutAPI lifts one lockout, named by its key
+func (h *AdminHandler) handleLockoutAPI(w http.ResponseWriter, r *http.Request, key string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	err := h.lockouts.Unlock(key)
+
+	if isHTMX(r) {
+		if err != nil {
+			renderAlerts(w, errorAlert(err))
+			return
+		}
+		w.Header().Set("HX-Trigger", "lockoutsChanged")
+		renderAlerts(w, alert{Kind: "success", Message: "Unlocked", Subject: key})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, auth.ErrLockoutNotFound) {
+			status = http.StatusNotFound
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Message: "Unlocked " + key})
+}
+
+// handleLoginsAPI lists the login audit trail, newest first. ?failed=true
+// lists failures only, and ?limit= sets how many events are returned.
+func (h *AdminHandler) handleLoginsAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	limit := defaultLoginEvents
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxLoginEvents)
+	}
+	events, err := h.audit.List(limit, r.URL.Query().Get("failed") == "true")
+	if err != nil {
+		http.Error(w, "Failed to list login events", http.StatusInternalServerError)
+		return
+	}
+	if isHTMX(r) {
+		h.renderLoginList(w, events)
+		return
+	}
+	if events == nil {
+		events = []types.LoginEvent{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: events})
+}
+
+func (h *AdminHandler) renderLockoutList(w http.ResponseWriter, lockouts []auth.Lockout) {
+	lockoutListTemplate := `
+	{{range .}}
+	<tr>
+		<td><span class="badge {{if eq .Kind "user"}}bg-warning text-dark{{else}}bg-secondary{{end}}">{{.Kind}}</span></td>
+		<td class="path-cell">{{.Subject}}</td>
+		<td>{{.Failures}}</td>
+		<td class="small text-muted">{{formatTime .Until}}</td>
+		<td>
+			<button class="btn btn-outline-success btn-sm"
+					hx-delete="/admin/api/lockouts/{{.Key}}"
+					hx-target="#login-alerts">
+				<i class="fas fa-unlock"></i>
+			</button>
+		</td>
+	</tr>
+	{{else}}
+	<tr>
+		<td colspan="5" class="text-center text-muted">Nobody is locked out</td>
+	</tr>
+	{{end}}`
+
+	tmpl := template.Must(template.New("lockoutlist").Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Local().Format("2006-01-02 15:04:05")
+		},
+	}).Parse(lockoutListTemplate))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, lockouts)
+}
+
+func (h *AdminHandler) renderLoginList(w http.ResponseWriter, events []types.LoginEvent) {
+	loginListTemplate := `
+	{{range .}}
+	<tr>
+		<td class="small text-muted">{{formatTime .Time}}</td>
+		<td>{{if .Success}}<span class="badge bg-success">success</span>{{else}}<span class="badge bg-danger">failed</span>{{end}}</td>
+		<td>{{if .Username}}{{.Username}}{{else}}<span class="text-muted">&mdash;</span>{{end}}</td>
+		<td class="path-cell">{{.ClientIP}}</td>
+		<td class="small">{{if .Success}}{{.Method}}{{else}}{{.Reason}}{{end}}</td>
+		<td class="small text-muted">{{.UserAgent}}</td>
+	</tr>
+	{{else}}
+	<tr>
+		<td colspan="6" class="text-center text-muted">No logins recorded</td>
+	</tr>
+	{{end}}`
+
+	tmpl := template.Must(template.New("loginlist").Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Local().Format("2006-01-02 15:04:05")
+		},
+	}).Parse(loginListTemplate))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, events)
+}
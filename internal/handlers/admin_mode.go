@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"proxydav/internal/config"
+)
+
+// ModeResponse is the read-only and maintenance state of the server
+type ModeResponse struct {
+	ReadOnly              bool   `json:"read_only"`
+	Maintenance           bool   `json:"maintenance"`
+	MaintenanceMessage    string `json:"maintenance_message"`
+	MaintenanceRetryAfter string `json:"maintenance_retry_after"`
+}
+
+func newModeResponse(cfg *config.Config) ModeResponse {
+	return ModeResponse{
+		ReadOnly:              cfg.ReadOnly,
+		Maintenance:           cfg.Maintenance,
+		MaintenanceMessage:    cfg.MaintenanceMessage,
+		MaintenanceRetryAfter: cfg.MaintenanceRetryAfter.String(),
+	}
+}
+
+// handleModeAPI shows the read-only and maintenance modes, and switches
+// them. Only the fields a POST carries change.
+func (h *AdminHandler) handleModeAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		mode := newModeResponse(h.configUpdater.GetConfig())
+		if isHTMX(r) {
+			h.renderMode(w, mode)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: mode})
+	case http.MethodPost:
+		h.updateMode(w, r)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *AdminHandler) updateMode(w http.ResponseWriter, r *http.Request) {
+	newConfig := *h.configUpdater.GetConfig()
+	err := parseModeForm(r, &newConfig)
+	if err == nil {
+		if err = h.configUpdater.UpdateConfig(&newConfig); err != nil {
+			err = fmt.Errorf("failed to switch modes: %w", err)
+		}
+		// The configuration form starts from this copy
+		h.config = h.configUpdater.GetConfig()
+	}
+
+	if isHTMX(r) {
+		if err != nil {
+			renderAlerts(w, errorAlert(err))
+			return
+		}
+		w.Header().Set("HX-Trigger", "modeChanged")
+		renderAlerts(w, alert{Kind: "success", Message: modeSummary(h.config)})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Message: modeSummary(h.config), Data: newModeResponse(h.config)})
+}
+
+// parseModeForm applies the mode fields a form carries to cfg
+func parseModeForm(r *http.Request, cfg *config.Config) error {
+	if value := r.FormValue("read_only"); value != "" {
+		readOnly, err := parseSwitch("read_only", value)
+		if err != nil {
+			return err
+		}
+		cfg.ReadOnly = readOnly
+	}
+	if value := r.FormValue("maintenance"); value != "" {
+		maintenance, err := parseSwitch("maintenance", value)
+		if err != nil {
+			return err
+		}
+		cfg.Maintenance = maintenance
+	}
+	if _, ok := r.Form["maintenance_message"]; ok {
+		cfg.MaintenanceMessage = strings.TrimSpace(r.FormValue("maintenance_message"))
+	}
+	if value := strings.TrimSpace(r.FormValue("maintenance_retry_after")); value != "" {
+		retryAfter, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("maintenance_retry_after must be a duration such as 5m")
+		}
+		cfg.MaintenanceRetryAfter = retryAfter
+	}
+	return nil
+}
+
+// parseSwitch reads a mode switch from a form value
+func parseSwitch(name, value string) (bool, error) {
+	switch value {
+	case "true", "on":
+		return true, nil
+	case "false", "off":
+		return false, nil
+	}
+	return false, fmt.Errorf("%s must be true or false", name)
+}
+
+// modeSummary describes the modes the server is in
+func modeSummary(cfg *config.Config) string {
+	switch {
+	case cfg.Maintenance && cfg.ReadOnly:
+		return "The server is in maintenance mode, and read-only once it ends"
+	case cfg.Maintenance:
+		return "The server is in maintenance mode"
+	case cfg.ReadOnly:
+		return "The server is read-only"
+	}
+	return "The server is serving normally"
+}
+
+func (h *AdminHandler) renderMode(w http.ResponseWriter, mode ModeResponse) {
+	modeTemplate := `
+	<div class="row">
+		<div class="col-md-5 mb-3">
+			<h6>
+				Read-Only Mode
+				{{if .ReadOnly}}<span class="badge bg-warning text-dark">On</span>{{else}}<span class="badge bg-secondary">Off</span>{{end}}
+			</h6>
+			<p class="small text-muted">Downloads and listings keep working; WebDAV and API clients cannot add, change or delete files.</p>
+			<button class="btn btn-sm {{if .ReadOnly}}btn-outline-secondary{{else}}btn-warning{{end}}"
+					hx-post="/admin/api/mode" hx-vals='{"read_only": "{{if .ReadOnly}}false{{else}}true{{end}}"}'
+					hx-target="#mode-alerts">
+				<i class="fas fa-book-open me-2"></i>{{if .ReadOnly}}Turn Off{{else}}Turn On{{end}}
+			</button>
+		</div>
+		<div class="col-md-7 mb-3">
+			<h6>
+				Maintenance Mode
+				{{if .Maintenance}}<span class="badge bg-danger">On</span>{{else}}<span class="badge bg-secondary">Off</span>{{end}}
+			</h6>
+			<p class="small text-muted">Everything but health checks and this panel is answered with 503 Service Unavailable.</p>
+			<form hx-post="/admin/api/mode" hx-target="#mode-alerts">
+				<input type="hidden" name="maintenance" value="{{if .Maintenance}}false{{else}}true{{end}}">
+				<div class="row g-2">
+					<div class="col-md-7">
+						<input type="text" class="form-control form-control-sm" name="maintenance_message" value="{{.MaintenanceMessage}}" placeholder="ProxyDAV is down for maintenance, please try again later">
+					</div>
+					<div class="col-md-2">
+						<input type="text" class="form-control form-control-sm" name="maintenance_retry_after" value="{{.MaintenanceRetryAfter}}" title="Retry-After, such as 5m">
+					</div>
+					<div class="col-md-3">
+						<button type="submit" class="btn btn-sm w-100 {{if .Maintenance}}btn-outline-secondary{{else}}btn-danger{{end}}">
+							<i class="fas fa-tools me-2"></i>{{if .Maintenance}}Turn Off{{else}}Turn On{{end}}
+						</button>
+					</div>
+				</div>
+			</form>
+		</div>
+	</div>`
+
+	tmpl := template.Must(template.New("mode").Parse(modeTemplate))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, mode)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"proxydav/internal/auth"
+	"proxydav/internal/forwarded"
+	"proxydav/pkg/types"
+)
+
+// ConfirmPasswordHeader carries the password that confirms a destructive
+// admin action. The panel asks for it before sending such a request.
+const ConfirmPasswordHeader = "X-Confirm-Password"
+
+// confirmed checks that a destructive admin action carries the password the
+// user signed in with, and writes an error otherwise. htpasswd users confirm
+// with their htpasswd password; users of other methods with the password of
+// their account. Without authentication there is no account to confirm with.
+// API tokens and app passwords cannot confirm, as both are kept by clients,
+// so even admin tokens are refused these actions. Wrong passwords count
+// towards login lockouts like failed logins.
+func (h *AdminHandler) confirmed(w http.ResponseWriter, r *http.Request) bool {
+	user := auth.UserFrom(r.Context())
+	if user == nil {
+		return true
+	}
+	if auth.TokenFrom(r.Context()) != nil {
+		refuseUnconfirmed(w, "API tokens cannot confirm this action, sign in with an admin account")
+		return false
+	}
+
+	clientIP := forwarded.From(r).ClientIP
+	if wait := h.lockouts.Check(clientIP, user.Username); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too Many Requests: too many failed logins, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	password := r.Header.Get(ConfirmPasswordHeader)
+	if password == "" {
+		refuseUnconfirmed(w, "confirm this action with your password in the "+ConfirmPasswordHeader+" header")
+		return false
+	}
+	if err := h.checkPassword(r, user.Username, password); err != nil {
+		if !errors.Is(err, auth.ErrInvalidCredentials) && !errors.Is(err, auth.ErrNoCredentials) {
+			log.Printf("❌ Failed to confirm the password of %s: %v", user.Username, err)
+		}
+		h.confirmationFailed(r, clientIP, user.Username)
+		refuseUnconfirmed(w, "the confirmation password is wrong")
+		return false
+	}
+	return true
+}
+
+// checkPassword checks a confirmation password of username
+func (h *AdminHandler) checkPassword(r *http.Request, username, password string) error {
+	if checker, ok := h.configUpdater.(PasswordChecker); ok {
+		_, err := checker.CheckPassword(auth.MethodFrom(r.Context()), username, password)
+		if !errors.Is(err, auth.ErrNoCredentials) {
+			return err
+		}
+	}
+	// Methods without passwords of their own confirm with the account's
+	_, err := h.users.Authenticate(username, password)
+	return err
+}
+
+// confirmationFailed records a wrong confirmation password and counts it
+// towards a lockout
+func (h *AdminHandler) confirmationFailed(r *http.Request, clientIP, username string) {
+	event := types.LoginEvent{Username: username, ClientIP: clientIP, Reason: "wrong confirmation password", UserAgent: r.UserAgent()}
+	h.audit.Record(event)
+	if lockout := h.lockouts.Fail(clientIP, username); lockout > 0 {
+		log.Printf("🚫 Locked out %s from %s for %v after repeated wrong confirmation passwords", username, clientIP, lockout)
+		event.Reason = fmt.Sprintf("locked out for %v", lockout)
+		h.audit.Record(event)
+	}
+}
+
+// refuseUnconfirmed answers an unconfirmed action. The header tells the
+// panel to ask for the password again.
+func refuseUnconfirmed(w http.ResponseWriter, reason string) {
+	w.Header().Set("X-Confirm-Required", "true")
+	http.Error(w, "Forbidden: "+reason, http.StatusForbidden)
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"proxydav/internal/auth"
+	"proxydav/internal/forwarded"
+)
+
+const (
+	// CSRFCookie holds the token of a browser session with the admin panel
+	CSRFCookie = "proxydav_csrf"
+	// CSRFHeader must repeat the cookie's token on every request that changes something
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// pagePolicy allows the panel's own scripts, marked with a per-response
+// nonce, and the CDNs it loads Bootstrap, htmx and Font Awesome from
+const pagePolicy = "default-src 'none'; " +
+	"script-src 'nonce-%s' https://unpkg.com https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdn.jsdelivr.net https://cdnjs.cloudflare.com; " +
+	"font-src https://cdnjs.cloudflare.com; " +
+	"img-src 'self' data:; " +
+	"connect-src 'self'; " +
+	"form-action 'self'; " +
+	"base-uri 'none'; " +
+	"frame-ancestors 'none'"
+
+// setSecurityHeaders makes admin responses unframeable and keeps browsers
+// from interpreting them as anything but what they claim to be. Pages
+// replace the policy with pagePolicy.
+func setSecurityHeaders(w http.ResponseWriter) {
+	header := w.Header()
+	header.Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	header.Set("X-Frame-Options", "DENY")
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Referrer-Policy", "same-origin")
+	header.Set("Cross-Origin-Opener-Policy", "same-origin")
+	header.Set("Cache-Control", "no-store")
+}
+
+// safeMethod reports whether method only reads
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// checkCSRF refuses requests that change something unless they come from
+// the panel itself: their origin must be this server, and they must repeat
+// the session's CSRF token in CSRFHeader. Requests authenticated with an
+// API token or JWT are exempt, as browsers never send bearer tokens on
+// their own.
+func checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	method := auth.MethodFrom(r.Context())
+	if safeMethod(r.Method) || method == auth.MethodToken || method == auth.MethodJWT {
+		return true
+	}
+	if !sameOrigin(r) {
+		http.Error(w, "Forbidden: cross-origin request", http.StatusForbidden)
+		return false
+	}
+	cookie, err := r.Cookie(CSRFCookie)
+	token := r.Header.Get(CSRFHeader)
+	if err != nil || cookie.Value == "" || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+		http.Error(w, "Forbidden: missing or invalid CSRF token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// sameOrigin checks the Origin header, or the Referer when a browser sends
+// no Origin, against the host the client made the request to. Clients that send
+// neither still need the CSRF token.
+func sameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+		if source == "" {
+			return true
+		}
+	}
+	parsed, err := url.Parse(source)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	return parsed.Host == forwarded.From(r).Host
+}
+
+// csrfToken returns the CSRF token of the request's session, starting a
+// new session when it has none
+func csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(CSRFCookie); err == nil && len(cookie.Value) >= 32 {
+		return cookie.Value, nil
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     CSRFCookie,
+		Value:    token,
+		Path:     forwarded.Prefix(r.Context()) + "/admin",
+		HttpOnly: true,
+		Secure:   forwarded.From(r).Scheme == "https",
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// handleCSRFAPI hands scripts that sign in with a password the CSRF token
+// (and cookie) that the panel gets with its pages
+func (h *AdminHandler) handleCSRFAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, err := csrfToken(w, r)
+	if err != nil {
+		http.Error(w, "Failed to create CSRF token", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Data: map[string]string{"token": token, "header": CSRFHeader}})
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
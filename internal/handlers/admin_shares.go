@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxydav/internal/auth"
+	"proxydav/internal/forwarded"
+	"proxydav/pkg/types"
+)
+
+// shareView is a share as shown by the admin API, without its password hash
+type shareView struct {
+	ID           string    `json:"id"`
+	URL          string    `json:"url"`
+	Path         string    `json:"path"`
+	HasPassword  bool      `json:"has_password"`
+	Listing      bool      `json:"listing"`
+	MaxDownloads int       `json:"max_downloads"`
+	Downloads    int       `json:"downloads"`
+	Accesses     int       `json:"accesses"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+	Created      time.Time `json:"created"`
+	Expires      time.Time `json:"expires"`
+	LastAccess   time.Time `json:"last_access"`
+}
+
+func newShareView(ctx context.Context, share *types.Share) shareView {
+	return shareView{
+		ID:           share.ID,
+		URL:          shareURL(ctx, share),
+		Path:         share.Path,
+		HasPassword:  share.PasswordHash != "",
+		Listing:      share.Listing,
+		MaxDownloads: share.MaxDownloads,
+		Downloads:    share.Downloads,
+		Accesses:     share.Accesses,
+		CreatedBy:    share.CreatedBy,
+		Created:      share.Created,
+		Expires:      share.Expires,
+		LastAccess:   share.LastAccess,
+	}
+}
+
+// shareURL is the URL path of a share, below the prefix of a reverse proxy
+func shareURL(ctx context.Context, share *types.Share) string {
+	return forwarded.Prefix(ctx) + SharePrefix + share.ID + "/"
+}
+
+func (h *AdminHandler) handleShares(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Title   string
+		Section string
+	}{
+		Title:   "Share Links",
+		Section: "shares",
+	}
+
+	h.renderTemplate(w, r, "shares", data)
+}
+
+// handleSharesAPI lists shares or creates one from a form or JSON body
+func (h *AdminHandler) handleSharesAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		shares, err := h.shares.List()
+		if err != nil {
+			http.Error(w, "Failed to list shares", http.StatusInternalServerError)
+			return
+		}
+		views := make([]shareView, 0, len(shares))
+		for i := range shares {
+			views = append(views, newShareView(r.Context(), &shares[i]))
+		}
+		if isHTMX(r) {
+			h.renderShareList(w, views)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: views})
+
+	case http.MethodPost:
+		var request auth.ShareRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				h.shareResult(w, r, nil, fmt.Errorf("invalid JSON: %w", err), "")
+				return
+			}
+		} else {
+			r.ParseForm()
+			request.Path = r.FormValue("path")
+			request.Password = r.FormValue("password")
+			request.Listing = r.FormValue("listing") == "on"
+			if max := strings.TrimSpace(r.FormValue("max_downloads")); max != "" {
+				n, err := strconv.Atoi(max)
+				if err != nil {
+					h.shareResult(w, r, nil, fmt.Errorf("maximum downloads must be a number"), "")
+					return
+				}
+				request.MaxDownloads = n
+			}
+			if days := strings.TrimSpace(r.FormValue("expires_days")); days != "" {
+				n, err := strconv.Atoi(days)
+				if err != nil || n < 0 {
+					h.shareResult(w, r, nil, fmt.Errorf("expiry must be a number of days"), "")
+					return
+				}
+				if n > 0 {
+					request.Expires = time.Now().AddDate(0, 0, n)
+				}
+			}
+		}
+
+		sharePath := path.Clean("/" + strings.TrimPrefix(strings.TrimSpace(request.Path), "/"))
+		if strings.TrimSpace(request.Path) != "" && !h.vfs.Exists(sharePath) {
+			h.shareResult(w, r, nil, fmt.Errorf("%s does not exist", sharePath), "")
+			return
+		}
+
+		createdBy := ""
+		if user := auth.UserFrom(r.Context()); user != nil {
+			createdBy = user.Username
+		}
+		share, err := h.shares.Create(request, createdBy)
+		h.shareResult(w, r, share, err, "Created")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleShareAPI revokes one share
+func (h *AdminHandler) handleShareAPI(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.confirmed(w, r) {
+		return
+	}
+	err := h.shares.Revoke(id)
+	h.shareResult(w, r, &types.Share{ID: id}, err, "Revoked")
+}
+
+// shareResult reports the outcome of a share change, as an alert that
+// makes the panel reload its list or as JSON
+func (h *AdminHandler) shareResult(w http.ResponseWriter, r *http.Request, share *types.Share, err error, action string) {
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, auth.ErrShareNotFound):
+		status = http.StatusNotFound
+	case err != nil:
+		status = http.StatusBadRequest
+	case action == "Created":
+		status = http.StatusCreated
+	}
+
+	if isHTMX(r) {
+		if err != nil {
+			renderAlerts(w, errorAlert(err))
+			return
+		}
+		w.Header().Set("HX-Trigger", "sharesChanged")
+		if action == "Created" {
+			renderAlerts(w, alert{Kind: "success", Message: "Shared", Subject: share.Path, Detail: " at:", Code: shareURL(r.Context(), share)})
+			return
+		}
+		renderAlerts(w, alert{Kind: "success", Message: "Revoked the share link."})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err != nil {
+		json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if action == "Created" {
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Message: "Shared " + share.Path, Data: newShareView(r.Context(), share)})
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Message: "Revoked share " + share.ID})
+}
+
+func (h *AdminHandler) renderShareList(w http.ResponseWriter, shares []shareView) {
+	shareListTemplate := `
+	{{range .}}
+	<tr>
+		<td class="path-cell">{{.Path}}{{if .CreatedBy}}<div class="small text-muted">by {{.CreatedBy}}</div>{{end}}</td>
+		<td><a href="{{.URL}}" target="_blank" class="url-link">{{.URL}}</a></td>
+		<td>
+			{{if .HasPassword}}<span class="badge bg-secondary me-1"><i class="fas fa-lock"></i> password</span>{{end}}
+			{{if .Listing}}<span class="badge bg-info text-dark">listing</span>{{else}}<span class="badge bg-light text-dark">downloads only</span>{{end}}
+		</td>
+		<td class="small">{{.Downloads}}{{if .MaxDownloads}} / {{.MaxDownloads}}{{end}}<div class="text-muted">{{.Accesses}} requests</div></td>
+		<td class="small text-muted">{{if .LastAccess.IsZero}}Never{{else}}{{formatTime .LastAccess}}{{end}}</td>
+		<td class="small {{if expired .Expires}}text-danger{{else}}text-muted{{end}}">{{if .Expires.IsZero}}Never{{else}}{{formatTime .Expires}}{{end}}</td>
+		<td>
+			<button class="btn btn-outline-danger btn-sm"
+					hx-delete="/admin/api/shares/{{.ID}}"
+					hx-target="#share-alerts"
+					hx-confirm="Are you sure you want to revoke this share link?">
+				<i class="fas fa-ban"></i>
+			</button>
+		</td>
+	</tr>
+	{{else}}
+	<tr>
+		<td colspan="7" class="text-center text-muted">No share links yet</td>
+	</tr>
+	{{end}}`
+
+	tmpl := template.Must(template.New("sharelist").Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04:05")
+		},
+		"expired": func(t time.Time) bool {
+			return !t.IsZero() && time.Now().After(t)
+		},
+	}).Parse(shareListTemplate))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, shares)
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxydav/internal/auth"
+	"proxydav/pkg/types"
+)
+
+// tokenView is an API token as shown by the admin API, without its hash
+type tokenView struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	PathPrefix string    `json:"path_prefix"`
+	Scopes     []string  `json:"scopes"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	LastUsed   time.Time `json:"last_used"`
+}
+
+func newTokenView(token *types.APIToken) tokenView {
+	return tokenView{
+		ID:         token.ID,
+		Name:       token.Name,
+		PathPrefix: token.PathPrefix,
+		Scopes:     token.Scopes,
+		CreatedBy:  token.CreatedBy,
+		Created:    token.Created,
+		Expires:    token.Expires,
+		LastUsed:   token.LastUsed,
+	}
+}
+
+func (h *AdminHandler) handleTokens(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Title   string
+		Section string
+	}{
+		Title:   "API Tokens",
+		Section: "tokens",
+	}
+
+	h.renderTemplate(w, r, "tokens", data)
+}
+
+// handleTokensAPI lists tokens or creates one from a form or JSON body.
+// The secret of a new token is only ever returned by this call.
+func (h *AdminHandler) handleTokensAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := h.tokens.List()
+		if err != nil {
+			http.Error(w, "Failed to list tokens", http.StatusInternalServerError)
+			return
+		}
+		if isHTMX(r) {
+			h.renderTokenList(w, tokens)
+			return
+		}
+		views := make([]tokenView, 0, len(tokens))
+		for i := range tokens {
+			views = append(views, newTokenView(&tokens[i]))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: views})
+
+	case http.MethodPost:
+		var request auth.TokenRequest
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				h.tokenResult(w, r, "", nil, fmt.Errorf("invalid JSON: %w", err))
+				return
+			}
+		} else {
+			r.ParseForm()
+			request.Name = r.FormValue("name")
+			request.PathPrefix = r.FormValue("path_prefix")
+			request.Scopes = r.Form["scopes"]
+			if days := strings.TrimSpace(r.FormValue("expires_days")); days != "" {
+				n, err := strconv.Atoi(days)
+				if err != nil || n < 0 {
+					h.tokenResult(w, r, "", nil, fmt.Errorf("expiry must be a number of days"))
+					return
+				}
+				if n > 0 {
+					request.Expires = time.Now().AddDate(0, 0, n)
+				}
+			}
+		}
+
+		createdBy := ""
+		if user := auth.UserFrom(r.Context()); user != nil {
+			createdBy = user.Username
+		}
+		secret, token, err := h.tokens.Create(request, createdBy)
+		h.tokenResult(w, r, secret, token, err)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTokenAPI revokes one token
+func (h *AdminHandler) handleTokenAPI(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.confirmed(w, r) {
+		return
+	}
+	err := h.tokens.Revoke(id)
+	h.tokenResult(w, r, "", &types.APIToken{ID: id}, err)
+}
+
+// tokenResult reports the outcome of a token change, as an alert that
+// makes the panel reload its list or as JSON. A secret is only set for
+// newly created tokens.
+func (h *AdminHandler) tokenResult(w http.ResponseWriter, r *http.Request, secret string, token *types.APIToken, err error) {
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, auth.ErrTokenNotFound):
+		status = http.StatusNotFound
+	case err != nil:
+		status = http.StatusBadRequest
+	case secret != "":
+		status = http.StatusCreated
+	}
+
+	if isHTMX(r) {
+		if err != nil {
+			renderAlerts(w, errorAlert(err))
+			return
+		}
+		w.Header().Set("HX-Trigger", "tokensChanged")
+		if secret == "" {
+			renderAlerts(w, alert{Kind: "success", Message: "Revoked the token."})
+			return
+		}
+		renderAlerts(w, alert{Kind: "success", Message: "Created token", Subject: token.Name, Detail: ". Copy it now, it is not shown again:", Code: secret})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err != nil {
+		json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if secret == "" {
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Message: "Revoked token " + token.ID})
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{
+		Success: true,
+		Message: "Created token " + token.Name,
+		Data: struct {
+			Token string    `json:"token"`
+			Info  tokenView `json:"info"`
+		}{secret, newTokenView(token)},
+	})
+}
+
+func (h *AdminHandler) renderTokenList(w http.ResponseWriter, tokens []types.APIToken) {
+	tokenListTemplate := `
+	{{range .}}
+	<tr>
+		<td>{{.Name}}{{if .CreatedBy}}<div class="small text-muted">by {{.CreatedBy}}</div>{{end}}</td>
+		<td class="path-cell">{{.PathPrefix}}</td>
+		<td>{{range .Scopes}}<span class="badge {{if eq . "admin"}}bg-danger{{else if eq . "read"}}bg-info{{else}}bg-warning text-dark{{end}} me-1">{{.}}</span>{{end}}</td>
+		<td class="small text-muted">{{formatTime .Created}}</td>
+		<td class="small {{if expired .Expires}}text-danger{{else}}text-muted{{end}}">{{if .Expires.IsZero}}Never{{else}}{{formatTime .Expires}}{{end}}</td>
+		<td class="small text-muted">{{if .LastUsed.IsZero}}Never{{else}}{{formatTime .LastUsed}}{{end}}</td>
+		<td>
+			<button class="btn btn-outline-danger btn-sm"
+					hx-delete="/admin/api/tokens/{{.ID}}"
+					hx-target="#token-alerts"
+					hx-confirm="Are you sure you want to revoke this token?">
+				<i class="fas fa-ban"></i>
+			</button>
+		</td>
+	</tr>
+	{{else}}
+	<tr>
+		<td colspan="7" class="text-center text-muted">No API tokens yet</td>
+	</tr>
+	{{end}}`
+
+	tmpl := template.Must(template.New("tokenlist").Funcs(template.FuncMap{
+		"formatTime": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04:05")
+		},
+		"expired": func(t time.Time) bool {
+			return !t.IsZero() && time.Now().After(t)
+		},
+	}).Parse(tokenListTemplate))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, tokens)
+}
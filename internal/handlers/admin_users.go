@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"proxydav/internal/auth"
+	"proxydav/pkg/types"
+)
+
+// userView is an account as shown by the admin API, without its password hash
+type userView struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Groups    []string  `json:"groups"`
+	Disabled  bool      `json:"disabled"`
+	Created   time.Time `json:"created"`
+	LastLogin time.Time `json:"last_login"`
+}
+
+func newUserView(user *types.User) userView {
+	return userView{
+		Username:  user.Username,
+		Role:      user.Role,
+		Groups:    user.Groups,
+		Disabled:  user.Disabled,
+		Created:   user.Created,
+		LastLogin: user.LastLogin,
+	}
+}
+
+// isHTMX reports whether a request comes from the admin panel, which
+// expects HTML fragments instead of JSON
+func isHTMX(r *http.Request) bool {
+	return r.Header.Get("HX-Request") == "true"
+}
+
+func (h *AdminHandler) handleUsers(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Title   string
+		Section string
+	}{
+		Title:   "User Accounts",
+		Section: "users",
+	}
+
+	h.renderTemplate(w, r, "users", data)
+}
+
+// handleUsersAPI lists accounts or creates one from a form or JSON body
+func (h *AdminHandler) handleUsersAPI(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		users, err := h.users.List()
+		if err != nil {
+			http.Error(w, "Failed to list users", http.StatusInternalServerError)
+			return
+		}
+		if isHTMX(r) {
+			h.renderUserList(w, users)
+			return
+		}
+		views := make([]userView, 0, len(users))
+		for i := range users {
+			views = append(views, newUserView(&users[i]))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(APIResponse{Success: true, Data: views})
+
+	case http.MethodPost:
+		var request struct {
+			Username string   `json:"username"`
+			Password string   `json:"password"`
+			Role     string   `json:"role"`
+			Groups   []string `json:"groups"`
+		}
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				h.userResult(w, r, nil, fmt.Errorf("invalid JSON: %w", err), "")
+				return
+			}
+		} else {
+			request.Username = strings.TrimSpace(r.FormValue("username"))
+			request.Password = r.FormValue("password")
+			request.Role = r.FormValue("role")
+			request.Groups = splitGroups(r.FormValue("groups"))
+		}
+		if request.Role == "" {
+			request.Role = types.RoleReader
+		}
+
+		user, err := h.users.Create(request.Username, request.Password, request.Role, request.Groups)
+		h.userResult(w, r, user, err, "Created")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleUserAPI changes or deletes one account. Changes take a JSON
+// auth.UserUpdate, or the form of a row in the panel.
+func (h *AdminHandler) handleUserAPI(w http.ResponseWriter, r *http.Request, username string) {
+	switch r.Method {
+	case http.MethodPut, http.MethodPost:
+		var update auth.UserUpdate
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+				h.userResult(w, r, nil, fmt.Errorf("invalid JSON: %w", err), "")
+				return
+			}
+		} else {
+			r.ParseForm()
+			if role := r.FormValue("role"); role != "" {
+				update.Role = &role
+				// Unchecked checkboxes are not submitted, so the row's role marks a full row form
+				disabled := r.FormValue("enabled") != "on"
+				update.Disabled = &disabled
+				groups := splitGroups(r.FormValue("groups"))
+				update.Groups = &groups
+			}
+			if password := r.FormValue("password"); password != "" {
+				update.Password = &password
+			}
+		}
+
+		user, err := h.users.Update(username, update)
+		h.userResult(w, r, user, err, "Updated")
+
+	case http.MethodDelete:
+		if !h.confirmed(w, r) {
+			return
+		}
+		err := h.users.Delete(username)
+		h.userResult(w, r, &types.User{Username: username}, err, "Deleted")
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// splitGroups reads the comma-separated group list of a form
+func splitGroups(value string) []string {
+	var groups []string
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// userResult reports the outcome of an account change, as an alert that
+// makes the panel reload its list or as JSON
+func (h *AdminHandler) userResult(w http.ResponseWriter, r *http.Request, user *types.User, err error, action string) {
+	status := http.StatusOK
+	switch {
+	case errors.Is(err, auth.ErrUserNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, auth.ErrUserExists), errors.Is(err, auth.ErrLastAdmin):
+		status = http.StatusConflict
+	case err != nil:
+		status = http.StatusBadRequest
+	case action == "Created":
+		status = http.StatusCreated
+	}
+
+	if isHTMX(r) {
+		if err != nil {
+			renderAlerts(w, errorAlert(err))
+			return
+		}
+		w.Header().Set("HX-Trigger", "usersChanged")
+		renderAlerts(w, alert{Kind: "success", Message: action + " account", Subject: user.Username, Detail: "."})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err != nil {
+		json.NewEncoder(w).Encode(APIResponse{Success: false, Error: err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(APIResponse{Success: true, Message: action + " " + user.Username, Data: newUserView(user)})
+}
+
+func (h *AdminHandler) renderUserList(w http.ResponseWriter, users []types.User) {
+	userListTemplate := `
+	{{range .}}
+	<tr>
+		<td class="path-cell">{{.Username}}</td>
+		<td>
+			<select class="form-select form-select-sm" name="role">
+				{{$role := .Role}}{{range roles}}<option value="{{.}}" {{if eq . $role}}selected{{end}}>{{.}}</option>{{end}}
+			</select>
+		</td>
+		<td><input type="text" class="form-control form-control-sm" name="groups" value="{{join .Groups ", "}}" placeholder="None"></td>
+		<td>
+			<div class="form-check form-switch">
+				<input class="form-check-input" type="checkbox" name="enabled" {{if not .Disabled}}checked{{end}}>
+			</div>
+		</td>
+		<td><input type="password" class="form-control form-control-sm" name="password" placeholder="Unchanged" autocomplete="new-password"></td>
+		<td class="small text-muted">{{if .LastLogin.IsZero}}Never{{else}}{{formatTime .LastLogin}}{{end}}</td>
+		<td class="text-nowrap">
+			<button class="btn btn-outline-primary btn-sm"
+					hx-put="/admin/api/users/{{.Username}}"
+					hx-include="closest tr"
+					hx-target="#user-alerts">
+				<i class="fas fa-save"></i>
+			</button>
+			<button class="btn btn-outline-danger btn-sm"
+					hx-delete="/admin/api/users/{{escapePath .Username}}"
+					hx-target="#user-alerts"
+					hx-confirm="Are you sure you want to delete this account?">
+				<i class="fas fa-trash"></i>
+			</button>
+		</td>
+	</tr>
+	{{else}}
+	<tr>
+		<td colspan="7" class="text-center text-muted">No accounts yet</td>
+	</tr>
+	{{end}}`
+
+	tmpl := template.Must(template.New("userlist").Funcs(template.FuncMap{
+		"roles":      func() []string { return []string{types.RoleReader, types.RoleEditor, types.RoleAdmin} },
+		"join":       strings.Join,
+		"escapePath": escapePath,
+		"formatTime": func(t time.Time) string {
+			return t.Format("2006-01-02 15:04:05")
+		},
+	}).Parse(userListTemplate))
+	w.Header().Set("Content-Type", "text/html")
+	tmpl.Execute(w, users)
+}
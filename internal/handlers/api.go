@@ -1,26 +1,59 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"path"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"proxydav/internal/acl"
+	"proxydav/internal/archive"
+	"proxydav/internal/auth"
+	"proxydav/internal/backend"
 	"proxydav/internal/filesystem"
+	"proxydav/internal/integrity"
+	"proxydav/internal/linkcheck"
+	"proxydav/internal/metadata"
+	"proxydav/internal/upstream"
 	"proxydav/pkg/types"
 )
 
 type APIHandler struct {
-	vfs *filesystem.VirtualFS
+	vfs      *filesystem.VirtualFS
+	policy   *upstream.Policy
+	metadata *metadata.Manager
+	links    *linkcheck.Checker
+	archives *archive.Reader
+	backends *backend.Registry
+	acls     *acl.List
+	readOnly atomic.Bool
+
+	appPasswords *auth.AppPasswords
 }
 
-func NewAPIHandler(vfs *filesystem.VirtualFS) *APIHandler {
+func NewAPIHandler(vfs *filesystem.VirtualFS, policy *upstream.Policy, metadataManager *metadata.Manager, links *linkcheck.Checker, archives *archive.Reader, backends *backend.Registry, acls *acl.List, appPasswords *auth.AppPasswords) *APIHandler {
 	return &APIHandler{
-		vfs: vfs,
+		vfs:      vfs,
+		policy:   policy,
+		metadata: metadataManager,
+		links:    links,
+		archives: archives,
+		backends: backends,
+		acls:     acls,
+
+		appPasswords: appPasswords,
 	}
 }
 
+// SetReadOnly refuses or allows adding and deleting files
+func (h *APIHandler) SetReadOnly(readOnly bool) {
+	h.readOnly.Store(readOnly)
+}
+
 type APIResponse struct {
 	Success bool        `json:"success"`
 	Message string      `json:"message,omitempty"`
@@ -29,13 +62,30 @@ type APIResponse struct {
 }
 
 type AddFilesRequest struct {
-	Files []types.FileEntry `json:"files"`
+	Files []AddFileEntry `json:"files"`
+}
+
+// AddFileEntry is a file to add. Content, when set, is stored inline and
+// takes the place of the URL.
+type AddFileEntry struct {
+	types.FileEntry
+	Content *string `json:"content,omitempty"`
 }
 
 type DeleteFilesRequest struct {
 	Files []types.FileEntry `json:"files"`
 }
 
+type RefreshMetadataRequest struct {
+	Path string `json:"path"`
+}
+
+type LinkReportResponse struct {
+	Links   []linkcheck.Report `json:"links"`
+	Total   int                `json:"total"`
+	Running bool               `json:"running"`
+}
+
 type FileListResponse struct {
 	Files []types.FileEntry `json:"files"`
 	Total int               `json:"total"`
@@ -46,6 +96,23 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// Parse the path to determine the operation
 	pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(pathParts) == 3 && pathParts[0] == "api" && pathParts[1] == "metadata" && pathParts[2] == "refresh" {
+		if r.Method != "POST" {
+			h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		h.handleRefreshMetadata(w, r)
+		return
+	}
+	if len(pathParts) >= 2 && pathParts[0] == "api" && pathParts[1] == "app-passwords" {
+		h.handleAppPasswords(w, r, pathParts[2:])
+		return
+	}
+	if len(pathParts) >= 2 && pathParts[0] == "api" && pathParts[1] == "links" {
+		h.handleLinks(w, r, pathParts[2:])
+		return
+	}
+
 	if len(pathParts) < 2 || pathParts[0] != "api" || pathParts[1] != "files" {
 		h.sendError(w, http.StatusNotFound, "Invalid API endpoint")
 		return
@@ -56,6 +123,11 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if h.readOnly.Load() && r.Method != "GET" {
+		h.sendError(w, http.StatusForbidden, "The server is read-only")
+		return
+	}
+
 	switch r.Method {
 	case "GET":
 		h.handleListFiles(w, r)
@@ -68,9 +140,14 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GET /api/files - list all files
+// GET /api/files - list all files the user may see
 func (h *APIHandler) handleListFiles(w http.ResponseWriter, r *http.Request) {
-	files := h.vfs.GetAllFiles()
+	files := make([]types.FileEntry, 0)
+	for _, file := range h.vfs.GetAllFiles() {
+		if requestAccess(h.acls, r, file.Path) != acl.Hidden {
+			files = append(files, file)
+		}
+	}
 
 	response := FileListResponse{
 		Files: files,
@@ -99,18 +176,35 @@ func (h *APIHandler) handleAddFiles(w http.ResponseWriter, r *http.Request) {
 	errors := make(map[string]string)
 	successfulFiles := make([]types.FileEntry, 0)
 
-	for _, file := range request.Files {
-		if err := h.validateFileEntry(file); err != nil {
+	for _, requested := range request.Files {
+		file := requested.FileEntry
+		if requested.Content != nil {
+			if err := h.storeInline(r.Context(), &file, *requested.Content); err != nil {
+				errors[file.Path] = err.Error()
+				failed++
+				continue
+			}
+		}
+
+		if err := h.validateFileEntry(r.Context(), &file); err != nil {
 			errors[file.Path] = err.Error()
 			failed++
+			h.vfs.ReleaseContent(file.URL)
 			continue
 		}
 
 		file.Path = path.Clean("/" + strings.TrimPrefix(file.Path, "/"))
+		if requestAccess(h.acls, r, file.Path) < acl.Write {
+			errors[file.Path] = "Permission denied"
+			failed++
+			h.vfs.ReleaseContent(file.URL)
+			continue
+		}
 
-		if err := h.vfs.AddFile(file.Path, file.URL); err != nil {
+		if err := addEntry(r.Context(), h.vfs, h.archives, file); err != nil {
 			errors[file.Path] = err.Error()
 			failed++
+			h.vfs.ReleaseContent(file.URL)
 		} else {
 			successful++
 			successfulFiles = append(successfulFiles, file)
@@ -161,19 +255,30 @@ func (h *APIHandler) handleDeleteFiles(w http.ResponseWriter, r *http.Request) {
 
 		filePath := path.Clean("/" + strings.TrimPrefix(file.Path, "/"))
 
-		if !h.vfs.Exists(filePath) {
+		if !h.vfs.Exists(filePath) || requestAccess(h.acls, r, filePath) == acl.Hidden {
 			errors[filePath] = "File not found"
 			failed++
 			continue
 		}
+		if requestTreeAccess(h.acls, r, filePath) < acl.Write {
+			errors[filePath] = "Permission denied"
+			failed++
+			continue
+		}
 
-		if h.vfs.IsDir(filePath) {
+		var err error
+		switch {
+		case h.vfs.IsMount(filePath):
+			err = h.vfs.RemoveDirectory(filePath)
+		case h.vfs.IsDir(filePath):
 			errors[filePath] = "Cannot delete directory"
 			failed++
 			continue
+		default:
+			err = h.vfs.RemoveFile(filePath)
 		}
 
-		if err := h.vfs.RemoveFile(filePath); err != nil {
+		if err != nil {
 			errors[filePath] = err.Error()
 			failed++
 		} else {
@@ -198,19 +303,243 @@ func (h *APIHandler) handleDeleteFiles(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *APIHandler) validateFileEntry(file types.FileEntry) error {
+// POST /api/metadata/refresh - force a metadata refresh of a file or subtree
+func (h *APIHandler) handleRefreshMetadata(w http.ResponseWriter, r *http.Request) {
+	if h.metadata == nil {
+		h.sendError(w, http.StatusServiceUnavailable, "Metadata refresh is not available")
+		return
+	}
+
+	var request RefreshMetadataRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		h.sendError(w, http.StatusBadRequest, "Invalid JSON payload: "+err.Error())
+		return
+	}
+	if request.Path == "" {
+		request.Path = "/"
+	}
+
+	targetPath := path.Clean("/" + strings.TrimPrefix(request.Path, "/"))
+	if !h.vfs.Exists(targetPath) || requestAccess(h.acls, r, targetPath) == acl.Hidden {
+		h.sendError(w, http.StatusNotFound, "Path not found")
+		return
+	}
+
+	var entries []types.FileEntry
+	for _, entry := range h.vfs.GetFilesUnder(targetPath) {
+		if requestAccess(h.acls, r, entry.Path) != acl.Hidden {
+			entries = append(entries, entry)
+		}
+	}
+	queued := h.metadata.Refresh(entries)
+
+	// Mounted archives are relisted right away so new members show up,
+	// unless read-only mode keeps their members as they are
+	archiveErrors := make(map[string]string)
+	remounted := 0
+	for _, entry := range entries {
+		if entry.Kind != types.EntryKindZip || h.readOnly.Load() {
+			continue
+		}
+		if err := remountArchive(r.Context(), h.vfs, h.archives, entry); err != nil {
+			archiveErrors[entry.Path] = err.Error()
+			continue
+		}
+		remounted++
+	}
+
+	results := map[string]interface{}{
+		"path":     targetPath,
+		"files":    len(entries),
+		"queued":   queued,
+		"archives": remounted,
+	}
+	if len(archiveErrors) > 0 {
+		results["errors"] = archiveErrors
+	}
+	h.sendSuccess(w, http.StatusAccepted, fmt.Sprintf("Metadata refresh queued for %d files", queued), results)
+}
+
+// /api/links - report link health; /api/links/check - start a check now
+func (h *APIHandler) handleLinks(w http.ResponseWriter, r *http.Request, rest []string) {
+	if h.links == nil {
+		h.sendError(w, http.StatusServiceUnavailable, "Link checking is not available")
+		return
+	}
+
+	switch {
+	case len(rest) == 0 && r.Method == "GET":
+		all, err := h.links.Reports(r.URL.Query().Get("status"))
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		reports := make([]linkcheck.Report, 0, len(all))
+		for _, report := range all {
+			if requestAccess(h.acls, r, report.Path) != acl.Hidden {
+				reports = append(reports, report)
+			}
+		}
+		running, _ := h.links.Running()
+		h.sendSuccess(w, http.StatusOK, "Link health retrieved successfully", LinkReportResponse{
+			Links:   reports,
+			Total:   len(reports),
+			Running: running,
+		})
+	case len(rest) == 1 && rest[0] == "check" && r.Method == "POST":
+		if !h.links.RunNow() {
+			h.sendError(w, http.StatusConflict, "A link check is already running")
+			return
+		}
+		h.sendSuccess(w, http.StatusAccepted, "Link check started", nil)
+	case len(rest) <= 1:
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		h.sendError(w, http.StatusNotFound, "Invalid API endpoint")
+	}
+}
+
+// storeInline stores content for an entry that has no URL of its own and
+// points the entry at it
+func (h *APIHandler) storeInline(ctx context.Context, file *types.FileEntry, content string) error {
+	if file.Path == "" {
+		return fmt.Errorf("path is required")
+	}
+	if file.URL != "" || file.Kind != types.EntryKindFile {
+		return fmt.Errorf("content cannot be combined with url or kind")
+	}
+	writer, ok := h.backends.Writer("inline")
+	if !ok {
+		return fmt.Errorf("inline content is not available")
+	}
+	fileURL, err := writer.Put(ctx, strings.NewReader(content))
+	if err != nil {
+		return err
+	}
+	file.URL = fileURL
+	return nil
+}
+
+func (h *APIHandler) validateFileEntry(ctx context.Context, file *types.FileEntry) error {
+	return validateFileEntry(ctx, h.policy, h.backends, file)
+}
+
+// validateFileEntry checks an entry before it is added, including the
+// upstream destination policy when one is configured. URLs with another
+// scheme must name an existing file of a registered backend. Checksums are
+// normalized in place and any client-supplied integrity state is dropped.
+func validateFileEntry(ctx context.Context, policy *upstream.Policy, backends *backend.Registry, file *types.FileEntry) error {
 	if file.Path == "" {
 		return fmt.Errorf("path is required")
 	}
-	if file.URL == "" {
-		return fmt.Errorf("url is required")
+	if err := validateKind(file); err != nil {
+		return err
+	}
+	for _, fileURL := range file.URLs() {
+		if types.IsRemoteURL(fileURL) {
+			continue
+		}
+		b, ok := backends.For(fileURL)
+		if !ok {
+			return fmt.Errorf("url must be a valid HTTP or HTTPS URL, or use a scheme of a configured backend (%s)", strings.Join(backends.Schemes(), ", "))
+		}
+		if file.Kind == types.EntryKindZip {
+			return fmt.Errorf("zip entries must use an HTTP or HTTPS url")
+		}
+		if _, err := b.Stat(ctx, fileURL); err != nil {
+			return err
+		}
+	}
+	checksums, err := integrity.Normalize(file.Checksums)
+	if err != nil {
+		return err
+	}
+	file.Checksums = checksums
+	file.Integrity = nil
+	if policy != nil {
+		for _, fileURL := range file.RemoteURLs() {
+			if err := policy.CheckURL(ctx, fileURL); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateKind checks that an entry carries exactly the fields its kind uses
+func validateKind(file *types.FileEntry) error {
+	switch file.Kind {
+	case types.EntryKindFile, types.EntryKindZip, types.EntryKindSlice:
+		if file.URL == "" {
+			return fmt.Errorf("url is required")
+		}
+		if len(file.Parts) > 0 {
+			return fmt.Errorf("parts are only valid for concat entries")
+		}
+	case types.EntryKindConcat:
+		if file.URL != "" {
+			return fmt.Errorf("concat entries take parts instead of url")
+		}
+		if len(file.Parts) == 0 {
+			return fmt.Errorf("parts are required for concat entries")
+		}
+	default:
+		return fmt.Errorf("unsupported kind %q (use zip, concat or slice)", file.Kind)
+	}
+
+	if file.Kind != types.EntryKindSlice {
+		if file.Offset != 0 || file.Length != 0 {
+			return fmt.Errorf("offset and length are only valid for slice entries")
+		}
+		return nil
+	}
+	if file.Offset < 0 {
+		return fmt.Errorf("offset cannot be negative")
 	}
-	if !strings.HasPrefix(file.URL, "http://") && !strings.HasPrefix(file.URL, "https://") {
-		return fmt.Errorf("url must be a valid HTTP or HTTPS URL")
+	if file.Length <= 0 {
+		return fmt.Errorf("length must be positive for slice entries")
 	}
 	return nil
 }
 
+// addEntry adds a validated entry to the filesystem. Archives are mounted
+// by reading their central directory first.
+func addEntry(ctx context.Context, vfs *filesystem.VirtualFS, archives *archive.Reader, entry types.FileEntry) error {
+	entry.Path = path.Clean("/" + strings.TrimPrefix(entry.Path, "/"))
+	if entry.Kind != types.EntryKindZip {
+		return vfs.AddEntry(entry)
+	}
+	if archives == nil {
+		return fmt.Errorf("archive mounting is not available")
+	}
+	if vfs.Exists(entry.Path) {
+		return fmt.Errorf("path already exists: %s", entry.Path)
+	}
+
+	ctx, cancel := context.WithTimeout(upstream.WithVirtualPath(ctx, entry.Path), 30*time.Second)
+	defer cancel()
+	index, err := archives.ReadIndex(ctx, entry.URL)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	return vfs.AddArchive(entry, index)
+}
+
+// remountArchive reads a mounted archive's central directory again
+func remountArchive(ctx context.Context, vfs *filesystem.VirtualFS, archives *archive.Reader, entry types.FileEntry) error {
+	if archives == nil {
+		return fmt.Errorf("archive mounting is not available")
+	}
+
+	ctx, cancel := context.WithTimeout(upstream.WithVirtualPath(ctx, entry.Path), 30*time.Second)
+	defer cancel()
+	index, err := archives.ReadIndex(ctx, entry.URL)
+	if err != nil {
+		return fmt.Errorf("failed to read archive: %w", err)
+	}
+	return vfs.ReplaceArchiveIndex(entry.Path, index)
+}
+
 func (h *APIHandler) sendSuccess(w http.ResponseWriter, statusCode int, message string, data interface{}) {
 	w.WriteHeader(statusCode)
 	response := APIResponse{
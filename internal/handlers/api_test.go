@@ -1,13 +1,20 @@
 package handlers
 
 import (
+	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"proxydav/internal/filesystem"
+	"proxydav/internal/metadata"
 	"proxydav/internal/storage"
 	"proxydav/pkg/types"
 )
@@ -29,7 +36,7 @@ func createTestVFS(t *testing.T) *filesystem.VirtualFS {
 
 func TestAPIHandler_ListFiles(t *testing.T) {
 	vfs := createTestVFS(t)
-	handler := NewAPIHandler(vfs)
+	handler := NewAPIHandler(vfs, nil, nil, nil, nil, nil, nil, nil)
 
 	// Add some test files
 	vfs.AddFile("/test1.txt", "https://example.com/test1.txt")
@@ -70,12 +77,12 @@ func TestAPIHandler_ListFiles(t *testing.T) {
 
 func TestAPIHandler_AddFiles(t *testing.T) {
 	vfs := createTestVFS(t)
-	handler := NewAPIHandler(vfs)
+	handler := NewAPIHandler(vfs, nil, nil, nil, nil, nil, nil, nil)
 
 	request := AddFilesRequest{
-		Files: []types.FileEntry{
-			{Path: "/test1.txt", URL: "https://example.com/test1.txt"},
-			{Path: "/test2.txt", URL: "https://example.com/test2.txt"},
+		Files: []AddFileEntry{
+			{FileEntry: types.FileEntry{Path: "/test1.txt", URL: "https://example.com/test1.txt"}},
+			{FileEntry: types.FileEntry{Path: "/test2.txt", URL: "https://example.com/test2.txt"}},
 		},
 	}
 
@@ -110,7 +117,7 @@ func TestAPIHandler_AddFiles(t *testing.T) {
 
 func TestAPIHandler_DeleteFiles(t *testing.T) {
 	vfs := createTestVFS(t)
-	handler := NewAPIHandler(vfs)
+	handler := NewAPIHandler(vfs, nil, nil, nil, nil, nil, nil, nil)
 
 	// Add test files first
 	vfs.AddFile("/test1.txt", "https://example.com/test1.txt")
@@ -151,3 +158,87 @@ func TestAPIHandler_DeleteFiles(t *testing.T) {
 		t.Error("Expected /test2.txt to be deleted")
 	}
 }
+
+func TestAPIHandler_ReadOnly(t *testing.T) {
+	vfs := createTestVFS(t)
+	handler := NewAPIHandler(vfs, nil, nil, nil, nil, nil, nil, nil)
+	handler.SetReadOnly(true)
+	vfs.AddFile("/test1.txt", "https://example.com/test1.txt")
+
+	body, _ := json.Marshal(DeleteFilesRequest{Files: []types.FileEntry{{Path: "/test1.txt"}}})
+	for _, method := range []string{"POST", "DELETE"} {
+		req := httptest.NewRequest(method, "/api/files", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s to be refused, got %d", method, w.Code)
+		}
+	}
+	if !vfs.Exists("/test1.txt") {
+		t.Error("Expected /test1.txt to be kept")
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/api/files", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected listing to keep working, got %d", w.Code)
+	}
+}
+
+func TestAPIHandler_ReadOnlyKeepsArchives(t *testing.T) {
+	bundle := func(name string) []byte {
+		var buf bytes.Buffer
+		writer := zip.NewWriter(&buf)
+		member, _ := writer.Create(name)
+		io.WriteString(member, "hello")
+		writer.Close()
+		return buf.Bytes()
+	}
+	var data atomic.Value
+	data.Store(bundle("old.txt"))
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "bundle.zip", time.Time{}, bytes.NewReader(data.Load().([]byte)))
+	}))
+	defer upstreamServer.Close()
+
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+	webdav := createTestWebDAVHandler(t, vfs)
+	handler := NewAPIHandler(vfs, nil, metadata.NewManager(store, webdav.client, metadata.Options{TTL: time.Hour}), nil, webdav.archives, nil, nil, nil)
+	handler.SetReadOnly(true)
+
+	entry := types.FileEntry{Path: "/bundle.zip", URL: upstreamServer.URL + "/bundle.zip", Kind: types.EntryKindZip}
+	if err := addEntry(context.Background(), vfs, webdav.archives, entry); err != nil {
+		t.Fatalf("Failed to mount archive: %v", err)
+	}
+	data.Store(bundle("new.txt"))
+
+	refresh := func() {
+		t.Helper()
+		req := httptest.NewRequest("POST", "/api/metadata/refresh", strings.NewReader(`{"path": "/bundle.zip"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusAccepted {
+			t.Fatalf("Expected the refresh to be accepted, got %d: %s", w.Code, w.Body.String())
+		}
+	}
+	refresh()
+	if !vfs.Exists("/bundle.zip/old.txt") || vfs.Exists("/bundle.zip/new.txt") {
+		t.Error("Expected read-only mode to keep the archive's members as they are")
+	}
+
+	handler.SetReadOnly(false)
+	refresh()
+	if !vfs.Exists("/bundle.zip/new.txt") {
+		t.Error("Expected the archive to be relisted once read-only mode is off")
+	}
+}
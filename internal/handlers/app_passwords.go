@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"proxydav/internal/auth"
+	"proxydav/pkg/types"
+)
+
+// appPasswordView is an app password as shown by the API, without its hash
+type appPasswordView struct {
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used"`
+}
+
+func newAppPasswordView(appPassword *types.AppPassword) appPasswordView {
+	return appPasswordView{
+		ID:       appPassword.ID,
+		Username: appPassword.Username,
+		Name:     appPassword.Name,
+		Created:  appPassword.Created,
+		LastUsed: appPassword.LastUsed,
+	}
+}
+
+// handleAppPasswords lets users manage their own app passwords:
+//
+//	GET    /api/app-passwords       - list them (?all=true lists everyone's for admins)
+//	POST   /api/app-passwords       - create one ({"name"}); the response holds the password
+//	DELETE /api/app-passwords/{id}  - revoke one; admins may revoke anyone's
+func (h *APIHandler) handleAppPasswords(w http.ResponseWriter, r *http.Request, rest []string) {
+	user := auth.UserFrom(r.Context())
+	if h.appPasswords == nil || user == nil {
+		h.sendError(w, http.StatusBadRequest, "App passwords require authentication to be enabled")
+		return
+	}
+	if auth.TokenFrom(r.Context()) != nil {
+		h.sendError(w, http.StatusForbidden, "API tokens cannot have app passwords")
+		return
+	}
+	isAdmin := user.Role == types.RoleAdmin
+
+	if len(rest) == 1 {
+		if r.Method != http.MethodDelete {
+			h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		owner := user.Username
+		if isAdmin {
+			owner = ""
+		}
+		if err := h.appPasswords.Revoke(rest[0], owner); err != nil {
+			if errors.Is(err, auth.ErrAppPasswordNotFound) {
+				h.sendError(w, http.StatusNotFound, err.Error())
+				return
+			}
+			h.sendError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		h.sendSuccess(w, http.StatusOK, "Revoked app password "+rest[0], nil)
+		return
+	}
+	if len(rest) != 0 {
+		h.sendError(w, http.StatusNotFound, "Invalid API endpoint")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		owner := user.Username
+		if isAdmin && r.URL.Query().Get("all") == "true" {
+			owner = ""
+		}
+		appPasswords, err := h.appPasswords.List(owner)
+		if err != nil {
+			h.sendError(w, http.StatusInternalServerError, "Failed to list app passwords")
+			return
+		}
+		views := make([]appPasswordView, 0, len(appPasswords))
+		for i := range appPasswords {
+			views = append(views, newAppPasswordView(&appPasswords[i]))
+		}
+		h.sendSuccess(w, http.StatusOK, "", views)
+
+	case http.MethodPost:
+		// A leaked app password must not be able to mint more of them
+		if auth.MethodFrom(r.Context()) == auth.MethodAppPassword {
+			h.sendError(w, http.StatusForbidden, "Sign in with your password or single sign-on to create app passwords")
+			return
+		}
+		var request struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			h.sendError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+			return
+		}
+		local := auth.MethodFrom(r.Context()) == auth.MethodPassword
+		secret, appPassword, err := h.appPasswords.Create(user, local, request.Name)
+		if err != nil {
+			h.sendError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		h.sendSuccess(w, http.StatusCreated, "Created app password "+appPassword.Name, struct {
+			Password string          `json:"password"`
+			Info     appPasswordView `json:"info"`
+		}{secret, newAppPasswordView(appPassword)})
+
+	default:
+		h.sendError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/internal/forwarded"
+	"proxydav/internal/webdav"
+)
+
+// Limits of the scratch area that absorbs OS metadata files. Clients write
+// small files there (AppleDouble headers are 4 KiB), so these are generous.
+const (
+	maxScratchFile     = 1 << 20
+	maxScratchSession  = 8 << 20
+	maxScratchSessions = 256
+	scratchIdleTimeout = time.Hour
+)
+
+// clientCompat absorbs the metadata files Finder and Explorer create next to
+// whatever they browse (._*, .DS_Store, Thumbs.db, desktop.ini). Paths whose
+// name matches a pattern never reach the virtual filesystem: writes land in
+// a per-session scratch area kept in memory, and listings leave them out.
+type clientCompat struct {
+	mutex    sync.Mutex
+	patterns []string
+	sessions map[string]*scratchSession
+}
+
+type scratchSession struct {
+	files    map[string]*scratchFile
+	size     int64
+	lastSeen time.Time
+}
+
+type scratchFile struct {
+	data     []byte
+	modified time.Time
+}
+
+func newClientCompat() *clientCompat {
+	return &clientCompat{sessions: make(map[string]*scratchSession)}
+}
+
+// setPatterns replaces the name patterns; an empty list turns the layer off
+func (c *clientCompat) setPatterns(patterns []string) {
+	lowered := make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		lowered = append(lowered, strings.ToLower(pattern))
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.patterns = lowered
+	if len(lowered) == 0 {
+		c.sessions = make(map[string]*scratchSession)
+	}
+}
+
+// isJunk reports whether the name of itemPath matches a pattern, ignoring case
+func (c *clientCompat) isJunk(itemPath string) bool {
+	name := strings.ToLower(path.Base(itemPath))
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, pattern := range c.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionKey identifies a client by its address and, if any, the user it
+// authenticated as, so one client never sees another's scratch files
+func sessionKey(r *http.Request) string {
+	user, _, _ := r.BasicAuth()
+	return user + "@" + forwarded.From(r).ClientIP
+}
+
+// session returns the scratch area of a client, creating it if asked and
+// dropping areas that have been idle for too long
+func (c *clientCompat) session(key string, create bool) *scratchSession {
+	now := time.Now()
+	for sessionKey, session := range c.sessions {
+		if now.Sub(session.lastSeen) > scratchIdleTimeout {
+			delete(c.sessions, sessionKey)
+		}
+	}
+
+	session, ok := c.sessions[key]
+	if !ok {
+		if !create {
+			return nil
+		}
+		if len(c.sessions) >= maxScratchSessions {
+			c.evictOldest()
+		}
+		session = &scratchSession{files: make(map[string]*scratchFile)}
+		c.sessions[key] = session
+	}
+	session.lastSeen = now
+	return session
+}
+
+func (c *clientCompat) evictOldest() {
+	var oldestKey string
+	var oldest time.Time
+	for key, session := range c.sessions {
+		if oldestKey == "" || session.lastSeen.Before(oldest) {
+			oldestKey, oldest = key, session.lastSeen
+		}
+	}
+	delete(c.sessions, oldestKey)
+}
+
+func (c *clientCompat) get(key, itemPath string) (*scratchFile, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	session := c.session(key, false)
+	if session == nil {
+		return nil, false
+	}
+	file, ok := session.files[itemPath]
+	return file, ok
+}
+
+// put stores a file, reporting whether it replaced one. Files that would
+// exceed the limits are accepted but not kept.
+func (c *clientCompat) put(key, itemPath string, data []byte) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	session := c.session(key, true)
+	existing, replaced := session.files[itemPath]
+	if replaced {
+		session.size -= int64(len(existing.data))
+		delete(session.files, itemPath)
+	}
+	if len(data) <= maxScratchFile && session.size+int64(len(data)) <= maxScratchSession {
+		session.files[itemPath] = &scratchFile{data: data, modified: time.Now().UTC()}
+		session.size += int64(len(data))
+	}
+	return replaced
+}
+
+func (c *clientCompat) remove(key, itemPath string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	session := c.session(key, false)
+	if session == nil {
+		return
+	}
+	if file, ok := session.files[itemPath]; ok {
+		session.size -= int64(len(file.data))
+		delete(session.files, itemPath)
+	}
+}
+
+// serveJunk handles a request for an OS metadata file and reports whether it
+// did. MOVE and COPY are only absorbed when both ends are metadata files.
+func (h *WebDAVHandler) serveJunk(w http.ResponseWriter, r *http.Request) bool {
+	normalizedPath := path.Clean("/" + strings.TrimPrefix(r.URL.Path, "/"))
+	if normalizedPath == "/" || !h.compat.isJunk(normalizedPath) {
+		return false
+	}
+	key := sessionKey(r)
+
+	switch r.Method {
+	case "GET", "HEAD":
+		file, ok := h.compat.get(key, normalizedPath)
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return true
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		http.ServeContent(w, r, normalizedPath, file.modified, bytes.NewReader(file.data))
+	case "PROPFIND":
+		file, ok := h.compat.get(key, normalizedPath)
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return true
+		}
+		size := int64(len(file.data))
+		writeMultistatus(w, []webdav.Response{{
+			Href: publicHref(r.Context(), normalizedPath),
+			Propstat: webdav.Propstat{
+				Status: "HTTP/1.1 200 OK",
+				Prop: webdav.Prop{
+					DisplayName:   path.Base(normalizedPath),
+					ContentLength: &size,
+					ContentType:   "application/octet-stream",
+					LastModified:  webdav.FormatTime(file.modified),
+				},
+			},
+		}})
+	case "PUT":
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxScratchFile+1))
+		if err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return true
+		}
+		if h.compat.put(key, normalizedPath, data) {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "DELETE":
+		h.compat.remove(key, normalizedPath)
+		w.WriteHeader(http.StatusNoContent)
+	case "MOVE", "COPY":
+		destPath, err := h.parseDestinationPath(r.Context(), r.Header.Get("Destination"))
+		normalizedDest := path.Clean("/" + strings.TrimPrefix(destPath, "/"))
+		if err != nil || !h.compat.isJunk(normalizedDest) {
+			http.Error(w, "Forbidden: metadata files stay out of the namespace", http.StatusForbidden)
+			return true
+		}
+		file, ok := h.compat.get(key, normalizedPath)
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return true
+		}
+		if r.Method == "MOVE" {
+			h.compat.remove(key, normalizedPath)
+		}
+		if h.compat.put(key, normalizedDest, file.data) {
+			w.WriteHeader(http.StatusNoContent)
+		} else {
+			w.WriteHeader(http.StatusCreated)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// writeMultistatus writes a 207 response listing responses
+func writeMultistatus(w http.ResponseWriter, responses []webdav.Response) {
+	xmlData, err := xml.MarshalIndent(webdav.Multistatus{Responses: responses}, "", "  ")
+	if err != nil {
+		log.Printf("Error marshaling XML: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>` + "\n"))
+	w.Write(xmlData)
+}
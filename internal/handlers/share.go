@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"proxydav/internal/acl"
+	"proxydav/internal/auth"
+	"proxydav/internal/forwarded"
+	"proxydav/pkg/types"
+)
+
+// SharePrefix is where share links are served, as /api/share/{id}/path.
+// It lies under /api/ so that it cannot hide virtual paths.
+const SharePrefix = "/api/share/"
+
+// ShareHandler serves public share links with the read-only parts of the
+// WebDAV handler, limited to the shared path. Wrong passwords count towards
+// lockouts of the client address and of the share.
+type ShareHandler struct {
+	shares   *auth.Shares
+	lockouts *auth.Lockouts
+	audit    *auth.Audit
+	webdav   *WebDAVHandler
+}
+
+func NewShareHandler(shares *auth.Shares, lockouts *auth.Lockouts, audit *auth.Audit, webdav *WebDAVHandler) *ShareHandler {
+	return &ShareHandler{shares: shares, lockouts: lockouts, audit: audit, webdav: webdav}
+}
+
+// shareBase maps the virtual paths of a share to its URL
+type shareBase struct {
+	root   string // shared virtual path
+	prefix string // URL path of the share, without a trailing slash
+}
+
+type shareBaseKey struct{}
+
+// publicHref returns the URL path a virtual path is reachable at. For share
+// links that is below the share's URL; otherwise the path itself. Either is
+// below the prefix a reverse proxy serves ProxyDAV under.
+func publicHref(ctx context.Context, href string) string {
+	prefix := forwarded.Prefix(ctx)
+	base, ok := ctx.Value(shareBaseKey{}).(shareBase)
+	if !ok {
+		return prefix + href
+	}
+	if base.root != "/" {
+		href = strings.TrimPrefix(href, base.root)
+	}
+	return prefix + base.prefix + href
+}
+
+// isShareRequest reports whether a request came in through a share link
+func isShareRequest(ctx context.Context) bool {
+	_, ok := ctx.Value(shareBaseKey{}).(shareBase)
+	return ok
+}
+
+func (h *ShareHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, subPath, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, SharePrefix), "/")
+	if id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, GET, HEAD")
+		w.Header().Set("DAV", "1")
+		w.WriteHeader(http.StatusOK)
+		return
+	case http.MethodGet, http.MethodHead, "PROPFIND":
+	default:
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, GET, HEAD")
+		http.Error(w, "Method not allowed: share links are read-only", http.StatusMethodNotAllowed)
+		return
+	}
+
+	clientIP := forwarded.From(r).ClientIP
+	if wait := h.lockouts.CheckShare(clientIP, id); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too Many Requests: too many wrong passwords, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	// Any username goes; only the password counts
+	_, password, _ := r.BasicAuth()
+	share, err := h.shares.Open(id, password)
+	switch {
+	case errors.Is(err, auth.ErrSharePassword):
+		// Clients ask without a password first; only wrong ones count
+		if password != "" {
+			h.passwordFailed(r, clientIP, id)
+		}
+		w.Header().Set("WWW-Authenticate", `Basic realm="ProxyDAV share"`)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	case errors.Is(err, auth.ErrShareUnavailable):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		log.Printf("❌ Failed to open share: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if share.PasswordHash != "" {
+		h.lockouts.SucceedShare(clientIP, share.ID)
+	}
+
+	// Cleaning the path below the share keeps ".." from leaving it
+	target := path.Join(share.Path, path.Clean("/"+subPath))
+	isDir := h.webdav.vfs.IsDir(target)
+	if isDir && !share.Listing {
+		http.Error(w, "Forbidden: this share does not allow listing folders", http.StatusForbidden)
+		return
+	}
+
+	download := r.Method == http.MethodGet && h.webdav.vfs.Exists(target) && !isDir && startsDownload(r)
+	if _, err := h.shares.Record(share.ID, download); err != nil {
+		if errors.Is(err, auth.ErrDownloadLimit) {
+			http.Error(w, "Gone: this share has reached its download limit", http.StatusGone)
+			return
+		}
+		if !errors.Is(err, auth.ErrShareUnavailable) {
+			log.Printf("❌ Failed to record share access: %v", err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	token := auth.ShareToken(share)
+	ctx := auth.WithToken(auth.WithUser(r.Context(), auth.TokenUser(token)), token)
+	ctx = context.WithValue(ctx, shareBaseKey{}, shareBase{root: share.Path, prefix: strings.TrimSuffix(SharePrefix, "/") + "/" + share.ID})
+	shared := r.Clone(ctx)
+	shared.URL.Path = target
+
+	switch {
+	case r.Method == "PROPFIND":
+		h.webdav.handlePropFind(w, shared)
+	case isDir:
+		h.serveIndex(w, shared, share, target)
+	default:
+		h.webdav.handleGetHead(w, shared)
+	}
+}
+
+// passwordFailed records a wrong share password and counts it towards a
+// lockout
+func (h *ShareHandler) passwordFailed(r *http.Request, clientIP, id string) {
+	event := types.LoginEvent{ClientIP: clientIP, Reason: "wrong password for share " + id, UserAgent: r.UserAgent()}
+	h.audit.Record(event)
+	if lockout := h.lockouts.FailShare(clientIP, id); lockout > 0 {
+		log.Printf("🚫 Locked out share %s from %s for %v after repeated wrong passwords", id, clientIP, lockout)
+		event.Reason = fmt.Sprintf("locked out of share %s for %v", id, lockout)
+		h.audit.Record(event)
+	}
+}
+
+// startsDownload reports whether a GET starts from the first byte of the
+// file. Only those count as downloads: players and download managers fetch
+// the rest of a file in further ranges.
+func startsDownload(r *http.Request) bool {
+	ranges := strings.TrimSpace(r.Header.Get("Range"))
+	return ranges == "" || strings.HasPrefix(ranges, "bytes=0-")
+}
+
+var shareIndexTemplate = template.Must(template.New("shareindex").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<title>{{.Name}}</title>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<ul>
+{{if .Parent}}<li><a href="{{.Parent}}">../</a></li>{{end}}
+{{range .Items}}<li><a href="{{.Href}}">{{.Name}}{{if .IsDir}}/{{end}}</a></li>
+{{else}}<li>This folder is empty</li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+type shareIndexItem struct {
+	Name  string
+	Href  string
+	IsDir bool
+}
+
+// serveIndex lists a shared folder for browsers, which cannot GET a WebDAV
+// collection
+func (h *ShareHandler) serveIndex(w http.ResponseWriter, r *http.Request, share *types.Share, dirPath string) {
+	if requestAccess(h.webdav.acls, r, dirPath) == acl.Hidden {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct {
+		Name   string
+		Parent string
+		Items  []shareIndexItem
+	}{Name: path.Base(dirPath)}
+	if dirPath == "/" {
+		data.Name = "Shared files"
+	}
+	if dirPath != share.Path {
+		data.Parent = dirHref(r.Context(), path.Dir(dirPath))
+	}
+	for _, child := range h.webdav.vfs.ListDir(dirPath) {
+		if h.webdav.hidden(child.Path) || h.webdav.compat.isJunk(child.Path) || requestAccess(h.webdav.acls, r, child.Path) == acl.Hidden {
+			continue
+		}
+		href := escapePath(publicHref(r.Context(), child.Path))
+		if child.IsDir {
+			href = dirHref(r.Context(), child.Path)
+		}
+		data.Items = append(data.Items, shareIndexItem{Name: child.Name, Href: href, IsDir: child.IsDir})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	if r.Method == http.MethodHead {
+		return
+	}
+	if err := shareIndexTemplate.Execute(w, data); err != nil {
+		log.Printf("❌ Failed to render share index: %v", err)
+	}
+}
+
+// dirHref is the escaped URL of a folder, with the trailing slash that
+// keeps relative links working
+func dirHref(ctx context.Context, dirPath string) string {
+	href := escapePath(publicHref(ctx, dirPath))
+	if !strings.HasSuffix(href, "/") {
+		href += "/"
+	}
+	return href
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"bufio"
 	"context"
-	"encoding/xml"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"mime"
@@ -11,38 +13,100 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"proxydav/internal/acl"
+	"proxydav/internal/archive"
+	"proxydav/internal/backend"
+	"proxydav/internal/composite"
+	"proxydav/internal/contentcheck"
 	"proxydav/internal/filesystem"
+	"proxydav/internal/forwarded"
+	"proxydav/internal/integrity"
+	"proxydav/internal/linkcheck"
+	"proxydav/internal/metadata"
 	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
 	"proxydav/internal/webdav"
 	"proxydav/pkg/types"
 )
 
 type WebDAVHandler struct {
-	vfs         *filesystem.VirtualFS
-	store       *storage.PersistentStore
-	useRedirect bool
-	client      *http.Client
-}
-
-func NewWebDAVHandler(vfs *filesystem.VirtualFS, store *storage.PersistentStore, useRedirect bool) *WebDAVHandler {
-	return &WebDAVHandler{
-		vfs:         vfs,
-		store:       store,
-		useRedirect: useRedirect,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+	vfs               *filesystem.VirtualFS
+	store             *storage.PersistentStore
+	policy            *upstream.Policy
+	metadata          *metadata.Manager
+	links             *linkcheck.Checker
+	archives          *archive.Reader
+	backends          *backend.Registry
+	acls              *acl.List
+	compat            *clientCompat
+	useRedirect       atomic.Bool // switches are set while requests are served
+	readOnly          atomic.Bool
+	verifyChecksums   atomic.Bool
+	validateResponses atomic.Bool
+	sniffResponses    atomic.Bool
+	client            *http.Client
+}
+
+func NewWebDAVHandler(vfs *filesystem.VirtualFS, store *storage.PersistentStore, client *http.Client, policy *upstream.Policy, metadataManager *metadata.Manager, links *linkcheck.Checker, archives *archive.Reader, backends *backend.Registry, acls *acl.List, useRedirect bool) *WebDAVHandler {
+	h := &WebDAVHandler{
+		vfs:      vfs,
+		store:    store,
+		policy:   policy,
+		metadata: metadataManager,
+		links:    links,
+		archives: archives,
+		backends: backends,
+		acls:     acls,
+		compat:   newClientCompat(),
+		client:   client,
 	}
+	h.useRedirect.Store(useRedirect)
+	return h
 }
 
 // SetUseRedirect updates the redirect behavior dynamically
 func (h *WebDAVHandler) SetUseRedirect(useRedirect bool) {
-	h.useRedirect = useRedirect
+	h.useRedirect.Store(useRedirect)
+}
+
+// SetReadOnly refuses or allows changes to the namespace
+func (h *WebDAVHandler) SetReadOnly(readOnly bool) {
+	h.readOnly.Store(readOnly)
+}
+
+// SetContentValidation controls refusing upstream responses that look like
+// error pages, optionally by inspecting the first bytes of the body
+func (h *WebDAVHandler) SetContentValidation(validate, sniff bool) {
+	h.validateResponses.Store(validate)
+	h.sniffResponses.Store(sniff)
+}
+
+// SetVerifyChecksums enables hashing of proxied content against stored checksums
+func (h *WebDAVHandler) SetVerifyChecksums(verify bool) {
+	h.verifyChecksums.Store(verify)
 }
 
+// SetJunkPatterns sets the names of OS metadata files that are absorbed
+// instead of being added to the filesystem
+func (h *WebDAVHandler) SetJunkPatterns(patterns []string) {
+	h.compat.setPatterns(patterns)
+}
+
+// writeMethods change the namespace and are refused in read-only mode
+var writeMethods = map[string]bool{"PUT": true, "DELETE": true, "MOVE": true, "COPY": true, "MKCOL": true, "PROPPATCH": true}
+
 func (h *WebDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.readOnly.Load() && writeMethods[r.Method] {
+		http.Error(w, "Forbidden: the server is read-only", http.StatusForbidden)
+		return
+	}
+	if h.serveJunk(w, r) {
+		return
+	}
+
 	switch r.Method {
 	case "OPTIONS":
 		h.handleOptions(w, r)
@@ -50,6 +114,8 @@ func (h *WebDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handlePropFind(w, r)
 	case "GET", "HEAD":
 		h.handleGetHead(w, r)
+	case "PUT":
+		h.handlePut(w, r)
 	case "DELETE":
 		h.handleDelete(w, r)
 	case "MOVE":
@@ -62,7 +128,11 @@ func (h *WebDAVHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *WebDAVHandler) handleOptions(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Allow", "OPTIONS, PROPFIND, GET, HEAD, DELETE, MOVE, COPY")
+	if h.readOnly.Load() {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, GET, HEAD")
+	} else {
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, GET, HEAD, PUT, DELETE, MOVE, COPY")
+	}
 	w.Header().Set("DAV", "1")
 	w.Header().Set("MS-Author-Via", "DAV")
 	w.WriteHeader(http.StatusOK)
@@ -71,7 +141,7 @@ func (h *WebDAVHandler) handleOptions(w http.ResponseWriter, r *http.Request) {
 func (h *WebDAVHandler) handlePropFind(w http.ResponseWriter, r *http.Request) {
 	requestPath := r.URL.Path
 	normalizedPath := path.Clean("/" + strings.TrimPrefix(requestPath, "/"))
-	if !h.vfs.Exists(normalizedPath) {
+	if !h.vfs.Exists(normalizedPath) || h.hidden(normalizedPath) || requestAccess(h.acls, r, normalizedPath) == acl.Hidden {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
@@ -81,42 +151,42 @@ func (h *WebDAVHandler) handlePropFind(w http.ResponseWriter, r *http.Request) {
 		depth = "1"
 	}
 
-	var responses []webdav.Response
-
-	// Add response for the requested path itself
-	if response := h.createResponse(normalizedPath); response != nil {
-		responses = append(responses, *response)
-	}
-
-	// If it's a directory and depth allows, add children
+	// Collect the requested path and, if it's a directory and depth allows, its children
+	paths := []string{normalizedPath}
 	if depth != "0" && h.vfs.IsDir(normalizedPath) {
-		children := h.vfs.ListDir(normalizedPath)
-		for _, child := range children {
-			if response := h.createResponse(child.Path); response != nil {
-				responses = append(responses, *response)
+		for _, child := range h.vfs.ListDir(normalizedPath) {
+			if h.hidden(child.Path) || h.compat.isJunk(child.Path) || requestAccess(h.acls, r, child.Path) == acl.Hidden {
+				continue
 			}
+			paths = append(paths, child.Path)
 		}
 	}
 
-	multistatus := webdav.Multistatus{
-		Responses: responses,
+	// Resolve metadata for all files up front so uncached lookups run concurrently
+	var lookups []metadata.Lookup
+	for _, itemPath := range paths {
+		if item, exists := h.vfs.GetItem(itemPath); exists && !item.IsDir && item.Entry != nil {
+			for _, fileURL := range item.Entry.URLs() {
+				lookups = append(lookups, metadata.Lookup{URL: fileURL, VirtualPath: item.Path})
+			}
+		}
 	}
+	metadataByURL := h.resolveMetadata(r.Context(), lookups)
 
-	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
-	w.WriteHeader(http.StatusMultiStatus)
-
-	xmlData, err := xml.MarshalIndent(multistatus, "", "  ")
-	if err != nil {
-		log.Printf("Error marshaling XML: %v", err)
-		return
+	var responses []webdav.Response
+	for _, itemPath := range paths {
+		if response := h.createResponse(itemPath, metadataByURL); response != nil {
+			response.Propstat.Prop.CurrentUserPrivilegeSet = privileges(requestAccess(h.acls, r, itemPath))
+			response.Href = publicHref(r.Context(), response.Href)
+			responses = append(responses, *response)
+		}
 	}
 
-	w.Write([]byte(`<?xml version="1.0" encoding="utf-8"?>` + "\n"))
-	w.Write(xmlData)
+	writeMultistatus(w, responses)
 }
 
-// createResponse creates a WebDAV response for a given path
-func (h *WebDAVHandler) createResponse(requestPath string) *webdav.Response {
+// createResponse creates a WebDAV response for a given path using prefetched file metadata
+func (h *WebDAVHandler) createResponse(requestPath string, metadataByURL map[string]*types.FileMetadata) *webdav.Response {
 	item, exists := h.vfs.GetItem(requestPath)
 	if !exists && !h.vfs.IsDir(requestPath) {
 		return nil
@@ -135,7 +205,9 @@ func (h *WebDAVHandler) createResponse(requestPath string) *webdav.Response {
 		},
 	}
 
-	if item != nil && !item.IsDir {
+	if item != nil && item.Member != nil {
+		response.Propstat.Prop = h.memberProp(item)
+	} else if item != nil && !item.IsDir {
 		// It's a file
 		response.Propstat.Prop = webdav.Prop{
 			DisplayName:  item.Name,
@@ -143,12 +215,26 @@ func (h *WebDAVHandler) createResponse(requestPath string) *webdav.Response {
 			ContentType:  mime.TypeByExtension(filepath.Ext(item.Name)),
 		}
 
-		// Try to get metadata from persistent store or fetch it
-		metadata := h.getFileMetadata(item.URL)
-		if metadata != nil {
-			response.Propstat.Prop.ContentLength = &metadata.Size
-			response.Propstat.Prop.LastModified = webdav.FormatTime(metadata.LastModified)
-			response.Propstat.Prop.ETag = webdav.GenerateETag(metadata.URL, metadata.LastModified)
+		if fileMetadata := entryMetadata(item, metadataByURL); fileMetadata != nil {
+			response.Propstat.Prop.ContentLength = &fileMetadata.Size
+			response.Propstat.Prop.LastModified = webdav.FormatTime(fileMetadata.LastModified)
+			if fileMetadata.ETag != "" {
+				response.Propstat.Prop.ETag = fileMetadata.ETag
+			} else {
+				response.Propstat.Prop.ETag = webdav.GenerateETag(fileMetadata.URL, fileMetadata.LastModified)
+			}
+			if response.Propstat.Prop.ContentType == "" {
+				response.Propstat.Prop.ContentType = fileMetadata.ContentType
+			}
+		}
+		if item.Entry != nil {
+			response.Propstat.Prop.LinkStatus = h.linkStatus(item.Entry)
+			if values := integrity.PropValues(item.Entry.Checksums); len(values) > 0 {
+				response.Propstat.Prop.Checksums = &webdav.Checksums{Checksum: values}
+			}
+			if item.Entry.Integrity != nil {
+				response.Propstat.Prop.Integrity = item.Entry.Integrity.Status
+			}
 		}
 	} else {
 		// It's a directory
@@ -168,62 +254,87 @@ func (h *WebDAVHandler) createResponse(requestPath string) *webdav.Response {
 	return response
 }
 
-// getFileMetadata gets file metadata from persistent store or by making a HEAD request
-func (h *WebDAVHandler) getFileMetadata(url string) *types.FileMetadata {
-	// Try persistent store first
-	if metadata, err := h.store.GetFileMetadata(url); err == nil && metadata != nil {
-		return metadata
+// resolveMetadata returns metadata for lookups. URLs served by a backend
+// are stat'ed directly; HTTP URLs go through the metadata cache.
+func (h *WebDAVHandler) resolveMetadata(ctx context.Context, lookups []metadata.Lookup) map[string]*types.FileMetadata {
+	results := make(map[string]*types.FileMetadata, len(lookups))
+	var remote []metadata.Lookup
+	for _, lookup := range lookups {
+		b, ok := h.backends.For(lookup.URL)
+		if !ok {
+			remote = append(remote, lookup)
+			continue
+		}
+		if fileMetadata, err := b.Stat(ctx, lookup.URL); err == nil {
+			results[lookup.URL] = fileMetadata
+		}
 	}
-
-	// Make HEAD request to get metadata
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
-	if err != nil {
-		log.Printf("Error creating HEAD request for %s: %v", url, err)
-		return nil
+	if len(remote) > 0 {
+		for fileURL, fileMetadata := range h.metadata.GetMany(ctx, remote) {
+			results[fileURL] = fileMetadata
+		}
 	}
+	return results
+}
 
-	resp, err := h.client.Do(req)
+// entryMetadata returns the metadata of a file's upstream URL, or of the
+// assembled file for concatenated and sliced entries
+func entryMetadata(item *types.VirtualItem, metadataByURL map[string]*types.FileMetadata) *types.FileMetadata {
+	if item.Entry == nil || !composite.IsComposite(item.Entry.Kind) {
+		return metadataByURL[item.URL]
+	}
+	_, combined, err := composite.Layout(item.Entry, metadataByURL)
 	if err != nil {
-		log.Printf("Error making HEAD request for %s: %v", url, err)
 		return nil
 	}
-	defer resp.Body.Close()
+	return combined
+}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Printf("HEAD request for %s returned status %d", url, resp.StatusCode)
-		return nil
+// linkStatus reports the health of an entry's upstream URLs; one broken part breaks the entry
+func (h *WebDAVHandler) linkStatus(entry *types.FileEntry) string {
+	status := ""
+	for _, fileURL := range entry.URLs() {
+		health, err := h.store.GetLinkHealth(fileURL)
+		if err != nil || health == nil {
+			continue
+		}
+		if health.Status == types.LinkStatusBroken {
+			return health.Status
+		}
+		if status == "" {
+			status = health.Status
+		}
 	}
+	return status
+}
 
-	// Parse metadata
-	metadata := &types.FileMetadata{
-		URL: url,
+// memberProp describes a file inside a mounted archive from its directory entry
+func (h *WebDAVHandler) memberProp(item *types.VirtualItem) webdav.Prop {
+	member := item.Member
+	prop := webdav.Prop{
+		DisplayName:   item.Name,
+		ContentType:   mime.TypeByExtension(filepath.Ext(item.Name)),
+		ContentLength: &member.Size,
+		LastModified:  webdav.FormatTime(member.Modified),
 	}
-
-	if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
-		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
-			metadata.Size = size
-		}
+	if _, index, ok := h.vfs.GetArchive(item.Archive); ok {
+		prop.ETag = archive.MemberETag(index, member)
 	}
+	return prop
+}
 
-	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
-		if t, err := time.Parse(time.RFC1123, lastModified); err == nil {
-			metadata.LastModified = t
-		} else {
-			metadata.LastModified = time.Now()
-		}
-	} else {
-		metadata.LastModified = time.Now()
+// hidden reports whether the file or mounted archive at itemPath is hidden because its link is broken
+func (h *WebDAVHandler) hidden(itemPath string) bool {
+	item, exists := h.vfs.GetItem(itemPath)
+	if !exists || item.Entry == nil {
+		return false
 	}
-
-	// Store the metadata persistently
-	if err := h.store.SetFileMetadata(metadata); err != nil {
-		log.Printf("Failed to store metadata for %s: %v", url, err)
+	for _, fileURL := range item.Entry.URLs() {
+		if h.links.Hidden(fileURL) {
+			return true
+		}
 	}
-
-	return metadata
+	return false
 }
 
 // handleGetHead handles GET and HEAD requests
@@ -232,7 +343,7 @@ func (h *WebDAVHandler) handleGetHead(w http.ResponseWriter, r *http.Request) {
 
 	normalizedPath := path.Clean("/" + strings.TrimPrefix(requestPath, "/"))
 	item, exists := h.vfs.GetItem(normalizedPath)
-	if !exists {
+	if !exists || h.hidden(normalizedPath) || requestAccess(h.acls, r, normalizedPath) == acl.Hidden {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
@@ -242,17 +353,37 @@ func (h *WebDAVHandler) handleGetHead(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if h.useRedirect {
+	// Members and assembled files have no URL of their own, so they are always served by us
+	if item.Member != nil {
+		h.serveArchiveMember(w, r.WithContext(upstream.WithVirtualPath(r.Context(), item.Path)), item)
+		return
+	}
+
+	// Neither can clients follow a redirect to a local file or inline content
+	if b, ok := h.backends.For(item.URL); ok && !composite.IsComposite(item.Entry.Kind) {
+		h.serveBackend(w, r, item, b)
+		return
+	}
+
+	// Share links always proxy, so their URL stays the only way in
+	if h.useRedirect.Load() && !composite.IsComposite(item.Entry.Kind) && !isShareRequest(r.Context()) {
 		http.Redirect(w, r, item.URL, http.StatusFound)
 		return
 	}
 
 	// Proxy the content
-	h.proxyContent(w, r, item.URL)
+	h.proxyContent(w, r.WithContext(upstream.WithVirtualPath(r.Context(), item.Path)), item)
 }
 
-// proxyContent proxies content from the remote URL
-func (h *WebDAVHandler) proxyContent(w http.ResponseWriter, r *http.Request, url string) {
+// proxyContent proxies content from the item's remote URL
+func (h *WebDAVHandler) proxyContent(w http.ResponseWriter, r *http.Request, item *types.VirtualItem) {
+	if item.Entry != nil && composite.IsComposite(item.Entry.Kind) {
+		h.serveComposite(w, r, item)
+		return
+	}
+
+	url := item.URL
+
 	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
 	defer cancel()
 
@@ -275,11 +406,49 @@ func (h *WebDAVHandler) proxyContent(w http.ResponseWriter, r *http.Request, url
 	resp, err := h.client.Do(req)
 	if err != nil {
 		log.Printf("Error proxying request to %s: %v", url, err)
+		if upstream.IsPolicyError(err) {
+			http.Error(w, "Upstream destination not allowed", http.StatusForbidden)
+			return
+		}
 		http.Error(w, "Bad Gateway", http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
 
+	var body io.Reader = resp.Body
+	encoding := resp.Header.Get("Content-Encoding")
+	unencoded := encoding == "" || encoding == "identity"
+
+	if h.validateResponses.Load() && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent) {
+		var cached *types.FileMetadata
+		if h.store != nil {
+			cached, _ = h.store.GetFileMetadata(url)
+		}
+
+		err := contentcheck.CheckResponse(item.Path, resp.StatusCode, resp.Header, resp.ContentLength, cached)
+		if contentcheck.ETagChanged(err) && h.metadata != nil {
+			// A new ETag may mean the file was replaced upstream; believe the
+			// response if the file's metadata now describes it
+			fresh, checkErr := h.metadata.Check(upstream.WithVirtualPath(r.Context(), item.Path), url)
+			if checkErr == nil {
+				err = contentcheck.CheckResponse(item.Path, resp.StatusCode, resp.Header, resp.ContentLength, fresh)
+			}
+		}
+		if err == nil && h.sniffResponses.Load() && r.Method != "HEAD" && unencoded && contentcheck.StartsAtZero(resp.StatusCode, resp.Header) {
+			buffered := bufio.NewReaderSize(resp.Body, contentcheck.SniffLength)
+			prefix, _ := buffered.Peek(contentcheck.SniffLength)
+			err = contentcheck.Sniff(item.Path, prefix)
+			body = buffered
+		}
+
+		if err != nil {
+			log.Printf("⚠️  Refusing upstream response for %s from %s: %v", item.Path, url, err)
+			h.links.Flag(url, err.Error())
+			http.Error(w, "Bad Gateway: upstream returned an unexpected response", http.StatusBadGateway)
+			return
+		}
+	}
+
 	// Copy response headers
 	for name, values := range resp.Header {
 		for _, value := range values {
@@ -287,14 +456,436 @@ func (h *WebDAVHandler) proxyContent(w http.ResponseWriter, r *http.Request, url
 		}
 	}
 
+	var checksums map[string]string
+	if item.Entry != nil {
+		checksums = item.Entry.Checksums
+	}
+	if len(checksums) > 0 && (resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent) {
+		// Advertise the expected digests of the whole representation
+		w.Header().Set("Digest", integrity.DigestHeader(checksums))
+		w.Header().Set("Repr-Digest", integrity.ReprDigestHeader(checksums))
+	}
+
 	w.WriteHeader(resp.StatusCode)
 
+	if r.Method == "HEAD" {
+		return
+	}
+
+	// Only a complete, unencoded body can be compared with the stored checksums
+	var verifier *integrity.Verifier
+	if h.verifyChecksums.Load() && resp.StatusCode == http.StatusOK && unencoded {
+		verifier = integrity.NewVerifier(checksums)
+	}
+	if verifier != nil {
+		body = io.TeeReader(body, verifier)
+	}
+
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Error copying response body: %v", err)
+		return
+	}
+
+	if verifier != nil {
+		h.recordIntegrity(item, verifier.Result())
+	}
+}
+
+// serveComposite streams a concatenated or sliced entry by requesting the
+// byte ranges that make it up. Range and conditional requests are handled
+// by http.ServeContent; the first upstream request is made beforehand so
+// that failures can still be answered with an error status.
+func (h *WebDAVHandler) serveComposite(w http.ResponseWriter, r *http.Request, item *types.VirtualItem) {
+	entry := item.Entry
+
+	var lookups []metadata.Lookup
+	for _, fileURL := range entry.URLs() {
+		lookups = append(lookups, metadata.Lookup{URL: fileURL, VirtualPath: item.Path})
+	}
+	segments, combined, err := composite.Layout(entry, h.resolveMetadata(r.Context(), lookups))
+	if err != nil {
+		log.Printf("Error assembling %s: %v", item.Path, err)
+		http.Error(w, "Bad Gateway: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var check composite.CheckFunc
+	if h.validateResponses.Load() {
+		check = func(segment composite.Segment, resp *http.Response) error {
+			err := contentcheck.CheckResponse(item.Path, resp.StatusCode, resp.Header, resp.ContentLength, nil)
+			if err != nil {
+				h.links.Flag(segment.URL, err.Error())
+			}
+			return err
+		}
+	}
+
+	file := composite.NewFile(ctx, h.client, h.backends, segments, check)
+	defer file.Close()
+
 	if r.Method != "HEAD" {
-		_, err := io.Copy(w, resp.Body)
-		if err != nil {
-			log.Printf("Error copying response body: %v", err)
+		if err := file.Prime(rangeStart(r.Header.Get("Range"), combined.Size)); err != nil {
+			log.Printf("Error proxying %s: %v", item.Path, err)
+			var suspicious *contentcheck.SuspiciousError
+			switch {
+			case upstream.IsPolicyError(err):
+				http.Error(w, "Upstream destination not allowed", http.StatusForbidden)
+			case errors.As(err, &suspicious):
+				http.Error(w, "Bad Gateway: upstream returned an unexpected response", http.StatusBadGateway)
+			default:
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			}
+			return
 		}
 	}
+
+	h.serveSeekable(w, r, item, combined, file)
+}
+
+// serveBackend serves a file from the backend of its URL scheme
+func (h *WebDAVHandler) serveBackend(w http.ResponseWriter, r *http.Request, item *types.VirtualItem, b backend.Backend) {
+	fileMetadata, err := b.Stat(r.Context(), item.URL)
+	if err == nil {
+		var file io.ReadSeekCloser
+		if file, err = b.Open(r.Context(), item.URL); err == nil {
+			defer file.Close()
+			h.serveSeekable(w, r, item, fileMetadata, file)
+			return
+		}
+	}
+
+	log.Printf("Error serving %s from %s: %v", item.Path, item.URL, err)
+	switch {
+	case errors.Is(err, backend.ErrNotFound):
+		http.Error(w, "Not Found", http.StatusNotFound)
+	case errors.Is(err, backend.ErrOutsideRoots):
+		http.Error(w, "Forbidden: file is outside of the local roots", http.StatusForbidden)
+	default:
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// serveSeekable serves content with known metadata through http.ServeContent,
+// which handles Range and conditional requests, hashing it when verification is on
+func (h *WebDAVHandler) serveSeekable(w http.ResponseWriter, r *http.Request, item *types.VirtualItem, fileMetadata *types.FileMetadata, content io.ReadSeeker) {
+	entry := item.Entry
+
+	contentType := mime.TypeByExtension(filepath.Ext(item.Name))
+	if contentType == "" {
+		contentType = fileMetadata.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if fileMetadata.ETag != "" {
+		w.Header().Set("ETag", fileMetadata.ETag)
+	}
+	if len(entry.Checksums) > 0 {
+		w.Header().Set("Digest", integrity.DigestHeader(entry.Checksums))
+		w.Header().Set("Repr-Digest", integrity.ReprDigestHeader(entry.Checksums))
+	}
+
+	var verifier *integrity.Verifier
+	if h.verifyChecksums.Load() && r.Method != "HEAD" {
+		verifier = integrity.NewVerifier(entry.Checksums)
+	}
+	if verifier == nil {
+		http.ServeContent(w, r, item.Name, fileMetadata.LastModified, content)
+		return
+	}
+
+	// Only a read of the whole file from its first byte can be verified
+	tracked := &sequentialReader{ReadSeeker: content, verifier: verifier}
+	http.ServeContent(w, r, item.Name, fileMetadata.LastModified, tracked)
+	if tracked.hashed == fileMetadata.Size {
+		h.recordIntegrity(item, verifier.Result())
+	}
+}
+
+// sequentialReader hashes content read contiguously from the first byte
+type sequentialReader struct {
+	io.ReadSeeker
+	verifier *integrity.Verifier
+	position int64
+	hashed   int64
+}
+
+func (s *sequentialReader) Read(p []byte) (int, error) {
+	n, err := s.ReadSeeker.Read(p)
+	if s.position == s.hashed {
+		s.verifier.Write(p[:n])
+		s.hashed += int64(n)
+	}
+	s.position += int64(n)
+	return n, err
+}
+
+func (s *sequentialReader) Seek(offset int64, whence int) (int64, error) {
+	position, err := s.ReadSeeker.Seek(offset, whence)
+	if err == nil {
+		s.position = position
+	}
+	return position, err
+}
+
+// rangeStart returns the first byte requested by a single-range Range
+// header, or 0 when the whole file will be sent
+func rangeStart(header string, size int64) int64 {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0
+	}
+	first, last, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return 0
+	}
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0
+		}
+		if suffix > size {
+			return 0
+		}
+		return size - suffix
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0
+	}
+	return start
+}
+
+// serveArchiveMember streams one file of a mounted archive, requesting
+// only its bytes from upstream. Range and conditional requests are
+// handled by http.ServeContent over a lazily opened member reader.
+func (h *WebDAVHandler) serveArchiveMember(w http.ResponseWriter, r *http.Request, item *types.VirtualItem) {
+	entry, index, ok := h.vfs.GetArchive(item.Archive)
+	if !ok || h.archives == nil {
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+	member := item.Member
+	if err := archive.Supported(member); err != nil {
+		http.Error(w, "Not Implemented: "+err.Error(), http.StatusNotImplemented)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	// Locating the data up front lets upstream failures become a proper
+	// error status instead of a truncated 200 response
+	if r.Method != "HEAD" {
+		if _, err := h.archives.Locate(ctx, index, member); err != nil {
+			log.Printf("Error reading %s from archive %s: %v", member.Name, entry.URL, err)
+			switch {
+			case upstream.IsPolicyError(err):
+				http.Error(w, "Upstream destination not allowed", http.StatusForbidden)
+			case errors.Is(err, archive.ErrChanged):
+				http.Error(w, "Bad Gateway: archive changed upstream, refresh the mount", http.StatusBadGateway)
+			default:
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			}
+			return
+		}
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(item.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", archive.MemberETag(index, member))
+
+	file := h.archives.File(ctx, index, member)
+	defer file.Close()
+	http.ServeContent(w, r, item.Name, member.Modified, file)
+}
+
+// recordIntegrity stores a verification result on the entry, unless the
+// entry was changed while the content was streaming
+func (h *WebDAVHandler) recordIntegrity(item *types.VirtualItem, result *types.Integrity) {
+	if result.Status == types.IntegrityMismatch {
+		log.Printf("⚠️  Checksum mismatch for %s (%s): expected %v, got %v", item.Path, item.URL, result.Expected, result.Actual)
+	}
+
+	current, exists := h.vfs.GetItem(item.Path)
+	if !exists || current.Entry == nil || current.URL != item.URL {
+		return
+	}
+
+	entry := *current.Entry
+	entry.Integrity = result
+	if err := h.vfs.UpdateEntry(entry); err != nil {
+		log.Printf("⚠️  Failed to record integrity for %s: %v", item.Path, err)
+	}
+}
+
+// linkHeader names the URL a PUT should link to, whatever its body
+const linkHeader = "X-ProxyDAV-URL"
+
+// maxLinkBody bounds the body of a PUT that names a URL
+const maxLinkBody = 64 << 10
+
+// handlePut adds or replaces a file. A request naming a URL, through
+// linkHeader, a text/uri-list body or an Internet Shortcut saved as .url,
+// creates a proxy entry for it; any other body is kept in the blob store.
+func (h *WebDAVHandler) handlePut(w http.ResponseWriter, r *http.Request) {
+	requestPath := r.URL.Path
+	normalizedPath := path.Clean("/" + strings.TrimPrefix(requestPath, "/"))
+
+	if h.vfs.InArchive(normalizedPath) {
+		http.Error(w, "Forbidden: archive members are read-only", http.StatusForbidden)
+		return
+	}
+
+	targetURL, isLink, err := linkTarget(r, normalizedPath)
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	entryPath := normalizedPath
+	if isLink && strings.EqualFold(path.Ext(normalizedPath), ".url") {
+		// The shortcut stands for the file it points to
+		entryPath = strings.TrimSuffix(normalizedPath, path.Ext(normalizedPath))
+		if path.Base(entryPath) == "" || strings.HasSuffix(entryPath, "/") {
+			http.Error(w, "Bad Request: shortcut has no file name", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !authorize(w, r, h.acls, entryPath, acl.Write, false) {
+		return
+	}
+	if normalizedPath == "/" || h.vfs.IsDir(entryPath) {
+		http.Error(w, "Cannot PUT a collection", http.StatusMethodNotAllowed)
+		return
+	}
+	exists := h.vfs.Exists(entryPath)
+	if exists && r.Header.Get("If-None-Match") == "*" {
+		http.Error(w, "File already exists", http.StatusPreconditionFailed)
+		return
+	}
+
+	entry := types.FileEntry{Path: entryPath, URL: targetURL}
+	if isLink {
+		if err := validateFileEntry(r.Context(), h.policy, h.backends, &entry); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		writer, ok := h.backends.Writer("blob")
+		if !ok {
+			http.Error(w, "Forbidden: uploads are not available", http.StatusForbidden)
+			return
+		}
+		fileURL, err := writer.Put(r.Context(), r.Body)
+		switch {
+		case errors.Is(err, backend.ErrUploadsDisabled):
+			http.Error(w, "Forbidden: uploads are disabled; PUT a text/uri-list or .url file to add a link", http.StatusForbidden)
+			return
+		case errors.Is(err, backend.ErrTooLarge):
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		case errors.Is(err, backend.ErrQuotaExceeded):
+			http.Error(w, err.Error(), http.StatusInsufficientStorage)
+			return
+		case err != nil:
+			log.Printf("Error storing upload for %s: %v", entryPath, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		entry.URL = fileURL
+		entry.Checksums = map[string]string{"sha256": strings.TrimPrefix(fileURL, backend.BlobPrefix)}
+	}
+
+	if exists {
+		err = h.vfs.UpdateEntry(entry)
+	} else {
+		err = h.vfs.AddEntry(entry)
+	}
+	if err != nil {
+		h.vfs.ReleaseContent(entry.URL)
+		log.Printf("Error saving %s: %v", entryPath, err)
+		http.Error(w, "Conflict: "+err.Error(), http.StatusConflict)
+		return
+	}
+
+	if entryPath != normalizedPath {
+		w.Header().Set("Location", escapePath(publicHref(r.Context(), entryPath)))
+	}
+	if exists {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// linkTarget returns the URL a PUT asks to link to, reading the body only
+// when it is a URI list or an Internet Shortcut
+func linkTarget(r *http.Request, filePath string) (string, bool, error) {
+	if target := strings.TrimSpace(r.Header.Get(linkHeader)); target != "" {
+		return target, true, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	isURIList := mediaType == "text/uri-list"
+	if !isURIList && !strings.EqualFold(path.Ext(filePath), ".url") {
+		return "", false, nil
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxLinkBody+1))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read body: %w", err)
+	}
+	if len(body) > maxLinkBody {
+		return "", false, fmt.Errorf("link bodies are limited to %d bytes", maxLinkBody)
+	}
+
+	var target string
+	if isURIList {
+		target = firstListedURI(string(body))
+	} else {
+		target = shortcutURL(string(body))
+	}
+	if target == "" {
+		return "", false, fmt.Errorf("body names no URL")
+	}
+	return target, true, nil
+}
+
+// firstListedURI returns the first URI of a text/uri-list, skipping comments
+func firstListedURI(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "#") {
+			return line
+		}
+	}
+	return ""
+}
+
+// shortcutURL returns the URL key of the [InternetShortcut] section of a
+// Windows .url file
+func shortcutURL(body string) string {
+	inSection := false
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inSection = strings.EqualFold(line, "[InternetShortcut]")
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if inSection && ok && strings.EqualFold(strings.TrimSpace(key), "URL") {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
 }
 
 func (h *WebDAVHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
@@ -305,6 +896,14 @@ func (h *WebDAVHandler) handleDelete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+	if !authorize(w, r, h.acls, normalizedPath, acl.Write, true) {
+		return
+	}
+
+	if h.vfs.InArchive(normalizedPath) {
+		http.Error(w, "Forbidden: archive members are read-only", http.StatusForbidden)
+		return
+	}
 
 	var err error
 	if h.vfs.IsDir(normalizedPath) {
@@ -332,7 +931,7 @@ func (h *WebDAVHandler) handleMove(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	destPath, err := h.parseDestinationPath(destination)
+	destPath, err := h.parseDestinationPath(r.Context(), destination)
 	if err != nil {
 		log.Printf("Error parsing destination %s: %v", destination, err)
 		http.Error(w, "Bad Destination", http.StatusBadRequest)
@@ -345,6 +944,15 @@ func (h *WebDAVHandler) handleMove(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+	// Moving removes the whole source tree; the destination may replace one
+	if !authorize(w, r, h.acls, normalizedSource, acl.Write, true) || !authorize(w, r, h.acls, normalizedDest, acl.Write, true) {
+		return
+	}
+
+	if h.vfs.InArchive(normalizedSource) || h.vfs.InArchive(normalizedDest) {
+		http.Error(w, "Forbidden: archive members are read-only", http.StatusForbidden)
+		return
+	}
 
 	overwrite := r.Header.Get("Overwrite")
 	if overwrite == "" {
@@ -401,7 +1009,7 @@ func (h *WebDAVHandler) handleCopy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	destPath, err := h.parseDestinationPath(destination)
+	destPath, err := h.parseDestinationPath(r.Context(), destination)
 	if err != nil {
 		log.Printf("Error parsing destination %s: %v", destination, err)
 		http.Error(w, "Bad Destination", http.StatusBadRequest)
@@ -414,6 +1022,15 @@ func (h *WebDAVHandler) handleCopy(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Not Found", http.StatusNotFound)
 		return
 	}
+	// Copying a tree would reveal hidden parts of it at the destination
+	if !authorize(w, r, h.acls, normalizedSource, acl.Read, true) || !authorize(w, r, h.acls, normalizedDest, acl.Write, true) {
+		return
+	}
+
+	if h.vfs.InArchive(normalizedSource) || h.vfs.InArchive(normalizedDest) {
+		http.Error(w, "Forbidden: archive members are read-only", http.StatusForbidden)
+		return
+	}
 
 	overwrite := r.Header.Get("Overwrite")
 	if overwrite == "" {
@@ -460,7 +1077,7 @@ func (h *WebDAVHandler) handleCopy(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (h *WebDAVHandler) parseDestinationPath(destination string) (string, error) {
+func (h *WebDAVHandler) parseDestinationPath(ctx context.Context, destination string) (string, error) {
 	// The destination can be a full URL or just a path
 	// We need to extract just the path part
 
@@ -471,9 +1088,16 @@ func (h *WebDAVHandler) parseDestinationPath(destination string) (string, error)
 		if len(parts) < 4 {
 			return "/", nil
 		}
-		return "/" + parts[3], nil
+		destination = "/" + parts[3]
 	}
 
-	// Otherwise, treat as path
+	// Clients name the destination as they see it, below the prefix of a
+	// reverse proxy, which only strips it from the request URL
+	if prefix := forwarded.Prefix(ctx); prefix != "" {
+		if destination != prefix && !strings.HasPrefix(destination, prefix+"/") {
+			return "", fmt.Errorf("destination %s is outside %s", destination, prefix)
+		}
+		destination = "/" + strings.TrimPrefix(strings.TrimPrefix(destination, prefix), "/")
+	}
 	return destination, nil
 }
@@ -0,0 +1,673 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"proxydav/internal/acl"
+	"proxydav/internal/archive"
+	"proxydav/internal/auth"
+	"proxydav/internal/backend"
+	"proxydav/internal/filesystem"
+	"proxydav/internal/metadata"
+	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
+)
+
+func createTestWebDAVHandler(t *testing.T, vfs *filesystem.VirtualFS) *WebDAVHandler {
+	policy, err := upstream.NewPolicy(nil, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	client := upstream.NewClient(policy, &upstream.Router{}, 5*time.Second)
+	return NewWebDAVHandler(vfs, nil, client, nil, nil, nil, archive.NewReader(client), nil, nil, false)
+}
+
+func TestWebDAVHandler_VerifiesChecksums(t *testing.T) {
+	body := "hello world"
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+	defer upstreamServer.Close()
+
+	vfs := createTestVFS(t)
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.SetVerifyChecksums(true)
+
+	err := vfs.AddEntry(types.FileEntry{
+		Path:      "/hello.txt",
+		URL:       upstreamServer.URL + "/hello.txt",
+		Checksums: map[string]string{"sha256": "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to add entry: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/hello.txt", nil))
+
+	if w.Body.String() != body {
+		t.Errorf("Expected proxied body, got %q", w.Body.String())
+	}
+	if got := w.Header().Get("Repr-Digest"); got != "sha-256=:uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=:" {
+		t.Errorf("Unexpected Repr-Digest header %q", got)
+	}
+	if got := w.Header().Get("Digest"); got != "SHA-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=" {
+		t.Errorf("Unexpected Digest header %q", got)
+	}
+
+	item, _ := vfs.GetItem("/hello.txt")
+	if item.Entry.Integrity == nil || item.Entry.Integrity.Status != types.IntegrityVerified {
+		t.Errorf("Expected entry to be verified, got %+v", item.Entry.Integrity)
+	}
+
+	// The mirror silently swaps content
+	body = "goodbye world"
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/hello.txt", nil))
+
+	item, _ = vfs.GetItem("/hello.txt")
+	if item.Entry.Integrity == nil || item.Entry.Integrity.Status != types.IntegrityMismatch {
+		t.Errorf("Expected mismatch to be recorded, got %+v", item.Entry.Integrity)
+	}
+}
+
+func TestWebDAVHandler_RefusesErrorPages(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sniffed.zip" {
+			// Mislabelled as binary, only sniffing can catch it
+			w.Header().Set("Content-Type", "application/octet-stream")
+		} else {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		}
+		io.WriteString(w, "<!DOCTYPE html><html><body>Please log in</body></html>")
+	}))
+	defer upstreamServer.Close()
+
+	vfs := createTestVFS(t)
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.SetContentValidation(true, true)
+
+	vfs.AddFile("/archive.zip", upstreamServer.URL+"/archive.zip")
+	vfs.AddFile("/sniffed.zip", upstreamServer.URL+"/sniffed.zip")
+	vfs.AddFile("/page.html", upstreamServer.URL+"/page.html")
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/archive.zip", want: http.StatusBadGateway},
+		{path: "/sniffed.zip", want: http.StatusBadGateway},
+		{path: "/page.html", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		if w.Code != tt.want {
+			t.Errorf("GET %s: expected status %d, got %d", tt.path, tt.want, w.Code)
+		}
+	}
+
+	// Validation can be switched off
+	handler.SetContentValidation(false, false)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/archive.zip", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected response to pass through with validation off, got %d", w.Code)
+	}
+}
+
+func TestWebDAVHandler_RefusesSizeMismatches(t *testing.T) {
+	etag := ""
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if etag != "" {
+			w.Header().Set("ETag", etag)
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", "10")
+		io.WriteString(w, "0123456789")
+	}))
+	defer upstreamServer.Close()
+
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	defer store.Close()
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+	policy, _ := upstream.NewPolicy(nil, nil, true)
+	client := upstream.NewClient(policy, &upstream.Router{}, 5*time.Second)
+	manager := metadata.NewManager(store, client, metadata.Options{TTL: time.Hour})
+	handler := NewWebDAVHandler(vfs, store, client, policy, manager, nil, archive.NewReader(client), nil, nil, false)
+	handler.SetContentValidation(true, false)
+
+	fileURL := upstreamServer.URL + "/a.bin"
+	vfs.AddFile("/a.bin", fileURL)
+	store.SetFileMetadata(&types.FileMetadata{URL: fileURL, Size: 1 << 20, ETag: `"v1"`, FetchedAt: time.Now()})
+
+	get := func() int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", "/a.bin", nil))
+		return w.Code
+	}
+
+	// An error page without an ETag is refused whatever the cached ETag
+	if code := get(); code != http.StatusBadGateway {
+		t.Errorf("Expected a response of the wrong size without an ETag to be refused, got %d", code)
+	}
+
+	// A new ETag that upstream's metadata confirms is a replaced file
+	etag = `"v2"`
+	if code := get(); code != http.StatusOK {
+		t.Errorf("Expected a replaced file to be served after revalidation, got %d", code)
+	}
+	if cached, _ := store.GetFileMetadata(fileURL); cached == nil || cached.Size != 10 || cached.ETag != `"v2"` {
+		t.Errorf("Expected the revalidated metadata to be cached, got %+v", cached)
+	}
+}
+
+func TestWebDAVHandler_ServesArchiveMembers(t *testing.T) {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	member, _ := writer.Create("docs/readme.txt")
+	io.WriteString(member, "hello from inside the archive")
+	writer.Close()
+	data := buf.Bytes()
+
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "bundle.zip", time.Time{}, bytes.NewReader(data))
+	}))
+	defer upstreamServer.Close()
+
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.store = store
+	handler.metadata = metadata.NewManager(store, handler.client, metadata.Options{TTL: time.Hour})
+
+	index, err := handler.archives.ReadIndex(context.Background(), upstreamServer.URL+"/bundle.zip")
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	if err := vfs.AddArchive(types.FileEntry{Path: "/bundle.zip", URL: upstreamServer.URL + "/bundle.zip"}, index); err != nil {
+		t.Fatalf("Failed to mount archive: %v", err)
+	}
+
+	propfind := httptest.NewRequest("PROPFIND", "/bundle.zip/docs", nil)
+	propfind.Header.Set("Depth", "1")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, propfind)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<getcontentlength>29</getcontentlength>") {
+		t.Errorf("Expected member listed with its size, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/bundle.zip/docs/readme.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello from inside the archive" {
+		t.Errorf("Expected member content, got %d: %q", w.Code, w.Body.String())
+	}
+
+	rangeRequest := httptest.NewRequest("GET", "/bundle.zip/docs/readme.txt", nil)
+	rangeRequest.Header.Set("Range", "bytes=6-9")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, rangeRequest)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "from" {
+		t.Errorf("Expected ranged member content, got %d: %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/bundle.zip/docs/readme.txt", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected members to be read-only, got %d", w.Code)
+	}
+}
+
+func TestWebDAVHandler_ServesCompositeEntries(t *testing.T) {
+	parts := map[string]string{"/video.001": "first part|", "/video.002": "second part", "/blob": "0123456789abcdef"}
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := parts[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(content))
+	}))
+	defer upstreamServer.Close()
+
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.store = store
+	handler.metadata = metadata.NewManager(store, handler.client, metadata.Options{TTL: time.Hour})
+
+	entries := []types.FileEntry{
+		{Path: "/video.mkv", Kind: types.EntryKindConcat, Parts: []string{upstreamServer.URL + "/video.001", upstreamServer.URL + "/video.002"}},
+		{Path: "/slice.bin", Kind: types.EntryKindSlice, URL: upstreamServer.URL + "/blob", Offset: 4, Length: 8},
+	}
+	for _, entry := range entries {
+		if err := vfs.AddEntry(entry); err != nil {
+			t.Fatalf("Failed to add %s: %v", entry.Path, err)
+		}
+	}
+
+	propfind := httptest.NewRequest("PROPFIND", "/video.mkv", nil)
+	propfind.Header.Set("Depth", "0")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, propfind)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<getcontentlength>22</getcontentlength>") {
+		t.Errorf("Expected combined size of the parts, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/video.mkv", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "first part|second part" {
+		t.Errorf("Expected concatenated content, got %d: %q", w.Code, w.Body.String())
+	}
+
+	rangeRequest := httptest.NewRequest("GET", "/video.mkv", nil)
+	rangeRequest.Header.Set("Range", "bytes=6-16")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, rangeRequest)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "part|second" {
+		t.Errorf("Expected range across the part boundary, got %d: %q", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/slice.bin", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "456789ab" {
+		t.Errorf("Expected slice content, got %d: %q", w.Code, w.Body.String())
+	}
+
+	rangeRequest = httptest.NewRequest("GET", "/slice.bin", nil)
+	rangeRequest.Header.Set("Range", "bytes=2-4")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, rangeRequest)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "678" {
+		t.Errorf("Expected range inside the slice, got %d: %q", w.Code, w.Body.String())
+	}
+}
+
+func TestWebDAVHandler_ServesBackendEntries(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "notes.txt"), []byte("local file content"), 0o644)
+
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+
+	backends := backend.NewRegistry()
+	backends.Register("file", backend.NewLocal([]string{root}))
+	backends.Register("inline", backend.NewInline(store))
+	vfs.SetContentRelease(backends.Release)
+
+	api := NewAPIHandler(vfs, nil, nil, nil, nil, backends, nil, nil)
+	readme := "# Welcome\n"
+	body, _ := json.Marshal(AddFilesRequest{Files: []AddFileEntry{
+		{FileEntry: types.FileEntry{Path: "/README.md"}, Content: &readme},
+		{FileEntry: types.FileEntry{Path: "/notes.txt", URL: "file://" + filepath.Join(root, "notes.txt")}},
+		{FileEntry: types.FileEntry{Path: "/passwd", URL: "file:///etc/passwd"}},
+	}})
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest("POST", "/api/files", bytes.NewReader(body)))
+	if w.Code != http.StatusPartialContent || vfs.Exists("/passwd") {
+		t.Fatalf("Expected files outside the roots to be rejected, got %d: %s", w.Code, w.Body.String())
+	}
+
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.store = store
+	handler.backends = backends
+	handler.useRedirect.Store(true)
+
+	propfind := httptest.NewRequest("PROPFIND", "/", nil)
+	propfind.Header.Set("Depth", "1")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, propfind)
+	if !strings.Contains(w.Body.String(), "<getcontentlength>18</getcontentlength>") || !strings.Contains(w.Body.String(), "<getcontentlength>10</getcontentlength>") {
+		t.Errorf("Expected sizes from the backends, got %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/README.md", nil))
+	if w.Code != http.StatusOK || w.Body.String() != readme {
+		t.Errorf("Expected inline content, got %d: %q", w.Code, w.Body.String())
+	}
+
+	rangeRequest := httptest.NewRequest("GET", "/notes.txt", nil)
+	rangeRequest.Header.Set("Range", "bytes=6-9")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, rangeRequest)
+	if w.Code != http.StatusPartialContent || w.Body.String() != "file" {
+		t.Errorf("Expected ranged local content, got %d: %q", w.Code, w.Body.String())
+	}
+
+	item, _ := vfs.GetItem("/README.md")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/README.md", nil))
+	if content, _ := store.GetInlineContent(item.URL); w.Code != http.StatusNoContent || content != nil {
+		t.Errorf("Expected inline content to be removed with its entry, got %d", w.Code)
+	}
+}
+
+func TestWebDAVHandler_Put(t *testing.T) {
+	vfs := createTestVFS(t)
+	blobs, err := backend.NewBlob(t.TempDir(), false, 16, 0)
+	if err != nil {
+		t.Fatalf("Failed to create blob store: %v", err)
+	}
+	backends := backend.NewRegistry()
+	backends.Register("blob", blobs)
+	vfs.SetContentRelease(backends.Release)
+
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.backends = backends
+
+	put := func(target, contentType, body string, header ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest("PUT", target, strings.NewReader(body))
+		if contentType != "" {
+			request.Header.Set("Content-Type", contentType)
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			request.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, request)
+		return w
+	}
+
+	w := put("/movies/a.mkv", "text/uri-list", "# comment\r\nhttps://example.com/a.mkv\r\n")
+	if item, ok := vfs.GetItem("/movies/a.mkv"); w.Code != http.StatusCreated || !ok || item.URL != "https://example.com/a.mkv" {
+		t.Errorf("Expected a link from the URI list, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = put("/movies/a.mkv", "", "ignored", linkHeader, "https://example.com/b.mkv")
+	if item, _ := vfs.GetItem("/movies/a.mkv"); w.Code != http.StatusNoContent || item.URL != "https://example.com/b.mkv" {
+		t.Errorf("Expected the header to replace the link, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = put("/movies/a.mkv", "text/uri-list", "https://example.com/c.mkv", "If-None-Match", "*"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("Expected If-None-Match to protect the entry, got %d", w.Code)
+	}
+
+	w = put("/movies/Trailer.URL", "", "[InternetShortcut]\r\nURL=https://example.com/trailer.mp4\r\n")
+	if item, ok := vfs.GetItem("/movies/Trailer"); w.Code != http.StatusCreated || !ok || item.URL != "https://example.com/trailer.mp4" || w.Header().Get("Location") != "/movies/Trailer" {
+		t.Errorf("Expected the shortcut to become a link, got %d: %s", w.Code, w.Body.String())
+	}
+	if w = put("/movies/empty.url", "", "[InternetShortcut]\r\n"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a shortcut without URL to be rejected, got %d", w.Code)
+	}
+	if w = put("/movies", "text/uri-list", "https://example.com/"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected PUT on a directory to be refused, got %d", w.Code)
+	}
+
+	if w = put("/notes.txt", "text/plain", "hello"); w.Code != http.StatusForbidden || vfs.Exists("/notes.txt") {
+		t.Errorf("Expected uploads to be refused while disabled, got %d", w.Code)
+	}
+
+	blobs.Configure(true, 16, 0)
+	if w = put("/notes.txt", "text/plain", "hello"); w.Code != http.StatusCreated {
+		t.Fatalf("Expected the upload to be stored, got %d: %s", w.Code, w.Body.String())
+	}
+	item, _ := vfs.GetItem("/notes.txt")
+	if !strings.HasPrefix(item.URL, backend.BlobPrefix) || item.Entry.Checksums["sha256"] == "" {
+		t.Errorf("Expected a blob entry with its checksum, got %+v", item.Entry)
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/notes.txt", nil))
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("Expected uploaded content, got %d: %q", w.Code, w.Body.String())
+	}
+
+	if w = put("/large.bin", "", strings.Repeat("x", 17)); w.Code != http.StatusRequestEntityTooLarge || vfs.Exists("/large.bin") {
+		t.Errorf("Expected the file size limit to apply, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("DELETE", "/notes.txt", nil))
+	if _, err := blobs.Stat(context.Background(), item.URL); w.Code != http.StatusNoContent || !errors.Is(err, backend.ErrNotFound) {
+		t.Errorf("Expected the blob to be removed with its entry, got %d, %v", w.Code, err)
+	}
+}
+
+func TestWebDAVHandler_AbsorbsJunkFiles(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader("content"))
+	}))
+	defer upstreamServer.Close()
+
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+	vfs.AddFile("/movies/a.mkv", upstreamServer.URL+"/a.mkv")
+	vfs.AddFile("/movies/Thumbs.db", upstreamServer.URL+"/Thumbs.db")
+
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.store = store
+	handler.metadata = metadata.NewManager(store, handler.client, metadata.Options{TTL: time.Hour})
+	handler.SetJunkPatterns([]string{"._*", ".DS_Store", "thumbs.db"})
+
+	request := func(method, target, body, remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+		if method == "MOVE" {
+			r.Header.Set("Destination", "/movies/._b.mkv")
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	finder := "192.0.2.1:50000"
+	other := "192.0.2.2:50000"
+
+	if w := request("GET", "/movies/._a.mkv", "", finder); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a missing metadata file to be absent, got %d", w.Code)
+	}
+	if w := request("PUT", "/movies/._a.mkv", "resource fork", finder); w.Code != http.StatusCreated {
+		t.Errorf("Expected the metadata file to be accepted, got %d", w.Code)
+	}
+	if vfs.Exists("/movies/._a.mkv") {
+		t.Error("Expected the metadata file to stay out of the filesystem")
+	}
+	if w := request("GET", "/movies/._a.mkv", "", finder); w.Code != http.StatusOK || w.Body.String() != "resource fork" {
+		t.Errorf("Expected the session to read its metadata file back, got %d: %q", w.Code, w.Body.String())
+	}
+	if w := request("PROPFIND", "/movies/._a.mkv", "", finder); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected the session to find its metadata file, got %d", w.Code)
+	}
+	if w := request("GET", "/movies/._a.mkv", "", other); w.Code != http.StatusNotFound {
+		t.Errorf("Expected other clients not to see the metadata file, got %d", w.Code)
+	}
+
+	w := request("PROPFIND", "/movies/", "", finder)
+	if !strings.Contains(w.Body.String(), "a.mkv") || strings.Contains(w.Body.String(), "._a.mkv") || strings.Contains(w.Body.String(), "Thumbs.db") {
+		t.Errorf("Expected metadata files to be left out of listings, got %s", w.Body.String())
+	}
+
+	if w := request("MOVE", "/movies/._a.mkv", "", finder); w.Code != http.StatusCreated {
+		t.Errorf("Expected the metadata file to be moved, got %d", w.Code)
+	}
+	if w := request("GET", "/movies/._b.mkv", "", finder); w.Code != http.StatusOK {
+		t.Errorf("Expected the moved metadata file, got %d", w.Code)
+	}
+	if w := request("DELETE", "/movies/.DS_Store", "", finder); w.Code != http.StatusNoContent {
+		t.Errorf("Expected deleting a metadata file to succeed, got %d", w.Code)
+	}
+
+	handler.SetJunkPatterns(nil)
+	if w := request("GET", "/movies/._b.mkv", "", finder); w.Code != http.StatusNotFound {
+		t.Errorf("Expected scratch files to be dropped when the layer is off, got %d", w.Code)
+	}
+	if w := request("PROPFIND", "/movies/", "", finder); !strings.Contains(w.Body.String(), "Thumbs.db") {
+		t.Error("Expected entries to be listed again when the layer is off")
+	}
+}
+
+func TestWebDAVHandler_EnforcesACLs(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader("content"))
+	}))
+	defer upstreamServer.Close()
+
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+	vfs.AddFile("/other/a.txt", upstreamServer.URL+"/a.txt")
+	vfs.AddFile("/shared/b.txt", upstreamServer.URL+"/b.txt")
+	vfs.AddFile("/shared/private/c.txt", upstreamServer.URL+"/c.txt")
+
+	acls, err := acl.New(store)
+	if err != nil {
+		t.Fatalf("Failed to load ACLs: %v", err)
+	}
+	acls.Set("/shared", []types.ACLRule{{Principal: "*", Permission: "read"}, {Principal: "@staff", Permission: "write"}})
+	acls.Set("/shared/private", []types.ACLRule{{Principal: "*", Permission: "hidden"}, {Principal: "@staff", Permission: "read"}})
+
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.store = store
+	handler.metadata = metadata.NewManager(store, handler.client, metadata.Options{TTL: time.Hour})
+	handler.acls = acls
+
+	guest := &types.User{Username: "guest", Role: types.RoleEditor}
+	staff := &types.User{Username: "staff", Role: types.RoleEditor, Groups: []string{"staff"}}
+	request := func(user *types.User, method, target, destination string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		if destination != "" {
+			r.Header.Set("Destination", destination)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r.WithContext(auth.WithUser(r.Context(), user)))
+		return w
+	}
+
+	w := request(guest, "PROPFIND", "/shared/", "")
+	if !strings.Contains(w.Body.String(), "b.txt") || strings.Contains(w.Body.String(), "private") {
+		t.Errorf("Expected hidden children to be left out of listings, got %s", w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "current-user-privilege-set") || strings.Contains(w.Body.String(), "bind") {
+		t.Errorf("Expected read-only privileges to be reported, got %s", w.Body.String())
+	}
+	if w := request(staff, "PROPFIND", "/shared/", ""); !strings.Contains(w.Body.String(), "private") || !strings.Contains(w.Body.String(), "bind") {
+		t.Errorf("Expected staff to see the private directory and write privileges, got %s", w.Body.String())
+	}
+
+	if w := request(guest, "GET", "/shared/private/c.txt", ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a hidden file to look missing, got %d", w.Code)
+	}
+	if w := request(staff, "GET", "/shared/private/c.txt", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected staff to read the private file, got %d", w.Code)
+	}
+	if w := request(guest, "DELETE", "/shared/b.txt", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected deleting a read-only file to be forbidden, got %d", w.Code)
+	}
+	if w := request(staff, "DELETE", "/shared", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected deleting a tree with read-only parts to be forbidden, got %d", w.Code)
+	}
+	if w := request(guest, "MOVE", "/other/a.txt", "/shared/private/a.txt"); w.Code != http.StatusNotFound {
+		t.Errorf("Expected moving into a hidden directory to fail like a missing one, got %d", w.Code)
+	}
+	if w := request(guest, "COPY", "/shared/b.txt", "/other/b.txt"); w.Code != http.StatusCreated {
+		t.Errorf("Expected copying a readable file to a writable place, got %d", w.Code)
+	}
+	if w := request(staff, "MOVE", "/shared/b.txt", "/shared/d.txt"); w.Code != http.StatusCreated {
+		t.Errorf("Expected staff to move files in /shared, got %d", w.Code)
+	}
+	if !vfs.Exists("/shared/private/c.txt") || !vfs.Exists("/shared/d.txt") {
+		t.Error("Expected forbidden requests to leave the filesystem unchanged")
+	}
+}
+
+func TestWebDAVHandler_ReadOnly(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	defer upstreamServer.Close()
+
+	vfs := createTestVFS(t)
+	vfs.AddFile("/docs/a.txt", upstreamServer.URL+"/a.txt")
+	handler := createTestWebDAVHandler(t, vfs)
+	handler.SetReadOnly(true)
+
+	serve := func(method, target string, header ...string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader("https://example.com/b.txt"))
+		for i := 0; i+1 < len(header); i += 2 {
+			request.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, request)
+		return w
+	}
+
+	for _, method := range []string{"PUT", "DELETE", "MOVE", "COPY", "MKCOL", "PROPPATCH"} {
+		if w := serve(method, "/docs/a.txt", "Content-Type", "text/uri-list", "Destination", "/docs/b.txt"); w.Code != http.StatusForbidden {
+			t.Errorf("Expected %s to be refused, got %d", method, w.Code)
+		}
+	}
+	if item, ok := vfs.GetItem("/docs/a.txt"); !ok || item.URL != upstreamServer.URL+"/a.txt" || vfs.Exists("/docs/b.txt") {
+		t.Error("Expected the namespace to be unchanged")
+	}
+	// OS metadata files are refused too rather than absorbed
+	if w := serve("PUT", "/docs/._a.txt"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected metadata files to be refused, got %d", w.Code)
+	}
+
+	if w := serve("GET", "/docs/a.txt"); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("Expected downloads to keep working, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve("PROPFIND", "/docs/", "Depth", "0"); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected listings to keep working, got %d", w.Code)
+	}
+	if w := serve("OPTIONS", "/"); w.Header().Get("Allow") != "OPTIONS, PROPFIND, GET, HEAD" {
+		t.Errorf("Expected only reading methods to be allowed, got %q", w.Header().Get("Allow"))
+	}
+
+	handler.SetReadOnly(false)
+	if w := serve("DELETE", "/docs/a.txt"); w.Code != http.StatusNoContent || vfs.Exists("/docs/a.txt") {
+		t.Errorf("Expected deletes to work again, got %d", w.Code)
+	}
+}
@@ -0,0 +1,181 @@
+package integrity
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"sort"
+	"strings"
+	"time"
+
+	"proxydav/pkg/types"
+)
+
+// Supported checksum algorithms, as used for the keys of FileEntry.Checksums
+const (
+	SHA256 = "sha256"
+	MD5    = "md5"
+	CRC32C = "crc32c"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+type algorithm struct {
+	size       int    // digest size in bytes
+	digestName string // RFC 3230 Digest token
+	reprName   string // RFC 9530 Repr-Digest token
+	newHash    func() hash.Hash
+}
+
+var algorithms = map[string]algorithm{
+	SHA256: {size: sha256.Size, digestName: "SHA-256", reprName: "sha-256", newHash: sha256.New},
+	MD5:    {size: md5.Size, digestName: "MD5", reprName: "md5", newHash: md5.New},
+	CRC32C: {size: crc32.Size, digestName: "CRC32C", reprName: "crc32c", newHash: func() hash.Hash { return crc32.New(castagnoli) }},
+}
+
+// aliases maps accepted spellings to canonical algorithm names
+var aliases = map[string]string{
+	"sha256":  SHA256,
+	"sha-256": SHA256,
+	"md5":     MD5,
+	"crc32c":  CRC32C,
+}
+
+// Normalize validates a checksum map and returns it with canonical
+// algorithm names and lowercase hex values. Values may be given as hex or
+// base64. A nil or empty map is returned as nil.
+func Normalize(checksums map[string]string) (map[string]string, error) {
+	if len(checksums) == 0 {
+		return nil, nil
+	}
+
+	normalized := make(map[string]string, len(checksums))
+	for name, value := range checksums {
+		canonical, ok := aliases[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unsupported checksum algorithm %q (use sha256, md5 or crc32c)", name)
+		}
+
+		raw, err := decode(strings.TrimSpace(value), algorithms[canonical].size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s checksum: %w", canonical, err)
+		}
+		normalized[canonical] = hex.EncodeToString(raw)
+	}
+	return normalized, nil
+}
+
+func decode(value string, size int) ([]byte, error) {
+	if len(value) == size*2 {
+		if raw, err := hex.DecodeString(value); err == nil {
+			return raw, nil
+		}
+	}
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == size {
+		return raw, nil
+	}
+	return nil, fmt.Errorf("expected %d bytes as hex or base64", size)
+}
+
+// sortedNames returns the algorithms present in checksums in a stable order
+func sortedNames(checksums map[string]string) []string {
+	names := make([]string, 0, len(checksums))
+	for name := range checksums {
+		if _, ok := algorithms[name]; ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func base64Value(hexValue string) (string, bool) {
+	raw, err := hex.DecodeString(hexValue)
+	if err != nil {
+		return "", false
+	}
+	return base64.StdEncoding.EncodeToString(raw), true
+}
+
+// DigestHeader formats checksums as an RFC 3230 Digest header value
+func DigestHeader(checksums map[string]string) string {
+	var parts []string
+	for _, name := range sortedNames(checksums) {
+		if value, ok := base64Value(checksums[name]); ok {
+			parts = append(parts, algorithms[name].digestName+"="+value)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// ReprDigestHeader formats checksums as an RFC 9530 Repr-Digest header value
+func ReprDigestHeader(checksums map[string]string) string {
+	var parts []string
+	for _, name := range sortedNames(checksums) {
+		if value, ok := base64Value(checksums[name]); ok {
+			parts = append(parts, algorithms[name].reprName+"=:"+value+":")
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PropValues formats checksums as "ALGO:hex" strings for PROPFIND
+func PropValues(checksums map[string]string) []string {
+	var values []string
+	for _, name := range sortedNames(checksums) {
+		values = append(values, strings.ToUpper(name)+":"+checksums[name])
+	}
+	return values
+}
+
+// Verifier hashes a stream with every algorithm an entry has a checksum for
+type Verifier struct {
+	expected map[string]string
+	hashes   map[string]hash.Hash
+}
+
+// NewVerifier returns a verifier for the expected checksums, or nil if there are none
+func NewVerifier(expected map[string]string) *Verifier {
+	names := sortedNames(expected)
+	if len(names) == 0 {
+		return nil
+	}
+
+	v := &Verifier{expected: expected, hashes: make(map[string]hash.Hash, len(names))}
+	for _, name := range names {
+		v.hashes[name] = algorithms[name].newHash()
+	}
+	return v
+}
+
+func (v *Verifier) Write(p []byte) (int, error) {
+	for _, h := range v.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+// Result compares the hashed stream with the expected checksums
+func (v *Verifier) Result() *types.Integrity {
+	result := &types.Integrity{
+		Status:    types.IntegrityVerified,
+		CheckedAt: time.Now(),
+		Actual:    make(map[string]string, len(v.hashes)),
+	}
+
+	for name, h := range v.hashes {
+		actual := hex.EncodeToString(h.Sum(nil))
+		result.Actual[name] = actual
+		if actual != v.expected[name] {
+			result.Status = types.IntegrityMismatch
+		}
+	}
+	if result.Status == types.IntegrityMismatch {
+		result.Expected = v.expected
+	}
+	return result
+}
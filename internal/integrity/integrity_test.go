@@ -0,0 +1,82 @@
+package integrity
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"proxydav/pkg/types"
+)
+
+// Checksums of "hello world"
+const (
+	helloSHA256 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	helloMD5    = "5eb63bbbe01eeed093cb22bb8f5acdc3"
+	helloCRC32C = "c99465aa"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", input: nil, want: nil},
+		{name: "hex", input: map[string]string{"SHA-256": strings.ToUpper(helloSHA256)}, want: map[string]string{SHA256: helloSHA256}},
+		{name: "base64", input: map[string]string{"md5": "XrY7u+Ae7tCTyyK7j1rNww=="}, want: map[string]string{MD5: helloMD5}},
+		{name: "crc32c", input: map[string]string{"crc32c": helloCRC32C}, want: map[string]string{CRC32C: helloCRC32C}},
+		{name: "unknown algorithm", input: map[string]string{"sha1": "abc"}, wantErr: true},
+		{name: "wrong length", input: map[string]string{"md5": "abcd"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Normalize(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Normalize(%v) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Normalize(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+			for name, value := range tt.want {
+				if got[name] != value {
+					t.Errorf("Normalize(%v)[%s] = %q, want %q", tt.input, name, got[name], value)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	checksums := map[string]string{SHA256: helloSHA256, MD5: helloMD5}
+
+	if got, want := DigestHeader(checksums), "MD5=XrY7u+Ae7tCTyyK7j1rNww==,SHA-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek="; got != want {
+		t.Errorf("DigestHeader = %q, want %q", got, want)
+	}
+	if got, want := ReprDigestHeader(checksums), "md5=:XrY7u+Ae7tCTyyK7j1rNww==:, sha-256=:uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=:"; got != want {
+		t.Errorf("ReprDigestHeader = %q, want %q", got, want)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	if NewVerifier(nil) != nil {
+		t.Error("Expected no verifier without checksums")
+	}
+
+	v := NewVerifier(map[string]string{SHA256: helloSHA256, CRC32C: helloCRC32C})
+	io.Copy(v, strings.NewReader("hello world"))
+	if result := v.Result(); result.Status != types.IntegrityVerified {
+		t.Errorf("Expected verified content, got %+v", result)
+	}
+
+	v = NewVerifier(map[string]string{MD5: helloMD5})
+	io.Copy(v, strings.NewReader("hello there"))
+	result := v.Result()
+	if result.Status != types.IntegrityMismatch {
+		t.Errorf("Expected mismatch, got %+v", result)
+	}
+	if result.Expected[MD5] != helloMD5 || result.Actual[MD5] == helloMD5 {
+		t.Errorf("Expected mismatch details, got %+v", result)
+	}
+}
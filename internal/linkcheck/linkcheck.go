@@ -0,0 +1,463 @@
+package linkcheck
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/internal/contentcheck"
+	"proxydav/internal/filesystem"
+	"proxydav/internal/metadata"
+	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
+)
+
+// Actions applied to entries whose link is broken
+const (
+	ActionNone       = "none"
+	ActionHide       = "hide"
+	ActionQuarantine = "quarantine"
+)
+
+// QuarantineDir is where broken entries are moved by the quarantine action
+const QuarantineDir = "/.quarantine"
+
+// Options controls scheduling and handling of broken links
+type Options struct {
+	// Interval between scheduled checks; 0 disables scheduled runs
+	Interval time.Duration
+	// Concurrency bounds the number of links probed at once
+	Concurrency int
+	// FailureThreshold is the number of consecutive failures before a link is broken
+	FailureThreshold int
+	// Action is applied to broken entries: none, hide or quarantine
+	Action string
+	// ValidateContent treats responses that look like error pages as failures
+	ValidateContent bool
+	// ReadOnly keeps entries where they are: broken entries are quarantined
+	// and recovered ones restored by the first check after it is turned off
+	ReadOnly bool
+}
+
+// ValidAction reports whether action is a supported broken-link action
+func ValidAction(action string) bool {
+	switch action {
+	case ActionNone, ActionHide, ActionQuarantine:
+		return true
+	}
+	return false
+}
+
+// Checker periodically probes every upstream URL and records its health
+type Checker struct {
+	store    *storage.PersistentStore
+	vfs      *filesystem.VirtualFS
+	metadata *metadata.Manager
+
+	mutex   sync.RWMutex
+	options Options
+	running bool
+	lastRun time.Time
+
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func New(store *storage.PersistentStore, vfs *filesystem.VirtualFS, metadataManager *metadata.Manager, options Options) *Checker {
+	return &Checker{
+		store:    store,
+		vfs:      vfs,
+		metadata: metadataManager,
+		options:  normalize(options),
+		stopChan: make(chan struct{}),
+	}
+}
+
+func normalize(options Options) Options {
+	if options.Concurrency <= 0 {
+		options.Concurrency = 4
+	}
+	if options.FailureThreshold <= 0 {
+		options.FailureThreshold = 1
+	}
+	if !ValidAction(options.Action) {
+		options.Action = ActionNone
+	}
+	return options
+}
+
+// Start launches the check scheduler
+func (c *Checker) Start() {
+	c.wg.Add(1)
+	go c.scheduler()
+}
+
+// Stop waits for a running check to finish and stops the scheduler
+func (c *Checker) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopChan)
+		c.wg.Wait()
+	})
+}
+
+// Configure applies new options at runtime
+func (c *Checker) Configure(options Options) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.options = normalize(options)
+}
+
+func (c *Checker) getOptions() Options {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.options
+}
+
+// Running reports whether a check is in progress and when the last one finished
+func (c *Checker) Running() (bool, time.Time) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.running, c.lastRun
+}
+
+// RunNow starts a check in the background. It returns false if one is already running.
+func (c *Checker) RunNow() bool {
+	if !c.begin() {
+		return false
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.run()
+	}()
+	return true
+}
+
+func (c *Checker) begin() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.running {
+		return false
+	}
+	c.running = true
+	return true
+}
+
+func (c *Checker) scheduler() {
+	defer c.wg.Done()
+	for {
+		interval := c.getOptions().Interval
+		if interval <= 0 {
+			// Scheduling disabled; check again later in case it is enabled at runtime
+			interval = time.Minute
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-c.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if c.getOptions().Interval > 0 && c.begin() {
+				c.run()
+			}
+		}
+	}
+}
+
+// run checks every file entry once. Entries sharing a URL are probed together.
+func (c *Checker) run() {
+	defer func() {
+		c.mutex.Lock()
+		c.running = false
+		c.lastRun = time.Now()
+		c.mutex.Unlock()
+	}()
+
+	options := c.getOptions()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-c.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	byURL := make(map[string][]types.FileEntry)
+	for _, entry := range c.vfs.GetAllFiles() {
+		for _, fileURL := range entry.RemoteURLs() {
+			byURL[fileURL] = append(byURL[fileURL], entry)
+		}
+	}
+
+	var wg sync.WaitGroup
+	var broken, recovered int
+	var countMutex sync.Mutex
+	slots := make(chan struct{}, options.Concurrency)
+
+	for fileURL, entries := range byURL {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		}
+
+		wg.Add(1)
+		go func(fileURL string, entries []types.FileEntry) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			before, after := c.check(ctx, fileURL, entries, options)
+			countMutex.Lock()
+			if after == types.LinkStatusBroken && before != types.LinkStatusBroken {
+				broken++
+			}
+			if after == types.LinkStatusOK && before == types.LinkStatusBroken {
+				recovered++
+			}
+			countMutex.Unlock()
+		}(fileURL, entries)
+	}
+	wg.Wait()
+	c.restore()
+
+	log.Printf("🔗 Link check finished: %d links, %d newly broken, %d recovered", len(byURL), broken, recovered)
+}
+
+// check probes one URL, records the outcome and applies the configured
+// action to the entries pointing at it. It returns the previous and new status.
+func (c *Checker) check(ctx context.Context, fileURL string, entries []types.FileEntry, options Options) (string, string) {
+	health, err := c.store.GetLinkHealth(fileURL)
+	if err != nil || health == nil {
+		health = &types.LinkHealth{URL: fileURL, Status: types.LinkStatusUnknown}
+	}
+	previous := health.Status
+
+	virtualPath := c.originalPath(entries[0])
+	previousMetadata, _ := c.store.GetFileMetadata(fileURL)
+	fetched, err := c.metadata.Check(upstream.WithVirtualPath(ctx, virtualPath), fileURL)
+	if err == nil && options.ValidateContent {
+		if err = contentcheck.CheckMetadata(virtualPath, fetched, previousMetadata); err != nil && previousMetadata != nil {
+			// Keep serving the last good size and type rather than the error page's
+			_ = c.store.SetFileMetadata(previousMetadata)
+		}
+	}
+	if ctx.Err() != nil {
+		// Interrupted by shutdown; don't count it against the link
+		return previous, previous
+	}
+
+	now := time.Now()
+	health.LastChecked = now
+	if err == nil {
+		health.Status = types.LinkStatusOK
+		health.StatusCode = http.StatusOK
+		health.Error = ""
+		health.ConsecutiveFailures = 0
+		health.LastSuccess = now
+	} else {
+		health.StatusCode = metadata.StatusCode(err)
+		health.Error = err.Error()
+		health.ConsecutiveFailures++
+		health.LastFailure = now
+		if health.ConsecutiveFailures >= options.FailureThreshold {
+			health.Status = types.LinkStatusBroken
+		}
+	}
+
+	if health.Status == types.LinkStatusBroken && options.Action == ActionQuarantine {
+		c.quarantine(entries)
+	}
+
+	if err := c.store.SetLinkHealth(health); err != nil {
+		log.Printf("⚠️  Failed to save link health for %s: %v", fileURL, err)
+	}
+	if health.Status != previous && health.Status == types.LinkStatusBroken {
+		log.Printf("🔗 Link broken: %s (%s)", fileURL, health.Error)
+	}
+
+	return previous, health.Status
+}
+
+// Flag marks fileURL as broken immediately, regardless of the failure
+// threshold, because upstream was seen serving something other than the file
+func (c *Checker) Flag(fileURL, reason string) {
+	if c == nil || fileURL == "" {
+		return
+	}
+
+	health, err := c.store.GetLinkHealth(fileURL)
+	if err != nil || health == nil {
+		health = &types.LinkHealth{URL: fileURL}
+	}
+
+	now := time.Now()
+	if health.Status != types.LinkStatusBroken {
+		log.Printf("🔗 Link flagged as broken: %s (%s)", fileURL, reason)
+	}
+	health.Status = types.LinkStatusBroken
+	health.StatusCode = 0
+	health.Error = reason
+	health.ConsecutiveFailures++
+	health.LastChecked = now
+	health.LastFailure = now
+
+	if err := c.store.SetLinkHealth(health); err != nil {
+		log.Printf("⚠️  Failed to save link health for %s: %v", fileURL, err)
+	}
+}
+
+// quarantine moves broken entries under QuarantineDir, recording where
+// each came from
+func (c *Checker) quarantine(entries []types.FileEntry) {
+	if c.getOptions().ReadOnly {
+		return
+	}
+	for _, entry := range entries {
+		if IsQuarantined(entry.Path) {
+			continue
+		}
+		destPath := QuarantineDir + entry.Path
+		if err := c.move(entry, destPath); err != nil {
+			log.Printf("⚠️  Failed to quarantine %s: %v", entry.Path, err)
+			continue
+		}
+		c.record(destPath, entry.Path)
+		log.Printf("🔗 Quarantined %s -> %s", entry.Path, destPath)
+	}
+}
+
+// record remembers that the entry at quarantinePath came from originalPath
+func (c *Checker) record(quarantinePath, originalPath string) {
+	quarantine := &types.Quarantine{Path: quarantinePath, From: originalPath, Quarantined: time.Now()}
+	if err := c.store.SetQuarantine(quarantine); err != nil {
+		log.Printf("⚠️  Failed to record quarantine of %s: %v", originalPath, err)
+	}
+}
+
+// restore moves quarantined entries back once every link they read from is
+// healthy again, if their original location is still free
+func (c *Checker) restore() {
+	if c.getOptions().ReadOnly {
+		return
+	}
+	quarantines, err := c.store.GetAllQuarantines()
+	if err != nil {
+		log.Printf("⚠️  Failed to read quarantined entries: %v", err)
+		return
+	}
+	for _, quarantine := range quarantines {
+		item, exists := c.vfs.GetItem(quarantine.Path)
+		if !exists || item.Entry == nil {
+			// Deleted or moved out of quarantine by hand
+			c.forget(quarantine.Path)
+			continue
+		}
+		entry := *item.Entry
+		entry.Path = quarantine.Path
+		if !c.healthy(entry) {
+			continue
+		}
+		if c.vfs.Exists(quarantine.From) {
+			log.Printf("⚠️  Cannot restore %s: path is taken", quarantine.From)
+			continue
+		}
+		if err := c.move(entry, quarantine.From); err != nil {
+			log.Printf("⚠️  Failed to restore %s: %v", quarantine.From, err)
+			continue
+		}
+		c.forget(quarantine.Path)
+		log.Printf("🔗 Restored %s", quarantine.From)
+	}
+}
+
+// healthy reports whether every link of entry was last found working
+func (c *Checker) healthy(entry types.FileEntry) bool {
+	for _, fileURL := range entry.RemoteURLs() {
+		health, err := c.store.GetLinkHealth(fileURL)
+		if err != nil || health == nil || health.Status != types.LinkStatusOK {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Checker) forget(quarantinePath string) {
+	if err := c.store.DeleteQuarantine(quarantinePath); err != nil {
+		log.Printf("⚠️  Failed to forget quarantine of %s: %v", quarantinePath, err)
+	}
+}
+
+// move relocates an entry; a mounted archive moves together with its members
+func (c *Checker) move(entry types.FileEntry, destPath string) error {
+	if entry.Kind == types.EntryKindZip {
+		return c.vfs.MoveDirectory(entry.Path, destPath)
+	}
+	return c.vfs.MoveFile(entry.Path, destPath)
+}
+
+// originalPath returns where an entry was before it was quarantined
+func (c *Checker) originalPath(entry types.FileEntry) string {
+	if quarantine, _ := c.store.GetQuarantine(entry.Path); quarantine != nil {
+		return quarantine.From
+	}
+	return entry.Path
+}
+
+// IsQuarantined reports whether filePath lies inside the quarantine directory
+func IsQuarantined(filePath string) bool {
+	filePath = path.Clean("/" + strings.TrimPrefix(filePath, "/"))
+	return filePath == QuarantineDir || strings.HasPrefix(filePath, QuarantineDir+"/")
+}
+
+// Hidden reports whether an entry for fileURL should be left out of listings
+func (c *Checker) Hidden(fileURL string) bool {
+	if c == nil || fileURL == "" || c.getOptions().Action != ActionHide {
+		return false
+	}
+	health, err := c.store.GetLinkHealth(fileURL)
+	return err == nil && health != nil && health.Status == types.LinkStatusBroken
+}
+
+// Report pairs a file entry with its recorded link health
+type Report struct {
+	Path   string            `json:"path"`
+	URL    string            `json:"url"`
+	Health *types.LinkHealth `json:"health"`
+}
+
+// Reports returns the health of every upstream URL of every file entry, optionally filtered by status
+func (c *Checker) Reports(status string) ([]Report, error) {
+	if status != "" && status != types.LinkStatusOK && status != types.LinkStatusBroken && status != types.LinkStatusUnknown {
+		return nil, fmt.Errorf("invalid status filter: %s", status)
+	}
+
+	var reports []Report
+	for _, entry := range c.vfs.GetAllFiles() {
+		for _, fileURL := range entry.RemoteURLs() {
+			health, err := c.store.GetLinkHealth(fileURL)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read link health: %w", err)
+			}
+			if health == nil {
+				health = &types.LinkHealth{URL: fileURL, Status: types.LinkStatusUnknown}
+			}
+			if status != "" && health.Status != status {
+				continue
+			}
+			reports = append(reports, Report{Path: entry.Path, URL: fileURL, Health: health})
+		}
+	}
+	return reports, nil
+}
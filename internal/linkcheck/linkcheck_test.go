@@ -0,0 +1,258 @@
+package linkcheck
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxydav/internal/filesystem"
+	"proxydav/internal/metadata"
+	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
+)
+
+func newTestChecker(t *testing.T, options Options) (*Checker, *filesystem.VirtualFS, *storage.PersistentStore) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	vfs, err := filesystem.New(store)
+	if err != nil {
+		t.Fatalf("Failed to create VFS: %v", err)
+	}
+
+	policy, err := upstream.NewPolicy(nil, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	client := upstream.NewClient(policy, &upstream.Router{}, 5*time.Second)
+	manager := metadata.NewManager(store, client, metadata.Options{TTL: time.Hour})
+
+	return New(store, vfs, manager, options), vfs, store
+}
+
+// flakyServer serves /ok.bin and answers /broken.bin with 404 while healthy is false
+func flakyServer(t *testing.T, healthy *atomic.Bool) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken.bin" && !healthy.Load() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", "10")
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func runOnce(t *testing.T, checker *Checker) {
+	t.Helper()
+	if !checker.begin() {
+		t.Fatal("Expected no check to be running")
+	}
+	checker.run()
+}
+
+func TestChecker_FailureThreshold(t *testing.T) {
+	var healthy atomic.Bool
+	upstreamServer := flakyServer(t, &healthy)
+
+	checker, vfs, store := newTestChecker(t, Options{FailureThreshold: 2})
+	vfs.AddFile("/ok.bin", upstreamServer.URL+"/ok.bin")
+	vfs.AddFile("/broken.bin", upstreamServer.URL+"/broken.bin")
+
+	runOnce(t, checker)
+	health, _ := store.GetLinkHealth(upstreamServer.URL + "/broken.bin")
+	if health == nil || health.Status != types.LinkStatusUnknown || health.ConsecutiveFailures != 1 {
+		t.Fatalf("Expected one failure below threshold, got %+v", health)
+	}
+	if health.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status code 404, got %d", health.StatusCode)
+	}
+
+	runOnce(t, checker)
+	health, _ = store.GetLinkHealth(upstreamServer.URL + "/broken.bin")
+	if health.Status != types.LinkStatusBroken {
+		t.Errorf("Expected broken after two failures, got %s", health.Status)
+	}
+
+	ok, _ := store.GetLinkHealth(upstreamServer.URL + "/ok.bin")
+	if ok == nil || ok.Status != types.LinkStatusOK {
+		t.Errorf("Expected healthy link, got %+v", ok)
+	}
+
+	reports, err := checker.Reports(types.LinkStatusBroken)
+	if err != nil {
+		t.Fatalf("Reports failed: %v", err)
+	}
+	if len(reports) != 1 || reports[0].Path != "/broken.bin" {
+		t.Errorf("Expected only /broken.bin to be reported, got %+v", reports)
+	}
+}
+
+func TestChecker_Hide(t *testing.T) {
+	var healthy atomic.Bool
+	upstreamServer := flakyServer(t, &healthy)
+
+	checker, vfs, _ := newTestChecker(t, Options{Action: ActionHide})
+	vfs.AddFile("/broken.bin", upstreamServer.URL+"/broken.bin")
+
+	runOnce(t, checker)
+	if !checker.Hidden(upstreamServer.URL + "/broken.bin") {
+		t.Error("Expected broken link to be hidden")
+	}
+
+	checker.Configure(Options{Action: ActionNone})
+	if checker.Hidden(upstreamServer.URL + "/broken.bin") {
+		t.Error("Expected broken link to be visible when action is none")
+	}
+}
+
+func TestChecker_QuarantineAndRestore(t *testing.T) {
+	var healthy atomic.Bool
+	upstreamServer := flakyServer(t, &healthy)
+
+	checker, vfs, _ := newTestChecker(t, Options{Action: ActionQuarantine})
+	vfs.AddFile("/docs/broken.bin", upstreamServer.URL+"/broken.bin")
+
+	runOnce(t, checker)
+	if vfs.Exists("/docs/broken.bin") {
+		t.Error("Expected broken entry to be moved out of place")
+	}
+	if !vfs.Exists(QuarantineDir + "/docs/broken.bin") {
+		t.Fatal("Expected broken entry in quarantine")
+	}
+
+	healthy.Store(true)
+	runOnce(t, checker)
+	if !vfs.Exists("/docs/broken.bin") {
+		t.Error("Expected recovered entry to be restored")
+	}
+	if vfs.Exists(QuarantineDir + "/docs/broken.bin") {
+		t.Error("Expected quarantine copy to be gone after restore")
+	}
+}
+
+func TestChecker_ReadOnlyKeepsEntriesInPlace(t *testing.T) {
+	var healthy atomic.Bool
+	upstreamServer := flakyServer(t, &healthy)
+
+	checker, vfs, store := newTestChecker(t, Options{Action: ActionQuarantine, ReadOnly: true})
+	vfs.AddFile("/docs/broken.bin", upstreamServer.URL+"/broken.bin")
+
+	runOnce(t, checker)
+	if !vfs.Exists("/docs/broken.bin") || vfs.Exists(QuarantineDir+"/docs/broken.bin") {
+		t.Fatal("Expected read-only mode to keep the broken entry in place")
+	}
+	if health, _ := store.GetLinkHealth(upstreamServer.URL + "/broken.bin"); health == nil || health.Status != types.LinkStatusBroken {
+		t.Errorf("Expected the link to be reported broken anyway, got %+v", health)
+	}
+
+	checker.Configure(Options{Action: ActionQuarantine})
+	runOnce(t, checker)
+	if !vfs.Exists(QuarantineDir + "/docs/broken.bin") {
+		t.Fatal("Expected the entry to be quarantined once read-only mode is off")
+	}
+
+	healthy.Store(true)
+	checker.Configure(Options{Action: ActionQuarantine, ReadOnly: true})
+	runOnce(t, checker)
+	if vfs.Exists("/docs/broken.bin") {
+		t.Error("Expected read-only mode to keep the recovered entry in quarantine")
+	}
+
+	checker.Configure(Options{Action: ActionQuarantine})
+	runOnce(t, checker)
+	if !vfs.Exists("/docs/broken.bin") {
+		t.Error("Expected the entry to be restored once read-only mode is off")
+	}
+}
+
+func TestChecker_QuarantineSharedAndCompositeEntries(t *testing.T) {
+	var healthy atomic.Bool
+	upstreamServer := flakyServer(t, &healthy)
+	var secondHealthy atomic.Bool
+	secondServer := flakyServer(t, &secondHealthy)
+
+	checker, vfs, store := newTestChecker(t, Options{Action: ActionQuarantine})
+	brokenURL := upstreamServer.URL + "/broken.bin"
+	vfs.AddFile("/a/copy.bin", brokenURL)
+	vfs.AddFile("/b/copy.bin", brokenURL)
+	vfs.AddEntry(types.FileEntry{Path: "/joined.bin", Kind: types.EntryKindConcat, Parts: []string{brokenURL, secondServer.URL + "/broken.bin"}})
+
+	runOnce(t, checker)
+	for _, name := range []string{"/a/copy.bin", "/b/copy.bin", "/joined.bin"} {
+		if !vfs.Exists(QuarantineDir + name) {
+			t.Fatalf("Expected %s in quarantine", name)
+		}
+	}
+
+	// Entries sharing a URL are all restored; the joined entry waits for its other part
+	healthy.Store(true)
+	runOnce(t, checker)
+	for _, name := range []string{"/a/copy.bin", "/b/copy.bin"} {
+		if !vfs.Exists(name) || vfs.Exists(QuarantineDir+name) {
+			t.Errorf("Expected %s to be restored", name)
+		}
+	}
+	if vfs.Exists("/joined.bin") {
+		t.Error("Expected the joined entry to stay in quarantine while a part is broken")
+	}
+
+	secondHealthy.Store(true)
+	runOnce(t, checker)
+	if !vfs.Exists("/joined.bin") {
+		t.Error("Expected the joined entry to be restored once all parts recovered")
+	}
+	if quarantines, _ := store.GetAllQuarantines(); len(quarantines) != 0 {
+		t.Errorf("Expected no quarantine records left, got %+v", quarantines)
+	}
+}
+
+func TestIsQuarantined(t *testing.T) {
+	tests := map[string]bool{
+		"/.quarantine":       true,
+		"/.quarantine/a.bin": true,
+		"/.quarantined/a":    false,
+		"/docs/a.bin":        false,
+	}
+	for filePath, want := range tests {
+		if got := IsQuarantined(filePath); got != want {
+			t.Errorf("IsQuarantined(%q) = %v, want %v", filePath, got, want)
+		}
+	}
+}
+
+func TestChecker_FlagsErrorPages(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Content-Length", "10")
+	}))
+	t.Cleanup(upstreamServer.Close)
+
+	checker, vfs, store := newTestChecker(t, Options{FailureThreshold: 1, ValidateContent: true})
+	vfs.AddFile("/archive.zip", upstreamServer.URL+"/archive.zip")
+
+	runOnce(t, checker)
+	health, _ := store.GetLinkHealth(upstreamServer.URL + "/archive.zip")
+	if health == nil || health.Status != types.LinkStatusBroken {
+		t.Errorf("Expected HTML served for a zip to be broken, got %+v", health)
+	}
+}
+
+func TestChecker_Flag(t *testing.T) {
+	checker, _, store := newTestChecker(t, Options{FailureThreshold: 5})
+	checker.Flag("https://example.com/a.zip", "served HTML")
+
+	health, _ := store.GetLinkHealth("https://example.com/a.zip")
+	if health == nil || health.Status != types.LinkStatusBroken || health.Error != "served HTML" {
+		t.Errorf("Expected flagged link to be broken immediately, got %+v", health)
+	}
+
+	var nilChecker *Checker
+	nilChecker.Flag("https://example.com/a.zip", "ignored")
+}
@@ -0,0 +1,501 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
+)
+
+// Options controls caching and background revalidation of file metadata
+type Options struct {
+	// TTL is how long fetched metadata is considered fresh; 0 disables expiry
+	TTL time.Duration
+	// RefreshInterval is how often stale entries are revalidated; 0 disables scheduled runs
+	RefreshInterval time.Duration
+	// HostConcurrency limits simultaneous revalidation requests per upstream
+	// host. Lookups for listings are bounded by ListingConcurrency instead.
+	HostConcurrency int
+	// Workers is the number of background revalidation workers
+	Workers int
+	// ListingConcurrency bounds parallel lookups made by GetMany
+	ListingConcurrency int
+	// NegativeTTL is how long failed lookups are remembered before retrying
+	NegativeTTL time.Duration
+}
+
+// Lookup identifies a file whose metadata is requested by GetMany
+type Lookup struct {
+	URL         string
+	VirtualPath string
+}
+
+// call is an in-flight fetch shared by concurrent callers
+type call struct {
+	done      chan struct{}
+	metadata  *types.FileMetadata
+	err       error
+	abandoned bool // the caller that issued the request went away
+}
+
+// statusError is returned when upstream answers with an unusable status;
+// unlike connection errors it says nothing about the health of the host
+type statusError struct {
+	code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("upstream returned status %d", e.code)
+}
+
+type refreshJob struct {
+	url         string
+	virtualPath string
+	force       bool
+}
+
+// Manager serves file metadata from the persistent store and keeps it fresh.
+// Stale records are returned immediately while a background worker
+// revalidates them with a conditional HEAD request.
+type Manager struct {
+	store  *storage.PersistentStore
+	client *http.Client
+
+	mutex      sync.RWMutex
+	options    Options
+	hostSlots  map[string]chan struct{}
+	pending    map[string]bool
+	inflight   map[string]*call
+	failedURL  map[string]time.Time
+	failedHost map[string]time.Time
+
+	queue    chan refreshJob
+	stopChan chan struct{}
+	wg       sync.WaitGroup
+	stopOnce sync.Once
+}
+
+func NewManager(store *storage.PersistentStore, client *http.Client, options Options) *Manager {
+	if options.Workers <= 0 {
+		options.Workers = 4
+	}
+	if options.HostConcurrency <= 0 {
+		options.HostConcurrency = 2
+	}
+	if options.ListingConcurrency <= 0 {
+		options.ListingConcurrency = 16
+	}
+
+	return &Manager{
+		store:      store,
+		client:     client,
+		options:    options,
+		hostSlots:  make(map[string]chan struct{}),
+		pending:    make(map[string]bool),
+		inflight:   make(map[string]*call),
+		failedURL:  make(map[string]time.Time),
+		failedHost: make(map[string]time.Time),
+		queue:      make(chan refreshJob, 1024),
+		stopChan:   make(chan struct{}),
+	}
+}
+
+// Start launches the background workers and the refresh scheduler
+func (m *Manager) Start() {
+	for i := 0; i < m.options.Workers; i++ {
+		m.wg.Add(1)
+		go m.worker()
+	}
+
+	m.wg.Add(1)
+	go m.scheduler()
+}
+
+// Stop waits for in-flight revalidations and stops all background work
+func (m *Manager) Stop() {
+	m.stopOnce.Do(func() {
+		close(m.stopChan)
+		m.wg.Wait()
+	})
+}
+
+// Configure applies new options at runtime. The worker count is fixed at start.
+func (m *Manager) Configure(ttl, refreshInterval time.Duration, hostConcurrency, listingConcurrency int, negativeTTL time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.options.TTL = ttl
+	m.options.RefreshInterval = refreshInterval
+	m.options.NegativeTTL = negativeTTL
+	if listingConcurrency > 0 {
+		m.options.ListingConcurrency = listingConcurrency
+	}
+	if hostConcurrency > 0 && hostConcurrency != m.options.HostConcurrency {
+		m.options.HostConcurrency = hostConcurrency
+		// New slots apply to requests started after the change
+		m.hostSlots = make(map[string]chan struct{})
+	}
+}
+
+func (m *Manager) ttl() time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.options.TTL
+}
+
+func (m *Manager) refreshInterval() time.Duration {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.options.RefreshInterval
+}
+
+// IsStale reports whether metadata has outlived the configured TTL
+func (m *Manager) IsStale(metadata *types.FileMetadata) bool {
+	ttl := m.ttl()
+	if ttl <= 0 {
+		return false
+	}
+	return time.Since(metadata.FetchedAt) > ttl
+}
+
+// Get returns metadata for url. Cached metadata is returned even when stale,
+// in which case a background revalidation is scheduled. Missing metadata is
+// fetched synchronously.
+func (m *Manager) Get(ctx context.Context, fileURL string) *types.FileMetadata {
+	if metadata, err := m.store.GetFileMetadata(fileURL); err == nil && metadata != nil {
+		if m.IsStale(metadata) {
+			m.enqueue(refreshJob{url: fileURL, virtualPath: upstream.VirtualPath(ctx)})
+		}
+		return metadata
+	}
+
+	if m.recentlyFailed(fileURL) {
+		return nil
+	}
+
+	metadata, err := m.fetchShared(ctx, fileURL, nil)
+	if err != nil {
+		log.Printf("Error fetching metadata for %s: %v", fileURL, err)
+		return nil
+	}
+	return metadata
+}
+
+// Check revalidates fileURL immediately, bypassing the TTL and negative
+// cache, and returns the upstream error when the file is unreachable
+func (m *Manager) Check(ctx context.Context, fileURL string) (*types.FileMetadata, error) {
+	cached, _ := m.store.GetFileMetadata(fileURL)
+	return m.fetchShared(ctx, fileURL, cached)
+}
+
+// StatusCode returns the upstream HTTP status carried by a Check error, or 0
+func StatusCode(err error) int {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code
+	}
+	return 0
+}
+
+// GetMany resolves metadata for many files concurrently, bounded by the
+// listing concurrency. Files without metadata are absent from the result.
+func (m *Manager) GetMany(ctx context.Context, lookups []Lookup) map[string]*types.FileMetadata {
+	m.mutex.RLock()
+	concurrency := m.options.ListingConcurrency
+	m.mutex.RUnlock()
+
+	results := make(map[string]*types.FileMetadata, len(lookups))
+	var resultsMutex sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, concurrency)
+
+	for _, lookup := range lookups {
+		if lookup.URL == "" {
+			continue
+		}
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return results
+		}
+
+		wg.Add(1)
+		go func(lookup Lookup) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			metadata := m.Get(upstream.WithVirtualPath(ctx, lookup.VirtualPath), lookup.URL)
+			if metadata == nil {
+				return
+			}
+			resultsMutex.Lock()
+			results[lookup.URL] = metadata
+			resultsMutex.Unlock()
+		}(lookup)
+	}
+
+	wg.Wait()
+	return results
+}
+
+// fetchShared performs fetch, letting concurrent callers for the same URL
+// wait for a single upstream request instead of issuing their own
+func (m *Manager) fetchShared(ctx context.Context, fileURL string, cached *types.FileMetadata) (*types.FileMetadata, error) {
+	m.mutex.Lock()
+	for {
+		c, ok := m.inflight[fileURL]
+		if !ok {
+			break
+		}
+		m.mutex.Unlock()
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if !c.abandoned {
+			return c.metadata, c.err
+		}
+		// The request was cut short for its own caller; ask again
+		m.mutex.Lock()
+	}
+	c := &call{done: make(chan struct{})}
+	m.inflight[fileURL] = c
+	m.mutex.Unlock()
+
+	c.metadata, c.err = m.fetch(ctx, fileURL, cached)
+	switch {
+	case c.err != nil && ctx.Err() != nil && (errors.Is(c.err, context.Canceled) || errors.Is(c.err, context.DeadlineExceeded)):
+		// A client that went away says nothing about the file
+		c.abandoned = true
+	case c.err != nil:
+		m.recordFailure(fileURL, c.err)
+	default:
+		m.clearFailure(fileURL)
+	}
+
+	m.mutex.Lock()
+	delete(m.inflight, fileURL)
+	m.mutex.Unlock()
+	close(c.done)
+
+	return c.metadata, c.err
+}
+
+// recentlyFailed reports whether the URL or its host failed within the negative TTL
+func (m *Manager) recentlyFailed(fileURL string) bool {
+	now := time.Now()
+	host := hostOf(fileURL)
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if until, ok := m.failedURL[fileURL]; ok && now.Before(until) {
+		return true
+	}
+	if until, ok := m.failedHost[host]; ok && now.Before(until) {
+		return true
+	}
+	return false
+}
+
+// recordFailure negatively caches a failed URL. Connection failures also
+// mark the whole host so that one dead host cannot stall every listing.
+func (m *Manager) recordFailure(fileURL string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.options.NegativeTTL <= 0 {
+		return
+	}
+	until := time.Now().Add(m.options.NegativeTTL)
+	m.failedURL[fileURL] = until
+
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) && !upstream.IsPolicyError(err) && !errors.Is(err, context.Canceled) {
+		m.failedHost[hostOf(fileURL)] = until
+	}
+
+	// Drop expired records so the maps do not grow without bound
+	now := time.Now()
+	for key, expiry := range m.failedURL {
+		if now.After(expiry) {
+			delete(m.failedURL, key)
+		}
+	}
+	for key, expiry := range m.failedHost {
+		if now.After(expiry) {
+			delete(m.failedHost, key)
+		}
+	}
+}
+
+func (m *Manager) clearFailure(fileURL string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.failedURL, fileURL)
+	delete(m.failedHost, hostOf(fileURL))
+}
+
+func hostOf(fileURL string) string {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Host)
+}
+
+// Refresh schedules a forced revalidation of the given entries regardless of TTL
+func (m *Manager) Refresh(entries []types.FileEntry) int {
+	queued := 0
+	for _, entry := range entries {
+		for _, fileURL := range entry.RemoteURLs() {
+			if m.enqueue(refreshJob{url: fileURL, virtualPath: entry.Path, force: true}) {
+				queued++
+			}
+		}
+	}
+	return queued
+}
+
+// enqueue adds a job unless the same URL is already waiting
+func (m *Manager) enqueue(job refreshJob) bool {
+	m.mutex.Lock()
+	if m.pending[job.url] {
+		m.mutex.Unlock()
+		return false
+	}
+	m.pending[job.url] = true
+	m.mutex.Unlock()
+
+	select {
+	case m.queue <- job:
+		return true
+	default:
+		m.mutex.Lock()
+		delete(m.pending, job.url)
+		m.mutex.Unlock()
+		log.Printf("⚠️  Metadata refresh queue full, skipping %s", job.url)
+		return false
+	}
+}
+
+func (m *Manager) worker() {
+	defer m.wg.Done()
+	for {
+		select {
+		case <-m.stopChan:
+			return
+		case job := <-m.queue:
+			m.revalidate(job)
+			m.mutex.Lock()
+			delete(m.pending, job.url)
+			m.mutex.Unlock()
+		}
+	}
+}
+
+// scheduler periodically queues every stale entry for revalidation
+func (m *Manager) scheduler() {
+	defer m.wg.Done()
+	for {
+		interval := m.refreshInterval()
+		if interval <= 0 {
+			// Scheduling disabled; check again later in case it is enabled at runtime
+			interval = time.Minute
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-m.stopChan:
+			timer.Stop()
+			return
+		case <-timer.C:
+			if m.refreshInterval() > 0 {
+				m.refreshStale()
+			}
+		}
+	}
+}
+
+func (m *Manager) refreshStale() {
+	entries, err := m.store.GetAllFileEntries()
+	if err != nil {
+		log.Printf("⚠️  Metadata refresh failed to list entries: %v", err)
+		return
+	}
+
+	queued := 0
+	for _, entry := range entries {
+		for _, fileURL := range entry.RemoteURLs() {
+			metadata, err := m.store.GetFileMetadata(fileURL)
+			if err != nil || (metadata != nil && !m.IsStale(metadata)) {
+				continue
+			}
+			if m.enqueue(refreshJob{url: fileURL, virtualPath: entry.Path}) {
+				queued++
+			}
+		}
+	}
+	if queued > 0 {
+		log.Printf("🔄 Scheduled metadata refresh for %d entries", queued)
+	}
+}
+
+func (m *Manager) revalidate(job refreshJob) {
+	cached, _ := m.store.GetFileMetadata(job.url)
+	if cached != nil && !job.force && !m.IsStale(cached) {
+		return
+	}
+
+	release, err := m.acquireHost(job.url)
+	if err != nil {
+		return
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(upstream.WithVirtualPath(context.Background(), job.virtualPath))
+	defer cancel()
+	go func() {
+		select {
+		case <-m.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	if _, err := m.fetchShared(ctx, job.url, cached); err != nil {
+		log.Printf("Error revalidating metadata for %s: %v", job.url, err)
+	}
+}
+
+// acquireHost blocks until a request slot for the URL's host is available
+func (m *Manager) acquireHost(fileURL string) (func(), error) {
+	host := hostOf(fileURL)
+
+	m.mutex.Lock()
+	slots, ok := m.hostSlots[host]
+	if !ok {
+		slots = make(chan struct{}, m.options.HostConcurrency)
+		m.hostSlots[host] = slots
+	}
+	m.mutex.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-m.stopChan:
+		return nil, fmt.Errorf("metadata manager stopped")
+	}
+}
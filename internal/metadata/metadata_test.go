@@ -0,0 +1,306 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
+)
+
+func newTestManager(t *testing.T, options Options) (*Manager, *storage.PersistentStore) {
+	store, err := storage.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	policy, err := upstream.NewPolicy(nil, nil, true)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	client := upstream.NewClient(policy, &upstream.Router{}, 5*time.Second)
+
+	manager := NewManager(store, client, options)
+	manager.Start()
+	t.Cleanup(manager.Stop)
+	return manager, store
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("Timed out waiting for condition")
+}
+
+func TestManager_GetCachesMetadata(t *testing.T) {
+	var requests int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Length", "1234")
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+	}))
+	defer upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour})
+
+	first := manager.Get(context.Background(), upstreamServer.URL+"/file.bin")
+	if first == nil {
+		t.Fatal("Expected metadata, got nil")
+	}
+	if first.Size != 1234 || first.ETag != `"v1"` {
+		t.Errorf("Unexpected metadata: %+v", first)
+	}
+
+	second := manager.Get(context.Background(), upstreamServer.URL+"/file.bin")
+	if second == nil || second.Size != 1234 {
+		t.Fatalf("Expected cached metadata, got %+v", second)
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", got)
+	}
+}
+
+func TestManager_StaleWhileRevalidate(t *testing.T) {
+	var conditional int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&conditional, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Length", "10")
+		w.Header().Set("ETag", `"v1"`)
+	}))
+	defer upstreamServer.Close()
+
+	manager, store := newTestManager(t, Options{TTL: time.Minute})
+	fileURL := upstreamServer.URL + "/file.bin"
+
+	stale := &types.FileMetadata{
+		URL:       fileURL,
+		Size:      10,
+		ETag:      `"v1"`,
+		FetchedAt: time.Now().Add(-time.Hour),
+	}
+	if err := store.SetFileMetadata(stale); err != nil {
+		t.Fatalf("Failed to store metadata: %v", err)
+	}
+
+	got := manager.Get(context.Background(), fileURL)
+	if got == nil || !got.FetchedAt.Equal(stale.FetchedAt) {
+		t.Fatalf("Expected stale metadata to be served immediately, got %+v", got)
+	}
+
+	waitFor(t, func() bool {
+		renewed, _ := store.GetFileMetadata(fileURL)
+		return renewed != nil && time.Since(renewed.FetchedAt) < time.Minute
+	})
+	if atomic.LoadInt32(&conditional) != 1 {
+		t.Errorf("Expected one conditional HEAD request, got %d", conditional)
+	}
+}
+
+func TestManager_RefreshUpdatesChangedFiles(t *testing.T) {
+	var size atomic.Value
+	size.Store("100")
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", size.Load().(string))
+	}))
+	defer upstreamServer.Close()
+
+	manager, store := newTestManager(t, Options{TTL: time.Hour})
+	fileURL := upstreamServer.URL + "/file.bin"
+
+	if got := manager.Get(context.Background(), fileURL); got == nil || got.Size != 100 {
+		t.Fatalf("Expected initial size 100, got %+v", got)
+	}
+
+	size.Store("200")
+	queued := manager.Refresh([]types.FileEntry{{Path: "/file.bin", URL: fileURL}})
+	if queued != 1 {
+		t.Errorf("Expected 1 queued refresh, got %d", queued)
+	}
+
+	waitFor(t, func() bool {
+		updated, _ := store.GetFileMetadata(fileURL)
+		return updated != nil && updated.Size == 200
+	})
+}
+
+func TestManager_DeduplicatesConcurrentFetches(t *testing.T) {
+	var requests int32
+	release := make(chan struct{})
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		<-release
+		w.Header().Set("Content-Length", "42")
+	}))
+	defer upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour})
+	fileURL := upstreamServer.URL + "/shared.bin"
+
+	results := make(chan *types.FileMetadata, 10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			results <- manager.Get(context.Background(), fileURL)
+		}()
+	}
+
+	waitFor(t, func() bool { return atomic.LoadInt32(&requests) == 1 })
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for i := 0; i < 10; i++ {
+		if metadata := <-results; metadata == nil || metadata.Size != 42 {
+			t.Errorf("Expected shared metadata, got %+v", metadata)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", got)
+	}
+}
+
+func TestManager_GetManyRunsConcurrently(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Length", "1")
+	}))
+	defer upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour, ListingConcurrency: 20})
+
+	var lookups []Lookup
+	for i := 0; i < 40; i++ {
+		lookups = append(lookups, Lookup{URL: upstreamServer.URL + "/file" + strconv.Itoa(i)})
+	}
+
+	start := time.Now()
+	results := manager.GetMany(context.Background(), lookups)
+	elapsed := time.Since(start)
+
+	if len(results) != len(lookups) {
+		t.Errorf("Expected %d results, got %d", len(lookups), len(results))
+	}
+	// 40 lookups of 100ms with 20 workers should take about 200ms, not 4s
+	if elapsed > 2*time.Second {
+		t.Errorf("Expected concurrent lookups, took %v", elapsed)
+	}
+}
+
+func TestManager_GetManyIsNotLimitedPerHost(t *testing.T) {
+	var active, peak int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&active, 1)
+		defer atomic.AddInt32(&active, -1)
+		for {
+			seen := atomic.LoadInt32(&peak)
+			if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		w.Header().Set("Content-Length", "1")
+	}))
+	defer upstreamServer.Close()
+
+	// The host limit is for background refreshes; a listing of one host's
+	// files runs as many lookups at once as the listing concurrency allows
+	manager, _ := newTestManager(t, Options{TTL: time.Hour, ListingConcurrency: 8, HostConcurrency: 2})
+
+	var lookups []Lookup
+	for i := 0; i < 16; i++ {
+		lookups = append(lookups, Lookup{URL: upstreamServer.URL + "/file" + strconv.Itoa(i)})
+	}
+	if results := manager.GetMany(context.Background(), lookups); len(results) != len(lookups) {
+		t.Errorf("Expected %d results, got %d", len(lookups), len(results))
+	}
+	if got := atomic.LoadInt32(&peak); got <= 2 || got > 8 {
+		t.Errorf("Expected up to 8 concurrent lookups on one host, got %d", got)
+	}
+}
+
+func TestManager_NegativeCache(t *testing.T) {
+	var requests int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour, NegativeTTL: time.Minute})
+	fileURL := upstreamServer.URL + "/broken.bin"
+
+	for i := 0; i < 3; i++ {
+		if metadata := manager.Get(context.Background(), fileURL); metadata != nil {
+			t.Errorf("Expected nil metadata for failing URL, got %+v", metadata)
+		}
+	}
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Expected failing URL to be requested once, got %d", got)
+	}
+
+	// A status error doesn't mark the whole host as dead
+	if manager.recentlyFailed(upstreamServer.URL + "/other.bin") {
+		t.Error("Expected other URLs on the host to remain available")
+	}
+}
+
+func TestManager_CanceledLookupIsNotCached(t *testing.T) {
+	var requests int32
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Length", "42")
+	}))
+	defer upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour, NegativeTTL: time.Minute})
+	fileURL := upstreamServer.URL + "/file.bin"
+
+	// A client that goes away mid-listing takes its lookup with it, but
+	// another client waiting for the same URL asks again
+	ctx, cancel := context.WithCancel(context.Background())
+	go manager.Get(ctx, fileURL)
+	waitFor(t, func() bool { return atomic.LoadInt32(&requests) == 1 })
+	result := make(chan *types.FileMetadata)
+	go func() { result <- manager.Get(context.Background(), fileURL) }()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if metadata := <-result; metadata == nil || metadata.Size != 42 {
+		t.Errorf("Expected the waiting lookup to be retried, got %+v", metadata)
+	}
+	if manager.recentlyFailed(fileURL) {
+		t.Error("Expected a canceled lookup not to be negatively cached")
+	}
+}
+
+func TestManager_NegativeCacheMarksDeadHost(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := upstreamServer.URL
+	upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour, NegativeTTL: time.Minute})
+
+	if metadata := manager.Get(context.Background(), deadURL+"/a.bin"); metadata != nil {
+		t.Fatalf("Expected nil metadata for dead host, got %+v", metadata)
+	}
+	if !manager.recentlyFailed(deadURL + "/b.bin") {
+		t.Error("Expected other URLs on a dead host to be negatively cached")
+	}
+}
@@ -0,0 +1,152 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"proxydav/pkg/types"
+)
+
+// fetch requests metadata from upstream and persists it. When cached is
+// given the request is conditional, and a 304 response only renews the
+// cached record.
+//
+// A HEAD request is tried first. Many object stores and signed-URL hosts
+// reject HEAD or omit Content-Length, so in that case a one-byte range GET
+// is made and the size is taken from Content-Range instead. Redirect chains
+// are followed by the client for both requests.
+func (m *Manager) fetch(ctx context.Context, fileURL string, cached *types.FileMetadata) (*types.FileMetadata, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	resp, err := m.probe(ctx, http.MethodHead, fileURL, cached)
+	if err != nil {
+		return nil, fmt.Errorf("HEAD request failed: %w", err)
+	}
+	resp.Body.Close()
+
+	if headUnusable(resp) {
+		rangeResp, err := m.probe(ctx, http.MethodGet, fileURL, cached)
+		if err != nil {
+			return nil, fmt.Errorf("range GET request failed: %w", err)
+		}
+		// Only the headers are needed; a server ignoring the range would
+		// otherwise send the whole file, so the body is never read
+		rangeResp.Body.Close()
+		resp = rangeResp
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		renewed := *cached
+		renewed.FetchedAt = time.Now()
+		if err := m.store.SetFileMetadata(&renewed); err != nil {
+			log.Printf("Failed to store metadata for %s: %v", fileURL, err)
+		}
+		return &renewed, nil
+	}
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, &statusError{code: resp.StatusCode}
+	}
+
+	metadata := parseMetadata(fileURL, resp, cached)
+	if err := m.store.SetFileMetadata(metadata); err != nil {
+		log.Printf("Failed to store metadata for %s: %v", fileURL, err)
+	}
+
+	return metadata, nil
+}
+
+// probe issues a single metadata request, conditional when cached is known
+func (m *Manager) probe(ctx context.Context, method, fileURL string, cached *types.FileMetadata) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		} else if !cached.LastModified.IsZero() {
+			req.Header.Set("If-Modified-Since", cached.LastModified.UTC().Format(http.TimeFormat))
+		}
+	}
+	return m.client.Do(req)
+}
+
+// headUnusable reports whether a HEAD response should be retried as a range GET
+func headUnusable(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusOK:
+		return resp.Header.Get("Content-Length") == ""
+	}
+	return false
+}
+
+// parseMetadata builds metadata from a HEAD or range GET response
+func parseMetadata(fileURL string, resp *http.Response, cached *types.FileMetadata) *types.FileMetadata {
+	metadata := &types.FileMetadata{
+		URL:         fileURL,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: resp.Header.Get("Content-Type"),
+		Filename:    dispositionFilename(resp.Header.Get("Content-Disposition")),
+		FetchedAt:   time.Now(),
+	}
+
+	if resp.StatusCode == http.StatusPartialContent {
+		if total, ok := contentRangeTotal(resp.Header.Get("Content-Range")); ok {
+			metadata.Size = total
+		}
+	} else if contentLength := resp.Header.Get("Content-Length"); contentLength != "" {
+		if size, err := strconv.ParseInt(contentLength, 10, 64); err == nil {
+			metadata.Size = size
+		}
+	}
+
+	// Accept RFC 1123, RFC 850 and ANSI C dates. Without a usable date the
+	// previously recorded one is kept so the generated ETag stays stable.
+	if t, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		metadata.LastModified = t
+	} else if cached != nil && !cached.LastModified.IsZero() {
+		metadata.LastModified = cached.LastModified
+	} else {
+		metadata.LastModified = time.Now().UTC().Truncate(time.Second)
+	}
+
+	return metadata
+}
+
+// contentRangeTotal extracts the complete length from "bytes 0-0/12345"
+func contentRangeTotal(contentRange string) (int64, bool) {
+	slash := strings.LastIndex(contentRange, "/")
+	if !strings.HasPrefix(contentRange, "bytes ") || slash < 0 {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(strings.TrimSpace(contentRange[slash+1:]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return total, true
+}
+
+// dispositionFilename returns the filename from a Content-Disposition header
+func dispositionFilename(disposition string) string {
+	if disposition == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		return ""
+	}
+	return params["filename"]
+}
@@ -0,0 +1,115 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestManager_FallsBackToRangeGet(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Range") != "bytes=0-0" {
+			t.Errorf("Expected one-byte range request, got %q", r.Header.Get("Range"))
+		}
+		w.Header().Set("Content-Range", "bytes 0-0/987654")
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Disposition", `attachment; filename="archive.zip"`)
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("P"))
+	}))
+	defer upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour})
+	metadata := manager.Get(context.Background(), upstreamServer.URL+"/signed")
+	if metadata == nil {
+		t.Fatal("Expected metadata from range GET fallback, got nil")
+	}
+	if metadata.Size != 987654 {
+		t.Errorf("Expected size 987654, got %d", metadata.Size)
+	}
+	if metadata.ContentType != "application/zip" {
+		t.Errorf("Expected content type application/zip, got %q", metadata.ContentType)
+	}
+	if metadata.ETag != `"abc"` {
+		t.Errorf("Expected upstream ETag, got %q", metadata.ETag)
+	}
+	if metadata.Filename != "archive.zip" {
+		t.Errorf("Expected filename archive.zip, got %q", metadata.Filename)
+	}
+}
+
+func TestManager_RangeGetWhenContentLengthMissing(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			// Chunked responses carry no Content-Length
+			w.Header().Set("Transfer-Encoding", "chunked")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Range", "bytes 0-0/2048")
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write([]byte("x"))
+	}))
+	defer upstreamServer.Close()
+
+	manager, _ := newTestManager(t, Options{TTL: time.Hour})
+	metadata := manager.Get(context.Background(), upstreamServer.URL+"/chunked")
+	if metadata == nil || metadata.Size != 2048 {
+		t.Fatalf("Expected size 2048 from Content-Range, got %+v", metadata)
+	}
+}
+
+func TestManager_ParsesAllDateFormats(t *testing.T) {
+	expected := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	formats := map[string]string{
+		"rfc1123": "Sun, 06 Nov 1994 08:49:37 GMT",
+		"rfc850":  "Sunday, 06-Nov-94 08:49:37 GMT",
+		"ansic":   "Sun Nov  6 08:49:37 1994",
+	}
+
+	for name, value := range formats {
+		t.Run(name, func(t *testing.T) {
+			upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", "1")
+				w.Header().Set("Last-Modified", value)
+			}))
+			defer upstreamServer.Close()
+
+			manager, _ := newTestManager(t, Options{TTL: time.Hour})
+			metadata := manager.Get(context.Background(), upstreamServer.URL+"/file")
+			if metadata == nil {
+				t.Fatal("Expected metadata, got nil")
+			}
+			if !metadata.LastModified.Equal(expected) {
+				t.Errorf("Expected %v, got %v", expected, metadata.LastModified)
+			}
+		})
+	}
+}
+
+func TestContentRangeTotal(t *testing.T) {
+	tests := []struct {
+		header string
+		want   int64
+		ok     bool
+	}{
+		{header: "bytes 0-0/12345", want: 12345, ok: true},
+		{header: "bytes 0-0/*", ok: false},
+		{header: "", ok: false},
+		{header: "items 0-0/10", ok: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := contentRangeTotal(tt.header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("contentRangeTotal(%q) = %d, %v; want %d, %v", tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
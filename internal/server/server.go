@@ -2,35 +2,72 @@ package server
 
 import (
 	"context"
-	"crypto/subtle"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"proxydav/internal/acl"
+	"proxydav/internal/archive"
+	"proxydav/internal/auth"
+	"proxydav/internal/backend"
+	"proxydav/internal/certs"
 	"proxydav/internal/config"
 	"proxydav/internal/filesystem"
+	"proxydav/internal/forwarded"
 	"proxydav/internal/handlers"
+	"proxydav/internal/linkcheck"
+	"proxydav/internal/metadata"
 	"proxydav/internal/storage"
+	"proxydav/internal/upstream"
+	"proxydav/pkg/types"
 )
 
 // ErrRestart is returned when the server should restart
 var ErrRestart = errors.New("server restart requested")
 
 type Server struct {
-	config        *config.Config
-	vfs           *filesystem.VirtualFS
-	store         *storage.PersistentStore
-	httpServer    *http.Server
-	webdavHandler *handlers.WebDAVHandler
-	apiHandler    *handlers.APIHandler
-	adminHandler  *handlers.AdminHandler
-	restartChan   chan bool // Channel to signal restart
-	shutdownChan  chan bool // Channel to signal shutdown
+	config         *config.Config
+	vfs            *filesystem.VirtualFS
+	store          *storage.PersistentStore
+	users          *auth.Users
+	tokens         *auth.Tokens
+	appPasswords   *auth.AppPasswords
+	shares         *auth.Shares
+	lockouts       *auth.Lockouts
+	audit          *auth.Audit
+	authChain      atomic.Pointer[auth.Chain] // rebuilt when the configuration changes
+	proxies        atomic.Pointer[forwarded.Proxies]
+	mode           atomic.Pointer[serverMode] // read by every request, switched from the admin panel
+	dataDir        string                     // where the store was opened; fixed until a restart
+	acls           *acl.List
+	policy         *upstream.Policy
+	router         *upstream.Router
+	metadata       *metadata.Manager
+	links          *linkcheck.Checker
+	local          *backend.Local
+	blobs          *backend.Blob
+	httpServer     *http.Server
+	adminServer    *http.Server // nil when the admin panel shares the WebDAV port
+	redirectServer *http.Server // nil unless plain HTTP is redirected to HTTPS
+	webdavHandler  *handlers.WebDAVHandler
+	apiHandler     *handlers.APIHandler
+	shareHandler   *handlers.ShareHandler
+	adminHandler   *handlers.AdminHandler
+	restartChan    chan bool // Channel to signal restart
+	shutdownChan   chan bool // Channel to signal shutdown
 }
 
 func New(cfg *config.Config) (*Server, error) {
@@ -42,11 +79,33 @@ func New(cfg *config.Config) (*Server, error) {
 	log.Printf("💾 Initialized persistent storage in: %s", cfg.DataDir)
 
 	// Try to load saved configuration from database
-	if savedConfig, err := config.LoadFromStore(store); err == nil && savedConfig != nil {
+	savedConfig, err := config.LoadFromStore(store)
+	if err == nil && savedConfig != nil {
 		log.Printf("📋 Loaded configuration from database")
 		cfg = savedConfig
 	}
 
+	users := auth.NewUsers(store)
+	if err := migrateCredentials(users, cfg, savedConfig != nil, store); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	tokens := auth.NewTokens(store)
+	appPasswords := auth.NewAppPasswords(store)
+	shares := auth.NewShares(store)
+	lockouts, err := auth.NewLockouts(lockoutOptions(cfg))
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to configure login lockouts: %w", err)
+	}
+
+	acls, err := acl.New(store)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to load access rules: %w", err)
+	}
+
 	vfs, err := filesystem.New(store)
 	if err != nil {
 		store.Close()
@@ -55,19 +114,79 @@ func New(cfg *config.Config) (*Server, error) {
 
 	log.Println("🗂️  Virtual filesystem initialized")
 
-	webdavHandler := handlers.NewWebDAVHandler(vfs, store, cfg.UseRedirect)
-	apiHandler := handlers.NewAPIHandler(vfs)
+	policy, err := upstream.NewPolicy(cfg.UpstreamAllowHosts, cfg.UpstreamDenyHosts, cfg.UpstreamAllowPrivate)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to create upstream policy: %w", err)
+	}
+	router, err := upstream.NewRouter(cfg.UpstreamProxies)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to configure upstream proxies: %w", err)
+	}
+	client := upstream.NewClient(policy, router, 30*time.Second)
+
+	blobs, err := backend.NewBlob(filepath.Join(cfg.DataDir, "blobs"), cfg.BlobStoreEnabled, megabytes(cfg.BlobMaxFileMB), megabytes(cfg.BlobMaxTotalMB))
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to create blob store: %w", err)
+	}
+
+	metadataManager := metadata.NewManager(store, client, metadata.Options{
+		TTL:                cfg.MetadataTTL,
+		RefreshInterval:    cfg.MetadataRefreshInterval,
+		HostConcurrency:    cfg.MetadataHostConcurrency,
+		ListingConcurrency: cfg.MetadataConcurrency,
+		NegativeTTL:        cfg.MetadataNegativeTTL,
+	})
+	metadataManager.Start()
+
+	linkChecker := linkcheck.New(store, vfs, metadataManager, linkCheckOptions(cfg))
+	linkChecker.Start()
+
+	archiveReader := archive.NewReader(client)
+
+	// Entries with other schemes than http(s) are served by these backends
+	localBackend := backend.NewLocal(cfg.LocalRoots)
+	backends := backend.NewRegistry()
+	backends.Register("file", localBackend)
+	backends.Register("inline", backend.NewInline(store))
+	backends.Register("blob", blobs)
+	vfs.SetContentRelease(backends.Release)
 
+	webdavHandler := handlers.NewWebDAVHandler(vfs, store, client, policy, metadataManager, linkChecker, archiveReader, backends, acls, cfg.UseRedirect)
+	webdavHandler.SetVerifyChecksums(cfg.VerifyChecksums)
+	webdavHandler.SetContentValidation(cfg.ValidateResponses, cfg.SniffResponses)
+	webdavHandler.SetJunkPatterns(cfg.JunkPatterns)
+	webdavHandler.SetReadOnly(cfg.ReadOnly)
+	apiHandler := handlers.NewAPIHandler(vfs, policy, metadataManager, linkChecker, archiveReader, backends, acls, appPasswords)
+	apiHandler.SetReadOnly(cfg.ReadOnly)
+
+	audit := auth.NewAudit(store)
 	mux := http.NewServeMux()
 	server := &Server{
 		config:        cfg,
 		vfs:           vfs,
 		store:         store,
+		users:         users,
+		tokens:        tokens,
+		appPasswords:  appPasswords,
+		shares:        shares,
+		lockouts:      lockouts,
+		audit:         audit,
+		acls:          acls,
+		policy:        policy,
+		router:        router,
+		metadata:      metadataManager,
+		links:         linkChecker,
+		local:         localBackend,
+		blobs:         blobs,
+		dataDir:       cfg.DataDir,
 		webdavHandler: webdavHandler,
 		apiHandler:    apiHandler,
+		shareHandler:  handlers.NewShareHandler(shares, lockouts, audit, webdavHandler),
 		httpServer: &http.Server{
 			Addr:         fmt.Sprintf(":%d", cfg.Port),
-			Handler:      mux,
 			ReadTimeout:  30 * time.Second,
 			WriteTimeout: 30 * time.Second,
 			IdleTimeout:  60 * time.Second,
@@ -76,71 +195,501 @@ func New(cfg *config.Config) (*Server, error) {
 		shutdownChan: make(chan bool),
 	}
 
+	chain, err := server.buildAuthChain(cfg)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	server.authChain.Store(chain)
+	proxies, err := forwarded.ParseProxies(cfg.TrustedProxies)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	server.proxies.Store(proxies)
+	server.mode.Store(modeOf(cfg))
+	server.httpServer.Handler = server.forwardedMiddleware(server.maintenanceMiddleware(mux))
+
 	// Create admin handler with server as config updater
-	adminHandler := handlers.NewAdminHandler(vfs, store, cfg, server)
+	adminHandler := handlers.NewAdminHandler(vfs, store, users, tokens, shares, lockouts, server.audit, acls, policy, linkChecker, archiveReader, backends, cfg, server)
 	server.adminHandler = adminHandler
 
-	server.setupRoutes(mux)
+	adminMux := mux
+	if cfg.AdminAddr != "" {
+		adminMux = http.NewServeMux()
+		server.adminServer = &http.Server{
+			Addr:         cfg.AdminAddr,
+			Handler:      server.forwardedMiddleware(server.adminMaintenanceMiddleware(adminMux)),
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 30 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+	}
+	server.setupRoutes(mux, adminMux)
+
+	if cfg.TLSEnabled() {
+		tlsConfig, err := loadTLSConfig(cfg)
+		if err != nil {
+			store.Close()
+			return nil, err
+		}
+		server.httpServer.TLSConfig = tlsConfig
+		if server.adminServer != nil {
+			server.adminServer.TLSConfig = tlsConfig
+		}
+		if cfg.HTTPRedirectAddr != "" {
+			server.redirectServer = &http.Server{
+				Addr:         cfg.HTTPRedirectAddr,
+				Handler:      httpsRedirect(cfg.Port),
+				ReadTimeout:  30 * time.Second,
+				WriteTimeout: 30 * time.Second,
+				IdleTimeout:  60 * time.Second,
+			}
+		}
+	}
 
 	log.Println("🛠️  HTTP handlers and routes configured")
 
 	return server, nil
 }
 
-func (s *Server) setupRoutes(mux *http.ServeMux) {
+// migrateCredentials turns the single username and password of earlier
+// versions into the first admin account. The password is then dropped from
+// the configuration, and from the database if it was stored there.
+func migrateCredentials(users *auth.Users, cfg *config.Config, stored bool, store *storage.PersistentStore) error {
+	if cfg.AuthUser == "" && cfg.AuthPass == "" {
+		return nil
+	}
+	created, err := users.Migrate(cfg.AuthUser, cfg.AuthPass)
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Printf("👥 Created admin account %q from the configured credentials", cfg.AuthUser)
+	} else if cfg.AuthPass != "" {
+		log.Printf("ℹ️  Ignoring the configured credentials: user accounts already exist")
+	}
+
+	hadPassword := cfg.AuthPass != ""
+	cfg.AuthUser, cfg.AuthPass = "", ""
+	if stored && hadPassword {
+		if err := cfg.SaveToStore(store); err != nil {
+			return fmt.Errorf("failed to remove the stored password: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadTLSConfig loads the certificate the listeners serve HTTPS with, and
+// the CAs client certificates are verified against
+func loadTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	certFile, keyFile := cfg.TLSCert, cfg.TLSKey
+	if cfg.TLSSelfSigned {
+		var err error
+		certFile, keyFile, err = certs.SelfSigned(filepath.Join(cfg.DataDir, "tls"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create self-signed certificate: %w", err)
+		}
+	}
+	reloader, err := certs.NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	if cfg.TLSClientCA != "" {
+		pool, err := certs.LoadPool(cfg.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		// Clients without a certificate can still use the other methods
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// httpsRedirect sends plain HTTP requests to the same URL on the HTTPS
+// port. 308 keeps the method and body of WebDAV requests.
+func httpsRedirect(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+func linkCheckOptions(cfg *config.Config) linkcheck.Options {
+	return linkcheck.Options{
+		Interval:         cfg.LinkCheckInterval,
+		Concurrency:      cfg.LinkCheckConcurrency,
+		FailureThreshold: cfg.LinkCheckFailureThreshold,
+		Action:           cfg.LinkCheckAction,
+		ValidateContent:  cfg.ValidateResponses,
+		ReadOnly:         cfg.ReadOnly,
+	}
+}
+
+func lockoutOptions(cfg *config.Config) auth.LockoutOptions {
+	return auth.LockoutOptions{
+		MaxFailures: cfg.LoginMaxFailures,
+		Lockout:     cfg.LoginLockout,
+		MaxLockout:  cfg.LoginMaxLockout,
+		Allowlist:   cfg.LoginAllowlist,
+	}
+}
+
+// megabytes converts a size limit in MiB to bytes
+func megabytes(mb int) int64 {
+	return int64(mb) << 20
+}
+
+// setupRoutes registers the WebDAV and API routes on mux and the admin
+// panel on adminMux. When the panel has a listener of its own, the WebDAV
+// port answers /admin/ with 404 rather than serving it as a path.
+func (s *Server) setupRoutes(mux, adminMux *http.ServeMux) {
 	// Use dynamic middleware that checks current config state
 	adminHandler := s.loggingMiddleware(s.dynamicAuthMiddleware(s.adminHandler.ServeHTTP))
-	mux.HandleFunc("/admin/", adminHandler)
+	adminMux.HandleFunc("/admin/", adminHandler)
+	if adminMux != mux {
+		adminMux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, forwarded.Prefix(r.Context())+"/admin/", http.StatusFound)
+		})
+		mux.HandleFunc("/admin/", s.loggingMiddleware(http.NotFound))
+	}
 
 	apiHandler := s.loggingMiddleware(s.dynamicAuthMiddleware(s.apiHandler.ServeHTTP))
 	mux.HandleFunc("/api/", apiHandler)
 	mux.HandleFunc("/api/health", s.handleHealth)
 
+	// Share links carry their own access and skip account authentication.
+	// Their prefix is more specific than /api/, so it is routed here.
+	mux.HandleFunc(handlers.SharePrefix, s.loggingMiddleware(s.shareHandler.ServeHTTP))
+
 	// WebDAV routes (catch-all, should be last)
 	webdavHandler := s.loggingMiddleware(s.dynamicAuthMiddleware(s.webdavHandler.ServeHTTP))
 	mux.HandleFunc("/", webdavHandler)
 }
 
+// serverMode holds the read-only and maintenance settings requests check
+type serverMode struct {
+	readOnly    bool
+	maintenance bool
+	message     string
+	retryAfter  time.Duration
+}
+
+func modeOf(cfg *config.Config) *serverMode {
+	return &serverMode{
+		readOnly:    cfg.ReadOnly,
+		maintenance: cfg.Maintenance,
+		message:     cfg.MaintenanceMessage,
+		retryAfter:  cfg.MaintenanceRetryAfter,
+	}
+}
+
+type healthResponse struct {
+	Status  string `json:"status"`
+	Mode    string `json:"mode"`
+	DataDir string `json:"data_dir"`
+}
+
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	response := healthResponse{Status: "healthy", Mode: "normal", DataDir: s.dataDir}
+	switch mode := s.mode.Load(); {
+	case mode.maintenance:
+		response.Mode = "maintenance"
+	case mode.readOnly:
+		response.Mode = "read_only"
+	}
 	w.Header().Set("Content-Type", "application/json")
-	fmt.Fprintf(w, `{"status":"healthy","data_dir":"%s"}`, s.config.DataDir)
+	json.NewEncoder(w).Encode(response)
+}
+
+// buildAuthChain sets up the authentication methods of cfg in their order
+func (s *Server) buildAuthChain(cfg *config.Config) (*auth.Chain, error) {
+	methods := cfg.AuthMethods
+	if len(methods) == 0 {
+		methods = auth.DefaultMethods
+		if cfg.HtpasswdFile != "" {
+			// Users missing from the file are left to the accounts
+			methods = append([]string{auth.MethodHtpasswd}, methods...)
+		}
+		if cfg.TLSClientCA != "" {
+			// Clients without a certificate are left to the other methods
+			methods = append([]string{auth.MethodClientCert}, methods...)
+		}
+		if cfg.JWTJWKS != "" {
+			methods = append(append([]string(nil), methods...), auth.MethodJWT)
+		}
+	}
+
+	var authenticators []auth.Authenticator
+	for _, method := range methods {
+		switch method {
+		case auth.MethodPassword:
+			authenticators = append(authenticators, auth.NewPasswordAuth(s.users))
+		case auth.MethodAppPassword:
+			authenticators = append(authenticators, auth.NewAppPasswordAuth(s.appPasswords))
+		case auth.MethodToken:
+			authenticators = append(authenticators, auth.NewTokenAuth(s.tokens))
+		case auth.MethodHtpasswd:
+			roleMap, err := auth.ParseRoleMap(cfg.HtpasswdRoleMap)
+			if err != nil {
+				return nil, err
+			}
+			htpasswdAuth, err := auth.NewHtpasswdAuth(auth.HtpasswdOptions{
+				File:       cfg.HtpasswdFile,
+				GroupsFile: cfg.HtpasswdGroupsFile,
+				RoleMap:    roleMap,
+			}, s.users)
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure htpasswd authentication: %w", err)
+			}
+			authenticators = append(authenticators, htpasswdAuth)
+		case auth.MethodClientCert:
+			userMap, err := auth.ParseUserMap(cfg.TLSClientUserMap)
+			if err != nil {
+				return nil, err
+			}
+			authenticators = append(authenticators, auth.NewClientCertAuth(userMap, s.users))
+		case auth.MethodProxy:
+			roleMap, err := auth.ParseRoleMap(cfg.ProxyRoleMap)
+			if err != nil {
+				return nil, err
+			}
+			proxies, err := forwarded.ParseProxies(cfg.TrustedProxies)
+			if err != nil {
+				return nil, err
+			}
+			proxyAuth, err := auth.NewProxyAuth(auth.ProxyOptions{
+				Proxies:      proxies,
+				UserHeader:   cfg.ProxyUserHeader,
+				GroupsHeader: cfg.ProxyGroupsHeader,
+				RoleMap:      roleMap,
+			}, s.users)
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure proxy authentication: %w", err)
+			}
+			authenticators = append(authenticators, proxyAuth)
+		case auth.MethodJWT:
+			roleMap, err := auth.ParseRoleMap(cfg.JWTRoleMap)
+			if err != nil {
+				return nil, err
+			}
+			jwtAuth, err := auth.NewJWTAuth(auth.JWTOptions{
+				JWKS:          cfg.JWTJWKS,
+				Issuers:       cfg.JWTIssuers,
+				Audiences:     cfg.JWTAudiences,
+				UsernameClaim: cfg.JWTUsernameClaim,
+				GroupsClaim:   cfg.JWTGroupsClaim,
+				RoleClaim:     cfg.JWTRoleClaim,
+				RoleMap:       roleMap,
+			}, s.users)
+			if err != nil {
+				return nil, fmt.Errorf("failed to configure JWT authentication: %w", err)
+			}
+			authenticators = append(authenticators, jwtAuth)
+		default:
+			return nil, fmt.Errorf("unknown authentication method %q", method)
+		}
+	}
+	return auth.NewChain(authenticators...), nil
 }
 
-// basicAuthMiddleware provides HTTP Basic authentication
-func (s *Server) basicAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// authMiddleware authenticates requests with the configured chain of
+// methods and checks that the identity's role, or token's scopes, allow
+// the request. Clients and usernames with too many failed logins are
+// locked out for a while.
+func (s *Server) authMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		username, password, ok := r.BasicAuth()
-		if !ok {
-			w.Header().Set("WWW-Authenticate", `Basic realm="ProxyDAV"`)
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		clientIP := forwarded.From(r).ClientIP
+		username, _, _ := r.BasicAuth()
+		if wait := s.lockouts.Check(clientIP, username); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "Too Many Requests: too many failed logins, try again later", http.StatusTooManyRequests)
 			return
 		}
 
-		// Use constant-time comparison to prevent timing attacks
-		usernameMatch := subtle.ConstantTimeCompare([]byte(username), []byte(s.config.AuthUser)) == 1
-		passwordMatch := subtle.ConstantTimeCompare([]byte(password), []byte(s.config.AuthPass)) == 1
-
-		if !usernameMatch || !passwordMatch {
-			w.Header().Set("WWW-Authenticate", `Basic realm="ProxyDAV"`)
+		identity, challenges, err := s.authChain.Load().Authenticate(r)
+		if err != nil {
+			switch {
+			case errors.Is(err, auth.ErrInvalidCredentials), errors.Is(err, auth.ErrInvalidToken):
+				s.loginFailed(r, clientIP, username, err)
+			case !errors.Is(err, auth.ErrNoCredentials):
+				log.Printf("❌ Failed to authenticate request: %v", err)
+			}
+			for _, challenge := range challenges {
+				w.Header().Add("WWW-Authenticate", challenge)
+			}
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		next(w, r)
+		s.lockouts.Succeed(clientIP, username)
+		s.audit.Record(types.LoginEvent{Username: identity.User.Username, ClientIP: clientIP, Method: identity.Method, Success: true, UserAgent: r.UserAgent()})
+		setPrincipal(w, identity.Principal)
+		if identity.Token != nil {
+			for _, scope := range requiredScopes(r) {
+				if !auth.HasScope(identity.Token, scope) {
+					http.Error(w, "Forbidden: the token lacks the "+scope+" scope", http.StatusForbidden)
+					return
+				}
+			}
+		} else if !auth.Allows(identity.User.Role, requiredRole(r)) {
+			http.Error(w, "Forbidden: your account's role does not allow this request", http.StatusForbidden)
+			return
+		}
+
+		ctx := auth.WithMethod(auth.WithUser(r.Context(), identity.User), identity.Method)
+		if identity.Token != nil {
+			ctx = auth.WithToken(ctx, identity.Token)
+		}
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// loginFailed records a refused login and counts it towards a lockout
+func (s *Server) loginFailed(r *http.Request, clientIP, username string, err error) {
+	event := types.LoginEvent{Username: username, ClientIP: clientIP, Reason: err.Error(), UserAgent: r.UserAgent()}
+	s.audit.Record(event)
+	if lockout := s.lockouts.Fail(clientIP, username); lockout > 0 {
+		subject := clientIP
+		if username != "" {
+			subject = username + " from " + clientIP
+		}
+		log.Printf("🚫 Locked out %s for %v after repeated failed logins", subject, lockout)
+		event.Reason = fmt.Sprintf("locked out for %v", lockout)
+		s.audit.Record(event)
+	}
+}
+
+// requiredScopes returns the token scopes a request needs
+func requiredScopes(r *http.Request) []string {
+	if r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/") {
+		return []string{types.ScopeAdmin}
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		return []string{types.ScopeRead}
+	case http.MethodDelete:
+		return []string{types.ScopeDelete}
+	case "MOVE":
+		return []string{types.ScopeAdd, types.ScopeDelete}
+	case http.MethodPost:
+		// Refreshing metadata and checking links change no entries
+		if r.URL.Path == "/api/metadata/refresh" || r.URL.Path == "/api/links/check" {
+			return []string{types.ScopeRead}
+		}
 	}
+	return []string{types.ScopeAdd}
+}
+
+// requiredRole returns the least privileged role that may make a request:
+// the admin panel needs admins, and changes need editors. Everyone manages
+// their own app passwords.
+func requiredRole(r *http.Request) string {
+	if r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/") {
+		return types.RoleAdmin
+	}
+	if r.URL.Path == "/api/app-passwords" || strings.HasPrefix(r.URL.Path, "/api/app-passwords/") {
+		return types.RoleReader
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, "PROPFIND":
+		return types.RoleReader
+	}
+	return types.RoleEditor
 }
 
 // dynamicAuthMiddleware applies authentication only when enabled in current config
 func (s *Server) dynamicAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if s.config.AuthEnabled {
-			s.basicAuthMiddleware(next)(w, r)
+			s.authMiddleware(next)(w, r)
 		} else {
 			next(w, r)
 		}
 	}
 }
 
+// forwardedMiddleware resolves the client and external URL of requests,
+// believing X-Forwarded-* headers only from trusted proxies
+func (s *Server) forwardedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		info := s.proxies.Load().Resolve(r)
+		next.ServeHTTP(w, r.WithContext(forwarded.WithInfo(r.Context(), info)))
+	})
+}
+
+// defaultMaintenanceMessage is shown in maintenance mode without a
+// configured message
+const defaultMaintenanceMessage = "ProxyDAV is down for maintenance, please try again later"
+
+// adminFileChanges are the admin endpoints that change files or entries
+var adminFileChanges = map[string]bool{
+	"/admin/api/files":       true,
+	"/admin/api/import":      true,
+	"/admin/api/delete-file": true,
+	"/admin/api/links/check": true, // quarantines broken entries
+}
+
+// maintenanceMiddleware answers requests with 503 in maintenance mode,
+// except health checks and the admin panel that turns it off again. The
+// admin panel's file changes are refused as well, so that nothing changes
+// the filesystem while it is being worked on.
+func (s *Server) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin := r.URL.Path == "/admin" || strings.HasPrefix(r.URL.Path, "/admin/")
+		if !s.mode.Load().maintenance || r.URL.Path == "/api/health" || admin && !changesFiles(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.refuseForMaintenance(w)
+	})
+}
+
+// adminMaintenanceMiddleware refuses the admin panel's file changes in
+// maintenance mode on the separate admin listener, which keeps serving the
+// rest of the panel
+func (s *Server) adminMaintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.mode.Load().maintenance || !changesFiles(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s.refuseForMaintenance(w)
+	})
+}
+
+// changesFiles reports whether a request is one of the admin panel's file
+// changes
+func changesFiles(r *http.Request) bool {
+	return adminFileChanges[r.URL.Path] && r.Method != http.MethodGet && r.Method != http.MethodHead
+}
+
+// refuseForMaintenance answers 503 with the maintenance message
+func (s *Server) refuseForMaintenance(w http.ResponseWriter) {
+	mode := s.mode.Load()
+	message := mode.message
+	if message == "" {
+		message = defaultMaintenanceMessage
+	}
+	if mode.retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(mode.retryAfter.Seconds()))))
+	}
+	http.Error(w, message, http.StatusServiceUnavailable)
+}
+
 // loggingMiddleware logs HTTP requests
 func (s *Server) loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -159,14 +708,27 @@ func (s *Server) loggingMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			statusEmoji = "❌"
 		}
 
-		log.Printf("%s %s %s %d %v %s", statusEmoji, r.Method, r.URL.Path, wrapped.statusCode, duration, r.UserAgent())
+		principal := ""
+		if wrapped.principal != "" {
+			principal = " " + wrapped.principal
+		}
+		log.Printf("%s %s %s %s %d %v %s%s", statusEmoji, forwarded.From(r).ClientIP, r.Method, r.URL.Path, wrapped.statusCode, duration, r.UserAgent(), principal)
 	}
 }
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// responseWriter wraps http.ResponseWriter to capture status code and the
+// account or token the request was authenticated as
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	principal  string
+}
+
+// setPrincipal records who made a request for its log line
+func setPrincipal(w http.ResponseWriter, principal string) {
+	if rw, ok := w.(*responseWriter); ok {
+		rw.principal = principal
+	}
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
@@ -178,26 +740,120 @@ func (s *Server) Start() error {
 
 	log.Println("📋 Server Configuration:")
 	log.Printf("   🌐 Port: %d", s.config.Port)
+	switch {
+	case s.config.TLSSelfSigned:
+		log.Printf("   🔒 TLS: self-signed certificate in %s", filepath.Join(s.config.DataDir, "tls"))
+	case s.config.TLSCert != "":
+		log.Printf("   🔒 TLS: %s (reloaded when it changes)", s.config.TLSCert)
+	}
+	if s.config.TLSClientCA != "" {
+		log.Printf("   📜 Client Certificates: CAs from %s", s.config.TLSClientCA)
+	}
+	if s.redirectServer != nil {
+		log.Printf("   ↪️  HTTP Redirect: %s to HTTPS", s.redirectServer.Addr)
+	}
 	log.Printf("   📁 Data Directory: %s", s.config.DataDir)
 	log.Printf("   🔄 Redirect Mode: %v", s.config.UseRedirect)
+	if s.config.ReadOnly {
+		log.Printf("   📖 Read-Only Mode: on")
+	}
+	if s.config.Maintenance {
+		log.Printf("   🚧 Maintenance Mode: on")
+	}
 	log.Printf("   🔐 Authentication: %v", s.config.AuthEnabled)
-	if s.config.AuthEnabled {
-		log.Printf("   👤 Username: %s", s.config.AuthUser)
+	if len(s.config.AuthMethods) > 0 {
+		log.Printf("   🔗 Authentication Methods: %s", strings.Join(s.config.AuthMethods, ", "))
+	}
+	if s.config.JWTJWKS != "" {
+		log.Printf("   🪪 JWT Issuers: %s (keys from %s)", strings.Join(s.config.JWTIssuers, ", "), s.config.JWTJWKS)
+	}
+	if s.config.HtpasswdFile != "" {
+		log.Printf("   📒 htpasswd File: %s", s.config.HtpasswdFile)
+	}
+	if s.config.LoginMaxFailures > 0 {
+		log.Printf("   🚫 Login Lockouts: after %d failures, %v to %v", s.config.LoginMaxFailures, s.config.LoginLockout, s.config.LoginMaxLockout)
+	}
+	if users, err := s.users.List(); err == nil {
+		log.Printf("   👥 User Accounts: %d", len(users))
+	}
+	if tokens, err := s.tokens.List(); err == nil {
+		log.Printf("   🔑 API Tokens: %d", len(tokens))
+	}
+	log.Printf("   🔏 Paths With Access Rules: %d", s.acls.Len())
+	if shares, err := s.shares.List(); err == nil {
+		log.Printf("   🤝 Share Links: %d", len(shares))
+	}
+	if hasAdmin, err := s.users.HasAdmin(); err == nil && s.config.AuthEnabled && !hasAdmin {
+		log.Printf("⚠️  Authentication is enabled but no admin account exists; start with -user and -pass to create one")
+	}
+	if s.config.AuthEnabled && !s.config.TLSEnabled() && len(s.config.TrustedProxies) == 0 {
+		log.Printf("⚠️  Authentication is enabled without TLS; passwords cross the network in plain text unless a TLS proxy is in front (see -tls-cert and -tls-self-signed)")
+	}
+	if !s.config.AuthEnabled && s.adminServer == nil {
+		log.Printf("⚠️  Authentication is disabled and the admin panel shares the WebDAV port; anyone who can mount the share can reconfigure the server (see -admin-addr)")
+	}
+	log.Printf("   🧮 Checksum Verification: %v", s.config.VerifyChecksums)
+	log.Printf("   🕵️  Response Validation: %v (sniffing: %v)", s.config.ValidateResponses, s.config.SniffResponses)
+	log.Printf("   🛡️  Private Upstreams: %v", s.config.UpstreamAllowPrivate)
+	if len(s.config.UpstreamAllowHosts) > 0 {
+		log.Printf("   ✅ Upstream Allowlist: %s", strings.Join(s.config.UpstreamAllowHosts, ", "))
+	}
+	if len(s.config.UpstreamDenyHosts) > 0 {
+		log.Printf("   🚫 Upstream Denylist: %s", strings.Join(s.config.UpstreamDenyHosts, ", "))
+	}
+	log.Printf("   ⏳ Metadata TTL: %v (refresh every %v)", s.config.MetadataTTL, s.config.MetadataRefreshInterval)
+	log.Printf("   🔗 Link Check: every %v (action: %s)", s.config.LinkCheckInterval, s.config.LinkCheckAction)
+	if len(s.config.UpstreamProxies) > 0 {
+		log.Printf("   🧭 Upstream Proxy Rules: %d", len(s.config.UpstreamProxies))
+	}
+	if len(s.config.LocalRoots) > 0 {
+		log.Printf("   💽 Local Roots: %s", strings.Join(s.config.LocalRoots, ", "))
+	}
+	if s.config.BlobStoreEnabled {
+		log.Printf("   📤 Blob Store: %d MiB per file, %d MiB total", s.config.BlobMaxFileMB, s.config.BlobMaxTotalMB)
+	}
+	if len(s.config.TrustedProxies) > 0 {
+		log.Printf("   🔀 Trusted Proxies: %s", strings.Join(s.config.TrustedProxies, ", "))
+	}
+	if len(s.config.JunkPatterns) > 0 {
+		log.Printf("   🧹 OS Metadata Files: %s", strings.Join(s.config.JunkPatterns, ", "))
 	}
 	log.Printf("   🩺 Health Endpoint: /api/health")
 	log.Println()
 
 	go func() {
-		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		if err := listen(s.httpServer); err != nil && err != http.ErrServerClosed {
 			log.Fatalf("❌ Server failed to start: %v", err)
 		}
 	}()
+	if s.adminServer != nil {
+		go func() {
+			if err := listen(s.adminServer); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("❌ Admin listener failed to start: %v", err)
+			}
+		}()
+	}
+	if s.redirectServer != nil {
+		go func() {
+			if err := s.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("❌ HTTP redirect listener failed to start: %v", err)
+			}
+		}()
+	}
 
+	scheme := "http"
+	if s.config.TLSEnabled() {
+		scheme = "https"
+	}
 	log.Println("✅ ProxyDAV server started successfully!")
 	log.Printf("🌍 Server URLs:")
-	log.Printf("   🔗 WebDAV Endpoint: http://localhost:%d/", s.config.Port)
-	log.Printf("   🛠️  API Endpoint: http://localhost:%d/api/", s.config.Port)
-	log.Printf("   🎛️  Admin Panel: http://localhost:%d/admin/", s.config.Port)
+	log.Printf("   🔗 WebDAV Endpoint: %s://localhost:%d/", scheme, s.config.Port)
+	log.Printf("   🛠️  API Endpoint: %s://localhost:%d/api/", scheme, s.config.Port)
+	if s.adminServer != nil {
+		log.Printf("   🎛️  Admin Panel: %s://%s/admin/ (separate listener)", scheme, s.adminServer.Addr)
+	} else {
+		log.Printf("   🎛️  Admin Panel: %s://localhost:%d/admin/", scheme, s.config.Port)
+	}
 	log.Println()
 	log.Println("🛑 Press Ctrl+C to stop the server")
 	log.Println()
@@ -228,11 +884,14 @@ func (s *Server) waitForShutdown() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := s.httpServer.Shutdown(ctx); err != nil {
+	if err := s.shutdownListeners(ctx); err != nil {
 		log.Printf("❌ Server forced to shutdown: %v", err)
 		return err
 	}
 
+	s.links.Stop()
+	s.metadata.Stop()
+
 	if err := s.store.Close(); err != nil {
 		log.Printf("⚠️  Error closing persistent store: %v", err)
 	}
@@ -246,14 +905,40 @@ func (s *Server) waitForShutdown() error {
 	return nil
 }
 
+// listen serves HTTPS on listeners with a TLS configuration, otherwise HTTP
+func listen(server *http.Server) error {
+	if server.TLSConfig != nil {
+		return server.ListenAndServeTLS("", "")
+	}
+	return server.ListenAndServe()
+}
+
+// shutdownListeners gracefully stops the WebDAV, admin and redirect listeners
+func (s *Server) shutdownListeners(ctx context.Context) error {
+	if s.redirectServer != nil {
+		if err := s.redirectServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	if s.adminServer != nil {
+		if err := s.adminServer.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+	return s.httpServer.Shutdown(ctx)
+}
+
 func (s *Server) Stop() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := s.httpServer.Shutdown(ctx); err != nil {
+	if err := s.shutdownListeners(ctx); err != nil {
 		return err
 	}
 
+	s.links.Stop()
+	s.metadata.Stop()
+
 	return s.store.Close()
 }
 
@@ -262,10 +947,52 @@ func (s *Server) UpdateConfig(newConfig *config.Config) error {
 	if err := newConfig.Validate(); err != nil {
 		return fmt.Errorf("configuration validation failed: %w", err)
 	}
+	if newConfig.AuthEnabled {
+		// Enabling authentication without an admin would lock everyone out of the panel
+		hasAdmin, err := s.users.HasAdmin()
+		if err != nil {
+			return fmt.Errorf("failed to check user accounts: %w", err)
+		}
+		if !hasAdmin {
+			return fmt.Errorf("create an enabled admin account before enabling authentication")
+		}
+	}
+
+	chain, err := s.buildAuthChain(newConfig)
+	if err != nil {
+		return err
+	}
+	proxies, err := forwarded.ParseProxies(newConfig.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	if err := s.lockouts.Configure(lockoutOptions(newConfig)); err != nil {
+		return fmt.Errorf("failed to update login lockouts: %w", err)
+	}
+
+	if err := s.policy.Update(newConfig.UpstreamAllowHosts, newConfig.UpstreamDenyHosts, newConfig.UpstreamAllowPrivate); err != nil {
+		return fmt.Errorf("failed to update upstream policy: %w", err)
+	}
+	if err := s.router.Update(newConfig.UpstreamProxies); err != nil {
+		return fmt.Errorf("failed to update upstream proxies: %w", err)
+	}
+	s.metadata.Configure(newConfig.MetadataTTL, newConfig.MetadataRefreshInterval, newConfig.MetadataHostConcurrency,
+		newConfig.MetadataConcurrency, newConfig.MetadataNegativeTTL)
+	s.links.Configure(linkCheckOptions(newConfig))
+	s.local.SetRoots(newConfig.LocalRoots)
+	s.blobs.Configure(newConfig.BlobStoreEnabled, megabytes(newConfig.BlobMaxFileMB), megabytes(newConfig.BlobMaxTotalMB))
 
 	s.config = newConfig
+	s.authChain.Store(chain)
+	s.proxies.Store(proxies)
+	s.mode.Store(modeOf(newConfig))
 
 	s.webdavHandler.SetUseRedirect(newConfig.UseRedirect)
+	s.webdavHandler.SetVerifyChecksums(newConfig.VerifyChecksums)
+	s.webdavHandler.SetContentValidation(newConfig.ValidateResponses, newConfig.SniffResponses)
+	s.webdavHandler.SetJunkPatterns(newConfig.JunkPatterns)
+	s.webdavHandler.SetReadOnly(newConfig.ReadOnly)
+	s.apiHandler.SetReadOnly(newConfig.ReadOnly)
 
 	if err := newConfig.SaveToStore(s.store); err != nil {
 		log.Printf("⚠️  Warning: Failed to save configuration to database: %v", err)
@@ -276,9 +1003,8 @@ func (s *Server) UpdateConfig(newConfig *config.Config) error {
 	log.Printf("🔄 Configuration updated successfully")
 	log.Printf("   🔄 Redirect Mode: %v", newConfig.UseRedirect)
 	log.Printf("   🔐 Authentication: %v", newConfig.AuthEnabled)
-	if newConfig.AuthEnabled {
-		log.Printf("   👤 Username: %s", newConfig.AuthUser)
-	}
+	log.Printf("   📖 Read-Only Mode: %v", newConfig.ReadOnly)
+	log.Printf("   🚧 Maintenance Mode: %v", newConfig.Maintenance)
 
 	return nil
 }
@@ -289,6 +1015,12 @@ func (s *Server) GetConfig() *config.Config {
 	return &configCopy
 }
 
+// CheckPassword checks a password with the authentication method a user
+// signed in with, for confirming destructive admin actions
+func (s *Server) CheckPassword(method, username, password string) (*types.User, error) {
+	return s.authChain.Load().CheckPassword(method, username, password)
+}
+
 // Restart signals the server to restart gracefully
 func (s *Server) Restart() error {
 	select {
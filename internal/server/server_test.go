@@ -1,14 +1,36 @@
 package server
 
 import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"proxydav/internal/auth"
 	"proxydav/internal/config"
+	"proxydav/internal/handlers"
+	"proxydav/pkg/types"
 )
 
 func TestNew(t *testing.T) {
@@ -75,7 +97,8 @@ func TestNew_InvalidDataDir(t *testing.T) {
 }
 
 func TestServer_HealthEndpoint(t *testing.T) {
-	tempDir := t.TempDir()
+	// Quotes and backslashes in the path must not break the JSON
+	tempDir := filepath.Join(t.TempDir(), `odd "data\dir`)
 
 	cfg := &config.Config{
 		Port:        8080,
@@ -142,7 +165,7 @@ func TestServer_BasicAuthMiddleware(t *testing.T) {
 		w.WriteHeader(http.StatusOK)
 	}
 
-	authHandler := server.basicAuthMiddleware(testHandler)
+	authHandler := server.authMiddleware(testHandler)
 
 	tests := []struct {
 		name           string
@@ -210,6 +233,382 @@ func TestServer_BasicAuthMiddleware(t *testing.T) {
 	}
 }
 
+func TestServer_BasicAuthMiddleware_Roles(t *testing.T) {
+	cfg := &config.Config{
+		Port:        8080,
+		DataDir:     t.TempDir(),
+		AuthEnabled: true,
+		AuthUser:    "testuser",
+		AuthPass:    "testpass",
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+
+	if cfg.AuthUser != "" || cfg.AuthPass != "" {
+		t.Error("Expected the configured credentials to be cleared after migration")
+	}
+	if _, err := server.users.Create("reader", "readerpass", types.RoleReader, nil); err != nil {
+		t.Fatalf("Failed to create reader: %v", err)
+	}
+	if _, err := server.users.Create("editor", "editorpass", types.RoleEditor, nil); err != nil {
+		t.Fatalf("Failed to create editor: %v", err)
+	}
+
+	authHandler := server.authMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if auth.UserFrom(r.Context()) == nil {
+			t.Error("Expected the user in the request context")
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		username, password string
+		method, path       string
+		expectedStatus     int
+	}{
+		{"reader", "readerpass", "GET", "/files/a.txt", http.StatusOK},
+		{"reader", "readerpass", "PROPFIND", "/", http.StatusOK},
+		{"reader", "readerpass", "DELETE", "/a.txt", http.StatusForbidden},
+		{"reader", "readerpass", "GET", "/admin/", http.StatusForbidden},
+		{"editor", "editorpass", "MOVE", "/a.txt", http.StatusOK},
+		{"editor", "editorpass", "GET", "/admin/", http.StatusForbidden},
+		{"testuser", "testpass", "GET", "/admin/", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.SetBasicAuth(tt.username, tt.password)
+		w := httptest.NewRecorder()
+
+		authHandler(w, req)
+
+		if w.Code != tt.expectedStatus {
+			t.Errorf("%s %s as %s: expected status code %d, got %d", tt.method, tt.path, tt.username, tt.expectedStatus, w.Code)
+		}
+	}
+}
+
+func TestServer_TokenAuth(t *testing.T) {
+	cfg := &config.Config{
+		Port:        8080,
+		DataDir:     t.TempDir(),
+		AuthEnabled: true,
+		AuthUser:    "testuser",
+		AuthPass:    "testpass",
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+
+	server.vfs.AddFile("/builds/a.zip", "https://example.com/a.zip")
+	server.vfs.AddFile("/other/b.zip", "https://example.com/b.zip")
+	secret, _, err := server.tokens.Create(auth.TokenRequest{Name: "ci", PathPrefix: "/builds", Scopes: []string{types.ScopeRead, types.ScopeAdd}}, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	request := func(method, target, bearer string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.Header.Set("Authorization", "Bearer "+bearer)
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("GET", "/api/files", secret)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/builds/a.zip") || strings.Contains(w.Body.String(), "/other/b.zip") {
+		t.Errorf("Expected only files under the prefix, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("PROPFIND", "/", secret); !strings.Contains(w.Body.String(), "builds") || strings.Contains(w.Body.String(), "other") {
+		t.Errorf("Expected the root listing to lead to the prefix only, got %s", w.Body.String())
+	}
+	if w := request("DELETE", "/builds/a.zip", secret); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a token without the delete scope to be refused, got %d", w.Code)
+	}
+	if w := request("GET", "/admin/", secret); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a token without the admin scope to be refused, got %d", w.Code)
+	}
+	if w := request("COPY", "/builds/a.zip", secret); w.Code == http.StatusForbidden || w.Code == http.StatusUnauthorized {
+		t.Errorf("Expected the add scope to allow COPY, got %d", w.Code)
+	}
+	w = request("GET", "/api/files", secret+"x")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), "Bearer") {
+		t.Errorf("Expected an invalid token to be refused with a Bearer challenge, got %d", w.Code)
+	}
+
+	if !strings.Contains(logs.String(), "GET /api/files 200") || !strings.Contains(logs.String(), "🔑 ci") {
+		t.Errorf("Expected requests to be attributed to the token in logs, got %s", logs.String())
+	}
+}
+
+// signTestJWT makes an RS256 JWT for the key in the test's JWKS
+func signTestJWT(t *testing.T, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("Failed to sign JWT: %v", err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestServer_JWTAuth(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "test",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	jwksFile := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(jwksFile, jwks, 0600)
+
+	cfg := &config.Config{
+		Port:         8080,
+		DataDir:      t.TempDir(),
+		AuthEnabled:  true,
+		AuthUser:     "testuser",
+		AuthPass:     "testpass",
+		AuthMethods:  []string{"jwt", "app_password"},
+		JWTJWKS:      jwksFile,
+		JWTIssuers:   []string{"https://sso.example.com"},
+		JWTAudiences: []string{"proxydav"},
+		JWTRoleMap:   []string{"dav-editors=editor"},
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	server.vfs.AddFile("/docs/a.txt", "https://example.com/a.txt")
+
+	jwt := func(username string, roles ...string) string {
+		return signTestJWT(t, key, map[string]interface{}{
+			"iss":                "https://sso.example.com",
+			"aud":                "proxydav",
+			"preferred_username": username,
+			"roles":              roles,
+			"exp":                time.Now().Add(time.Hour).Unix(),
+		})
+	}
+	request := func(method, target, body string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		prepare(req)
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w
+	}
+	bearer := func(token string) func(*http.Request) {
+		return func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }
+	}
+	basic := func(username, password string) func(*http.Request) {
+		return func(r *http.Request) { r.SetBasicAuth(username, password) }
+	}
+
+	alice := jwt("alice")
+	if w := request("PROPFIND", "/docs/", "", bearer(alice)); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected a JWT to authenticate, got %d", w.Code)
+	}
+	if w := request("DELETE", "/docs/a.txt", "", bearer(alice)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a JWT without a mapped role to read only, got %d", w.Code)
+	}
+	if w := request("DELETE", "/docs/a.txt", "", bearer(jwt("bob", "dav-editors"))); w.Code != http.StatusNoContent {
+		t.Errorf("Expected the mapped editor role to allow deleting, got %d", w.Code)
+	}
+	if w := request("PROPFIND", "/", "", basic("testuser", "testpass")); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected account passwords to be refused without the password method, got %d", w.Code)
+	}
+	if w := request("PROPFIND", "/", "", func(*http.Request) {}); len(w.Header().Values("WWW-Authenticate")) != 2 {
+		t.Errorf("Expected Bearer and Basic challenges, got %v", w.Header().Values("WWW-Authenticate"))
+	}
+
+	// Legacy clients sign in with an app password made with the JWT
+	w := request("POST", "/api/app-passwords", `{"name":"davfs"}`, bearer(alice))
+	var created struct {
+		Data struct {
+			Password string `json:"password"`
+		} `json:"data"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	if w.Code != http.StatusCreated || created.Data.Password == "" {
+		t.Fatalf("Expected an app password, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("PROPFIND", "/", "", basic("alice", created.Data.Password)); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected the app password to authenticate, got %d", w.Code)
+	}
+	if w := request("PROPFIND", "/", "", basic("bob", created.Data.Password)); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the app password to work for its user only, got %d", w.Code)
+	}
+	if w := request("POST", "/api/app-passwords", `{"name":"more"}`, basic("alice", created.Data.Password)); w.Code != http.StatusForbidden {
+		t.Errorf("Expected app passwords not to create more of them, got %d", w.Code)
+	}
+	if w := request("GET", "/api/app-passwords", "", bearer(jwt("bob"))); strings.Contains(w.Body.String(), "davfs") {
+		t.Errorf("Expected users to see only their own app passwords, got %s", w.Body.String())
+	}
+
+	// The chain follows configuration changes
+	updated := server.GetConfig()
+	updated.AuthMethods = nil
+	if err := server.UpdateConfig(updated); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if w := request("PROPFIND", "/", "", basic("testuser", "testpass")); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected the default methods to include account passwords, got %d", w.Code)
+	}
+	if w := request("PROPFIND", "/", "", bearer(alice)); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected the default methods to include configured JWTs, got %d", w.Code)
+	}
+}
+
+func TestServer_HtpasswdAuth(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, "htpasswd")
+	os.WriteFile(htpasswd, []byte("alice:{SHA}xO2etOilyqtV8o1RvvnmkeBx7QI=\n"), 0600)
+	groups := filepath.Join(dir, "groups")
+	os.WriteFile(groups, []byte("ops: alice\n"), 0600)
+
+	cfg := &config.Config{
+		Port:               8080,
+		DataDir:            t.TempDir(),
+		AuthEnabled:        true,
+		AuthUser:           "testuser",
+		AuthPass:           "testpass",
+		HtpasswdFile:       htpasswd,
+		HtpasswdGroupsFile: groups,
+		HtpasswdRoleMap:    []string{"ops=editor"},
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	server.vfs.AddFile("/docs/a.txt", "https://example.com/a.txt")
+
+	request := func(method, target, username, password string) int {
+		req := httptest.NewRequest(method, target, nil)
+		req.SetBasicAuth(username, password)
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request("PROPFIND", "/", "alice", "sha-pass"); code != http.StatusMultiStatus {
+		t.Errorf("Expected an htpasswd user to authenticate, got %d", code)
+	}
+	if code := request("PROPFIND", "/", "testuser", "testpass"); code != http.StatusMultiStatus {
+		t.Errorf("Expected accounts to keep working next to the htpasswd file, got %d", code)
+	}
+	if code := request("DELETE", "/docs/a.txt", "alice", "sha-pass"); code != http.StatusNoContent {
+		t.Errorf("Expected the mapped editor role to allow deleting, got %d", code)
+	}
+
+	// Users added to the file can sign in right away
+	os.WriteFile(htpasswd, []byte("alice:{SHA}xO2etOilyqtV8o1RvvnmkeBx7QI=\nbob:$apr1$8sFt66rZ$8ctGeVTXq9XlA6l6wfsWp0\n"), 0600)
+	if code := request("PROPFIND", "/", "bob", "apr1-pass"); code != http.StatusMultiStatus {
+		t.Errorf("Expected users added to the file to authenticate, got %d", code)
+	}
+
+	// Listing the methods leaves accounts out
+	updated := server.GetConfig()
+	updated.AuthMethods = []string{"htpasswd"}
+	if err := server.UpdateConfig(updated); err != nil {
+		t.Fatalf("Failed to update config: %v", err)
+	}
+	if code := request("PROPFIND", "/", "testuser", "testpass"); code != http.StatusUnauthorized {
+		t.Errorf("Expected account passwords to be refused without the password method, got %d", code)
+	}
+}
+
+func TestServer_ReverseProxy(t *testing.T) {
+	cfg := &config.Config{
+		Port:           8080,
+		DataDir:        t.TempDir(),
+		AuthEnabled:    true,
+		AuthUser:       "testuser",
+		AuthPass:       "testpass",
+		AuthMethods:    []string{"proxy", "password"},
+		TrustedProxies: []string{"10.0.0.0/8"},
+		ProxyRoleMap:   []string{"dav-editors=editor", "dav-admins=admin"},
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	server.vfs.AddFile("/docs/a.txt", "https://example.com/a.txt")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	proxied := func(method, target, user, groups string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = "10.0.0.5:4000"
+		req.Header.Set("X-Forwarded-For", "203.0.113.9")
+		req.Header.Set("X-Forwarded-Proto", "https")
+		req.Header.Set("X-Forwarded-Host", "dav.example.com")
+		req.Header.Set("X-Forwarded-Prefix", "/dav")
+		req.Header.Set("X-Forwarded-User", user)
+		req.Header.Set("X-Forwarded-Groups", groups)
+		if method == "MOVE" {
+			req.Header.Set("Destination", "https://dav.example.com/dav/docs/b.txt")
+		}
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := proxied("PROPFIND", "/docs/", "alice", "")
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<href>/dav/docs/a.txt</href>") {
+		t.Errorf("Expected hrefs below the proxy's prefix, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "203.0.113.9 PROPFIND /docs/") || !strings.Contains(logs.String(), "🔀 alice") {
+		t.Errorf("Expected the client's address and user in the log, got %s", logs.String())
+	}
+	if w := proxied("MOVE", "/docs/a.txt", "alice", ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected unmapped proxy users to read only, got %d", w.Code)
+	}
+	if w := proxied("MOVE", "/docs/a.txt", "bob", "dav-editors"); w.Code != http.StatusCreated || !server.vfs.Exists("/docs/b.txt") {
+		t.Errorf("Expected a move to a destination below the prefix, got %d", w.Code)
+	}
+
+	// Anyone else sending the headers gets nothing from them
+	req := httptest.NewRequest("PROPFIND", "/docs/", nil)
+	req.Header.Set("X-Forwarded-User", "alice")
+	w = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected identity headers from untrusted peers to be ignored, got %d", w.Code)
+	}
+
+	// The admin panel links and sets its cookie below the prefix
+	w = proxied("GET", "/admin/", "carol", "dav-admins")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/dav/admin/config"`) || !strings.Contains(w.Body.String(), "https://dav.example.com/dav/api/health") {
+		t.Errorf("Expected admin links below the external URL, got %d", w.Code)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Path != "/dav/admin" || !cookies[0].Secure {
+		t.Errorf("Expected a secure CSRF cookie below the prefix, got %v", cookies)
+	}
+}
+
 func TestServer_BasicAuthMiddleware_NoAuth(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -381,3 +780,728 @@ func TestServer_RouteSetup(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_AdminListener(t *testing.T) {
+	cfg := &config.Config{
+		Port:      8080,
+		DataDir:   t.TempDir(),
+		AdminAddr: "127.0.0.1:8081",
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+
+	if server.adminServer == nil || server.adminServer.Addr != "127.0.0.1:8081" {
+		t.Fatalf("Expected a separate admin listener, got %+v", server.adminServer)
+	}
+
+	w := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected the WebDAV port not to serve the admin panel, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.adminServer.Handler.ServeHTTP(w, httptest.NewRequest("GET", "/admin/", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected the admin listener to serve the panel, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	server.adminServer.Handler.ServeHTTP(w, httptest.NewRequest("PROPFIND", "/", nil))
+	if w.Code != http.StatusFound {
+		t.Errorf("Expected the admin listener to redirect to the panel, got %d", w.Code)
+	}
+
+	// Maintenance mode refuses file changes on the admin listener as well
+	maintenance := *server.GetConfig()
+	maintenance.Maintenance = true
+	if err := server.UpdateConfig(&maintenance); err != nil {
+		t.Fatalf("Failed to turn on maintenance mode: %v", err)
+	}
+	page := httptest.NewRecorder()
+	server.adminServer.Handler.ServeHTTP(page, httptest.NewRequest("GET", "/admin/", nil))
+	if page.Code != http.StatusOK {
+		t.Errorf("Expected the admin listener to keep serving the panel, got %d", page.Code)
+	}
+	cookies := page.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a CSRF cookie with the page, got %v", cookies)
+	}
+	req := httptest.NewRequest("POST", "/admin/api/files", strings.NewReader(url.Values{"path": {"/b.txt"}, "url": {"https://example.com/b.txt"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-CSRF-Token", cookies[0].Value)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	server.adminServer.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable || server.vfs.Exists("/b.txt") {
+		t.Errorf("Expected file changes on the admin listener to be refused in maintenance mode, got %d", w.Code)
+	}
+}
+
+func TestServer_ConfirmDestructiveAdminActions(t *testing.T) {
+	cfg := &config.Config{
+		Port:        8080,
+		DataDir:     t.TempDir(),
+		AuthEnabled: true,
+		AuthUser:    "testuser",
+		AuthPass:    "testpass",
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+
+	for _, name := range []string{"alice", "bob"} {
+		if _, err := server.users.Create(name, name+"-password", types.RoleReader, nil); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+	secret, _, err := server.tokens.Create(auth.TokenRequest{Name: "ops", Scopes: []string{types.ScopeAdmin}}, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+
+	cookie, csrfToken := fetchCSRFToken(t, server)
+	deleteUser := func(username string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/admin/api/users/"+username, nil)
+		req.SetBasicAuth("testuser", "testpass")
+		req.AddCookie(cookie)
+		req.Header.Set("X-CSRF-Token", csrfToken)
+		prepare(req)
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := deleteUser("alice", func(*http.Request) {})
+	if w.Code != http.StatusForbidden || w.Header().Get("X-Confirm-Required") != "true" {
+		t.Errorf("Expected an unconfirmed delete to be refused, got %d", w.Code)
+	}
+	if w := deleteUser("alice", func(r *http.Request) { r.Header.Set("X-Confirm-Password", "wrong") }); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong confirmation password to be refused, got %d", w.Code)
+	}
+	if w := deleteUser("alice", func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+secret) }); w.Code != http.StatusForbidden {
+		t.Errorf("Expected an admin token to be refused destructive actions, got %d", w.Code)
+	}
+	if user, _ := server.users.Get("alice"); user == nil {
+		t.Fatal("Expected alice to survive unconfirmed deletes")
+	}
+
+	if w := deleteUser("alice", func(r *http.Request) { r.Header.Set("X-Confirm-Password", "testpass") }); w.Code != http.StatusOK {
+		t.Errorf("Expected a confirmed delete to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if user, _ := server.users.Get("alice"); user != nil {
+		t.Error("Expected alice to be deleted")
+	}
+
+	// Without authentication there is no account to confirm with
+	cfg.AuthEnabled = false
+	if w := deleteUser("bob", func(r *http.Request) { r.Header.Del("Authorization") }); w.Code != http.StatusOK {
+		t.Errorf("Expected deletes without authentication to need no confirmation, got %d", w.Code)
+	}
+}
+
+func TestServer_ConfirmWithSignInMethod(t *testing.T) {
+	dir := t.TempDir()
+	htpasswd := filepath.Join(dir, "htpasswd")
+	os.WriteFile(htpasswd, []byte("alice:{SHA}xO2etOilyqtV8o1RvvnmkeBx7QI=\n"), 0600)
+	groups := filepath.Join(dir, "groups")
+	os.WriteFile(groups, []byte("admin: alice\n"), 0600)
+
+	cfg := &config.Config{
+		Port:               8080,
+		DataDir:            t.TempDir(),
+		AuthEnabled:        true,
+		AuthUser:           "testuser",
+		AuthPass:           "testpass",
+		HtpasswdFile:       htpasswd,
+		HtpasswdGroupsFile: groups,
+		LoginMaxFailures:   1,
+		LoginLockout:       time.Minute,
+		LoginMaxLockout:    time.Hour,
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	for _, name := range []string{"bob", "carol"} {
+		if _, err := server.users.Create(name, name+"-password", types.RoleReader, nil); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	cookie, csrfToken := fetchCSRFToken(t, server)
+	deleteUser := func(username, confirmation string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("DELETE", "/admin/api/users/"+username, nil)
+		req.SetBasicAuth("alice", "sha-pass")
+		req.AddCookie(cookie)
+		req.Header.Set("X-CSRF-Token", csrfToken)
+		req.Header.Set("X-Confirm-Password", confirmation)
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// htpasswd admins confirm with the password they sign in with
+	if w := deleteUser("bob", "sha-pass"); w.Code != http.StatusOK {
+		t.Fatalf("Expected an htpasswd admin to confirm with their password, got %d: %s", w.Code, w.Body.String())
+	}
+
+	// App passwords sign clients in but cannot confirm
+	appPassword, _, err := server.appPasswords.Create(&types.User{Username: "alice", Role: types.RoleAdmin}, false, "davfs")
+	if err != nil {
+		t.Fatalf("Failed to create an app password: %v", err)
+	}
+	if w := deleteUser("carol", appPassword); w.Code != http.StatusForbidden {
+		t.Errorf("Expected an app password to be refused as confirmation, got %d", w.Code)
+	}
+	for _, lockout := range server.lockouts.List() {
+		server.lockouts.Unlock(lockout.Key)
+	}
+
+	// Wrong confirmations are audited and count towards lockouts
+	if w := deleteUser("carol", "guess"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a wrong confirmation password to be refused, got %d", w.Code)
+	}
+	events, err := server.audit.List(10, true)
+	if err != nil || len(events) == 0 || events[0].Username != "alice" || events[0].Reason == "" {
+		t.Errorf("Expected the wrong confirmation to be audited, got %+v, %v", events, err)
+	}
+	if w := deleteUser("carol", "sha-pass"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected alice to be locked out after a wrong confirmation, got %d", w.Code)
+	}
+	if user, _ := server.users.Get("carol"); user == nil {
+		t.Error("Expected carol to survive the refused deletes")
+	}
+}
+
+// fetchCSRFToken gets a CSRF token and its cookie from the admin API
+func fetchCSRFToken(t *testing.T, server *Server) (*http.Cookie, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/admin/api/csrf", nil)
+	req.SetBasicAuth("testuser", "testpass")
+	w := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, req)
+
+	var response struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	cookies := w.Result().Cookies()
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil || response.Data.Token == "" || len(cookies) != 1 {
+		t.Fatalf("Failed to get a CSRF token: %d %v", w.Code, err)
+	}
+	return cookies[0], response.Data.Token
+}
+
+func TestServer_AdminCSRF(t *testing.T) {
+	cfg := &config.Config{
+		Port:    8080,
+		DataDir: t.TempDir(),
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+
+	page := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(page, httptest.NewRequest("GET", "/admin/", nil))
+	policy := page.Header().Get("Content-Security-Policy")
+	if !strings.Contains(policy, "frame-ancestors 'none'") || !strings.Contains(policy, "'nonce-") || strings.Contains(policy, "unsafe-eval") {
+		t.Errorf("Unexpected Content-Security-Policy %q", policy)
+	}
+	if page.Header().Get("X-Frame-Options") != "DENY" || page.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("Expected strict security headers, got %v", page.Header())
+	}
+	cookies := page.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "proxydav_csrf" || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("Expected a CSRF cookie with the page, got %v", cookies)
+	}
+	token := cookies[0].Value
+	if !strings.Contains(page.Body.String(), `<meta name="csrf-token" content="`+token+`">`) {
+		t.Error("Expected the page to carry the CSRF token")
+	}
+
+	server.vfs.AddFile("/a&b.txt", "https://example.com/a.txt")
+	list := httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(list, httptest.NewRequest("GET", "/admin/api/files", nil))
+	if !strings.Contains(list.Body.String(), `hx-delete="/admin/api/delete-file?path=%2Fa%26b.txt"`) {
+		t.Errorf("Expected the delete URL to be query-escaped, got %s", list.Body.String())
+	}
+	deleteFile := func(prepare func(*http.Request)) int {
+		req := httptest.NewRequest("DELETE", "/admin/api/delete-file?path="+url.QueryEscape("/a&b.txt"), nil)
+		req.AddCookie(cookies[0])
+		prepare(req)
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	refused := map[string]func(*http.Request){
+		"without a token":  func(*http.Request) {},
+		"with a bad token": func(r *http.Request) { r.Header.Set("X-CSRF-Token", "forged") },
+		"from another origin": func(r *http.Request) {
+			r.Header.Set("X-CSRF-Token", token)
+			r.Header.Set("Origin", "https://evil.example")
+		},
+		"from a sandboxed frame": func(r *http.Request) {
+			r.Header.Set("X-CSRF-Token", token)
+			r.Header.Set("Origin", "null")
+		},
+		"with a foreign referer": func(r *http.Request) {
+			r.Header.Set("X-CSRF-Token", token)
+			r.Header.Set("Referer", "https://evil.example/page")
+		},
+	}
+	for name, prepare := range refused {
+		if code := deleteFile(prepare); code != http.StatusForbidden {
+			t.Errorf("Expected a delete %s to be refused, got %d", name, code)
+		}
+	}
+	if !server.vfs.Exists("/a&b.txt") {
+		t.Fatal("Expected the file to survive refused deletes")
+	}
+
+	code := deleteFile(func(r *http.Request) {
+		r.Header.Set("X-CSRF-Token", token)
+		r.Header.Set("Origin", "http://example.com")
+	})
+	if code != http.StatusOK {
+		t.Errorf("Expected a same-origin delete with the token to succeed, got %d", code)
+	}
+	if server.vfs.Exists("/a&b.txt") {
+		t.Error("Expected the file with a query character in its name to be deleted")
+	}
+}
+
+func TestServer_ShareLinks(t *testing.T) {
+	cfg := &config.Config{
+		Port:             8080,
+		DataDir:          t.TempDir(),
+		AuthEnabled:      true,
+		AuthUser:         "testuser",
+		AuthPass:         "testpass",
+		LoginMaxFailures: 3,
+		LoginLockout:     time.Minute,
+		LoginMaxLockout:  time.Hour,
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+
+	content := &types.InlineContent{URL: "inline:hello", Data: []byte("hello")}
+	if err := server.store.SetInlineContent(content); err != nil {
+		t.Fatalf("Failed to store content: %v", err)
+	}
+	server.vfs.AddFile("/docs/a.txt", content.URL)
+	server.vfs.AddFile("/docs/sub/b.txt", content.URL)
+	server.vfs.AddFile("/private/c.txt", content.URL)
+
+	listed, err := server.shares.Create(auth.ShareRequest{Path: "/docs", Listing: true, MaxDownloads: 1}, "testuser")
+	if err != nil {
+		t.Fatalf("Failed to create share: %v", err)
+	}
+	protected, _ := server.shares.Create(auth.ShareRequest{Path: "/docs/a.txt", Password: "outsider-pass"}, "testuser")
+	unlisted, _ := server.shares.Create(auth.ShareRequest{Path: "/docs"}, "testuser")
+
+	request := func(method, target string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if prepare != nil {
+			prepare(req)
+		}
+		w := httptest.NewRecorder()
+		server.shareHandler.ServeHTTP(w, req)
+		return w
+	}
+	base := handlers.SharePrefix + listed.ID
+
+	w := request("PROPFIND", base+"/", nil)
+	if w.Code != http.StatusMultiStatus || !strings.Contains(w.Body.String(), "<href>"+base+"/a.txt</href>") || strings.Contains(w.Body.String(), "/docs") {
+		t.Errorf("Expected the listing to use share URLs, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("GET", base+"/", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="`+base+`/sub/"`) {
+		t.Errorf("Expected an index of the folder for browsers, got %d: %s", w.Code, w.Body.String())
+	}
+	resume := func(req *http.Request) { req.Header.Set("Range", "bytes=2-") }
+	if w := request("GET", base+"/a.txt", resume); w.Code == http.StatusGone {
+		t.Errorf("Expected a ranged request not to count as a download, got %d", w.Code)
+	}
+	if w := request("GET", base+"/a.txt", nil); w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("Expected the shared file, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := request("GET", base+"/sub/b.txt", nil); w.Code != http.StatusGone {
+		t.Errorf("Expected the download limit to be enforced, got %d", w.Code)
+	}
+	if w := request("GET", base+"/../private/c.txt", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected paths outside the share to be unreachable, got %d", w.Code)
+	}
+	if w := request("PUT", base+"/new.txt", nil); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected share links to be read-only, got %d", w.Code)
+	}
+
+	if w := request("GET", handlers.SharePrefix+protected.ID, nil); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a password to be required, got %d", w.Code)
+	}
+	w = request("GET", handlers.SharePrefix+protected.ID, func(r *http.Request) { r.SetBasicAuth("anyone", "outsider-pass") })
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("Expected the password to open the share, got %d", w.Code)
+	}
+
+	if w := request("PROPFIND", handlers.SharePrefix+unlisted.ID+"/", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected listing to be refused, got %d", w.Code)
+	}
+	if w := request("GET", handlers.SharePrefix+unlisted.ID+"/a.txt", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected files of an unlisted share to download, got %d", w.Code)
+	}
+
+	// Share links bypass account authentication on the main mux
+	w = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, httptest.NewRequest("GET", handlers.SharePrefix+unlisted.ID+"/a.txt", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected share links to need no account, got %d", w.Code)
+	}
+
+	// A virtual /share folder stays reachable over WebDAV
+	server.vfs.AddFile("/share/d.txt", content.URL)
+	req := httptest.NewRequest("GET", "/share/d.txt", nil)
+	req.SetBasicAuth("testuser", "testpass")
+	w = httptest.NewRecorder()
+	server.httpServer.Handler.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("Expected a virtual /share folder to be served over WebDAV, got %d", w.Code)
+	}
+
+	if err := server.shares.Revoke(unlisted.ID); err != nil {
+		t.Fatalf("Failed to revoke share: %v", err)
+	}
+	if w := request("GET", handlers.SharePrefix+unlisted.ID+"/a.txt", nil); w.Code != http.StatusNotFound {
+		t.Errorf("Expected a revoked share to be gone, got %d", w.Code)
+	}
+
+	// Guessing share passwords locks the share out
+	for i := 0; i < cfg.LoginMaxFailures; i++ {
+		request("GET", handlers.SharePrefix+protected.ID, func(r *http.Request) { r.SetBasicAuth("anyone", "guess") })
+	}
+	w = request("GET", handlers.SharePrefix+protected.ID, func(r *http.Request) { r.SetBasicAuth("anyone", "outsider-pass") })
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected wrong share passwords to lock the share out, got %d", w.Code)
+	}
+	if lockouts := server.lockouts.List(); len(lockouts) != 2 || lockouts[1].Kind != auth.LockoutShare {
+		t.Errorf("Expected the address and the share to be locked out, got %+v", lockouts)
+	}
+}
+
+func TestServer_LoginLockout(t *testing.T) {
+	cfg := &config.Config{
+		Port:             8080,
+		DataDir:          t.TempDir(),
+		AuthEnabled:      true,
+		AuthUser:         "testuser",
+		AuthPass:         "testpass",
+		LoginMaxFailures: 3,
+		LoginLockout:     time.Minute,
+		LoginMaxLockout:  time.Hour,
+		LoginAllowlist:   []string{"10.0.0.0/8"},
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+
+	request := func(method, target, remoteAddr, password string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = remoteAddr
+		req.SetBasicAuth("testuser", password)
+		if prepare != nil {
+			prepare(req)
+		}
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 3; i++ {
+		if w := request("PROPFIND", "/", "192.0.2.1:5000", "wrong", nil); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected failure %d to be unauthorized, got %d", i+1, w.Code)
+		}
+	}
+	w := request("PROPFIND", "/", "192.0.2.1:5000", "testpass", nil)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected the right password to be refused during the lockout, got %d with Retry-After %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	// The username is locked out from other addresses too, but not from the allowlist
+	if w := request("PROPFIND", "/", "198.51.100.7:5000", "testpass", nil); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the username to be locked out, got %d", w.Code)
+	}
+	if w := request("PROPFIND", "/", "10.0.0.5:5000", "testpass", nil); w.Code != http.StatusMultiStatus {
+		t.Fatalf("Expected an allowlisted address to sign in, got %d", w.Code)
+	}
+
+	page := request("GET", "/admin/logins", "10.0.0.5:5000", "testpass", nil)
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), `hx-get="/admin/api/lockouts"`) {
+		t.Fatalf("Expected the logins page, got %d", page.Code)
+	}
+	cookies := page.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a CSRF cookie with the page, got %v", cookies)
+	}
+
+	var lockouts struct {
+		Data []auth.Lockout `json:"data"`
+	}
+	w = request("GET", "/admin/api/lockouts", "10.0.0.5:5000", "testpass", nil)
+	// Signing in from the allowlist, where nothing failed, leaves the username's lockout alone
+	if err := json.Unmarshal(w.Body.Bytes(), &lockouts); err != nil || len(lockouts.Data) != 2 {
+		t.Fatalf("Expected the address and the username to be listed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var events struct {
+		Data []types.LoginEvent `json:"data"`
+	}
+	w = request("GET", "/admin/api/logins?failed=true", "10.0.0.5:5000", "testpass", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil {
+		t.Fatalf("Failed to decode login events: %v", err)
+	}
+	// Three failures and the lockout the last one started
+	if len(events.Data) != 4 || events.Data[0].ClientIP != "192.0.2.1" || !strings.HasPrefix(events.Data[0].Reason, "locked out for") {
+		t.Errorf("Unexpected failed logins %+v", events.Data)
+	}
+	w = request("GET", "/admin/api/logins?limit=1", "10.0.0.5:5000", "testpass", nil)
+	if err := json.Unmarshal(w.Body.Bytes(), &events); err != nil || len(events.Data) != 1 || !events.Data[0].Success || events.Data[0].Method != auth.MethodPassword {
+		t.Errorf("Expected the allowlisted login to be recorded last, got %+v", events.Data)
+	}
+
+	for _, lockout := range lockouts.Data {
+		w := request("DELETE", "/admin/api/lockouts/"+lockout.Key, "10.0.0.5:5000", "testpass", func(r *http.Request) {
+			r.AddCookie(cookies[0])
+			r.Header.Set("X-CSRF-Token", cookies[0].Value)
+		})
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected %s to be unlocked, got %d: %s", lockout.Key, w.Code, w.Body.String())
+		}
+	}
+	if w := request("PROPFIND", "/", "192.0.2.1:5000", "testpass", nil); w.Code != http.StatusMultiStatus {
+		t.Errorf("Expected the unlocked client to sign in, got %d", w.Code)
+	}
+}
+
+func TestServer_TLS(t *testing.T) {
+	dataDir := t.TempDir()
+
+	// A CA and a client certificate naming the admin account
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Clients CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create CA: %v", err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	caFile := filepath.Join(dataDir, "clients.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644); err != nil {
+		t.Fatalf("Failed to write CA: %v", err)
+	}
+	clientKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	clientDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "testuser"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("Failed to create client certificate: %v", err)
+	}
+
+	cfg := &config.Config{
+		Port:             8443,
+		DataDir:          dataDir,
+		AuthEnabled:      true,
+		AuthUser:         "testuser",
+		AuthPass:         "testpass",
+		TLSSelfSigned:    true,
+		TLSClientCA:      caFile,
+		HTTPRedirectAddr: ":8080",
+	}
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	if server.redirectServer == nil {
+		t.Fatal("Expected a redirect listener")
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	go server.httpServer.ServeTLS(listener, "", "")
+
+	serverCert, err := os.ReadFile(filepath.Join(dataDir, "tls", "selfsigned.crt"))
+	if err != nil {
+		t.Fatalf("Expected a self-signed certificate in the data directory: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(serverCert)
+	request := func(clientCert bool, prepare func(*http.Request)) *http.Response {
+		t.Helper()
+		tlsConfig := &tls.Config{RootCAs: roots}
+		if clientCert {
+			tlsConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		req, _ := http.NewRequest("PROPFIND", "https://"+listener.Addr().String()+"/", nil)
+		if prepare != nil {
+			prepare(req)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := request(true, nil); resp.StatusCode != http.StatusMultiStatus {
+		t.Errorf("Expected the client certificate to sign in, got %d", resp.StatusCode)
+	}
+	if resp := request(false, nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected a client without a certificate to need credentials, got %d", resp.StatusCode)
+	}
+	if resp := request(false, func(r *http.Request) { r.SetBasicAuth("testuser", "testpass") }); resp.StatusCode != http.StatusMultiStatus {
+		t.Errorf("Expected passwords to work without a certificate, got %d", resp.StatusCode)
+	}
+
+	w := httptest.NewRecorder()
+	server.redirectServer.Handler.ServeHTTP(w, httptest.NewRequest("PUT", "http://dav.example.com:8080/docs/a.txt?x=1", nil))
+	if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "https://dav.example.com:8443/docs/a.txt?x=1" {
+		t.Errorf("Expected a redirect to HTTPS, got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestServer_ReadOnlyAndMaintenance(t *testing.T) {
+	cfg := &config.Config{
+		Port:                  8080,
+		DataDir:               t.TempDir(),
+		MaintenanceRetryAfter: 5 * time.Minute,
+	}
+
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	defer server.Stop()
+	server.vfs.AddFile("/a.txt", "https://example.com/a.txt")
+
+	serve := func(method, target string, prepare func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		if prepare != nil {
+			prepare(req)
+		}
+		w := httptest.NewRecorder()
+		server.httpServer.Handler.ServeHTTP(w, req)
+		return w
+	}
+	page := serve("GET", "/admin/", nil)
+	cookies := page.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Expected a CSRF cookie with the page, got %v", cookies)
+	}
+	switchMode := func(form url.Values) *httptest.ResponseRecorder {
+		t.Helper()
+		w := serve("POST", "/admin/api/mode", func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.Header.Set("X-CSRF-Token", cookies[0].Value)
+			r.AddCookie(cookies[0])
+		})
+		if w.Code != http.StatusOK {
+			t.Fatalf("Failed to switch modes with %v: %d %s", form, w.Code, w.Body.String())
+		}
+		return w
+	}
+
+	switchMode(url.Values{"read_only": {"true"}})
+	if w := serve("DELETE", "/a.txt", nil); w.Code != http.StatusForbidden || !server.vfs.Exists("/a.txt") {
+		t.Errorf("Expected deletes to be refused in read-only mode, got %d", w.Code)
+	}
+	if w := serve("POST", "/api/files", nil); w.Code != http.StatusForbidden {
+		t.Errorf("Expected API changes to be refused in read-only mode, got %d", w.Code)
+	}
+	if w := serve("GET", "/api/files", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the API to keep listing files, got %d", w.Code)
+	}
+	if saved, err := config.LoadFromStore(server.store); err != nil || saved == nil || !saved.ReadOnly {
+		t.Errorf("Expected read-only mode to be saved, got %+v, %v", saved, err)
+	}
+
+	switchMode(url.Values{"maintenance": {"true"}, "maintenance_message": {"Moving to new storage"}, "maintenance_retry_after": {"90s"}})
+	w := serve("PROPFIND", "/", nil)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "90" || !strings.Contains(w.Body.String(), "Moving to new storage") {
+		t.Errorf("Expected 503 with the message in maintenance mode, got %d with Retry-After %q: %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	if w := serve("GET", "/api/health", nil); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"mode":"maintenance"`) {
+		t.Errorf("Expected health checks to report maintenance, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := serve("GET", "/admin/", nil); w.Code != http.StatusOK {
+		t.Errorf("Expected the admin panel to stay reachable, got %d", w.Code)
+	}
+	w = serve("POST", "/admin/api/files", func(r *http.Request) {
+		r.Body = io.NopCloser(strings.NewReader(url.Values{"path": {"/b.txt"}, "url": {"https://example.com/b.txt"}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-CSRF-Token", cookies[0].Value)
+		r.AddCookie(cookies[0])
+	})
+	if w.Code != http.StatusServiceUnavailable || server.vfs.Exists("/b.txt") {
+		t.Errorf("Expected the admin panel's file changes to be refused in maintenance mode, got %d", w.Code)
+	}
+
+	var mode struct {
+		Data handlers.ModeResponse `json:"data"`
+	}
+	if err := json.Unmarshal(serve("GET", "/admin/api/mode", nil).Body.Bytes(), &mode); err != nil || !mode.Data.ReadOnly || !mode.Data.Maintenance || mode.Data.MaintenanceRetryAfter != "1m30s" {
+		t.Errorf("Unexpected mode %+v, %v", mode.Data, err)
+	}
+
+	switchMode(url.Values{"maintenance": {"false"}, "read_only": {"false"}})
+	if w := serve("DELETE", "/a.txt", nil); w.Code != http.StatusNoContent || server.vfs.Exists("/a.txt") {
+		t.Errorf("Expected deletes to work again, got %d", w.Code)
+	}
+
+	// The configuration form keeps the modes it does not show
+	switchMode(url.Values{"read_only": {"true"}})
+	w = serve("POST", "/admin/api/config", func(r *http.Request) {
+		r.Body = io.NopCloser(strings.NewReader(url.Values{"port": {"8080"}, "data_dir": {cfg.DataDir}}.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-CSRF-Token", cookies[0].Value)
+		r.AddCookie(cookies[0])
+	})
+	if w.Code != http.StatusOK || !server.GetConfig().ReadOnly {
+		t.Errorf("Expected saving the configuration to keep read-only mode, got %d: %s", w.Code, w.Body.String())
+	}
+}
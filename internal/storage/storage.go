@@ -158,6 +158,674 @@ func (s *PersistentStore) DeleteFileMetadata(url string) error {
 	})
 }
 
+func (s *PersistentStore) GetLinkHealth(url string) (*types.LinkHealth, error) {
+	var health *types.LinkHealth
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("health:" + url)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			health = &types.LinkHealth{}
+			return json.Unmarshal(val, health)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link health: %w", err)
+	}
+
+	return health, nil
+}
+
+func (s *PersistentStore) SetLinkHealth(health *types.LinkHealth) error {
+	data, err := json.Marshal(health)
+	if err != nil {
+		return fmt.Errorf("failed to marshal link health: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("health:" + health.URL)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteLinkHealth(url string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("health:" + url)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetQuarantine(path string) (*types.Quarantine, error) {
+	var quarantine *types.Quarantine
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("quarantine:" + path)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			quarantine = &types.Quarantine{}
+			return json.Unmarshal(val, quarantine)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quarantine: %w", err)
+	}
+
+	return quarantine, nil
+}
+
+func (s *PersistentStore) SetQuarantine(quarantine *types.Quarantine) error {
+	data, err := json.Marshal(quarantine)
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("quarantine:" + quarantine.Path)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteQuarantine(path string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("quarantine:" + path)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetAllQuarantines() ([]types.Quarantine, error) {
+	var quarantines []types.Quarantine
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("quarantine:")
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			err := iter.Item().Value(func(val []byte) error {
+				var quarantine types.Quarantine
+				if err := json.Unmarshal(val, &quarantine); err != nil {
+					return err
+				}
+				quarantines = append(quarantines, quarantine)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all quarantines: %w", err)
+	}
+
+	return quarantines, nil
+}
+
+func (s *PersistentStore) GetArchiveIndex(url string) (*types.ArchiveIndex, error) {
+	var index *types.ArchiveIndex
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("archive:" + url)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			index = &types.ArchiveIndex{}
+			return json.Unmarshal(val, index)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get archive index: %w", err)
+	}
+
+	return index, nil
+}
+
+func (s *PersistentStore) SetArchiveIndex(index *types.ArchiveIndex) error {
+	data, err := json.Marshal(index)
+	if err != nil {
+		return fmt.Errorf("failed to marshal archive index: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("archive:" + index.URL)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteArchiveIndex(url string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("archive:" + url)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetInlineContent(url string) (*types.InlineContent, error) {
+	var content *types.InlineContent
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("content:" + url)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			content = &types.InlineContent{}
+			return json.Unmarshal(val, content)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inline content: %w", err)
+	}
+
+	return content, nil
+}
+
+func (s *PersistentStore) SetInlineContent(content *types.InlineContent) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return fmt.Errorf("failed to marshal inline content: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("content:" + content.URL)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteInlineContent(url string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("content:" + url)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetUser(username string) (*types.User, error) {
+	var user *types.User
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("user:" + username)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			user = &types.User{}
+			return json.Unmarshal(val, user)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *PersistentStore) SetUser(user *types.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("user:" + user.Username)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteUser(username string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("user:" + username)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetAllUsers() ([]types.User, error) {
+	var users []types.User
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("user:")
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			err := iter.Item().Value(func(val []byte) error {
+				var user types.User
+				if err := json.Unmarshal(val, &user); err != nil {
+					return err
+				}
+				users = append(users, user)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all users: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *PersistentStore) GetAPIToken(id string) (*types.APIToken, error) {
+	var token *types.APIToken
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("token:" + id)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			token = &types.APIToken{}
+			return json.Unmarshal(val, token)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *PersistentStore) SetAPIToken(token *types.APIToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal API token: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("token:" + token.ID)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteAPIToken(id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("token:" + id)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetAllAPITokens() ([]types.APIToken, error) {
+	var tokens []types.APIToken
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("token:")
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			err := iter.Item().Value(func(val []byte) error {
+				var token types.APIToken
+				if err := json.Unmarshal(val, &token); err != nil {
+					return err
+				}
+				tokens = append(tokens, token)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all API tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *PersistentStore) GetAppPassword(id string) (*types.AppPassword, error) {
+	var appPassword *types.AppPassword
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("apppassword:" + id)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			appPassword = &types.AppPassword{}
+			return json.Unmarshal(val, appPassword)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get app password: %w", err)
+	}
+
+	return appPassword, nil
+}
+
+func (s *PersistentStore) SetAppPassword(appPassword *types.AppPassword) error {
+	data, err := json.Marshal(appPassword)
+	if err != nil {
+		return fmt.Errorf("failed to marshal app password: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("apppassword:" + appPassword.ID)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteAppPassword(id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("apppassword:" + id)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetAllAppPasswords() ([]types.AppPassword, error) {
+	var appPasswords []types.AppPassword
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("apppassword:")
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			err := iter.Item().Value(func(val []byte) error {
+				var appPassword types.AppPassword
+				if err := json.Unmarshal(val, &appPassword); err != nil {
+					return err
+				}
+				appPasswords = append(appPasswords, appPassword)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all app passwords: %w", err)
+	}
+
+	return appPasswords, nil
+}
+
+func (s *PersistentStore) GetShare(id string) (*types.Share, error) {
+	var share *types.Share
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		key := []byte("share:" + id)
+		item, err := txn.Get(key)
+		if err != nil {
+			return err
+		}
+
+		return item.Value(func(val []byte) error {
+			share = &types.Share{}
+			return json.Unmarshal(val, share)
+		})
+	})
+
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share: %w", err)
+	}
+
+	return share, nil
+}
+
+func (s *PersistentStore) SetShare(share *types.Share) error {
+	data, err := json.Marshal(share)
+	if err != nil {
+		return fmt.Errorf("failed to marshal share: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("share:" + share.ID)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteShare(id string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("share:" + id)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetAllShares() ([]types.Share, error) {
+	var shares []types.Share
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("share:")
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			err := iter.Item().Value(func(val []byte) error {
+				var share types.Share
+				if err := json.Unmarshal(val, &share); err != nil {
+					return err
+				}
+				shares = append(shares, share)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all shares: %w", err)
+	}
+
+	return shares, nil
+}
+
+func (s *PersistentStore) AddLoginEvent(event *types.LoginEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal login event: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("login:" + event.ID)
+		return txn.Set(key, data)
+	})
+}
+
+// GetLoginEvents returns up to limit login events, newest first
+func (s *PersistentStore) GetLoginEvents(limit int) ([]types.LoginEvent, error) {
+	var events []types.LoginEvent
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		opts.Reverse = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("login:")
+		// Reverse iteration starts at the last key before the seek key
+		for iter.Seek([]byte("login;")); iter.ValidForPrefix(prefix) && len(events) < limit; iter.Next() {
+			err := iter.Item().Value(func(val []byte) error {
+				var event types.LoginEvent
+				if err := json.Unmarshal(val, &event); err != nil {
+					return err
+				}
+				events = append(events, event)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login events: %w", err)
+	}
+
+	return events, nil
+}
+
+// PruneLoginEvents deletes all but the newest keep login events
+func (s *PersistentStore) PruneLoginEvents(keep int) error {
+	var stale [][]byte
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		opts.Reverse = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("login:")
+		seen := 0
+		for iter.Seek([]byte("login;")); iter.ValidForPrefix(prefix); iter.Next() {
+			if seen++; seen > keep {
+				stale = append(stale, iter.Item().KeyCopy(nil))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to prune login events: %w", err)
+	}
+
+	// Large deletions are split so no transaction grows too big
+	for len(stale) > 0 {
+		batch := stale[:min(len(stale), 1000)]
+		stale = stale[len(batch):]
+		err := s.db.Update(func(txn *badger.Txn) error {
+			for _, key := range batch {
+				if err := txn.Delete(key); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to prune login events: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *PersistentStore) SetACL(acl *types.ACL) error {
+	data, err := json.Marshal(acl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ACL: %w", err)
+	}
+
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("acl:" + acl.Path)
+		return txn.Set(key, data)
+	})
+}
+
+func (s *PersistentStore) DeleteACL(path string) error {
+	return s.db.Update(func(txn *badger.Txn) error {
+		key := []byte("acl:" + path)
+		return txn.Delete(key)
+	})
+}
+
+func (s *PersistentStore) GetAllACLs() ([]types.ACL, error) {
+	var acls []types.ACL
+
+	err := s.db.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = true
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		prefix := []byte("acl:")
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			err := iter.Item().Value(func(val []byte) error {
+				var acl types.ACL
+				if err := json.Unmarshal(val, &acl); err != nil {
+					return err
+				}
+				acls = append(acls, acl)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get all ACLs: %w", err)
+	}
+
+	return acls, nil
+}
+
 func (s *PersistentStore) CountFileEntries() (int, error) {
 	count := 0
 
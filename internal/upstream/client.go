@@ -0,0 +1,108 @@
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxRedirects matches the default limit of net/http
+const maxRedirects = 10
+
+// NewClient creates the HTTP client shared by all upstream requests.
+// Every connection is dialed through the policy, so hosts are re-checked
+// after each redirect and every resolved address is validated before use.
+// Outbound proxies are chosen per request by router.
+func NewClient(policy *Policy, router *Router, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = router.Proxy
+	transport.DialContext = policyDialer(policy, dialer)
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &policyTransport{policy: policy, router: router, next: transport},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return policy.CheckHost(req.URL.Hostname())
+		},
+	}
+}
+
+// policyDialer resolves the target host through the policy and dials only
+// the addresses it approved, which prevents DNS rebinding between the check
+// and the connection. A connection to the outbound proxy its request was
+// routed through is exempt, since proxies commonly live on private networks;
+// any other connection to the same address is not.
+func policyDialer(policy *Policy, dialer *net.Dialer) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if isRoutedProxy(ctx, addr) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		ips, err := policy.Resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastErr error
+		for _, ip := range ips {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+			lastErr = err
+		}
+		return nil, lastErr
+	}
+}
+
+// policyTransport rejects requests to blocked hosts before reusing any
+// pooled connection, so runtime policy changes take effect immediately.
+// Proxied requests are never dialed by us, so their target is resolved
+// locally and checked here instead, and the request is marked with the
+// proxy the dialer may connect to for it.
+type policyTransport struct {
+	policy *Policy
+	router *Router
+	next   http.RoundTripper
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	err := t.policy.CheckHost(req.URL.Hostname())
+	if err == nil {
+		var proxyURL *url.URL
+		if proxyURL, err = t.router.Proxy(req); err == nil && proxyURL != nil {
+			err = t.policy.CheckURL(req.Context(), req.URL.String())
+			req = req.WithContext(withRoutedProxy(req.Context(), proxyURL))
+		}
+	}
+	if err != nil {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
+
+// IsPolicyError reports whether err was caused by the upstream policy
+func IsPolicyError(err error) bool {
+	var policyErr *PolicyError
+	return errors.As(err, &policyErr)
+}
@@ -0,0 +1,267 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PolicyError describes an upstream destination rejected by the policy
+type PolicyError struct {
+	Host   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("upstream destination %s blocked: %s", e.Host, e.Reason)
+}
+
+// Policy decides which upstream hosts and addresses the server may contact.
+// It is safe for concurrent use and can be updated at runtime.
+type Policy struct {
+	mutex        sync.RWMutex
+	allowHosts   []string
+	allowNets    []*net.IPNet
+	denyHosts    []string
+	denyNets     []*net.IPNet
+	allowPrivate bool
+	resolver     *net.Resolver
+}
+
+// blockedNets are ranges that are never reachable unless explicitly allowed
+var blockedNets = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// NewPolicy creates a policy from host patterns and CIDRs.
+// Allow and deny entries may be exact hosts, "*.example.com" wildcards or CIDR ranges.
+func NewPolicy(allow, deny []string, allowPrivate bool) (*Policy, error) {
+	p := &Policy{resolver: net.DefaultResolver}
+	if err := p.Update(allow, deny, allowPrivate); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Update replaces the policy rules
+func (p *Policy) Update(allow, deny []string, allowPrivate bool) error {
+	allowHosts, allowNets, err := parseRules(allow)
+	if err != nil {
+		return fmt.Errorf("invalid upstream allow rule: %w", err)
+	}
+	denyHosts, denyNets, err := parseRules(deny)
+	if err != nil {
+		return fmt.Errorf("invalid upstream deny rule: %w", err)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.allowHosts = allowHosts
+	p.allowNets = allowNets
+	p.denyHosts = denyHosts
+	p.denyNets = denyNets
+	p.allowPrivate = allowPrivate
+	return nil
+}
+
+func parseRules(rules []string) ([]string, []*net.IPNet, error) {
+	var hosts []string
+	var nets []*net.IPNet
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+		if strings.Contains(rule, "/") {
+			_, n, err := net.ParseCIDR(rule)
+			if err != nil {
+				return nil, nil, err
+			}
+			nets = append(nets, n)
+			continue
+		}
+		if ip := net.ParseIP(rule); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		hosts = append(hosts, rule)
+	}
+	return hosts, nets, nil
+}
+
+func matchHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if pattern == host {
+			return true
+		}
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckHost validates a hostname or IP literal against the allow and deny lists
+func (p *Policy) CheckHost(host string) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	ip := net.ParseIP(host)
+	if matchHost(p.denyHosts, host) || (ip != nil && matchIP(p.denyNets, ip)) {
+		return &PolicyError{Host: host, Reason: "host is on the deny list"}
+	}
+
+	if len(p.allowHosts) == 0 && len(p.allowNets) == 0 {
+		return nil
+	}
+	if matchHost(p.allowHosts, host) || (ip != nil && matchIP(p.allowNets, ip)) {
+		return nil
+	}
+	// Hostnames may still be allowed by a CIDR rule once resolved
+	if ip == nil && len(p.allowNets) > 0 {
+		return nil
+	}
+	return &PolicyError{Host: host, Reason: "host is not on the allow list"}
+}
+
+// CheckIP validates an address that host resolved to
+func (p *Policy) CheckIP(host string, ip net.IP) error {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	if matchIP(p.denyNets, ip) {
+		return &PolicyError{Host: host, Reason: fmt.Sprintf("address %s is on the deny list", ip)}
+	}
+	hostAllowed := matchHost(p.allowHosts, host)
+	ipAllowed := matchIP(p.allowNets, ip)
+	if (len(p.allowHosts) > 0 || len(p.allowNets) > 0) && !hostAllowed && !ipAllowed {
+		return &PolicyError{Host: host, Reason: fmt.Sprintf("address %s is not on the allow list", ip)}
+	}
+	// An allowed hostname may still resolve to an internal address, so only
+	// an allowed address exempts the blocked ranges
+	if !p.allowPrivate && !ipAllowed && matchIP(blockedNets, ip) {
+		return &PolicyError{Host: host, Reason: fmt.Sprintf("address %s is in a private, loopback or link-local range", ip)}
+	}
+	return nil
+}
+
+// CheckURL validates a URL, resolving its host to verify every address.
+// Resolution failures are not treated as violations; the dialer enforces the
+// policy again when a connection is actually made.
+func (p *Policy) CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("url must be a valid HTTP or HTTPS URL")
+	}
+	host := u.Hostname()
+	if host == "" {
+		return fmt.Errorf("url must include a host")
+	}
+	if err := p.CheckHost(host); err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		return p.CheckIP(host, ip)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := p.CheckIP(host, addr.IP); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Resolve looks up host and returns only the addresses permitted by the policy
+func (p *Policy) Resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if err := p.CheckHost(host); err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		if err := p.CheckIP(host, ip); err != nil {
+			return nil, err
+		}
+		return []net.IP{ip}, nil
+	}
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	var firstErr error
+	for _, addr := range addrs {
+		if err := p.CheckIP(host, addr.IP); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		ips = append(ips, addr.IP)
+	}
+	if len(ips) == 0 {
+		if firstErr == nil {
+			firstErr = fmt.Errorf("no addresses found for %s", host)
+		}
+		return nil, firstErr
+	}
+	return ips, nil
+}
@@ -0,0 +1,140 @@
+package upstream
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicy_CheckIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		allow        []string
+		deny         []string
+		allowPrivate bool
+		host         string
+		ip           string
+		wantErr      bool
+	}{
+		{name: "public address", host: "example.com", ip: "93.184.216.34"},
+		{name: "metadata service", host: "169.254.169.254", ip: "169.254.169.254", wantErr: true},
+		{name: "loopback", host: "localhost", ip: "127.0.0.1", wantErr: true},
+		{name: "private range", host: "intranet", ip: "10.1.2.3", wantErr: true},
+		{name: "ipv6 loopback", host: "localhost", ip: "::1", wantErr: true},
+		{name: "private allowed", allowPrivate: true, host: "intranet", ip: "10.1.2.3"},
+		{name: "private allowed by cidr", allow: []string{"10.0.0.0/8"}, host: "intranet", ip: "10.1.2.3"},
+		{name: "denied cidr", deny: []string{"93.184.0.0/16"}, host: "example.com", ip: "93.184.216.34", wantErr: true},
+		{name: "not on allow list", allow: []string{"cdn.example.com"}, host: "other.com", ip: "93.184.216.34", wantErr: true},
+		{name: "wildcard allow", allow: []string{"*.example.com"}, host: "cdn.example.com", ip: "93.184.216.34"},
+		{name: "allowed wildcard resolving to loopback", allow: []string{"*.example.com"}, host: "rebind.example.com", ip: "127.0.0.1", wantErr: true},
+		{name: "allowed host resolving to metadata service", allow: []string{"cdn.example.com"}, host: "cdn.example.com", ip: "169.254.169.254", wantErr: true},
+		{name: "allowed host with allowed private cidr", allow: []string{"*.example.com", "10.0.0.0/8"}, host: "intranet.example.com", ip: "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := NewPolicy(tt.allow, tt.deny, tt.allowPrivate)
+			if err != nil {
+				t.Fatalf("Failed to create policy: %v", err)
+			}
+			err = policy.CheckIP(tt.host, net.ParseIP(tt.ip))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckIP(%s, %s) error = %v, wantErr %v", tt.host, tt.ip, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicy_CheckURL(t *testing.T) {
+	policy, err := NewPolicy(nil, []string{"*.blocked.example"}, false)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: "ftp://example.com/file", wantErr: true},
+		{url: "http://169.254.169.254/latest/meta-data/", wantErr: true},
+		{url: "http://[::1]:8080/", wantErr: true},
+		{url: "https://files.blocked.example/a.zip", wantErr: true},
+		{url: "https://93.184.216.34/file.pdf", wantErr: false},
+	}
+
+	for _, tt := range tests {
+		err := policy.CheckURL(context.Background(), tt.url)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckURL(%s) error = %v, wantErr %v", tt.url, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPolicy_InvalidRule(t *testing.T) {
+	if _, err := NewPolicy([]string{"10.0.0.0/99"}, nil, false); err == nil {
+		t.Error("Expected error for invalid CIDR rule")
+	}
+}
+
+func TestClient_BlocksPrivateDestinations(t *testing.T) {
+	upstreamServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer upstreamServer.Close()
+
+	policy, err := NewPolicy(nil, nil, false)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	client := NewClient(policy, &Router{}, 5*time.Second)
+
+	_, err = client.Get(upstreamServer.URL)
+	if !IsPolicyError(err) {
+		t.Fatalf("Expected policy error for loopback upstream, got %v", err)
+	}
+
+	// Allowing a hostname does not allow the internal addresses it resolves to
+	if err := policy.Update([]string{"localhost"}, nil, false); err != nil {
+		t.Fatalf("Failed to update policy: %v", err)
+	}
+	_, err = client.Get(strings.Replace(upstreamServer.URL, "127.0.0.1", "localhost", 1))
+	if !IsPolicyError(err) {
+		t.Fatalf("Expected policy error for an allowed host resolving to loopback, got %v", err)
+	}
+
+	if err := policy.Update(nil, nil, true); err != nil {
+		t.Fatalf("Failed to update policy: %v", err)
+	}
+	resp, err := client.Get(upstreamServer.URL)
+	if err != nil {
+		t.Fatalf("Expected request to succeed once private ranges are allowed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestClient_RechecksRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer target.Close()
+
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://localhost:"+target.URL[len("http://127.0.0.1:"):], http.StatusFound)
+	}))
+	defer redirector.Close()
+
+	policy, err := NewPolicy(nil, []string{"localhost"}, true)
+	if err != nil {
+		t.Fatalf("Failed to create policy: %v", err)
+	}
+	client := NewClient(policy, &Router{}, 5*time.Second)
+
+	_, err = client.Get(redirector.URL)
+	if !IsPolicyError(err) {
+		t.Fatalf("Expected redirect to denied host to be blocked, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// ProxyRule routes upstream requests matching Match through Proxy.
+// Match is a host ("cdn.example.com"), a host wildcard ("*.example.com"),
+// a virtual path prefix ("/mirrors/") or "*" for every request.
+// A nil Proxy means the request is sent directly.
+type ProxyRule struct {
+	Match string
+	Proxy *url.URL
+}
+
+// ParseProxyRules parses rules written as "match=proxy", where proxy is an
+// http://, https:// or socks5:// URL (optionally with credentials) or "direct"
+func ParseProxyRules(specs []string) ([]ProxyRule, error) {
+	rules := make([]ProxyRule, 0, len(specs))
+	for _, spec := range specs {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		match, target, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("proxy rule %q must be in the form match=proxy", spec)
+		}
+		match = strings.TrimSpace(match)
+		target = strings.TrimSpace(target)
+		if match == "" {
+			return nil, fmt.Errorf("proxy rule %q has an empty match", spec)
+		}
+		if !strings.HasPrefix(match, "/") {
+			match = strings.ToLower(match)
+		}
+
+		rule := ProxyRule{Match: match}
+		if target != "direct" {
+			proxyURL, err := url.Parse(target)
+			if err != nil {
+				return nil, fmt.Errorf("proxy rule %q has an invalid proxy URL: %w", spec, err)
+			}
+			switch proxyURL.Scheme {
+			case "http", "https", "socks5":
+			default:
+				return nil, fmt.Errorf("proxy rule %q uses unsupported scheme %q", spec, proxyURL.Scheme)
+			}
+			if proxyURL.Host == "" {
+				return nil, fmt.Errorf("proxy rule %q is missing the proxy host", spec)
+			}
+			rule.Proxy = proxyURL
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// Router selects the outbound proxy for each upstream request.
+// Rules are evaluated in order and the first match wins; requests that
+// match no rule fall back to the HTTP_PROXY/HTTPS_PROXY environment.
+type Router struct {
+	mutex sync.RWMutex
+	rules []ProxyRule
+}
+
+// NewRouter creates a proxy router from rule specs
+func NewRouter(specs []string) (*Router, error) {
+	r := &Router{}
+	if err := r.Update(specs); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Update replaces the routing rules
+func (r *Router) Update(specs []string) error {
+	rules, err := ParseProxyRules(specs)
+	if err != nil {
+		return err
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.rules = rules
+	return nil
+}
+
+type virtualPathKey struct{}
+
+// WithVirtualPath annotates ctx with the virtual path an upstream request is made for
+func WithVirtualPath(ctx context.Context, virtualPath string) context.Context {
+	return context.WithValue(ctx, virtualPathKey{}, virtualPath)
+}
+
+// VirtualPath returns the virtual path stored by WithVirtualPath
+func VirtualPath(ctx context.Context) string {
+	virtualPath, _ := ctx.Value(virtualPathKey{}).(string)
+	return virtualPath
+}
+
+// match returns the rule for a request, or false when no rule applies
+func (r *Router) match(req *http.Request) (ProxyRule, bool) {
+	host := strings.ToLower(req.URL.Hostname())
+	virtualPath := VirtualPath(req.Context())
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for _, rule := range r.rules {
+		switch {
+		case rule.Match == "*":
+			return rule, true
+		case strings.HasPrefix(rule.Match, "/"):
+			if virtualPath != "" && (virtualPath == strings.TrimSuffix(rule.Match, "/") || strings.HasPrefix(virtualPath, strings.TrimSuffix(rule.Match, "/")+"/")) {
+				return rule, true
+			}
+		case matchHost([]string{rule.Match}, host):
+			return rule, true
+		}
+	}
+	return ProxyRule{}, false
+}
+
+// Proxy is used as http.Transport.Proxy
+func (r *Router) Proxy(req *http.Request) (*url.URL, error) {
+	if rule, ok := r.match(req); ok {
+		return rule.Proxy, nil
+	}
+	return http.ProxyFromEnvironment(req)
+}
+
+type routedProxyKey struct{}
+
+// withRoutedProxy annotates ctx with the host:port of the proxy a request
+// is routed through, which its connection is then allowed to dial
+func withRoutedProxy(ctx context.Context, proxyURL *url.URL) context.Context {
+	return context.WithValue(ctx, routedProxyKey{}, proxyAddr(proxyURL))
+}
+
+// isRoutedProxy reports whether addr is the proxy stored by withRoutedProxy
+func isRoutedProxy(ctx context.Context, addr string) bool {
+	routed, _ := ctx.Value(routedProxyKey{}).(string)
+	return routed != "" && routed == strings.ToLower(addr)
+}
+
+func proxyAddr(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		switch proxyURL.Scheme {
+		case "https":
+			port = "443"
+		case "socks5":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return strings.ToLower(net.JoinHostPort(proxyURL.Hostname(), port))
+}
@@ -31,6 +31,39 @@ type Prop struct {
 	LastModified  string        `xml:"getlastmodified,omitempty"`
 	CreationDate  string        `xml:"creationdate,omitempty"`
 	ETag          string        `xml:"getetag,omitempty"`
+	LinkStatus    string        `xml:"urn:proxydav linkstatus,omitempty"`
+	Checksums     *Checksums    `xml:"urn:proxydav checksums,omitempty"`
+	Integrity     string        `xml:"urn:proxydav integrity,omitempty"`
+
+	CurrentUserPrivilegeSet *PrivilegeSet `xml:"current-user-privilege-set,omitempty"`
+}
+
+// PrivilegeSet lists RFC 3744 privileges, such as those of the current user
+type PrivilegeSet struct {
+	Privileges []Privilege `xml:"DAV: privilege"`
+}
+
+// Privilege wraps one privilege element, such as <D:read/>
+type Privilege struct {
+	Name PrivilegeName
+}
+
+type PrivilegeName struct {
+	XMLName xml.Name
+}
+
+// Privileges builds a privilege set from DAV: privilege names
+func Privileges(names ...string) *PrivilegeSet {
+	set := &PrivilegeSet{}
+	for _, name := range names {
+		set.Privileges = append(set.Privileges, Privilege{Name: PrivilegeName{XMLName: xml.Name{Space: "DAV:", Local: name}}})
+	}
+	return set
+}
+
+// Checksums lists expected content checksums as "ALGO:hex" values
+type Checksums struct {
+	Checksum []string `xml:"urn:proxydav checksum"`
 }
 
 type ResourceType struct {
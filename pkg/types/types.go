@@ -1,21 +1,245 @@
 package types
 
-import "time"
+import (
+	"strings"
+	"time"
+)
+
+// Entry kinds
+const (
+	EntryKindFile   = ""       // a single remote file
+	EntryKindZip    = "zip"    // a remote ZIP archive mounted as a directory
+	EntryKindConcat = "concat" // remote parts joined in order into one file
+	EntryKindSlice  = "slice"  // a byte range of one remote file
+)
 
 type FileEntry struct {
-	Path string `json:"path"`
-	URL  string `json:"url"`
+	Path      string            `json:"path"`
+	URL       string            `json:"url"`
+	Kind      string            `json:"kind,omitempty"`
+	Parts     []string          `json:"parts,omitempty"`  // concat: part URLs in order
+	Offset    int64             `json:"offset,omitempty"` // slice: first byte
+	Length    int64             `json:"length,omitempty"` // slice: number of bytes
+	Checksums map[string]string `json:"checksums,omitempty"`
+	Integrity *Integrity        `json:"integrity,omitempty"`
+}
+
+// URLs returns every upstream URL the entry reads from
+func (e *FileEntry) URLs() []string {
+	if e.Kind == EntryKindConcat {
+		return e.Parts
+	}
+	if e.URL == "" {
+		return nil
+	}
+	return []string{e.URL}
+}
+
+// RemoteURLs returns the entry's URLs that are fetched over HTTP, leaving
+// out local files and inline content
+func (e *FileEntry) RemoteURLs() []string {
+	var remote []string
+	for _, fileURL := range e.URLs() {
+		if IsRemoteURL(fileURL) {
+			remote = append(remote, fileURL)
+		}
+	}
+	return remote
+}
+
+// IsRemoteURL reports whether fileURL is fetched over HTTP or HTTPS
+func IsRemoteURL(fileURL string) bool {
+	return strings.HasPrefix(fileURL, "http://") || strings.HasPrefix(fileURL, "https://")
+}
+
+// InlineContent is the stored content of an inline entry
+type InlineContent struct {
+	URL     string    `json:"url"`
+	Data    []byte    `json:"data"`
+	Created time.Time `json:"created"`
+}
+
+// Account roles, from least to most privileged
+const (
+	RoleReader = "reader" // browse and download
+	RoleEditor = "editor" // also add, change and remove entries
+	RoleAdmin  = "admin"  // also use the admin panel and manage accounts
+)
+
+// User is an account that can sign in. Only a bcrypt hash of the password is kept.
+type User struct {
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"password_hash"`
+	Role         string    `json:"role"`
+	Groups       []string  `json:"groups,omitempty"`
+	Disabled     bool      `json:"disabled"`
+	Created      time.Time `json:"created"`
+	LastLogin    time.Time `json:"last_login"`
+}
+
+// API token scopes
+const (
+	ScopeRead   = "read"   // browse and download
+	ScopeAdd    = "add"    // add, replace and copy files
+	ScopeDelete = "delete" // delete files; moving needs add as well
+	ScopeAdmin  = "admin"  // everything, including the admin panel
+)
+
+// APIToken lets automation authenticate with "Authorization: Bearer".
+// Only a SHA-256 hash of its secret is kept.
+type APIToken struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Hash       string    `json:"hash"`
+	PathPrefix string    `json:"path_prefix"`
+	Scopes     []string  `json:"scopes"`
+	CreatedBy  string    `json:"created_by,omitempty"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires,omitempty"`
+	LastUsed   time.Time `json:"last_used,omitempty"`
+}
+
+// AppPassword lets WebDAV clients that only speak Basic auth sign in as an
+// account, or as a single sign-on user without one. Only a SHA-256 hash of
+// its secret is kept.
+type AppPassword struct {
+	ID       string    `json:"id"`
+	Username string    `json:"username"`
+	Name     string    `json:"name"`
+	Hash     string    `json:"hash"`
+	Local    bool      `json:"local"`          // belongs to an account, whose current role and groups apply
+	Role     string    `json:"role,omitempty"` // role and groups of a single sign-on user when it was created
+	Groups   []string  `json:"groups,omitempty"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"last_used,omitempty"`
+}
+
+// Share is a public link that gives anyone with its URL read access to one
+// file or folder. Its ID is the secret part of the URL.
+type Share struct {
+	ID           string    `json:"id"`
+	Path         string    `json:"path"`
+	PasswordHash string    `json:"password_hash,omitempty"`
+	Listing      bool      `json:"listing"`       // folders can be listed, not only downloaded from
+	MaxDownloads int       `json:"max_downloads"` // 0 for no limit
+	Downloads    int       `json:"downloads"`
+	Accesses     int       `json:"accesses"`
+	CreatedBy    string    `json:"created_by,omitempty"`
+	Created      time.Time `json:"created"`
+	Expires      time.Time `json:"expires,omitempty"`
+	LastAccess   time.Time `json:"last_access,omitempty"`
+}
+
+// LoginEvent is an entry of the login audit trail: a failed or successful
+// authentication, or the start of a lockout
+type LoginEvent struct {
+	ID        string    `json:"id"` // sorts by time
+	Time      time.Time `json:"time"`
+	Username  string    `json:"username,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	Method    string    `json:"method,omitempty"` // authentication method of successful logins
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason,omitempty"` // why a login failed
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// ACL permissions, from least to most access
+const (
+	PermissionHidden = "hidden" // neither listed nor accessible
+	PermissionRead   = "read"   // browse and download
+	PermissionWrite  = "write"  // also add, move, copy and delete
+)
+
+// ACLRule grants a permission to a principal: a username, "@group" or "*" for everyone
+type ACLRule struct {
+	Principal  string `json:"principal"`
+	Permission string `json:"permission"`
+}
+
+// ACL is the list of rules attached to a virtual path. It applies to the
+// whole subtree, except where a deeper ACL has a rule for the same user.
+type ACL struct {
+	Path    string    `json:"path"`
+	Rules   []ACLRule `json:"rules"`
+	Updated time.Time `json:"updated"`
+}
+
+// Integrity states recorded by streaming verification
+const (
+	IntegrityVerified = "verified"
+	IntegrityMismatch = "mismatch"
+)
+
+// Integrity is the outcome of the last verification of an entry's content
+type Integrity struct {
+	Status    string            `json:"status"`
+	CheckedAt time.Time         `json:"checked_at"`
+	Expected  map[string]string `json:"expected,omitempty"`
+	Actual    map[string]string `json:"actual,omitempty"`
 }
 
 type FileMetadata struct {
 	URL          string    `json:"url"`
 	Size         int64     `json:"size"`
 	LastModified time.Time `json:"last_modified"`
+	ETag         string    `json:"etag,omitempty"`
+	ContentType  string    `json:"content_type,omitempty"`
+	Filename     string    `json:"filename,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// Link health states
+const (
+	LinkStatusUnknown = "unknown"
+	LinkStatusOK      = "ok"
+	LinkStatusBroken  = "broken"
+)
+
+type LinkHealth struct {
+	URL                 string    `json:"url"`
+	Status              string    `json:"status"`
+	StatusCode          int       `json:"status_code,omitempty"`
+	Error               string    `json:"error,omitempty"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastChecked         time.Time `json:"last_checked"`
+	LastSuccess         time.Time `json:"last_success,omitempty"`
+	LastFailure         time.Time `json:"last_failure,omitempty"`
+}
+
+// Quarantine records an entry the link checker moved into quarantine
+type Quarantine struct {
+	Path        string    `json:"path"` // where the entry is in quarantine
+	From        string    `json:"from"` // where it is restored to
+	Quarantined time.Time `json:"quarantined"`
+}
+
+// ArchiveMember describes one file in a remote ZIP archive's central directory
+type ArchiveMember struct {
+	Name           string    `json:"name"`
+	Method         uint16    `json:"method"`
+	Encrypted      bool      `json:"encrypted,omitempty"`
+	CRC32          uint32    `json:"crc32"`
+	CompressedSize int64     `json:"compressed_size"`
+	Size           int64     `json:"size"`
+	Modified       time.Time `json:"modified"`
+	HeaderOffset   int64     `json:"header_offset"`
+}
+
+// ArchiveIndex is the parsed central directory of a mounted ZIP archive
+type ArchiveIndex struct {
+	URL       string          `json:"url"`
+	Size      int64           `json:"size"`
+	ETag      string          `json:"etag,omitempty"`
+	Members   []ArchiveMember `json:"members"`
+	FetchedAt time.Time       `json:"fetched_at"`
 }
 
 type VirtualItem struct {
-	Name  string
-	Path  string
-	URL   string
-	IsDir bool
+	Name    string
+	Path    string
+	URL     string
+	IsDir   bool
+	Entry   *FileEntry     // the persisted entry of a file or mounted archive
+	Archive string         // mount path of the archive containing this item
+	Member  *ArchiveMember // set for files inside a mounted archive
 }